@@ -0,0 +1,333 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Alert states
+const (
+	alertFiring   = "firing"
+	alertResolved = "resolved"
+)
+
+// alertRule is a threshold checked after every -watch round, e.g.
+// "down < 100 for 3" or "error for 2".
+type alertRule struct {
+	text   string
+	metric string // "down", "up" or "error"
+	op     string
+	limit  float64
+	runs   int // consecutive breaching rounds before firing
+
+	breaches int
+	firing   bool
+}
+
+var alertRuleRe = regexp.MustCompile(`^(down|up)\s*(<=|>=|<|>)\s*([0-9]+(?:\.[0-9]+)?)(?:\s+for\s+([0-9]+))?$`)
+var alertErrorRe = regexp.MustCompile(`^error(?:\s+for\s+([0-9]+))?$`)
+
+// parseAlertRule parses "<down|up> <op> <Mbps> [for N]" or "error [for N]"
+func parseAlertRule(s string) (*alertRule, error) {
+	text := strings.Join(strings.Fields(s), " ")
+	rule := &alertRule{text: text, runs: 1}
+
+	var runs string
+	if m := alertRuleRe.FindStringSubmatch(text); m != nil {
+		rule.metric, rule.op, runs = m[1], m[2], m[4]
+		rule.limit, _ = strconv.ParseFloat(m[3], 64)
+	} else if m := alertErrorRe.FindStringSubmatch(text); m != nil {
+		rule.metric, runs = "error", m[1]
+	} else {
+		return nil, fmt.Errorf("invalid alert rule '%s', expected e.g. 'down < 100 for 3' or 'error for 2'", s)
+	}
+
+	if runs != "" {
+		n, err := strconv.Atoi(runs)
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("invalid alert rule '%s': run count must be at least 1", s)
+		}
+		rule.runs = n
+	}
+	return rule, nil
+}
+
+// check evaluates the rule against a round and returns the new state when
+// it changed. Rounds that lack the rule's metric (a failed download for a
+// "down" rule) neither count as a breach nor resolve the alert.
+func (a *alertRule) check(r watchRound) (state string, value float64, changed bool) {
+	var breach bool
+	switch a.metric {
+	case "error":
+		breach = r.Error != ""
+	default:
+		res := r.Download
+		if a.metric == "up" {
+			res = r.Upload
+		}
+		if res == nil {
+			return "", 0, false
+		}
+		value = res.Mbps
+		switch a.op {
+		case "<":
+			breach = value < a.limit
+		case "<=":
+			breach = value <= a.limit
+		case ">":
+			breach = value > a.limit
+		case ">=":
+			breach = value >= a.limit
+		}
+	}
+
+	if !breach {
+		a.breaches = 0
+		if a.firing {
+			a.firing = false
+			return alertResolved, value, true
+		}
+		return "", value, false
+	}
+
+	a.breaches++
+	if !a.firing && a.breaches >= a.runs {
+		a.firing = true
+		return alertFiring, value, true
+	}
+	return "", value, false
+}
+
+// alertEvent is what notifiers receive when a rule fires or resolves
+type alertEvent struct {
+	Rule   string    `json:"rule"`
+	State  string    `json:"state"`
+	Metric string    `json:"metric"`
+	Value  float64   `json:"value,omitempty"`
+	Runs   int       `json:"consecutive_runs"`
+	Error  string    `json:"error,omitempty"`
+	Server string    `json:"server"`
+	Time   time.Time `json:"time"`
+
+	Tags map[string]string `json:"tags,omitempty"`
+}
+
+func (e alertEvent) String() string {
+	msg := fmt.Sprintf("ALERT %s: %s", e.State, e.Rule)
+	switch {
+	case e.Error != "":
+		msg += fmt.Sprintf(" (%s)", e.Error)
+	case e.Metric != "error":
+		msg += fmt.Sprintf(" (%.1f Mbps)", e.Value)
+	}
+	return msg
+}
+
+// notifier delivers alert events somewhere outside the process
+type notifier interface {
+	notify(ctx context.Context, e alertEvent) error
+	String() string
+}
+
+// resultNotifier is a notifier that can also post every round's results
+type resultNotifier interface {
+	notifier
+	notifyResult(ctx context.Context, server string, r watchRound) error
+}
+
+// webhookNotifier POSTs the event as JSON
+type webhookNotifier struct {
+	url string
+}
+
+func (n webhookNotifier) String() string { return "webhook " + n.url }
+
+func (n webhookNotifier) notify(ctx context.Context, e alertEvent) error {
+	var body bytes.Buffer
+	enc := json.NewEncoder(&body)
+	enc.SetEscapeHTML(false) // keep "<" readable in rule texts
+	if err := enc.Encode(e); err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.url, &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// execNotifier runs a shell command with the event in its environment
+// (ETHSPEED_ALERT_*) and as JSON on stdin
+type execNotifier struct {
+	command string
+}
+
+func (n execNotifier) String() string { return "exec " + n.command }
+
+func (n execNotifier) notify(ctx context.Context, e alertEvent) error {
+	body, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd", "/C", n.command)
+	} else {
+		cmd = exec.CommandContext(ctx, "/bin/sh", "-c", n.command)
+	}
+	cmd.Stdin = bytes.NewReader(body)
+	cmd.Env = append(os.Environ(),
+		"ETHSPEED_ALERT_RULE="+e.Rule,
+		"ETHSPEED_ALERT_STATE="+e.State,
+		"ETHSPEED_ALERT_METRIC="+e.Metric,
+		"ETHSPEED_ALERT_VALUE="+strconv.FormatFloat(e.Value, 'f', 1, 64),
+		"ETHSPEED_ALERT_ERROR="+e.Error,
+		"ETHSPEED_ALERT_TAGS="+formatTags(e.Tags),
+		"ETHSPEED_SERVER="+e.Server,
+	)
+
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%v: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// alerter evaluates the configured rules after every round and fans state
+// changes out to all notifiers
+type alerter struct {
+	server    string
+	rules     []*alertRule
+	notifiers []notifier
+	results   bool // also post every round to chat result notifiers
+	summary   *dailySummary
+}
+
+func newAlerter(config Config) *alerter {
+	a := &alerter{server: config.Server, results: config.NotifyResults}
+	for _, s := range config.Alerts {
+		// Validated in Config.validate
+		rule, _ := parseAlertRule(s)
+		a.rules = append(a.rules, rule)
+	}
+	for _, url := range config.NotifyWebhook {
+		a.notifiers = append(a.notifiers, webhookNotifier{url})
+	}
+	for _, command := range config.NotifyExec {
+		a.notifiers = append(a.notifiers, execNotifier{command})
+	}
+
+	// Validated in Config.validate
+	tmpl, _ := parseChatTemplate(config.NotifyTemplate)
+	for _, url := range config.NotifySlack {
+		a.notifiers = append(a.notifiers, chatNotifier{chatSlack, url, tmpl})
+	}
+	for _, url := range config.NotifyDiscord {
+		a.notifiers = append(a.notifiers, chatNotifier{chatDiscord, url, tmpl})
+	}
+
+	if config.GrafanaURL != "" {
+		a.notifiers = append(a.notifiers, grafanaNotifier{config.GrafanaURL, config.GrafanaToken, config.GrafanaDashboard})
+	}
+
+	if len(config.NotifyEmail) > 0 {
+		email := emailNotifier{
+			addr:     withDefaultPort(config.SMTPHost, "587"),
+			user:     config.SMTPUser,
+			password: config.SMTPPassword,
+			from:     config.SMTPFrom,
+			to:       config.NotifyEmail,
+		}
+		if email.from == "" {
+			hostname, _ := os.Hostname()
+			email.from = "ethspeed@" + hostname
+		}
+		a.notifiers = append(a.notifiers, email)
+
+		if config.EmailSummary != "" {
+			at, _ := parseTimeOfDay(config.EmailSummary)
+			a.summary = newDailySummary(email, config.Server, at)
+		}
+	}
+	return a
+}
+
+// check returns the events raised by the round, after delivering them.
+// Delivery failures are returned as messages too, so -watch can show them.
+func (a *alerter) check(ctx context.Context, r watchRound) []string {
+	var messages []string
+	for _, n := range a.notifiers {
+		rn, ok := n.(resultNotifier)
+		if !ok {
+			continue
+		}
+		// Grafana marks every test, chat only gets them with -notify-results
+		if _, grafana := n.(grafanaNotifier); !grafana && !a.results {
+			continue
+		}
+		nctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+		if err := rn.notifyResult(nctx, a.server, r); err != nil {
+			messages = append(messages, fmt.Sprintf("%s notify %s failed: %v", r.Time.Format("15:04:05"), n, err))
+		}
+		cancel()
+	}
+
+	for _, rule := range a.rules {
+		state, value, changed := rule.check(r)
+		if !changed {
+			continue
+		}
+
+		e := alertEvent{
+			Rule:   rule.text,
+			State:  state,
+			Metric: rule.metric,
+			Value:  value,
+			Runs:   rule.runs,
+			Server: a.server,
+			Time:   r.Time,
+			Tags:   r.Tags,
+		}
+		if rule.metric == "error" && state == alertFiring {
+			e.Error = r.Error
+		}
+		messages = append(messages, fmt.Sprintf("%s %s", r.Time.Format("15:04:05"), e))
+
+		for _, n := range a.notifiers {
+			nctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+			if err := n.notify(nctx, e); err != nil {
+				messages = append(messages, fmt.Sprintf("%s notify %s failed: %v", r.Time.Format("15:04:05"), n, err))
+			}
+			cancel()
+		}
+	}
+
+	if a.summary != nil {
+		nctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+		if err := a.summary.add(nctx, r, messages); err != nil {
+			messages = append(messages, fmt.Sprintf("%s daily summary email failed: %v", r.Time.Format("15:04:05"), err))
+		}
+		cancel()
+	}
+	return messages
+}
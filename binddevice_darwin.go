@@ -0,0 +1,22 @@
+package main
+
+import (
+	"net"
+
+	"golang.org/x/sys/unix"
+)
+
+const bindDeviceSupported = true
+
+// bindToDevice makes the socket send through the named interface whatever
+// the routing table says (IP_BOUND_IF, IPV6_BOUND_IF)
+func bindToDevice(fd uintptr, name string, ipv6 bool) error {
+	iface, err := net.InterfaceByName(name)
+	if err != nil {
+		return err
+	}
+	if ipv6 {
+		return unix.SetsockoptInt(int(fd), unix.IPPROTO_IPV6, unix.IPV6_BOUND_IF, iface.Index)
+	}
+	return unix.SetsockoptInt(int(fd), unix.IPPROTO_IP, unix.IP_BOUND_IF, iface.Index)
+}
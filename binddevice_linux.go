@@ -0,0 +1,11 @@
+package main
+
+import "golang.org/x/sys/unix"
+
+const bindDeviceSupported = true
+
+// bindToDevice makes the socket send through the named interface whatever
+// the routing table says (SO_BINDTODEVICE)
+func bindToDevice(fd uintptr, name string, ipv6 bool) error {
+	return unix.BindToDevice(int(fd), name)
+}
@@ -0,0 +1,11 @@
+//go:build !linux && !darwin
+
+package main
+
+import "fmt"
+
+const bindDeviceSupported = false
+
+func bindToDevice(fd uintptr, name string, ipv6 bool) error {
+	return fmt.Errorf("binding sockets to an interface is only supported on Linux and macOS")
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// bitRate is a flag.Value for rates such as 50mbps, 1gbps or 500kbps,
+// kept in Mbps; a bare number is Mbps
+type bitRate float64
+
+func (b *bitRate) String() string {
+	if b == nil || *b == 0 {
+		return ""
+	}
+	return strconv.FormatFloat(float64(*b), 'g', -1, 64) + "mbps"
+}
+
+func (b *bitRate) Set(v string) error {
+	n, err := parseBitRate(v)
+	if err != nil {
+		return err
+	}
+	*b = bitRate(n)
+	return nil
+}
+
+func parseBitRate(v string) (float64, error) {
+	s := strings.ToLower(strings.TrimSpace(v))
+	s = strings.TrimSuffix(s, "bps")
+	// At most one unit letter; a bare number is Mbps
+	multiplier := 1.0
+	if n := len(s); n > 0 {
+		switch s[n-1] {
+		case 'k':
+			multiplier, s = 0.001, s[:n-1]
+		case 'm':
+			multiplier, s = 1, s[:n-1]
+		case 'g':
+			multiplier, s = 1000, s[:n-1]
+		}
+	}
+	n, err := strconv.ParseFloat(s, 64)
+	if err != nil || n < 0 || math.IsInf(n, 0) || math.IsNaN(n) {
+		return 0, fmt.Errorf("invalid rate '%s'", v)
+	}
+	return n * multiplier, nil
+}
+
+const (
+	// busyProbe is how long the interface is watched before a round
+	busyProbe = time.Second
+	// busyRecheck is the pause between checks while -busy-wait defers a round
+	busyRecheck = 10 * time.Second
+)
+
+// interfaceLoad measures the traffic on the interface towards server for
+// busyProbe; ok is false where interface counters are not available
+func interfaceLoad(ctx context.Context, server string) (name string, rxMbps, txMbps float64, ok bool) {
+	iface, _ := egressInterface(server)
+	if iface == nil {
+		return "", 0, 0, false
+	}
+	snapshot := snapshotInterface(iface.Name)
+	if snapshot == nil {
+		return "", 0, 0, false
+	}
+	start := time.Now()
+	select {
+	case <-ctx.Done():
+		return "", 0, 0, false
+	case <-time.After(busyProbe):
+	}
+	c := snapshot.since(nil)
+	if c == nil {
+		return "", 0, 0, false
+	}
+	elapsed := time.Since(start).Seconds()
+	return iface.Name, float64(c.RxBytes) * 8 / elapsed / 1_000_000, float64(c.TxBytes) * 8 / elapsed / 1_000_000, true
+}
+
+// waitForQuiet checks before a -watch round that the interface is not
+// already busy past -skip-if-busy, e.g. with a big download that would
+// share the link and pollute the history. With -busy-wait it keeps checking
+// for that long. It returns why the round is skipped, or "" to run it; when
+// the load cannot be measured, the round runs.
+func waitForQuiet(ctx context.Context, config Config) string {
+	deadline := time.Now().Add(config.BusyWait)
+	for {
+		name, rx, tx, ok := interfaceLoad(ctx, config.Server)
+		if !ok {
+			return ""
+		}
+		load := max(rx, tx)
+		if load < float64(config.SkipIfBusy) {
+			return ""
+		}
+		reason := fmt.Sprintf("%s already carries %s (limit %s)", name,
+			displayUnit.format(load), displayUnit.format(float64(config.SkipIfBusy)))
+		if time.Now().Add(busyRecheck).After(deadline) {
+			return reason
+		}
+		select {
+		case <-ctx.Done():
+			return reason
+		case <-time.After(busyRecheck):
+		}
+	}
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	crand "crypto/rand"
+	"encoding/hex"
+	"net/http"
+)
+
+// nonceParam makes every download URL unique, so that a transparent cache or
+// CDN in the path cannot answer it from an earlier body at impossible speed.
+// The server ignores it.
+const nonceParam = "nonce"
+
+// bustCache adds a random nonce to the URL of req and asks intermediaries to
+// neither cache nor transform (recompress, transcode) the response; a no-op
+// with -allow-cache, which leaves a cache in the path to be measured. A
+// -down-url gets the headers only: a parameter of its own could break a
+// signed or presigned third-party URL.
+func (c Config) bustCache(req *http.Request) {
+	if c.AllowCache {
+		return
+	}
+	if c.DownURL == "" {
+		var b [8]byte
+		crand.Read(b[:])
+		// Appended as it is, the query of -down-path keeps its order and
+		// escaping
+		if req.URL.RawQuery != "" {
+			req.URL.RawQuery += "&"
+		}
+		req.URL.RawQuery += nonceParam + "=" + hex.EncodeToString(b[:])
+	}
+	req.Header.Set("Cache-Control", "no-cache, no-transform")
+	req.Header.Set("Pragma", "no-cache")
+}
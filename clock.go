@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"time"
+)
+
+const (
+	timePath         = "/__time"
+	clockCheckProbes = 5
+)
+
+// timeHandler returns the server clock for the client's skew check
+func timeHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		httpError(w, codeMethodNotAllowed, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	now := time.Now()
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	fmt.Fprintf(w, `{"unix_ns":%d}`, now.UnixNano())
+}
+
+// measureClockOffset asks the server for its time a few times and returns
+// the offset (server minus client) seen by the fastest probe
+func measureClockOffset(config Config) (offset, rtt time.Duration, err error) {
+	var best *owdStamp
+	for range clockCheckProbes {
+		sent := time.Now()
+		req, err := http.NewRequest(http.MethodGet, config.endpointURL(timePath), nil)
+		if err != nil {
+			return 0, 0, err
+		}
+		config.authorize(req)
+		resp, err := httpClient.Do(req)
+		if err != nil {
+			return 0, 0, err
+		}
+		var reply struct {
+			UnixNs int64 `json:"unix_ns"`
+		}
+		err = json.NewDecoder(resp.Body).Decode(&reply)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK || err != nil || reply.UnixNs == 0 {
+			return 0, 0, fmt.Errorf("server does not provide %s", timePath)
+		}
+
+		s := owdStamp{sent: sent.UnixNano(), server: reply.UnixNs, received: time.Now().UnixNano()}
+		if best == nil || s.rtt() < best.rtt() {
+			best = &s
+		}
+	}
+	return time.Duration(best.offset()), time.Duration(best.rtt()), nil
+}
+
+// checkClock warns when the client clock is off by more than
+// -max-clock-skew, which distorts timestamps, one-way delays and long
+// -watch series. It returns the offset in ms for the report, or nil when
+// the check is disabled or the server cannot answer it.
+func checkClock(config Config) *float64 {
+	if config.MaxClockSkew <= 0 {
+		return nil
+	}
+	offset, rtt, err := measureClockOffset(config)
+	if err != nil {
+		return nil
+	}
+
+	ms := durationMs(offset)
+	if offset.Abs() > config.MaxClockSkew {
+		// Keep -json output parseable
+		out := os.Stdout
+		if config.JSON {
+			out = os.Stderr
+		}
+		side := "behind"
+		if offset < 0 {
+			side = "ahead of"
+		}
+		fmt.Fprintf(out, "WARNING: client clock is %.3f ms (+/- %.3f ms) %s the server, more than -max-clock-skew %v; sync it with NTP\n\n",
+			math.Abs(ms), durationMs(rtt)/2, side, config.MaxClockSkew)
+	}
+	return &ms
+}
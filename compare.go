@@ -0,0 +1,147 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/quic-go/quic-go/http3"
+)
+
+// protocolClient is one HTTP version taking part in -compare-protocols
+type protocolClient struct {
+	name   string // expected http.Response.Proto
+	client *http.Client
+	close  func()
+}
+
+// protocolClients builds one client per HTTP version that can be tried
+// against the server. Without -tls HTTP/2 is spoken in cleartext (prior
+// knowledge) and HTTP/3 is left out, as QUIC always needs TLS.
+func protocolClients(config Config) []protocolClient {
+	// Fresh transports: cloning httpClient.Transport would inherit its h2 ALPN setup
+	h1 := newTransport(config)
+	h1.Protocols = new(http.Protocols)
+	h1.Protocols.SetHTTP1(true)
+
+	h2 := newTransport(config)
+	h2.Protocols = new(http.Protocols)
+	if config.TLS {
+		h2.Protocols.SetHTTP2(true)
+	} else {
+		h2.Protocols.SetUnencryptedHTTP2(true)
+	}
+
+	clients := []protocolClient{
+		{"HTTP/1.1", &http.Client{Timeout: defaultHTTPTimeout, Transport: h1, Jar: clientCookies}, h1.CloseIdleConnections},
+		{"HTTP/2.0", &http.Client{Timeout: defaultHTTPTimeout, Transport: h2, Jar: clientCookies}, h2.CloseIdleConnections},
+	}
+
+	if config.TLS {
+		h3 := &http3.Transport{TLSClientConfig: config.clientTLSConfig()}
+		clients = append(clients, protocolClient{
+			"HTTP/3.0", &http.Client{Timeout: defaultHTTPTimeout, Transport: h3, Jar: clientCookies}, func() { h3.Close() },
+		})
+	}
+	return clients
+}
+
+// probeProtocol checks that the server answers over the client's protocol
+func probeProtocol(pc protocolClient, config Config) error {
+	req, err := http.NewRequest(http.MethodGet, config.endpointURL("/healthz"), nil)
+	if err != nil {
+		return err
+	}
+	config.authorize(req)
+	resp, err := pc.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.Proto != pc.name {
+		return fmt.Errorf("server answered with %s", resp.Proto)
+	}
+	return nil
+}
+
+// runProtocolComparison runs the configured transfer over every available
+// HTTP version and prints the averages side by side. A gap between HTTP/1.1
+// and HTTP/2 or HTTP/3 points at the HTTP layer (flow control, framing)
+// rather than at the TCP path itself.
+func runProtocolComparison(config Config) {
+	fmt.Printf("Protocol comparison - %d MB per run, %d run(s) each\n", config.Size, config.Count)
+	fmt.Printf("Server: %s\n\n", config.baseURL())
+
+	type row struct {
+		name     string
+		down, up float64
+		err      error
+	}
+	var rows []row
+
+	for _, pc := range protocolClients(config) {
+		r := row{name: pc.name}
+		if r.err = probeProtocol(pc, config); r.err != nil {
+			rows = append(rows, r)
+			pc.close()
+			continue
+		}
+
+		var downs, ups []float64
+		for i := 0; i < config.Count && r.err == nil; i++ {
+			if config.Direction != directionUp {
+				res, err := measureDownload(pc.client, config)
+				if err != nil {
+					r.err = fmt.Errorf("download: %w", err)
+					break
+				}
+				downs = append(downs, res.Mbps)
+			}
+			if config.Direction != directionDown {
+				res, err := measureUpload(pc.client, config)
+				if err != nil {
+					r.err = fmt.Errorf("upload: %w", err)
+					break
+				}
+				ups = append(ups, res.Mbps)
+			}
+			if i < config.Count-1 {
+				time.Sleep(500 * time.Millisecond)
+			}
+		}
+		if len(downs) > 0 {
+			r.down = calculateAverage(downs)
+		}
+		if len(ups) > 0 {
+			r.up = calculateAverage(ups)
+		}
+		rows = append(rows, r)
+		pc.close()
+	}
+
+	fmt.Printf("%-9s | %-8s | %-8s | %s\n", "protocol", "down", "up", displayUnit.label())
+	fmt.Println(strings.Repeat("-", 42))
+	for _, r := range rows {
+		name := strings.TrimSuffix(r.name, ".0")
+		if r.err != nil {
+			fmt.Printf("%-9s | unavailable: %v\n", name, r.err)
+			continue
+		}
+		fmt.Printf("%-9s | %-8s | %-8s |\n", name, formatMbpsCell(r.down), formatMbpsCell(r.up))
+	}
+	if !config.TLS {
+		fmt.Println("HTTP/3 skipped: needs -tls and a server started with -h3")
+	}
+	fmt.Println()
+}
+
+func formatMbpsCell(mbps float64) string {
+	if mbps == 0 {
+		return "-"
+	}
+	return displayUnit.cell(mbps)
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// compressGzip is the one encoding a download's compress= asks for
+const compressGzip = "gzip"
+
+var errCompressUnsupported = errors.New("server did not gzip the download (no -compress support)")
+
+// requestCompression reports whether a download should be gzipped on the
+// fly
+func requestCompression(r *http.Request) (bool, error) {
+	switch q := r.URL.Query().Get("compress"); q {
+	case "":
+		return false, nil
+	case compressGzip:
+		return true, nil
+	default:
+		return false, fmt.Errorf("unsupported compression '%s'", q)
+	}
+}
+
+// countingReader counts the bytes read through it, i.e. the compressed
+// bytes on the wire under a gzip reader
+type countingReader struct {
+	io.Reader
+	n int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	r.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// busySpan is the time from the first start to the last end of the
+// transfers in one direction
+type busySpan struct {
+	start, end time.Time
+}
+
+func (s *busySpan) add(start, end time.Time) {
+	if s.start.IsZero() || start.Before(s.start) {
+		s.start = start
+	}
+	if end.After(s.end) {
+		s.end = end
+	}
+}
+
+// runConcurrentTests runs the -c iterations -concurrency at a time, like
+// several users testing at once. Every iteration has its own client, so
+// that HTTP/2 does not multiplex them over one connection. The table is
+// printed in iteration order once all have finished, followed by the
+// combined throughput and how evenly the server shared it.
+func runConcurrentTests(config Config, report *speedReport) error {
+	if !config.JSON {
+		fmt.Printf("Running %d iterations, %d at a time\n\n", config.Count, config.Concurrency)
+	}
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		failed   atomic.Bool
+		downSpan busySpan
+		upSpan   busySpan
+	)
+	runs := make([]runResult, config.Count)
+	errs := make([]error, config.Count)
+	slots := make(chan struct{}, config.Concurrency)
+	start := time.Now()
+	for i := range config.Count {
+		slots <- struct{}{}
+		// Iterations not started yet are skipped after an error
+		if failed.Load() {
+			<-slots
+			break
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-slots }()
+			client := &http.Client{Transport: newTransport(config), Timeout: defaultHTTPTimeout, Jar: clientCookies}
+			defer client.CloseIdleConnections()
+
+			if config.Direction != directionUp {
+				begin := time.Now()
+				down, err := measureDownload(client, config)
+				if err != nil {
+					errs[i] = fmt.Errorf("download test %d: %w", i+1, err)
+					failed.Store(true)
+					return
+				}
+				mu.Lock()
+				downSpan.add(begin, time.Now())
+				mu.Unlock()
+				runs[i].Download = down
+			}
+			if config.Direction != directionDown {
+				begin := time.Now()
+				up, err := measureUpload(client, config)
+				if err != nil {
+					errs[i] = fmt.Errorf("upload test %d: %w", i+1, err)
+					failed.Store(true)
+					return
+				}
+				mu.Lock()
+				upSpan.add(begin, time.Now())
+				mu.Unlock()
+				runs[i].Upload = up
+			}
+		}()
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+
+	report.Runs = append(report.Runs, runs...)
+	report.summarize()
+	report.TotalSeconds = time.Since(start).Seconds()
+	report.Concurrency = config.Concurrency
+	var downs, ups []*transferResult
+	for _, run := range runs {
+		if run.Download != nil {
+			downs = append(downs, run.Download)
+		}
+		if run.Upload != nil {
+			ups = append(ups, run.Upload)
+		}
+	}
+	report.AggregateDownloadMbps = aggregateMbps(downs, downSpan)
+	report.AggregateUploadMbps = aggregateMbps(ups, upSpan)
+	report.DownloadFairness = jainFairness(downs)
+	report.UploadFairness = jainFairness(ups)
+
+	if !config.JSON {
+		report.printConcurrent(config.Direction)
+	}
+	return nil
+}
+
+// aggregateMbps is the throughput of all results together over span
+func aggregateMbps(results []*transferResult, span busySpan) float64 {
+	elapsed := span.end.Sub(span.start).Seconds()
+	if len(results) == 0 || elapsed <= 0 {
+		return 0
+	}
+	var total int64
+	for _, r := range results {
+		total += r.Bytes
+	}
+	return float64(total) * 8 / elapsed / 1_000_000
+}
+
+// jainFairness is Jain's fairness index of the speeds: (Σx)² / (n·Σx²),
+// 1 when all are equal and 1/n when one result got everything
+func jainFairness(results []*transferResult) float64 {
+	var sum, squares float64
+	for _, r := range results {
+		sum += r.Mbps
+		squares += r.Mbps * r.Mbps
+	}
+	if squares == 0 {
+		return 0
+	}
+	return sum * sum / (float64(len(results)) * squares)
+}
+
+// printConcurrent prints the table of a -concurrency run
+func (r *speedReport) printConcurrent(direction string) {
+	switch direction {
+	case directionBoth:
+		fmt.Printf("%-4s | %-8s | %-8s | %s\n", "run", "down", "up", displayUnit.label())
+		fmt.Println(strings.Repeat("-", 37))
+		for i, run := range r.Runs {
+			fmt.Printf("%-4d | %-8s | %-8s | %s\n", i+1, displayUnit.cell(run.Download.Mbps), displayUnit.cell(run.Upload.Mbps), displayUnit.label())
+		}
+		fmt.Println(strings.Repeat("-", 37))
+		fmt.Printf("%-4s | %-8s | %-8s | Avg\n", "", displayUnit.cell(r.AvgDownloadMbps), displayUnit.cell(r.AvgUploadMbps))
+		fmt.Printf("%-4s | %-8s | %-8s | Aggregate\n", "", displayUnit.cell(r.AggregateDownloadMbps), displayUnit.cell(r.AggregateUploadMbps))
+		fmt.Printf("%-4s | %-8.3f | %-8.3f | Fairness\n", "", r.DownloadFairness, r.UploadFairness)
+	default:
+		res := func(run runResult) *transferResult { return run.Download }
+		avg, aggregate, fairness := r.AvgDownloadMbps, r.AggregateDownloadMbps, r.DownloadFairness
+		if direction == directionUp {
+			res = func(run runResult) *transferResult { return run.Upload }
+			avg, aggregate, fairness = r.AvgUploadMbps, r.AggregateUploadMbps, r.UploadFairness
+		}
+		fmt.Printf("%-4s | %-8s\n", "run", direction)
+		fmt.Println(strings.Repeat("-", 25))
+		for i, run := range r.Runs {
+			fmt.Printf("%-4d | %-8s %s\n", i+1, displayUnit.cell(res(run).Mbps), displayUnit.label())
+		}
+		fmt.Println(strings.Repeat("-", 25))
+		fmt.Printf("%-4s | %-8s Avg\n", "", displayUnit.cell(avg))
+		fmt.Printf("%-4s | %-8s Aggregate\n", "", displayUnit.cell(aggregate))
+		fmt.Printf("%-4s | %-8.3f Fairness\n", "", fairness)
+	}
+	fmt.Printf("Total time: %.2f seconds\n\n", r.TotalSeconds)
+}
@@ -0,0 +1,15 @@
+//go:build !linux
+
+package main
+
+import "fmt"
+
+const congestionSupported = false
+
+func setCongestion(fd uintptr, name string) error {
+	return fmt.Errorf("congestion control selection is only supported on Linux")
+}
+
+func getCongestion(fd uintptr) (string, error) {
+	return "", fmt.Errorf("congestion control selection is only supported on Linux")
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+// connRateBackoff is the pause of a worker after a failed connection, so
+// that a dead or refusing server does not turn the test into a busy loop
+const connRateBackoff = 100 * time.Millisecond
+
+// runConnRateTest opens new connections as fast as -connections workers
+// can for -duration, with a TLS handshake on each when -tls is set, and
+// reports the rate and the setup latencies. Stateful firewalls and NAT
+// boxes run out of session-table capacity or setup rate long before they
+// run out of bandwidth.
+func runConnRateTest(config Config) error {
+	port, proto := "80", "TCP"
+	if config.TLS {
+		port, proto = "443", "TLS"
+	}
+	addr := withDefaultPort(config.Server, port)
+	host, _, _ := net.SplitHostPort(addr)
+	fmt.Printf("Connection rate test - new %s connections from %d workers for %v\n", proto, config.Connections, config.Duration)
+	fmt.Printf("Server: %s\n\n", addr)
+
+	tlsConfig := config.clientTLSConfig()
+	tlsConfig.ServerName = host
+	dialer := &net.Dialer{Timeout: 5 * time.Second}
+
+	ctx, cancel := context.WithTimeout(context.Background(), config.Duration)
+	defer cancel()
+	var (
+		wg                   sync.WaitGroup
+		mu                   sync.Mutex
+		connects, handshakes []float64
+		failed               int
+		lastErr              error
+	)
+	start := time.Now()
+	for range config.Connections {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var localConnects, localHandshakes []float64
+			// failure records err, unless the test ended during the attempt,
+			// and waits before the next one
+			failure := func(err error) {
+				if ctx.Err() != nil {
+					return
+				}
+				mu.Lock()
+				failed++
+				lastErr = err
+				mu.Unlock()
+				select {
+				case <-ctx.Done():
+				case <-time.After(connRateBackoff):
+				}
+			}
+			for ctx.Err() == nil {
+				t := time.Now()
+				conn, err := dialer.DialContext(ctx, "tcp", addr)
+				if err != nil {
+					failure(err)
+					continue
+				}
+				connected := time.Now()
+				// A reset instead of a FIN leaves no TIME_WAIT socket behind,
+				// so the test does not run out of local ports
+				if tcp, ok := conn.(*net.TCPConn); ok {
+					tcp.SetLinger(0)
+				}
+				if config.TLS {
+					tc := tls.Client(conn, tlsConfig)
+					tc.SetDeadline(time.Now().Add(10 * time.Second))
+					if err := tc.HandshakeContext(ctx); err != nil {
+						conn.Close()
+						failure(fmt.Errorf("handshake: %w", err))
+						continue
+					}
+					localHandshakes = append(localHandshakes, durationMs(time.Since(connected)))
+				}
+				conn.Close()
+				localConnects = append(localConnects, durationMs(connected.Sub(t)))
+			}
+			mu.Lock()
+			connects = append(connects, localConnects...)
+			handshakes = append(handshakes, localHandshakes...)
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	elapsed := time.Since(start)
+
+	if len(connects) == 0 {
+		return fmt.Errorf("no connection succeeded: %v", lastErr)
+	}
+	fmt.Printf("Connections: %d in %.1f s, %d failed\n", len(connects)+failed, elapsed.Seconds(), failed)
+	fmt.Printf("Rate: %.0f connections/s\n", float64(len(connects))/elapsed.Seconds())
+	fmt.Printf("TCP connect ms:   %s\n", formatRTTStats(connects))
+	if config.TLS {
+		fmt.Printf("TLS handshake ms: %s\n", formatRTTStats(handshakes))
+	}
+	if failed > 0 {
+		fmt.Printf("Last error: %v\n", lastErr)
+	}
+	return nil
+}
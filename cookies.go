@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"strings"
+)
+
+// clientCookies keeps the cookies the server sets (-cookies) and those
+// given with -cookie, so that a session cookie from the first contact, e.g.
+// of an SSO portal in front of the server, goes with every test after it.
+// nil when the client keeps no cookies.
+var clientCookies http.CookieJar
+
+// parseCookies parses -cookie values, each "name=value" or a whole Cookie
+// header such as "a=1; b=2"
+func parseCookies(values []string) ([]*http.Cookie, error) {
+	var cookies []*http.Cookie
+	for _, v := range values {
+		parsed, err := http.ParseCookie(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cookie '%s': %w", v, err)
+		}
+		cookies = append(cookies, parsed...)
+	}
+	return cookies, nil
+}
+
+// newCookieJar returns a jar holding the -cookie values for the server and
+// the hosts of -down-url and -up-url
+func newCookieJar(config Config) (http.CookieJar, error) {
+	cookies, err := parseCookies(config.Cookies)
+	if err != nil {
+		return nil, err
+	}
+	// Scoped to the whole host: the default path of a -down-url such as
+	// /a/b would keep them from /__info and the -up-url
+	for _, c := range cookies {
+		c.Path = "/"
+	}
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		return nil, err
+	}
+	for _, target := range []string{config.baseURL() + "/", config.DownURL, config.UpURL} {
+		if target == "" {
+			continue
+		}
+		if u, err := url.Parse(expandURLTemplate(target, 1)); err == nil {
+			jar.SetCookies(u, cookies)
+		}
+	}
+	return jar, nil
+}
+
+// cookieHeader is the Cookie header for a request to rawURL outside an
+// http.Client, such as the WebSocket handshake; "" for none
+func cookieHeader(rawURL string) string {
+	if clientCookies == nil {
+		return ""
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	var pairs []string
+	for _, c := range clientCookies.Cookies(u) {
+		pairs = append(pairs, c.String())
+	}
+	return strings.Join(pairs, "; ")
+}
@@ -0,0 +1,19 @@
+//go:build !linux
+
+package main
+
+import (
+	"runtime"
+	"time"
+)
+
+// cpuCounters returns the process's CPU time and the wall time of all
+// cores, in nanoseconds: without a portable system-wide figure, the load is
+// the client's own
+func cpuCounters() (busy, all uint64, ok bool) {
+	cpu := processCPUTime()
+	if cpu == 0 {
+		return 0, 0, false
+	}
+	return uint64(cpu), uint64(time.Now().UnixNano()) * uint64(runtime.GOMAXPROCS(0)), true
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// stallChunk bounds each write of a stallWriter, so that one deadline
+// covers a piece a slow link can still send within -stall-timeout
+const stallChunk = 64 * 1024
+
+// errTruncated ends a /__up body that ran into its time limit; the upload
+// is then answered with what got through
+var errTruncated = errors.New("transfer reached its time limit")
+
+// truncatedTrailer marks a download the server ended at its time limit,
+// which tells it from a body cut short on the way
+const truncatedTrailer = "Ethspeed-Truncated"
+
+// serverMaxTest is the server's -max-test-duration
+var serverMaxTest time.Duration
+
+// transferLimit returns how long a transfer may run: the max_seconds it
+// asks for, but at most -max-test-duration; 0 for no limit. It protects
+// the server from clients on near-dead links that would hold a
+// connection for hours.
+func transferLimit(r *http.Request) (time.Duration, error) {
+	limit := serverMaxTest
+	if q := r.URL.Query().Get("max_seconds"); q != "" {
+		s, err := strconv.ParseFloat(q, 64)
+		if err != nil || s <= 0 || s > 1e6 {
+			return 0, fmt.Errorf("invalid max_seconds '%s'", q)
+		}
+		if d := time.Duration(s * float64(time.Second)); limit == 0 || d < limit {
+			limit = d
+		}
+	}
+	return limit, nil
+}
+
+// limitEnd is when a transfer started at start runs out of limit, zero
+// for no limit
+func limitEnd(start time.Time, limit time.Duration) time.Time {
+	if limit == 0 {
+		return time.Time{}
+	}
+	return start.Add(limit)
+}
+
+// stallWriter pushes the connection's write deadline -stall-timeout ahead
+// before every write. A download then runs as long as data keeps flowing,
+// however long that takes, while a client that stops reading is cut off
+// after -stall-timeout. Without -stall-timeout it only passes writes on.
+type stallWriter struct {
+	w  io.Writer
+	rc *http.ResponseController // nil without -stall-timeout
+}
+
+func newStallWriter(w http.ResponseWriter) *stallWriter {
+	s := &stallWriter{w: w}
+	if serverStallTimeout > 0 {
+		s.rc = http.NewResponseController(w)
+	}
+	return s
+}
+
+func (s *stallWriter) Write(p []byte) (int, error) {
+	if s.rc == nil {
+		return s.w.Write(p)
+	}
+	written := 0
+	for len(p) > 0 {
+		// Writers without deadline support (HTTP/3) keep the server's
+		s.rc.SetWriteDeadline(time.Now().Add(serverStallTimeout))
+		n, err := s.w.Write(p[:min(len(p), stallChunk)])
+		written += n
+		if err != nil {
+			return written, err
+		}
+		p = p[n:]
+	}
+	return written, nil
+}
+
+// finish hands the connection back to -write-timeout for what follows
+func (s *stallWriter) finish() {
+	if s.rc != nil {
+		s.rc.SetWriteDeadline(deadlineAfter(serverWriteTimeout))
+	}
+}
+
+// stallReader is the upload side of stallWriter: the read deadline moves
+// -stall-timeout ahead before every read of the body, but not past the
+// time limit, where reading ends with errTruncated.
+type stallReader struct {
+	r  io.Reader
+	rc *http.ResponseController // nil without -stall-timeout
+
+	until     time.Time // end of the transfer's time limit, zero for none
+	truncated bool      // the time limit cut the transfer short
+}
+
+func newStallReader(w http.ResponseWriter, r io.Reader, until time.Time) *stallReader {
+	s := &stallReader{r: r, until: until}
+	if serverStallTimeout > 0 {
+		s.rc = http.NewResponseController(w)
+	}
+	return s
+}
+
+func (s *stallReader) Read(p []byte) (int, error) {
+	limited := !s.until.IsZero()
+	if limited && !time.Now().Before(s.until) {
+		s.truncated = true
+		return 0, errTruncated
+	}
+	if s.rc != nil {
+		deadline := time.Now().Add(serverStallTimeout)
+		if limited && s.until.Before(deadline) {
+			deadline = s.until
+		}
+		s.rc.SetReadDeadline(deadline)
+	}
+	n, err := s.r.Read(p)
+	if err != nil && err != io.EOF && limited && !time.Now().Before(s.until) {
+		// The deadline at the limit, not a broken link
+		s.truncated = true
+		return n, errTruncated
+	}
+	return n, err
+}
+
+// finish hands the connection back to -read-timeout, and restarts
+// -write-timeout for the reply, which would otherwise have run out during a
+// long upload
+func (s *stallReader) finish() {
+	if s.rc != nil {
+		s.rc.SetReadDeadline(deadlineAfter(serverReadTimeout))
+		s.rc.SetWriteDeadline(deadlineAfter(serverWriteTimeout))
+	}
+}
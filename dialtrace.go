@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http/httptrace"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// dialReport is how a client connection picked its address. For a name
+// with A and AAAA records Go tries one family first and the other after a
+// fallback delay (Happy Eyeballs, RFC 8305); an unreachable IPv6 path shows
+// up as a first test that is always slower.
+type dialReport struct {
+	Host       string        `json:"host"`
+	Candidates []string      `json:"candidates,omitempty"` // DNS answers in order
+	Attempts   []dialAttempt `json:"attempts"`
+	Winner     string        `json:"winner"`
+	// Time from the first attempt to the start of the winning one
+	FallbackDelayMs float64 `json:"fallback_delay_ms"`
+}
+
+type dialAttempt struct {
+	Addr      string  `json:"addr"`
+	StartMs   float64 `json:"start_ms"` // since the first attempt
+	ConnectMs float64 `json:"connect_ms,omitempty"`
+	Error     string  `json:"error,omitempty"`
+
+	done bool
+}
+
+// clientDial keeps the first dial that had addresses to choose from until
+// a report takes it
+var clientDial struct {
+	sync.Mutex
+	report *dialReport
+}
+
+// dialTrace collects the DNS answers and connect attempts of one dial
+type dialTrace struct {
+	mu     sync.Mutex
+	host   string
+	start  time.Time
+	report dialReport
+}
+
+// traceDial returns ctx with hooks recording the dial of addr
+func traceDial(ctx context.Context, addr string) (context.Context, *dialTrace) {
+	host, _, _ := net.SplitHostPort(addr)
+	t := &dialTrace{host: host}
+	return httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		DNSDone: func(info httptrace.DNSDoneInfo) {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			for _, a := range info.Addrs {
+				t.report.Candidates = append(t.report.Candidates, a.String())
+			}
+		},
+		ConnectStart: func(network, addr string) {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			now := time.Now()
+			if t.start.IsZero() {
+				t.start = now
+			}
+			t.report.Attempts = append(t.report.Attempts, dialAttempt{Addr: addr, StartMs: durationMs(now.Sub(t.start))})
+		},
+		ConnectDone: func(network, addr string, err error) {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			for i := range t.report.Attempts {
+				a := &t.report.Attempts[i]
+				if a.Addr != addr || a.done {
+					continue
+				}
+				a.done = true
+				a.ConnectMs = durationMs(time.Since(t.start)) - a.StartMs
+				if err != nil {
+					var se *os.SyscallError
+					if errors.As(err, &se) {
+						err = se.Err
+					}
+					a.Error = err.Error()
+				}
+				break
+			}
+		},
+	}), t
+}
+
+// finish records the dial once conn is up. Dials of IP literals and of
+// names with one address are left out: there was nothing to choose.
+func (t *dialTrace) finish(conn net.Conn) {
+	t.mu.Lock()
+	report := t.report
+	report.Attempts = append([]dialAttempt(nil), report.Attempts...)
+	t.mu.Unlock()
+
+	if len(report.Candidates) < 2 && len(report.Attempts) < 2 {
+		return
+	}
+	report.Host = t.host
+	report.Winner = conn.RemoteAddr().String()
+	for i := range report.Attempts {
+		a := &report.Attempts[i]
+		if !a.done {
+			// Abandoned when another attempt won
+			a.Error = "cancelled"
+		}
+		if a.Addr == report.Winner && a.Error == "" {
+			report.FallbackDelayMs = a.StartMs
+		}
+	}
+
+	clientDial.Lock()
+	if clientDial.report == nil {
+		clientDial.report = &report
+	}
+	clientDial.Unlock()
+}
+
+// takeDialReport returns the recorded dial, if any, and clears it for the
+// next test
+func takeDialReport() *dialReport {
+	clientDial.Lock()
+	defer clientDial.Unlock()
+	report := clientDial.report
+	clientDial.report = nil
+	return report
+}
+
+func (d *dialReport) String() string {
+	tried := make([]string, len(d.Attempts))
+	for i, a := range d.Attempts {
+		switch {
+		case a.Addr == d.Winner && a.Error == "":
+			tried[i] = fmt.Sprintf("%s won in %.1f ms", a.Addr, a.ConnectMs)
+		case a.done:
+			tried[i] = fmt.Sprintf("%s %s after %.1f ms", a.Addr, a.Error, a.ConnectMs)
+		default:
+			tried[i] = fmt.Sprintf("%s %s", a.Addr, a.Error)
+		}
+		if a.StartMs > 0 {
+			tried[i] += fmt.Sprintf(" (started at +%.1f ms)", a.StartMs)
+		}
+	}
+	s := fmt.Sprintf("%s has %d addresses; tried %s", d.Host, len(d.Candidates), strings.Join(tried, ", "))
+	if d.FallbackDelayMs > 0 {
+		s += fmt.Sprintf("; fallback delay %.1f ms", d.FallbackDelayMs)
+	}
+	return s
+}
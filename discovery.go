@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// srvPrefix marks a -server value to be discovered through DNS SRV
+// records, e.g. srv:_ethspeed._tcp.example.com
+const srvPrefix = "srv:"
+
+// srvProbeTimeout bounds the TCP connect used to find the nearest target
+const srvProbeTimeout = 2 * time.Second
+
+// discoverServer resolves the SRV records of name and picks a test server:
+// the lowest priority group wins as in RFC 2782, and within it the target
+// with the fastest TCP connect, so one record set serves every site. A
+// group whose targets are all unreachable falls through to the next one.
+func discoverServer(name string) (server string, rtt time.Duration, err error) {
+	_, records, err := net.LookupSRV("", "", name)
+	if err != nil {
+		return "", 0, fmt.Errorf("SRV lookup of %s: %w", name, err)
+	}
+	// "." as the only target means the service is explicitly not offered
+	if len(records) == 0 || len(records) == 1 && records[0].Target == "." {
+		return "", 0, fmt.Errorf("no ethspeed servers published at %s", name)
+	}
+	// LookupSRV sorts by priority already, but keep that explicit
+	sort.SliceStable(records, func(i, j int) bool { return records[i].Priority < records[j].Priority })
+
+	for start := 0; start < len(records); {
+		end := start
+		for end < len(records) && records[end].Priority == records[start].Priority {
+			end++
+		}
+		if server, rtt, ok := nearestTarget(records[start:end]); ok {
+			return server, rtt, nil
+		}
+		start = end
+	}
+	return "", 0, fmt.Errorf("none of the servers published at %s is reachable", name)
+}
+
+// nearestTarget connects to every target at once and returns the one with
+// the fastest connect
+func nearestTarget(records []*net.SRV) (string, time.Duration, bool) {
+	type probe struct {
+		addr string
+		rtt  time.Duration
+	}
+	results := make(chan probe, len(records))
+	var wg sync.WaitGroup
+	for _, r := range records {
+		addr := net.JoinHostPort(strings.TrimSuffix(r.Target, "."), strconv.Itoa(int(r.Port)))
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			start := time.Now()
+			conn, err := net.DialTimeout("tcp", addr, srvProbeTimeout)
+			if err != nil {
+				return
+			}
+			results <- probe{addr, time.Since(start)}
+			conn.Close()
+		}()
+	}
+	wg.Wait()
+	close(results)
+
+	var best *probe
+	for p := range results {
+		if best == nil || p.rtt < best.rtt {
+			best = &p
+		}
+	}
+	if best == nil {
+		return "", 0, false
+	}
+	return best.addr, best.rtt, true
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"net"
+	"sync"
+	"time"
+)
+
+// dnsCache pins the address a name was last connected to, for -dns-ttl and
+// -resolve-once in -watch mode: rounds then test the same server even when
+// DNS balances the name over several, and a slow resolver stays out of the
+// connect time.
+type dnsCache struct {
+	ttl time.Duration // 0 keeps addresses for the whole run
+
+	mu      sync.Mutex
+	entries map[string]cachedAddr
+}
+
+type cachedAddr struct {
+	ip      string
+	expires time.Time // zero for never
+}
+
+// clientDNSCache is nil when every connection resolves the server name
+var clientDNSCache *dnsCache
+
+func newDNSCache(ttl time.Duration) *dnsCache {
+	return &dnsCache{ttl: ttl, entries: make(map[string]cachedAddr)}
+}
+
+// lookup returns addr with its host replaced by the pinned address, if any
+func (c *dnsCache) lookup(addr string) string {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil || net.ParseIP(host) != nil {
+		return addr
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[host]
+	if !ok || (!e.expires.IsZero() && time.Now().After(e.expires)) {
+		delete(c.entries, host)
+		return addr
+	}
+	return net.JoinHostPort(e.ip, port)
+}
+
+// pin remembers the address a connection to addr was made to
+func (c *dnsCache) pin(addr string, conn net.Conn) {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil || net.ParseIP(host) != nil {
+		return
+	}
+	remote, ok := conn.RemoteAddr().(*net.TCPAddr)
+	if !ok {
+		return
+	}
+	e := cachedAddr{ip: remote.IP.String()}
+	if remote.Zone != "" {
+		e.ip += "%" + remote.Zone
+	}
+	if c.ttl > 0 {
+		e.expires = time.Now().Add(c.ttl)
+	}
+	c.mu.Lock()
+	if _, ok := c.entries[host]; !ok {
+		c.entries[host] = e
+	}
+	c.mu.Unlock()
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"runtime"
+	"strings"
+)
+
+// environment describes the machine and route a result was measured from,
+// so results collected from many hosts can be told apart
+type environment struct {
+	Hostname  string    `json:"hostname,omitempty"`
+	OS        string    `json:"os"` // GOOS/GOARCH
+	Interface string    `json:"interface,omitempty"`
+	MTU       int       `json:"mtu,omitempty"`
+	Tunnel    string    `json:"tunnel,omitempty"` // why the interface may limit results, see tunnelNote
+	Link      *linkInfo `json:"link,omitempty"`
+	WiFi      *wifiInfo `json:"wifi,omitempty"`
+	LocalIP   string    `json:"local_ip,omitempty"`
+	Gateway   string    `json:"gateway,omitempty"`
+	Version   string    `json:"version"`
+	Commit    string    `json:"commit,omitempty"`
+}
+
+// collectEnvironment gathers the environment of a test against server;
+// fields that cannot be found are left empty
+func collectEnvironment(server string) *environment {
+	iface, ip := egressInterface(server)
+	return describeEnvironment(iface, ip)
+}
+
+// describeEnvironment gathers the environment of tests sent from ip on
+// iface; either may be nil when unknown
+func describeEnvironment(iface *net.Interface, ip net.IP) *environment {
+	env := &environment{
+		OS:      runtime.GOOS + "/" + runtime.GOARCH,
+		Version: build.Version,
+		Commit:  build.Commit,
+	}
+	env.Hostname, _ = os.Hostname()
+
+	if ip != nil {
+		env.LocalIP = ip.String()
+	}
+	if iface != nil {
+		env.Interface = iface.Name
+		if iface.Flags&net.FlagLoopback == 0 {
+			env.MTU = iface.MTU
+			env.Tunnel = tunnelNote(iface)
+			env.Link = linkSpeed(iface)
+			env.WiFi = wifiStatus(iface)
+			env.Gateway = defaultGateway(iface.Name, ip.To4() == nil)
+		}
+	}
+	// The transfers that follow are sent from here
+	sampledInterface.Store(env)
+	return env
+}
+
+// String renders the environment as the "Host:" line of the text report
+func (e *environment) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s (%s, ethspeed %s)", e.Hostname, e.OS, e.Version)
+	if e.Interface != "" {
+		fmt.Fprintf(&b, ", %s %s", e.Interface, e.LocalIP)
+	}
+	if e.Gateway != "" {
+		fmt.Fprintf(&b, " via %s", e.Gateway)
+	}
+	return b.String()
+}
+
+// egressInterface returns the interface and local address the system
+// routes traffic to server through. Connecting a UDP socket only looks up
+// the route, nothing is sent.
+func egressInterface(server string) (*net.Interface, net.IP) {
+	conn, err := net.Dial("udp", withDefaultPort(server, "80"))
+	if err != nil {
+		return nil, nil
+	}
+	ip := conn.LocalAddr().(*net.UDPAddr).IP
+	conn.Close()
+
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil, ip
+	}
+	for i := range ifaces {
+		addrs, err := ifaces[i].Addrs()
+		if err != nil {
+			continue
+		}
+		for _, addr := range addrs {
+			if ipnet, ok := addr.(*net.IPNet); ok && ipnet.IP.Equal(ip) {
+				return &ifaces[i], ip
+			}
+		}
+	}
+	return nil, ip
+}
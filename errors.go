@@ -0,0 +1,155 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// Stable error codes of the server's error envelope. Scripts match on these,
+// so existing codes must not be renamed; the messages may change freely.
+const (
+	codeMethodNotAllowed    = "METHOD_NOT_ALLOWED"
+	codeBadRequest          = "BAD_REQUEST"
+	codeSizeOutOfRange      = "SIZE_OUT_OF_RANGE"
+	codeBadPayload          = "BAD_PAYLOAD"
+	codeUnsupportedEncoding = "UNSUPPORTED_ENCODING"
+	codeUnauthorized        = "UNAUTHORIZED"
+	codeForbidden           = "FORBIDDEN"
+	codeAdminDisabled       = "ADMIN_DISABLED"
+	codeQueueFull           = "QUEUE_FULL"
+	codeQueueTimeout        = "QUEUE_TIMEOUT"
+	codeQuotaExceeded       = "QUOTA_EXCEEDED"
+	codeShuttingDown        = "SHUTTING_DOWN"
+	codeInternal            = "INTERNAL"
+)
+
+// Exit codes of the client. 2 is also what the flag package uses for bad
+// command lines.
+const (
+	exitFailure  = 1 // the test failed: network errors, timeouts, bad answers
+	exitUsage    = 2 // invalid flags or configuration
+	exitAuth     = 3 // the server refused the token or the address
+	exitRetry    = 4 // the server is busy: queue, quota or shutdown
+	exitRejected = 5 // the server rejected the request as invalid
+)
+
+// apiError is an error with a stable code. Server code returns it where the
+// code is known at the source; it is also the body of error responses.
+type apiError struct {
+	Code string `json:"code"`
+	Msg  string `json:"msg"`
+}
+
+func (e *apiError) Error() string { return e.Msg }
+
+// errorEnvelope is the JSON body of every error response
+type errorEnvelope struct {
+	OK bool `json:"ok"`
+	apiError
+}
+
+// httpError replaces http.Error: it answers with
+// {"ok":false,"code":...,"msg":...}
+func httpError(w http.ResponseWriter, code, msg string, status int) {
+	h := w.Header()
+	h.Del("Content-Length")
+	h.Set("Content-Type", "application/json; charset=utf-8")
+	h.Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(errorEnvelope{apiError: apiError{Code: code, Msg: msg}})
+}
+
+// writeError answers with err, using its code when it is an *apiError and
+// fallback otherwise
+func writeError(w http.ResponseWriter, err error, fallback string, status int) {
+	code := fallback
+	var e *apiError
+	if errors.As(err, &e) {
+		code = e.Code
+	}
+	httpError(w, code, err.Error(), status)
+}
+
+// serverError is an error response received by the client. Code is empty
+// when the server predates the error envelope.
+type serverError struct {
+	Status    int
+	Code      string
+	Msg       string
+	RequestID string // X-Request-ID of the response, to look it up in the server's log
+}
+
+func (e *serverError) Error() string {
+	msg := fmt.Sprintf("server returned status %d", e.Status)
+	switch {
+	case e.Code != "":
+		msg = fmt.Sprintf("server returned status %d (%s): %s", e.Status, e.Code, e.Msg)
+	case e.Msg != "":
+		msg = fmt.Sprintf("server returned status %d: %s", e.Status, e.Msg)
+	}
+	if e.RequestID != "" {
+		msg += " [id=" + e.RequestID + "]"
+	}
+	return msg
+}
+
+// errShortBody fails a transfer that moved another number of bytes than
+// it asked for: its speed would look plausible but be wrong
+var errShortBody = errors.New("byte count mismatch")
+
+// exitCodeOf maps a client error to the process exit code. Besides server
+// responses, the client's own checks against /__info return an *apiError
+// with the code the server would have answered.
+func exitCodeOf(err error) int {
+	var a *apiError
+	if errors.As(err, &a) {
+		return exitCodeFor(a.Code, 0)
+	}
+	var e *serverError
+	if !errors.As(err, &e) {
+		return exitFailure
+	}
+	return exitCodeFor(e.Code, e.Status)
+}
+
+// exitCodeFor maps an error code, or the status of servers without codes,
+// to the process exit code
+func exitCodeFor(code string, status int) int {
+	switch code {
+	case codeUnauthorized, codeForbidden, codeAdminDisabled:
+		return exitAuth
+	case codeQueueFull, codeQueueTimeout, codeQuotaExceeded, codeShuttingDown:
+		return exitRetry
+	case codeMethodNotAllowed, codeBadRequest, codeSizeOutOfRange, codeBadPayload, codeUnsupportedEncoding:
+		return exitRejected
+	case "":
+		// Older servers: fall back to the status
+		switch status {
+		case http.StatusUnauthorized, http.StatusForbidden:
+			return exitAuth
+		case http.StatusTooManyRequests, http.StatusServiceUnavailable:
+			return exitRetry
+		case http.StatusBadRequest, http.StatusMethodNotAllowed:
+			return exitRejected
+		}
+	}
+	return exitFailure
+}
+
+// clientExit is the exit code of the client run: that of its first error
+var clientExit int
+
+// noteFailure records err for the exit code
+func noteFailure(err error) {
+	if clientExit == 0 {
+		clientExit = exitCodeOf(err)
+	}
+}
+
+// fail prints a client error and records it for the exit code
+func fail(err error) {
+	fmt.Printf("ERROR: %v\n", err)
+	noteFailure(err)
+}
@@ -0,0 +1,997 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.12
+// 	protoc        v5.29.3
+// source: ethspeedpb/ethspeed.proto
+
+package ethspeedpb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type HealthResponse_Status int32
+
+const (
+	HealthResponse_STATUS_UNSPECIFIED HealthResponse_Status = 0
+	HealthResponse_READY              HealthResponse_Status = 1
+	HealthResponse_DRAINING           HealthResponse_Status = 2
+)
+
+// Enum value maps for HealthResponse_Status.
+var (
+	HealthResponse_Status_name = map[int32]string{
+		0: "STATUS_UNSPECIFIED",
+		1: "READY",
+		2: "DRAINING",
+	}
+	HealthResponse_Status_value = map[string]int32{
+		"STATUS_UNSPECIFIED": 0,
+		"READY":              1,
+		"DRAINING":           2,
+	}
+)
+
+func (x HealthResponse_Status) Enum() *HealthResponse_Status {
+	p := new(HealthResponse_Status)
+	*p = x
+	return p
+}
+
+func (x HealthResponse_Status) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (HealthResponse_Status) Descriptor() protoreflect.EnumDescriptor {
+	return file_ethspeedpb_ethspeed_proto_enumTypes[0].Descriptor()
+}
+
+func (HealthResponse_Status) Type() protoreflect.EnumType {
+	return &file_ethspeedpb_ethspeed_proto_enumTypes[0]
+}
+
+func (x HealthResponse_Status) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use HealthResponse_Status.Descriptor instead.
+func (HealthResponse_Status) EnumDescriptor() ([]byte, []int) {
+	return file_ethspeedpb_ethspeed_proto_rawDescGZIP(), []int{3, 0}
+}
+
+type GetStatsRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetStatsRequest) Reset() {
+	*x = GetStatsRequest{}
+	mi := &file_ethspeedpb_ethspeed_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetStatsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetStatsRequest) ProtoMessage() {}
+
+func (x *GetStatsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_ethspeedpb_ethspeed_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetStatsRequest.ProtoReflect.Descriptor instead.
+func (*GetStatsRequest) Descriptor() ([]byte, []int) {
+	return file_ethspeedpb_ethspeed_proto_rawDescGZIP(), []int{0}
+}
+
+type Stats struct {
+	state            protoimpl.MessageState `protogen:"open.v1"`
+	TotalDownloads   int64                  `protobuf:"varint,1,opt,name=total_downloads,json=totalDownloads,proto3" json:"total_downloads,omitempty"`
+	TotalUploads     int64                  `protobuf:"varint,2,opt,name=total_uploads,json=totalUploads,proto3" json:"total_uploads,omitempty"`
+	TotalBytesDown   int64                  `protobuf:"varint,3,opt,name=total_bytes_down,json=totalBytesDown,proto3" json:"total_bytes_down,omitempty"`
+	TotalBytesUp     int64                  `protobuf:"varint,4,opt,name=total_bytes_up,json=totalBytesUp,proto3" json:"total_bytes_up,omitempty"`
+	TotalConnections int64                  `protobuf:"varint,5,opt,name=total_connections,json=totalConnections,proto3" json:"total_connections,omitempty"`
+	UptimeSeconds    float64                `protobuf:"fixed64,6,opt,name=uptime_seconds,json=uptimeSeconds,proto3" json:"uptime_seconds,omitempty"`
+	CurrentTransfers int64                  `protobuf:"varint,7,opt,name=current_transfers,json=currentTransfers,proto3" json:"current_transfers,omitempty"`
+	PeakConcurrent   int64                  `protobuf:"varint,8,opt,name=peak_concurrent,json=peakConcurrent,proto3" json:"peak_concurrent,omitempty"`
+	Queued           int64                  `protobuf:"varint,9,opt,name=queued,proto3" json:"queued,omitempty"`
+	PeakQueued       int64                  `protobuf:"varint,10,opt,name=peak_queued,json=peakQueued,proto3" json:"peak_queued,omitempty"`
+	QueueRejected    int64                  `protobuf:"varint,11,opt,name=queue_rejected,json=queueRejected,proto3" json:"queue_rejected,omitempty"`
+	CorruptChunks    int64                  `protobuf:"varint,12,opt,name=corrupt_chunks,json=corruptChunks,proto3" json:"corrupt_chunks,omitempty"`
+	LastRequest      *timestamppb.Timestamp `protobuf:"bytes,13,opt,name=last_request,json=lastRequest,proto3" json:"last_request,omitempty"`
+	Draining         bool                   `protobuf:"varint,14,opt,name=draining,proto3" json:"draining,omitempty"`
+	Version          string                 `protobuf:"bytes,15,opt,name=version,proto3" json:"version,omitempty"`
+	Commit           string                 `protobuf:"bytes,16,opt,name=commit,proto3" json:"commit,omitempty"`
+	unknownFields    protoimpl.UnknownFields
+	sizeCache        protoimpl.SizeCache
+}
+
+func (x *Stats) Reset() {
+	*x = Stats{}
+	mi := &file_ethspeedpb_ethspeed_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Stats) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Stats) ProtoMessage() {}
+
+func (x *Stats) ProtoReflect() protoreflect.Message {
+	mi := &file_ethspeedpb_ethspeed_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Stats.ProtoReflect.Descriptor instead.
+func (*Stats) Descriptor() ([]byte, []int) {
+	return file_ethspeedpb_ethspeed_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *Stats) GetTotalDownloads() int64 {
+	if x != nil {
+		return x.TotalDownloads
+	}
+	return 0
+}
+
+func (x *Stats) GetTotalUploads() int64 {
+	if x != nil {
+		return x.TotalUploads
+	}
+	return 0
+}
+
+func (x *Stats) GetTotalBytesDown() int64 {
+	if x != nil {
+		return x.TotalBytesDown
+	}
+	return 0
+}
+
+func (x *Stats) GetTotalBytesUp() int64 {
+	if x != nil {
+		return x.TotalBytesUp
+	}
+	return 0
+}
+
+func (x *Stats) GetTotalConnections() int64 {
+	if x != nil {
+		return x.TotalConnections
+	}
+	return 0
+}
+
+func (x *Stats) GetUptimeSeconds() float64 {
+	if x != nil {
+		return x.UptimeSeconds
+	}
+	return 0
+}
+
+func (x *Stats) GetCurrentTransfers() int64 {
+	if x != nil {
+		return x.CurrentTransfers
+	}
+	return 0
+}
+
+func (x *Stats) GetPeakConcurrent() int64 {
+	if x != nil {
+		return x.PeakConcurrent
+	}
+	return 0
+}
+
+func (x *Stats) GetQueued() int64 {
+	if x != nil {
+		return x.Queued
+	}
+	return 0
+}
+
+func (x *Stats) GetPeakQueued() int64 {
+	if x != nil {
+		return x.PeakQueued
+	}
+	return 0
+}
+
+func (x *Stats) GetQueueRejected() int64 {
+	if x != nil {
+		return x.QueueRejected
+	}
+	return 0
+}
+
+func (x *Stats) GetCorruptChunks() int64 {
+	if x != nil {
+		return x.CorruptChunks
+	}
+	return 0
+}
+
+func (x *Stats) GetLastRequest() *timestamppb.Timestamp {
+	if x != nil {
+		return x.LastRequest
+	}
+	return nil
+}
+
+func (x *Stats) GetDraining() bool {
+	if x != nil {
+		return x.Draining
+	}
+	return false
+}
+
+func (x *Stats) GetVersion() string {
+	if x != nil {
+		return x.Version
+	}
+	return ""
+}
+
+func (x *Stats) GetCommit() string {
+	if x != nil {
+		return x.Commit
+	}
+	return ""
+}
+
+type HealthRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *HealthRequest) Reset() {
+	*x = HealthRequest{}
+	mi := &file_ethspeedpb_ethspeed_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *HealthRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*HealthRequest) ProtoMessage() {}
+
+func (x *HealthRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_ethspeedpb_ethspeed_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use HealthRequest.ProtoReflect.Descriptor instead.
+func (*HealthRequest) Descriptor() ([]byte, []int) {
+	return file_ethspeedpb_ethspeed_proto_rawDescGZIP(), []int{2}
+}
+
+type HealthResponse struct {
+	state           protoimpl.MessageState `protogen:"open.v1"`
+	Status          HealthResponse_Status  `protobuf:"varint,1,opt,name=status,proto3,enum=ethspeed.v1.HealthResponse_Status" json:"status,omitempty"`
+	ActiveTransfers int64                  `protobuf:"varint,2,opt,name=active_transfers,json=activeTransfers,proto3" json:"active_transfers,omitempty"`
+	Time            *timestamppb.Timestamp `protobuf:"bytes,3,opt,name=time,proto3" json:"time,omitempty"`
+	unknownFields   protoimpl.UnknownFields
+	sizeCache       protoimpl.SizeCache
+}
+
+func (x *HealthResponse) Reset() {
+	*x = HealthResponse{}
+	mi := &file_ethspeedpb_ethspeed_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *HealthResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*HealthResponse) ProtoMessage() {}
+
+func (x *HealthResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_ethspeedpb_ethspeed_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use HealthResponse.ProtoReflect.Descriptor instead.
+func (*HealthResponse) Descriptor() ([]byte, []int) {
+	return file_ethspeedpb_ethspeed_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *HealthResponse) GetStatus() HealthResponse_Status {
+	if x != nil {
+		return x.Status
+	}
+	return HealthResponse_STATUS_UNSPECIFIED
+}
+
+func (x *HealthResponse) GetActiveTransfers() int64 {
+	if x != nil {
+		return x.ActiveTransfers
+	}
+	return 0
+}
+
+func (x *HealthResponse) GetTime() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Time
+	}
+	return nil
+}
+
+type RunTestRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// host:port of the ethspeed server to test against
+	Server string `protobuf:"bytes,1,opt,name=server,proto3" json:"server,omitempty"`
+	// MB per transfer, 100 when unset
+	SizeMb int32 `protobuf:"varint,2,opt,name=size_mb,json=sizeMb,proto3" json:"size_mb,omitempty"`
+	// "down", "up" or "both" (the default)
+	Direction string `protobuf:"bytes,3,opt,name=direction,proto3" json:"direction,omitempty"`
+	// number of runs, 1 when unset
+	Count    int32 `protobuf:"varint,4,opt,name=count,proto3" json:"count,omitempty"`
+	Tls      bool  `protobuf:"varint,5,opt,name=tls,proto3" json:"tls,omitempty"`
+	Insecure bool  `protobuf:"varint,6,opt,name=insecure,proto3" json:"insecure,omitempty"`
+	// bearer token for targets started with -auth-tokens
+	Token         string `protobuf:"bytes,7,opt,name=token,proto3" json:"token,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *RunTestRequest) Reset() {
+	*x = RunTestRequest{}
+	mi := &file_ethspeedpb_ethspeed_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RunTestRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RunTestRequest) ProtoMessage() {}
+
+func (x *RunTestRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_ethspeedpb_ethspeed_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RunTestRequest.ProtoReflect.Descriptor instead.
+func (*RunTestRequest) Descriptor() ([]byte, []int) {
+	return file_ethspeedpb_ethspeed_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *RunTestRequest) GetServer() string {
+	if x != nil {
+		return x.Server
+	}
+	return ""
+}
+
+func (x *RunTestRequest) GetSizeMb() int32 {
+	if x != nil {
+		return x.SizeMb
+	}
+	return 0
+}
+
+func (x *RunTestRequest) GetDirection() string {
+	if x != nil {
+		return x.Direction
+	}
+	return ""
+}
+
+func (x *RunTestRequest) GetCount() int32 {
+	if x != nil {
+		return x.Count
+	}
+	return 0
+}
+
+func (x *RunTestRequest) GetTls() bool {
+	if x != nil {
+		return x.Tls
+	}
+	return false
+}
+
+func (x *RunTestRequest) GetInsecure() bool {
+	if x != nil {
+		return x.Insecure
+	}
+	return false
+}
+
+func (x *RunTestRequest) GetToken() string {
+	if x != nil {
+		return x.Token
+	}
+	return ""
+}
+
+type TestProgress struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Types that are valid to be assigned to Event:
+	//
+	//	*TestProgress_Started
+	//	*TestProgress_Transfer
+	//	*TestProgress_Summary
+	//	*TestProgress_Sample
+	Event         isTestProgress_Event `protobuf_oneof:"event"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *TestProgress) Reset() {
+	*x = TestProgress{}
+	mi := &file_ethspeedpb_ethspeed_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *TestProgress) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*TestProgress) ProtoMessage() {}
+
+func (x *TestProgress) ProtoReflect() protoreflect.Message {
+	mi := &file_ethspeedpb_ethspeed_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use TestProgress.ProtoReflect.Descriptor instead.
+func (*TestProgress) Descriptor() ([]byte, []int) {
+	return file_ethspeedpb_ethspeed_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *TestProgress) GetEvent() isTestProgress_Event {
+	if x != nil {
+		return x.Event
+	}
+	return nil
+}
+
+func (x *TestProgress) GetStarted() *TransferStarted {
+	if x != nil {
+		if x, ok := x.Event.(*TestProgress_Started); ok {
+			return x.Started
+		}
+	}
+	return nil
+}
+
+func (x *TestProgress) GetTransfer() *Transfer {
+	if x != nil {
+		if x, ok := x.Event.(*TestProgress_Transfer); ok {
+			return x.Transfer
+		}
+	}
+	return nil
+}
+
+func (x *TestProgress) GetSummary() *Summary {
+	if x != nil {
+		if x, ok := x.Event.(*TestProgress_Summary); ok {
+			return x.Summary
+		}
+	}
+	return nil
+}
+
+func (x *TestProgress) GetSample() *Sample {
+	if x != nil {
+		if x, ok := x.Event.(*TestProgress_Sample); ok {
+			return x.Sample
+		}
+	}
+	return nil
+}
+
+type isTestProgress_Event interface {
+	isTestProgress_Event()
+}
+
+type TestProgress_Started struct {
+	Started *TransferStarted `protobuf:"bytes,1,opt,name=started,proto3,oneof"`
+}
+
+type TestProgress_Transfer struct {
+	Transfer *Transfer `protobuf:"bytes,2,opt,name=transfer,proto3,oneof"`
+}
+
+type TestProgress_Summary struct {
+	Summary *Summary `protobuf:"bytes,3,opt,name=summary,proto3,oneof"`
+}
+
+type TestProgress_Sample struct {
+	Sample *Sample `protobuf:"bytes,4,opt,name=sample,proto3,oneof"`
+}
+
+func (*TestProgress_Started) isTestProgress_Event() {}
+
+func (*TestProgress_Transfer) isTestProgress_Event() {}
+
+func (*TestProgress_Summary) isTestProgress_Event() {}
+
+func (*TestProgress_Sample) isTestProgress_Event() {}
+
+type TransferStarted struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Run           int32                  `protobuf:"varint,1,opt,name=run,proto3" json:"run,omitempty"`
+	Direction     string                 `protobuf:"bytes,2,opt,name=direction,proto3" json:"direction,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *TransferStarted) Reset() {
+	*x = TransferStarted{}
+	mi := &file_ethspeedpb_ethspeed_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *TransferStarted) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*TransferStarted) ProtoMessage() {}
+
+func (x *TransferStarted) ProtoReflect() protoreflect.Message {
+	mi := &file_ethspeedpb_ethspeed_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use TransferStarted.ProtoReflect.Descriptor instead.
+func (*TransferStarted) Descriptor() ([]byte, []int) {
+	return file_ethspeedpb_ethspeed_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *TransferStarted) GetRun() int32 {
+	if x != nil {
+		return x.Run
+	}
+	return 0
+}
+
+func (x *TransferStarted) GetDirection() string {
+	if x != nil {
+		return x.Direction
+	}
+	return ""
+}
+
+// Sample is one 100 ms window of a running transfer
+type Sample struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Run           int32                  `protobuf:"varint,1,opt,name=run,proto3" json:"run,omitempty"`
+	Direction     string                 `protobuf:"bytes,2,opt,name=direction,proto3" json:"direction,omitempty"`
+	Index         int32                  `protobuf:"varint,3,opt,name=index,proto3" json:"index,omitempty"`
+	Mbps          float64                `protobuf:"fixed64,4,opt,name=mbps,proto3" json:"mbps,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Sample) Reset() {
+	*x = Sample{}
+	mi := &file_ethspeedpb_ethspeed_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Sample) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Sample) ProtoMessage() {}
+
+func (x *Sample) ProtoReflect() protoreflect.Message {
+	mi := &file_ethspeedpb_ethspeed_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Sample.ProtoReflect.Descriptor instead.
+func (*Sample) Descriptor() ([]byte, []int) {
+	return file_ethspeedpb_ethspeed_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *Sample) GetRun() int32 {
+	if x != nil {
+		return x.Run
+	}
+	return 0
+}
+
+func (x *Sample) GetDirection() string {
+	if x != nil {
+		return x.Direction
+	}
+	return ""
+}
+
+func (x *Sample) GetIndex() int32 {
+	if x != nil {
+		return x.Index
+	}
+	return 0
+}
+
+func (x *Sample) GetMbps() float64 {
+	if x != nil {
+		return x.Mbps
+	}
+	return 0
+}
+
+type Transfer struct {
+	state     protoimpl.MessageState `protogen:"open.v1"`
+	Run       int32                  `protobuf:"varint,1,opt,name=run,proto3" json:"run,omitempty"`
+	Direction string                 `protobuf:"bytes,2,opt,name=direction,proto3" json:"direction,omitempty"`
+	Mbps      float64                `protobuf:"fixed64,3,opt,name=mbps,proto3" json:"mbps,omitempty"`
+	Bytes     int64                  `protobuf:"varint,4,opt,name=bytes,proto3" json:"bytes,omitempty"`
+	Seconds   float64                `protobuf:"fixed64,5,opt,name=seconds,proto3" json:"seconds,omitempty"`
+	// throughput per 100 ms window
+	SamplesMbps   []float64 `protobuf:"fixed64,6,rep,packed,name=samples_mbps,json=samplesMbps,proto3" json:"samples_mbps,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Transfer) Reset() {
+	*x = Transfer{}
+	mi := &file_ethspeedpb_ethspeed_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Transfer) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Transfer) ProtoMessage() {}
+
+func (x *Transfer) ProtoReflect() protoreflect.Message {
+	mi := &file_ethspeedpb_ethspeed_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Transfer.ProtoReflect.Descriptor instead.
+func (*Transfer) Descriptor() ([]byte, []int) {
+	return file_ethspeedpb_ethspeed_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *Transfer) GetRun() int32 {
+	if x != nil {
+		return x.Run
+	}
+	return 0
+}
+
+func (x *Transfer) GetDirection() string {
+	if x != nil {
+		return x.Direction
+	}
+	return ""
+}
+
+func (x *Transfer) GetMbps() float64 {
+	if x != nil {
+		return x.Mbps
+	}
+	return 0
+}
+
+func (x *Transfer) GetBytes() int64 {
+	if x != nil {
+		return x.Bytes
+	}
+	return 0
+}
+
+func (x *Transfer) GetSeconds() float64 {
+	if x != nil {
+		return x.Seconds
+	}
+	return 0
+}
+
+func (x *Transfer) GetSamplesMbps() []float64 {
+	if x != nil {
+		return x.SamplesMbps
+	}
+	return nil
+}
+
+type Summary struct {
+	state           protoimpl.MessageState `protogen:"open.v1"`
+	AvgDownloadMbps float64                `protobuf:"fixed64,1,opt,name=avg_download_mbps,json=avgDownloadMbps,proto3" json:"avg_download_mbps,omitempty"`
+	AvgUploadMbps   float64                `protobuf:"fixed64,2,opt,name=avg_upload_mbps,json=avgUploadMbps,proto3" json:"avg_upload_mbps,omitempty"`
+	TotalSeconds    float64                `protobuf:"fixed64,3,opt,name=total_seconds,json=totalSeconds,proto3" json:"total_seconds,omitempty"`
+	unknownFields   protoimpl.UnknownFields
+	sizeCache       protoimpl.SizeCache
+}
+
+func (x *Summary) Reset() {
+	*x = Summary{}
+	mi := &file_ethspeedpb_ethspeed_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Summary) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Summary) ProtoMessage() {}
+
+func (x *Summary) ProtoReflect() protoreflect.Message {
+	mi := &file_ethspeedpb_ethspeed_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Summary.ProtoReflect.Descriptor instead.
+func (*Summary) Descriptor() ([]byte, []int) {
+	return file_ethspeedpb_ethspeed_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *Summary) GetAvgDownloadMbps() float64 {
+	if x != nil {
+		return x.AvgDownloadMbps
+	}
+	return 0
+}
+
+func (x *Summary) GetAvgUploadMbps() float64 {
+	if x != nil {
+		return x.AvgUploadMbps
+	}
+	return 0
+}
+
+func (x *Summary) GetTotalSeconds() float64 {
+	if x != nil {
+		return x.TotalSeconds
+	}
+	return 0
+}
+
+var File_ethspeedpb_ethspeed_proto protoreflect.FileDescriptor
+
+const file_ethspeedpb_ethspeed_proto_rawDesc = "" +
+	"\n" +
+	"\x19ethspeedpb/ethspeed.proto\x12\vethspeed.v1\x1a\x1fgoogle/protobuf/timestamp.proto\"\x11\n" +
+	"\x0fGetStatsRequest\"\xe3\x04\n" +
+	"\x05Stats\x12'\n" +
+	"\x0ftotal_downloads\x18\x01 \x01(\x03R\x0etotalDownloads\x12#\n" +
+	"\rtotal_uploads\x18\x02 \x01(\x03R\ftotalUploads\x12(\n" +
+	"\x10total_bytes_down\x18\x03 \x01(\x03R\x0etotalBytesDown\x12$\n" +
+	"\x0etotal_bytes_up\x18\x04 \x01(\x03R\ftotalBytesUp\x12+\n" +
+	"\x11total_connections\x18\x05 \x01(\x03R\x10totalConnections\x12%\n" +
+	"\x0euptime_seconds\x18\x06 \x01(\x01R\ruptimeSeconds\x12+\n" +
+	"\x11current_transfers\x18\a \x01(\x03R\x10currentTransfers\x12'\n" +
+	"\x0fpeak_concurrent\x18\b \x01(\x03R\x0epeakConcurrent\x12\x16\n" +
+	"\x06queued\x18\t \x01(\x03R\x06queued\x12\x1f\n" +
+	"\vpeak_queued\x18\n" +
+	" \x01(\x03R\n" +
+	"peakQueued\x12%\n" +
+	"\x0equeue_rejected\x18\v \x01(\x03R\rqueueRejected\x12%\n" +
+	"\x0ecorrupt_chunks\x18\f \x01(\x03R\rcorruptChunks\x12=\n" +
+	"\flast_request\x18\r \x01(\v2\x1a.google.protobuf.TimestampR\vlastRequest\x12\x1a\n" +
+	"\bdraining\x18\x0e \x01(\bR\bdraining\x12\x18\n" +
+	"\aversion\x18\x0f \x01(\tR\aversion\x12\x16\n" +
+	"\x06commit\x18\x10 \x01(\tR\x06commit\"\x0f\n" +
+	"\rHealthRequest\"\xe2\x01\n" +
+	"\x0eHealthResponse\x12:\n" +
+	"\x06status\x18\x01 \x01(\x0e2\".ethspeed.v1.HealthResponse.StatusR\x06status\x12)\n" +
+	"\x10active_transfers\x18\x02 \x01(\x03R\x0factiveTransfers\x12.\n" +
+	"\x04time\x18\x03 \x01(\v2\x1a.google.protobuf.TimestampR\x04time\"9\n" +
+	"\x06Status\x12\x16\n" +
+	"\x12STATUS_UNSPECIFIED\x10\x00\x12\t\n" +
+	"\x05READY\x10\x01\x12\f\n" +
+	"\bDRAINING\x10\x02\"\xb9\x01\n" +
+	"\x0eRunTestRequest\x12\x16\n" +
+	"\x06server\x18\x01 \x01(\tR\x06server\x12\x17\n" +
+	"\asize_mb\x18\x02 \x01(\x05R\x06sizeMb\x12\x1c\n" +
+	"\tdirection\x18\x03 \x01(\tR\tdirection\x12\x14\n" +
+	"\x05count\x18\x04 \x01(\x05R\x05count\x12\x10\n" +
+	"\x03tls\x18\x05 \x01(\bR\x03tls\x12\x1a\n" +
+	"\binsecure\x18\x06 \x01(\bR\binsecure\x12\x14\n" +
+	"\x05token\x18\a \x01(\tR\x05token\"\xe7\x01\n" +
+	"\fTestProgress\x128\n" +
+	"\astarted\x18\x01 \x01(\v2\x1c.ethspeed.v1.TransferStartedH\x00R\astarted\x123\n" +
+	"\btransfer\x18\x02 \x01(\v2\x15.ethspeed.v1.TransferH\x00R\btransfer\x120\n" +
+	"\asummary\x18\x03 \x01(\v2\x14.ethspeed.v1.SummaryH\x00R\asummary\x12-\n" +
+	"\x06sample\x18\x04 \x01(\v2\x13.ethspeed.v1.SampleH\x00R\x06sampleB\a\n" +
+	"\x05event\"A\n" +
+	"\x0fTransferStarted\x12\x10\n" +
+	"\x03run\x18\x01 \x01(\x05R\x03run\x12\x1c\n" +
+	"\tdirection\x18\x02 \x01(\tR\tdirection\"b\n" +
+	"\x06Sample\x12\x10\n" +
+	"\x03run\x18\x01 \x01(\x05R\x03run\x12\x1c\n" +
+	"\tdirection\x18\x02 \x01(\tR\tdirection\x12\x14\n" +
+	"\x05index\x18\x03 \x01(\x05R\x05index\x12\x12\n" +
+	"\x04mbps\x18\x04 \x01(\x01R\x04mbps\"\xa1\x01\n" +
+	"\bTransfer\x12\x10\n" +
+	"\x03run\x18\x01 \x01(\x05R\x03run\x12\x1c\n" +
+	"\tdirection\x18\x02 \x01(\tR\tdirection\x12\x12\n" +
+	"\x04mbps\x18\x03 \x01(\x01R\x04mbps\x12\x14\n" +
+	"\x05bytes\x18\x04 \x01(\x03R\x05bytes\x12\x18\n" +
+	"\aseconds\x18\x05 \x01(\x01R\aseconds\x12!\n" +
+	"\fsamples_mbps\x18\x06 \x03(\x01R\vsamplesMbps\"\x82\x01\n" +
+	"\aSummary\x12*\n" +
+	"\x11avg_download_mbps\x18\x01 \x01(\x01R\x0favgDownloadMbps\x12&\n" +
+	"\x0favg_upload_mbps\x18\x02 \x01(\x01R\ravgUploadMbps\x12#\n" +
+	"\rtotal_seconds\x18\x03 \x01(\x01R\ftotalSeconds2\xd0\x01\n" +
+	"\bEthspeed\x12<\n" +
+	"\bGetStats\x12\x1c.ethspeed.v1.GetStatsRequest\x1a\x12.ethspeed.v1.Stats\x12A\n" +
+	"\x06Health\x12\x1a.ethspeed.v1.HealthRequest\x1a\x1b.ethspeed.v1.HealthResponse\x12C\n" +
+	"\aRunTest\x12\x1b.ethspeed.v1.RunTestRequest\x1a\x19.ethspeed.v1.TestProgress0\x01B\x15Z\x13ethspeed/ethspeedpbb\x06proto3"
+
+var (
+	file_ethspeedpb_ethspeed_proto_rawDescOnce sync.Once
+	file_ethspeedpb_ethspeed_proto_rawDescData []byte
+)
+
+func file_ethspeedpb_ethspeed_proto_rawDescGZIP() []byte {
+	file_ethspeedpb_ethspeed_proto_rawDescOnce.Do(func() {
+		file_ethspeedpb_ethspeed_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_ethspeedpb_ethspeed_proto_rawDesc), len(file_ethspeedpb_ethspeed_proto_rawDesc)))
+	})
+	return file_ethspeedpb_ethspeed_proto_rawDescData
+}
+
+var file_ethspeedpb_ethspeed_proto_enumTypes = make([]protoimpl.EnumInfo, 1)
+var file_ethspeedpb_ethspeed_proto_msgTypes = make([]protoimpl.MessageInfo, 10)
+var file_ethspeedpb_ethspeed_proto_goTypes = []any{
+	(HealthResponse_Status)(0),    // 0: ethspeed.v1.HealthResponse.Status
+	(*GetStatsRequest)(nil),       // 1: ethspeed.v1.GetStatsRequest
+	(*Stats)(nil),                 // 2: ethspeed.v1.Stats
+	(*HealthRequest)(nil),         // 3: ethspeed.v1.HealthRequest
+	(*HealthResponse)(nil),        // 4: ethspeed.v1.HealthResponse
+	(*RunTestRequest)(nil),        // 5: ethspeed.v1.RunTestRequest
+	(*TestProgress)(nil),          // 6: ethspeed.v1.TestProgress
+	(*TransferStarted)(nil),       // 7: ethspeed.v1.TransferStarted
+	(*Sample)(nil),                // 8: ethspeed.v1.Sample
+	(*Transfer)(nil),              // 9: ethspeed.v1.Transfer
+	(*Summary)(nil),               // 10: ethspeed.v1.Summary
+	(*timestamppb.Timestamp)(nil), // 11: google.protobuf.Timestamp
+}
+var file_ethspeedpb_ethspeed_proto_depIdxs = []int32{
+	11, // 0: ethspeed.v1.Stats.last_request:type_name -> google.protobuf.Timestamp
+	0,  // 1: ethspeed.v1.HealthResponse.status:type_name -> ethspeed.v1.HealthResponse.Status
+	11, // 2: ethspeed.v1.HealthResponse.time:type_name -> google.protobuf.Timestamp
+	7,  // 3: ethspeed.v1.TestProgress.started:type_name -> ethspeed.v1.TransferStarted
+	9,  // 4: ethspeed.v1.TestProgress.transfer:type_name -> ethspeed.v1.Transfer
+	10, // 5: ethspeed.v1.TestProgress.summary:type_name -> ethspeed.v1.Summary
+	8,  // 6: ethspeed.v1.TestProgress.sample:type_name -> ethspeed.v1.Sample
+	1,  // 7: ethspeed.v1.Ethspeed.GetStats:input_type -> ethspeed.v1.GetStatsRequest
+	3,  // 8: ethspeed.v1.Ethspeed.Health:input_type -> ethspeed.v1.HealthRequest
+	5,  // 9: ethspeed.v1.Ethspeed.RunTest:input_type -> ethspeed.v1.RunTestRequest
+	2,  // 10: ethspeed.v1.Ethspeed.GetStats:output_type -> ethspeed.v1.Stats
+	4,  // 11: ethspeed.v1.Ethspeed.Health:output_type -> ethspeed.v1.HealthResponse
+	6,  // 12: ethspeed.v1.Ethspeed.RunTest:output_type -> ethspeed.v1.TestProgress
+	10, // [10:13] is the sub-list for method output_type
+	7,  // [7:10] is the sub-list for method input_type
+	7,  // [7:7] is the sub-list for extension type_name
+	7,  // [7:7] is the sub-list for extension extendee
+	0,  // [0:7] is the sub-list for field type_name
+}
+
+func init() { file_ethspeedpb_ethspeed_proto_init() }
+func file_ethspeedpb_ethspeed_proto_init() {
+	if File_ethspeedpb_ethspeed_proto != nil {
+		return
+	}
+	file_ethspeedpb_ethspeed_proto_msgTypes[5].OneofWrappers = []any{
+		(*TestProgress_Started)(nil),
+		(*TestProgress_Transfer)(nil),
+		(*TestProgress_Summary)(nil),
+		(*TestProgress_Sample)(nil),
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_ethspeedpb_ethspeed_proto_rawDesc), len(file_ethspeedpb_ethspeed_proto_rawDesc)),
+			NumEnums:      1,
+			NumMessages:   10,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_ethspeedpb_ethspeed_proto_goTypes,
+		DependencyIndexes: file_ethspeedpb_ethspeed_proto_depIdxs,
+		EnumInfos:         file_ethspeedpb_ethspeed_proto_enumTypes,
+		MessageInfos:      file_ethspeedpb_ethspeed_proto_msgTypes,
+	}.Build()
+	File_ethspeedpb_ethspeed_proto = out.File
+	file_ethspeedpb_ethspeed_proto_goTypes = nil
+	file_ethspeedpb_ethspeed_proto_depIdxs = nil
+}
@@ -0,0 +1,219 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.6.2
+// - protoc             v5.29.3
+// source: ethspeedpb/ethspeed.proto
+
+package ethspeedpb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	Ethspeed_GetStats_FullMethodName = "/ethspeed.v1.Ethspeed/GetStats"
+	Ethspeed_Health_FullMethodName   = "/ethspeed.v1.Ethspeed/Health"
+	Ethspeed_RunTest_FullMethodName  = "/ethspeed.v1.Ethspeed/RunTest"
+)
+
+// EthspeedClient is the client API for Ethspeed service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// Ethspeed is the control and stats API of an ethspeed server, served on
+// -grpc-listen.
+type EthspeedClient interface {
+	// GetStats returns the counters also served at /__stats.
+	GetStats(ctx context.Context, in *GetStatsRequest, opts ...grpc.CallOption) (*Stats, error)
+	// Health reports liveness and readiness like /readyz.
+	Health(ctx context.Context, in *HealthRequest, opts ...grpc.CallOption) (*HealthResponse, error)
+	// RunTest makes the server run a speed test against another ethspeed
+	// server, streaming its throughput every 100 ms and each transfer as it
+	// completes. It requires the server's -admin-token as
+	// "authorization: Bearer <token>" metadata.
+	RunTest(ctx context.Context, in *RunTestRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[TestProgress], error)
+}
+
+type ethspeedClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewEthspeedClient(cc grpc.ClientConnInterface) EthspeedClient {
+	return &ethspeedClient{cc}
+}
+
+func (c *ethspeedClient) GetStats(ctx context.Context, in *GetStatsRequest, opts ...grpc.CallOption) (*Stats, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Stats)
+	err := c.cc.Invoke(ctx, Ethspeed_GetStats_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *ethspeedClient) Health(ctx context.Context, in *HealthRequest, opts ...grpc.CallOption) (*HealthResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(HealthResponse)
+	err := c.cc.Invoke(ctx, Ethspeed_Health_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *ethspeedClient) RunTest(ctx context.Context, in *RunTestRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[TestProgress], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Ethspeed_ServiceDesc.Streams[0], Ethspeed_RunTest_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[RunTestRequest, TestProgress]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Ethspeed_RunTestClient = grpc.ServerStreamingClient[TestProgress]
+
+// EthspeedServer is the server API for Ethspeed service.
+// All implementations must embed UnimplementedEthspeedServer
+// for forward compatibility.
+//
+// Ethspeed is the control and stats API of an ethspeed server, served on
+// -grpc-listen.
+type EthspeedServer interface {
+	// GetStats returns the counters also served at /__stats.
+	GetStats(context.Context, *GetStatsRequest) (*Stats, error)
+	// Health reports liveness and readiness like /readyz.
+	Health(context.Context, *HealthRequest) (*HealthResponse, error)
+	// RunTest makes the server run a speed test against another ethspeed
+	// server, streaming its throughput every 100 ms and each transfer as it
+	// completes. It requires the server's -admin-token as
+	// "authorization: Bearer <token>" metadata.
+	RunTest(*RunTestRequest, grpc.ServerStreamingServer[TestProgress]) error
+	mustEmbedUnimplementedEthspeedServer()
+}
+
+// UnimplementedEthspeedServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedEthspeedServer struct{}
+
+func (UnimplementedEthspeedServer) GetStats(context.Context, *GetStatsRequest) (*Stats, error) {
+	return nil, status.Error(codes.Unimplemented, "method GetStats not implemented")
+}
+func (UnimplementedEthspeedServer) Health(context.Context, *HealthRequest) (*HealthResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method Health not implemented")
+}
+func (UnimplementedEthspeedServer) RunTest(*RunTestRequest, grpc.ServerStreamingServer[TestProgress]) error {
+	return status.Error(codes.Unimplemented, "method RunTest not implemented")
+}
+func (UnimplementedEthspeedServer) mustEmbedUnimplementedEthspeedServer() {}
+func (UnimplementedEthspeedServer) testEmbeddedByValue()                  {}
+
+// UnsafeEthspeedServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to EthspeedServer will
+// result in compilation errors.
+type UnsafeEthspeedServer interface {
+	mustEmbedUnimplementedEthspeedServer()
+}
+
+func RegisterEthspeedServer(s grpc.ServiceRegistrar, srv EthspeedServer) {
+	// If the following call panics, it indicates UnimplementedEthspeedServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&Ethspeed_ServiceDesc, srv)
+}
+
+func _Ethspeed_GetStats_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetStatsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(EthspeedServer).GetStats(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Ethspeed_GetStats_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(EthspeedServer).GetStats(ctx, req.(*GetStatsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Ethspeed_Health_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(HealthRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(EthspeedServer).Health(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Ethspeed_Health_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(EthspeedServer).Health(ctx, req.(*HealthRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Ethspeed_RunTest_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(RunTestRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(EthspeedServer).RunTest(m, &grpc.GenericServerStream[RunTestRequest, TestProgress]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Ethspeed_RunTestServer = grpc.ServerStreamingServer[TestProgress]
+
+// Ethspeed_ServiceDesc is the grpc.ServiceDesc for Ethspeed service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Ethspeed_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "ethspeed.v1.Ethspeed",
+	HandlerType: (*EthspeedServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "GetStats",
+			Handler:    _Ethspeed_GetStats_Handler,
+		},
+		{
+			MethodName: "Health",
+			Handler:    _Ethspeed_Health_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "RunTest",
+			Handler:       _Ethspeed_RunTest_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "ethspeedpb/ethspeed.proto",
+}
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Formats of ethspeed export
+const (
+	exportCSV        = "csv"         // a row per round, samples as space-separated cells
+	exportCSVSamples = "csv-samples" // a row per throughput sample
+	exportJSON       = "json"        // JSON Lines, like -watch -json
+)
+
+// runExport implements "ethspeed export": it dumps the -db history for
+// spreadsheets and pandas, per-interval samples included
+func runExport(args []string) error {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	db := fs.String("db", "", "SQLite results file written by -watch -db (required)")
+	format := fs.String("format", exportCSV, "output format: csv, csv-samples or json")
+	since := fs.String("since", "", "only results from this time on: RFC 3339, YYYY-MM-DD or an age like 30d")
+	until := fs.String("until", "", "only results before this time, same forms as -since")
+	server := fs.String("server", "", "only results against this server")
+	output := fs.String("o", "", "output file (default: stdout)")
+	name := fs.String("name", "", "only results of this -name session")
+	var tags stringList
+	fs.Var(&tags, "tag", "only results with this key=value tag (repeatable)")
+	rollups := fs.Bool("rollups", false, "export the -rollup aggregates of pruned rounds instead (csv or json)")
+	fs.Parse(args)
+
+	if *db == "" {
+		return fmt.Errorf("-db is required")
+	}
+	var q historyQuery
+	var err error
+	now := time.Now()
+	if *since != "" {
+		if q.since, err = parseSince(*since, now); err != nil {
+			return err
+		}
+	}
+	if *until != "" {
+		if q.until, err = parseSince(*until, now); err != nil {
+			return err
+		}
+	}
+	q.server = *server
+	q.name = *name
+	if q.tags, err = parseTags(tags); err != nil {
+		return err
+	}
+
+	if *rollups && *format == exportCSVSamples {
+		return fmt.Errorf("rollups have no samples, use -format csv or json")
+	}
+	if *rollups && (len(tags) > 0 || *name != "") {
+		return fmt.Errorf("rollups are per server and cannot be filtered by -tag or -name")
+	}
+
+	var write func(io.Writer, []storedResult) error
+	switch *format {
+	case exportCSV:
+		write = writeResultsCSV
+	case exportCSVSamples:
+		write = writeSamplesCSV
+	case exportJSON:
+		write = writeResultsJSON[storedResult]
+	default:
+		return fmt.Errorf("invalid format '%s', must be 'csv', 'csv-samples' or 'json'", *format)
+	}
+
+	// Opening creates the file, so check that it exists first
+	if _, err := os.Stat(*db); err != nil {
+		return err
+	}
+	history, err := openHistory(*db)
+	if err != nil {
+		return err
+	}
+	defer history.Close()
+
+	out := os.Stdout
+	if *output != "" {
+		if out, err = os.Create(*output); err != nil {
+			return err
+		}
+		defer out.Close()
+	}
+	w := bufio.NewWriter(out)
+
+	if *rollups {
+		list, err := history.rollups(q)
+		if err != nil {
+			return err
+		}
+		if *format == exportJSON {
+			err = writeResultsJSON(w, list)
+		} else {
+			err = writeRollupsCSV(w, list)
+		}
+		if err != nil {
+			return err
+		}
+		return w.Flush()
+	}
+
+	if *format == exportCSV {
+		w.WriteString("id,time,server,download_mbps,download_bytes,download_seconds,upload_mbps,upload_bytes,upload_seconds,latency_idle_ms,latency_loaded_ms,error,download_samples_mbps,upload_samples_mbps,tags,hostname,os,interface,local_ip,gateway,version,wifi_ssid,wifi_rssi_dbm,wifi_channel,wifi_tx_rate_mbps,name,note\n")
+	} else if *format == exportCSVSamples {
+		w.WriteString("id,time,server,direction,window,mbps\n")
+	}
+
+	// Page through the table so a large history is not held in memory
+	q.limit = maxResultsLimit
+	for {
+		results, err := history.query(q)
+		if err != nil {
+			return err
+		}
+		if err := write(w, results); err != nil {
+			return err
+		}
+		if len(results) < q.limit {
+			break
+		}
+		q.after = results[len(results)-1].ID
+	}
+	return w.Flush()
+}
+
+func writeResultsJSON[T any](w io.Writer, results []T) error {
+	enc := json.NewEncoder(w)
+	for _, r := range results {
+		if err := enc.Encode(r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeResultsCSV(w io.Writer, results []storedResult) error {
+	cw := csv.NewWriter(w)
+	for _, r := range results {
+		row := []string{strconv.FormatInt(r.ID, 10), r.Time.Format(time.RFC3339), r.Server}
+		row = append(row, transferCells(r.Download)...)
+		row = append(row, transferCells(r.Upload)...)
+		row = append(row, optionalCell(r.LatencyIdleMs), optionalCell(r.LatencyLoadedMs), r.Error,
+			samplesCell(r.Download), samplesCell(r.Upload), formatTags(r.Tags))
+		row = append(row, environmentCells(r.Environment)...)
+		row = append(row, r.Name, r.Note)
+		cw.Write(row)
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func writeSamplesCSV(w io.Writer, results []storedResult) error {
+	cw := csv.NewWriter(w)
+	for _, r := range results {
+		for _, t := range []struct {
+			direction string
+			result    *transferResult
+		}{{directionDown, r.Download}, {directionUp, r.Upload}} {
+			if t.result == nil {
+				continue
+			}
+			// Sample i covers roughly the i-th throughputWindow of the transfer
+			for i, mbps := range t.result.Samples {
+				cw.Write([]string{strconv.FormatInt(r.ID, 10), r.Time.Format(time.RFC3339), r.Server, t.direction,
+					strconv.Itoa(i), formatCSVFloat(mbps)})
+			}
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func writeRollupsCSV(w io.Writer, rollups []storedRollup) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"period", "start", "server", "rounds", "failed",
+		"download_avg_mbps", "download_min_mbps", "download_max_mbps",
+		"upload_avg_mbps", "upload_min_mbps", "upload_max_mbps",
+		"latency_idle_avg_ms", "latency_loaded_avg_ms"})
+	for _, r := range rollups {
+		cw.Write([]string{r.Period, r.Start.Format(time.RFC3339), r.Server,
+			strconv.FormatInt(r.Rounds, 10), strconv.FormatInt(r.Failed, 10),
+			optionalCell(r.DownloadAvg), optionalCell(r.DownloadMin), optionalCell(r.DownloadMax),
+			optionalCell(r.UploadAvg), optionalCell(r.UploadMin), optionalCell(r.UploadMax),
+			optionalCell(r.LatencyIdleAvg), optionalCell(r.LatencyLoadedAvg)})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// transferCells are the mbps, bytes and seconds cells, empty when the
+// direction was not tested
+func transferCells(t *transferResult) []string {
+	if t == nil {
+		return []string{"", "", ""}
+	}
+	return []string{formatCSVFloat(t.Mbps), strconv.FormatInt(t.Bytes, 10), formatCSVFloat(t.Seconds)}
+}
+
+// environmentCells are the hostname to Wi-Fi cells, empty for rounds
+// recorded before environments were stored
+func environmentCells(e *environment) []string {
+	if e == nil {
+		return []string{"", "", "", "", "", "", "", "", "", ""}
+	}
+	cells := []string{e.Hostname, e.OS, e.Interface, e.LocalIP, e.Gateway, e.Version}
+	if w := e.WiFi; w != nil {
+		return append(cells, w.SSID, strconv.Itoa(w.RSSIdBm), strconv.Itoa(w.Channel), formatCSVFloat(w.TxRateMbps))
+	}
+	return append(cells, "", "", "", "")
+}
+
+func samplesCell(t *transferResult) string {
+	if t == nil {
+		return ""
+	}
+	cells := make([]string, len(t.Samples))
+	for i, v := range t.Samples {
+		cells[i] = formatCSVFloat(v)
+	}
+	return strings.Join(cells, " ")
+}
+
+func optionalCell(v *float64) string {
+	if v == nil {
+		return ""
+	}
+	return formatCSVFloat(*v)
+}
+
+func formatCSVFloat(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/hex"
+	"net"
+	"os"
+	"strings"
+)
+
+// defaultGateway returns the next hop of the default route, preferring the
+// one through iface, from the kernel routing tables in /proc
+func defaultGateway(iface string, ipv6 bool) string {
+	path := "/proc/net/route"
+	if ipv6 {
+		path = "/proc/net/ipv6_route"
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+
+	var first string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		var name, gw string
+		if ipv6 {
+			// dest, dest prefix, src, src prefix, next hop, metric, refcnt, use, flags, iface
+			if len(fields) < 10 || fields[1] != "00" || strings.Trim(fields[0], "0") != "" {
+				continue
+			}
+			name, gw = fields[9], parseHexIPv6(fields[4])
+		} else {
+			// iface, destination, gateway, flags, refcnt, use, metric, mask, ...
+			if len(fields) < 8 || fields[1] != "00000000" || fields[7] != "00000000" {
+				continue
+			}
+			name, gw = fields[0], parseHexIPv4(fields[2])
+		}
+		if gw == "" {
+			continue
+		}
+		if name == iface {
+			return gw
+		}
+		if first == "" {
+			first = gw
+		}
+	}
+	return first
+}
+
+// parseHexIPv4 decodes an address of /proc/net/route, which is in host
+// (little endian on every Linux ethspeed runs on) byte order
+func parseHexIPv4(s string) string {
+	b, err := hex.DecodeString(s)
+	if err != nil || len(b) != 4 {
+		return ""
+	}
+	ip := make(net.IP, 4)
+	binary.BigEndian.PutUint32(ip, binary.LittleEndian.Uint32(b))
+	if ip.IsUnspecified() {
+		return ""
+	}
+	return ip.String()
+}
+
+func parseHexIPv6(s string) string {
+	b, err := hex.DecodeString(s)
+	if err != nil || len(b) != 16 {
+		return ""
+	}
+	ip := net.IP(b)
+	if ip.IsUnspecified() {
+		return ""
+	}
+	return ip.String()
+}
@@ -0,0 +1,53 @@
+//go:build !linux
+
+package main
+
+import (
+	"context"
+	"net"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// defaultGateway returns the next hop of the default route as printed by
+// the system route tool; iface is only used on Linux
+func defaultGateway(iface string, ipv6 bool) string {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	if runtime.GOOS == "windows" {
+		if ipv6 {
+			return ""
+		}
+		out, err := exec.CommandContext(ctx, "route", "print", "-4", "0.0.0.0").Output()
+		if err != nil {
+			return ""
+		}
+		// Network Destination, Netmask, Gateway, Interface, Metric
+		for _, line := range strings.Split(string(out), "\n") {
+			fields := strings.Fields(line)
+			if len(fields) >= 5 && fields[0] == "0.0.0.0" && fields[1] == "0.0.0.0" && net.ParseIP(fields[2]) != nil {
+				return fields[2]
+			}
+		}
+		return ""
+	}
+
+	// macOS and the BSDs
+	family := "-inet"
+	if ipv6 {
+		family = "-inet6"
+	}
+	out, err := exec.CommandContext(ctx, "route", "-n", "get", family, "default").Output()
+	if err != nil {
+		return ""
+	}
+	for _, line := range strings.Split(string(out), "\n") {
+		if gw, ok := strings.CutPrefix(strings.TrimSpace(line), "gateway:"); ok {
+			return strings.TrimSpace(gw)
+		}
+	}
+	return ""
+}
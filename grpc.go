@@ -0,0 +1,252 @@
+package main
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative ethspeedpb/ethspeed.proto
+
+import (
+	"context"
+	"crypto/subtle"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"ethspeed/ethspeedpb"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// Limits of a RunTest request, which costs the server real bandwidth
+const (
+	maxGRPCTestSize  = 10000
+	maxGRPCTestCount = 100
+)
+
+// grpcService implements the Ethspeed gRPC API of -grpc-listen
+type grpcService struct {
+	ethspeedpb.UnimplementedEthspeedServer
+	adminToken string
+}
+
+// serveGRPC serves the gRPC API on ln until ctx is cancelled, over TLS
+// when the server has a tls: listener
+func serveGRPC(ctx context.Context, ln net.Listener, adminToken string, tlsConfig *tls.Config) {
+	var opts []grpc.ServerOption
+	if tlsConfig != nil {
+		c := tlsConfig.Clone()
+		// Keep gRPC handshakes out of the TLS histograms of timeHandshakes
+		c.GetConfigForClient = nil
+		c.NextProtos = []string{"h2"}
+		opts = append(opts, grpc.Creds(credentials.NewTLS(c)))
+	}
+	srv := grpc.NewServer(opts...)
+	ethspeedpb.RegisterEthspeedServer(srv, &grpcService{adminToken: adminToken})
+	// Lets grpcurl and similar tools work without the .proto file
+	reflection.Register(srv)
+	go func() {
+		<-ctx.Done()
+		// Stop rather than wait: a RunTest stream can take minutes
+		srv.Stop()
+	}()
+	if err := srv.Serve(ln); err != nil {
+		logger.Printf("[GRPC] serve error: %v", err)
+	}
+}
+
+func (s *grpcService) GetStats(ctx context.Context, _ *ethspeedpb.GetStatsRequest) (*ethspeedpb.Stats, error) {
+	stats.mu.RLock()
+	defer stats.mu.RUnlock()
+
+	resp := &ethspeedpb.Stats{
+		TotalDownloads:   stats.totalDownloads,
+		TotalUploads:     stats.totalUploads,
+		TotalBytesDown:   stats.totalBytesDown,
+		TotalBytesUp:     stats.totalBytesUp,
+		TotalConnections: stats.totalConnections,
+		UptimeSeconds:    time.Since(stats.startTime).Seconds(),
+		CurrentTransfers: atomic.LoadInt64(&stats.currentConcurrent),
+		PeakConcurrent:   stats.peakConcurrent,
+		Queued:           atomic.LoadInt64(&stats.currentQueued),
+		PeakQueued:       atomic.LoadInt64(&stats.peakQueued),
+		QueueRejected:    atomic.LoadInt64(&stats.queueRejected),
+		CorruptChunks:    atomic.LoadInt64(&stats.corruptChunks),
+		Draining:         draining.Load(),
+		Version:          build.Version,
+		Commit:           build.Commit,
+	}
+	if !stats.lastRequestTime.IsZero() {
+		resp.LastRequest = timestamppb.New(stats.lastRequestTime)
+	}
+	return resp, nil
+}
+
+func (s *grpcService) Health(ctx context.Context, _ *ethspeedpb.HealthRequest) (*ethspeedpb.HealthResponse, error) {
+	resp := &ethspeedpb.HealthResponse{
+		Status:          ethspeedpb.HealthResponse_READY,
+		ActiveTransfers: atomic.LoadInt64(&stats.currentConcurrent),
+		Time:            timestamppb.Now(),
+	}
+	if draining.Load() {
+		resp.Status = ethspeedpb.HealthResponse_DRAINING
+	}
+	return resp, nil
+}
+
+// RunTest runs a speed test from this server to another one, so a fleet of
+// servers can be used as probes. It takes the admin token like /__drain.
+func (s *grpcService) RunTest(req *ethspeedpb.RunTestRequest, stream ethspeedpb.Ethspeed_RunTestServer) error {
+	ctx := stream.Context()
+	if err := s.authorize(ctx); err != nil {
+		return err
+	}
+
+	config := Config{
+		Mode:      modeClient,
+		Server:    req.GetServer(),
+		Size:      int(req.GetSizeMb()),
+		Direction: req.GetDirection(),
+		Count:     int(req.GetCount()),
+		TLS:       req.GetTls(),
+		Insecure:  req.GetInsecure(),
+		Token:     req.GetToken(),
+
+		DownPath:   "/__down",
+		UpPath:     "/__up",
+		BytesParam: "bytes",
+	}
+	if config.Size == 0 {
+		config.Size = 100
+	}
+	if config.Direction == "" {
+		config.Direction = directionBoth
+	}
+	if config.Count == 0 {
+		config.Count = 1
+	}
+	switch {
+	case config.Server == "":
+		return status.Error(codes.InvalidArgument, "server is required")
+	case config.Size < 1 || config.Size > maxGRPCTestSize:
+		return status.Errorf(codes.InvalidArgument, "size_mb must be between 1 and %d", maxGRPCTestSize)
+	case !isValidDirection(config.Direction):
+		return status.Errorf(codes.InvalidArgument, "invalid direction '%s', must be 'down', 'up', or 'both'", config.Direction)
+	case config.Count < 1 || config.Count > maxGRPCTestCount:
+		return status.Errorf(codes.InvalidArgument, "count must be between 1 and %d", maxGRPCTestCount)
+	}
+	if err := config.resolveServer(); err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	caller := "unknown"
+	if p, ok := peer.FromContext(ctx); ok {
+		caller = p.Addr.String()
+	}
+	logger.Printf("[GRPC] %s - test to %s started (%d x %d MB, %s)", caller, config.Server, config.Count, config.Size, config.Direction)
+
+	client := &http.Client{Transport: newTransport(config), Timeout: defaultHTTPTimeout, Jar: clientCookies}
+	defer client.CloseIdleConnections()
+
+	type phase struct {
+		direction string
+		measure   func(*http.Client, Config) (*transferResult, error)
+	}
+	var phases []phase
+	if config.Direction != directionUp {
+		phases = append(phases, phase{directionDown, measureDownload})
+	}
+	if config.Direction != directionDown {
+		phases = append(phases, phase{directionUp, measureUpload})
+	}
+
+	// The meter of an upload runs in the transport's goroutine, and a
+	// stream takes one sender at a time
+	var sendMu sync.Mutex
+	send := func(p *ethspeedpb.TestProgress) error {
+		sendMu.Lock()
+		defer sendMu.Unlock()
+		return stream.Send(p)
+	}
+
+	report := &speedReport{Server: config.Server, SizeMB: config.Size, Direction: config.Direction}
+	for i := 1; i <= config.Count; i++ {
+		var run runResult
+		config.onSample = func(direction string, index int, mbps float64) {
+			// A failed send ends the test at the next event
+			send(&ethspeedpb.TestProgress{Event: &ethspeedpb.TestProgress_Sample{
+				Sample: &ethspeedpb.Sample{Run: int32(i), Direction: direction, Index: int32(index), Mbps: mbps},
+			}})
+		}
+		for _, p := range phases {
+			if ctx.Err() != nil {
+				return status.FromContextError(ctx.Err()).Err()
+			}
+			err := send(&ethspeedpb.TestProgress{Event: &ethspeedpb.TestProgress_Started{
+				Started: &ethspeedpb.TransferStarted{Run: int32(i), Direction: p.direction},
+			}})
+			if err != nil {
+				return err
+			}
+
+			result, err := p.measure(client, config)
+			if err != nil {
+				logger.Printf("[GRPC] %s - test to %s failed: %v", caller, config.Server, err)
+				return status.Errorf(codes.Unavailable, "run %d %s: %v", i, p.direction, err)
+			}
+			if p.direction == directionDown {
+				run.Download = result
+			} else {
+				run.Upload = result
+			}
+
+			err = send(&ethspeedpb.TestProgress{Event: &ethspeedpb.TestProgress_Transfer{
+				Transfer: &ethspeedpb.Transfer{
+					Run:         int32(i),
+					Direction:   p.direction,
+					Mbps:        result.Mbps,
+					Bytes:       result.Bytes,
+					Seconds:     result.Seconds,
+					SamplesMbps: result.Samples,
+				},
+			}})
+			if err != nil {
+				return err
+			}
+		}
+		report.Runs = append(report.Runs, run)
+	}
+
+	report.summarize()
+	logger.Printf("[GRPC] %s - test to %s done (down %.1f Mbps, up %.1f Mbps)",
+		caller, config.Server, report.AvgDownloadMbps, report.AvgUploadMbps)
+	return send(&ethspeedpb.TestProgress{Event: &ethspeedpb.TestProgress_Summary{
+		Summary: &ethspeedpb.Summary{
+			AvgDownloadMbps: report.AvgDownloadMbps,
+			AvgUploadMbps:   report.AvgUploadMbps,
+			TotalSeconds:    report.TotalSeconds,
+		},
+	}})
+}
+
+// authorize checks the admin token in the "authorization" metadata
+func (s *grpcService) authorize(ctx context.Context) error {
+	if s.adminToken == "" {
+		return status.Error(codes.PermissionDenied, "admin RPCs disabled, set -admin-token")
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	for _, v := range md.Get("authorization") {
+		got, ok := strings.CutPrefix(v, "Bearer ")
+		if ok && subtle.ConstantTimeCompare([]byte(got), []byte(s.adminToken)) == 1 {
+			return nil
+		}
+	}
+	return status.Error(codes.Unauthenticated, "unauthorized")
+}
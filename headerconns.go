@@ -0,0 +1,74 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+)
+
+// headerConns follows the connections still sending their request
+// headers: accepted ones, and keep-alive ones whose next request has begun.
+// A slowloris client opens many and trickles a byte now and then; past
+// -max-header-conns new ones are closed right away, so the half-open
+// requests cannot take every socket while -read-header-timeout runs.
+type headerConns struct {
+	max int // 0 for no limit
+
+	mu    sync.Mutex
+	conns map[net.Conn]struct{}
+
+	rejected atomic.Int64 // connections closed for the limit
+}
+
+var serverHeaders = newHeaderConns(0)
+
+func newHeaderConns(max int) *headerConns {
+	return &headerConns{max: max, conns: make(map[net.Conn]struct{})}
+}
+
+// connState is called from http.Server.ConnState. A connection turns
+// active with the first byte of a request and leaves the header phase when
+// its handler starts (served).
+func (h *headerConns) connState(conn net.Conn, state http.ConnState) {
+	reject := false
+	h.mu.Lock()
+	switch state {
+	case http.StateNew, http.StateActive:
+		if _, ok := h.conns[conn]; !ok {
+			if h.max > 0 && len(h.conns) >= h.max {
+				reject = true
+			} else {
+				h.conns[conn] = struct{}{}
+			}
+		}
+	default:
+		delete(h.conns, conn)
+	}
+	h.mu.Unlock()
+
+	if reject {
+		h.rejected.Add(1)
+		conn.Close()
+	}
+}
+
+// served takes a request's connection out of the header phase once its
+// handler runs
+func (h *headerConns) served(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if conn, ok := r.Context().Value(connContextKey{}).(net.Conn); ok {
+			h.mu.Lock()
+			delete(h.conns, conn)
+			h.mu.Unlock()
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// count returns the connections in the header phase right now
+func (h *headerConns) count() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.conns)
+}
@@ -0,0 +1,417 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+// Page sizes of /api/results
+const (
+	defaultResultsLimit = 100
+	maxResultsLimit     = 1000
+)
+
+// historySchema keeps the summary of every -watch round in columns for
+// queries, and the whole round, samples included, as JSON in data. Rounds
+// pruned by -retain with -rollup live on as per-period aggregates.
+const historySchema = `
+CREATE TABLE IF NOT EXISTS results (
+	id            INTEGER PRIMARY KEY,
+	time          INTEGER NOT NULL,
+	server        TEXT NOT NULL,
+	download_mbps REAL,
+	upload_mbps   REAL,
+	error         TEXT NOT NULL DEFAULT '',
+	data          TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS results_time ON results (time);
+
+CREATE TABLE IF NOT EXISTS rollups (
+	period             TEXT NOT NULL,
+	start              INTEGER NOT NULL,
+	server             TEXT NOT NULL,
+	rounds             INTEGER NOT NULL,
+	failed             INTEGER NOT NULL,
+	download_avg       REAL,
+	download_min       REAL,
+	download_max       REAL,
+	upload_avg         REAL,
+	upload_min         REAL,
+	upload_max         REAL,
+	latency_idle_avg   REAL,
+	latency_loaded_avg REAL,
+	PRIMARY KEY (period, start, server)
+);
+`
+
+// historyDB is the SQLite file of -db: -watch appends a row per round,
+// a server started with the same file serves it at /api/results
+type historyDB struct {
+	db *sql.DB
+}
+
+func openHistory(path string) (*historyDB, error) {
+	// WAL lets the server read while a -watch client writes
+	db, err := sql.Open("sqlite", "file:"+path+"?_pragma=journal_mode(WAL)&_pragma=busy_timeout(5000)")
+	if err != nil {
+		return nil, fmt.Errorf("db: %w", err)
+	}
+	if _, err := db.Exec(historySchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("db %s: %w", path, err)
+	}
+	return &historyDB{db: db}, nil
+}
+
+func (h *historyDB) Close() error { return h.db.Close() }
+
+// storedResult is a -watch round read back from the database
+type storedResult struct {
+	ID     int64  `json:"id"`
+	Server string `json:"server"`
+	watchRound
+}
+
+// record appends a -watch round
+func (h *historyDB) record(server string, r watchRound) error {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	var down, up *float64
+	if r.Download != nil {
+		down = &r.Download.Mbps
+	}
+	if r.Upload != nil {
+		up = &r.Upload.Mbps
+	}
+	_, err = h.db.Exec(`INSERT INTO results (time, server, download_mbps, upload_mbps, error, data) VALUES (?, ?, ?, ?, ?, ?)`,
+		r.Time.UnixMilli(), server, down, up, r.Error, string(data))
+	return err
+}
+
+// historyQuery selects results by time, server, -name and -tag values;
+// after is the id of the last result of the previous page
+type historyQuery struct {
+	since, until time.Time
+	server       string
+	name         string
+	tags         map[string]string
+	after        int64
+	limit        int
+}
+
+// query returns matching results oldest first
+func (h *historyDB) query(q historyQuery) ([]storedResult, error) {
+	where := []string{"id > ?"}
+	args := []any{q.after}
+	if !q.since.IsZero() {
+		where = append(where, "time >= ?")
+		args = append(args, q.since.UnixMilli())
+	}
+	if !q.until.IsZero() {
+		where = append(where, "time < ?")
+		args = append(args, q.until.UnixMilli())
+	}
+	if q.server != "" {
+		where = append(where, "server = ?")
+		args = append(args, q.server)
+	}
+	if q.name != "" {
+		where = append(where, "json_extract(data, '$.name') = ?")
+		args = append(args, q.name)
+	}
+	for k, v := range q.tags {
+		// parseTags only lets through keys that are safe in a JSON path
+		where = append(where, "json_extract(data, ?) = ?")
+		args = append(args, "$.tags."+k, v)
+	}
+	args = append(args, q.limit)
+
+	rows, err := h.db.Query(`SELECT id, server, data FROM results WHERE `+strings.Join(where, " AND ")+` ORDER BY id LIMIT ?`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := []storedResult{}
+	for rows.Next() {
+		var (
+			r    storedResult
+			data string
+		)
+		if err := rows.Scan(&r.ID, &r.Server, &data); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(data), &r.watchRound); err != nil {
+			return nil, fmt.Errorf("result %d: %w", r.ID, err)
+		}
+		results = append(results, r)
+	}
+	return results, rows.Err()
+}
+
+// parseSince parses a point in time given as RFC 3339, a date, or an age
+// such as "90m", "24h" or "30d" before now
+func parseSince(s string, now time.Time) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation(time.DateOnly, s, time.Local); err == nil {
+		return t, nil
+	}
+	if age, err := parseAge(s); err == nil {
+		return now.Add(-age), nil
+	}
+	return time.Time{}, fmt.Errorf("invalid time '%s', expected RFC 3339, YYYY-MM-DD or an age like 24h or 30d", s)
+}
+
+// parseAge parses a duration that may also be given in days, like "30d"
+func parseAge(s string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		if n, err := strconv.Atoi(days); err == nil && n >= 0 {
+			return time.Duration(n) * 24 * time.Hour, nil
+		}
+	}
+	if d, err := time.ParseDuration(s); err == nil && d >= 0 {
+		return d, nil
+	}
+	return 0, fmt.Errorf("invalid age '%s', expected a duration like 12h or 90d", s)
+}
+
+// resultsHandler serves GET /api/results?since=&until=&server=&name=&tag=&limit=&after=
+// as pages of stored -watch rounds, oldest first. tag=key=value may repeat. Per-interval samples are
+// left out unless samples=1. The response carries "next", the after value
+// of the following page, while more results remain.
+func resultsHandler(h *historyDB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			httpError(w, codeMethodNotAllowed, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		params := r.URL.Query()
+		q := historyQuery{server: params.Get("server"), name: params.Get("name"), limit: defaultResultsLimit}
+		var err error
+		if v := params.Get("since"); v != "" {
+			if q.since, err = parseSince(v, time.Now()); err != nil {
+				writeError(w, err, codeBadRequest, http.StatusBadRequest)
+				return
+			}
+		}
+		if v := params.Get("until"); v != "" {
+			if q.until, err = parseSince(v, time.Now()); err != nil {
+				writeError(w, err, codeBadRequest, http.StatusBadRequest)
+				return
+			}
+		}
+		if q.tags, err = parseTags(params["tag"]); err != nil {
+			writeError(w, err, codeBadRequest, http.StatusBadRequest)
+			return
+		}
+		if v := params.Get("limit"); v != "" {
+			if q.limit, err = strconv.Atoi(v); err != nil || q.limit < 1 || q.limit > maxResultsLimit {
+				httpError(w, codeBadRequest, fmt.Sprintf("limit must be between 1 and %d", maxResultsLimit), http.StatusBadRequest)
+				return
+			}
+		}
+		if v := params.Get("after"); v != "" {
+			if q.after, err = strconv.ParseInt(v, 10, 64); err != nil {
+				httpError(w, codeBadRequest, "invalid after", http.StatusBadRequest)
+				return
+			}
+		}
+
+		// One extra row tells whether there is a next page
+		limit := q.limit
+		q.limit++
+		results, err := h.query(q)
+		if err != nil {
+			logger.Printf("db: %v", err)
+			httpError(w, codeInternal, "query failed", http.StatusInternalServerError)
+			return
+		}
+
+		page := struct {
+			Results []storedResult `json:"results"`
+			Next    *int64         `json:"next,omitempty"`
+		}{Results: results}
+		if len(results) > limit {
+			page.Results = results[:limit]
+			page.Next = &results[limit-1].ID
+		}
+		if params.Get("samples") != "1" {
+			for _, res := range page.Results {
+				if res.Download != nil {
+					res.Download.Samples = nil
+				}
+				if res.Upload != nil {
+					res.Upload.Samples = nil
+				}
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(page)
+	}
+}
+
+// Periods of -rollup
+const (
+	rollupHourly = "hourly"
+	rollupDaily  = "daily"
+)
+
+// retention is the -retain, -retain-rows and -rollup policy of a -db
+type retention struct {
+	maxAge  time.Duration // 0 keeps rounds of any age
+	maxRows int           // 0 keeps any number of rounds
+	rollup  string        // "", rollupHourly or rollupDaily
+}
+
+// rollupPeriod returns the bucket length of a -rollup period
+func rollupPeriod(period string) time.Duration {
+	if period == rollupDaily {
+		return 24 * time.Hour
+	}
+	return time.Hour
+}
+
+// prune deletes the rounds the policy no longer keeps, after folding them
+// into rollups if asked to. The cutoff is moved back to a period boundary
+// so every rollup bucket is built from all of its rounds at once; a few
+// more rounds than -retain-rows may stay until their period is complete.
+func (h *historyDB) prune(p retention, now time.Time) error {
+	var cutoff int64 // unix ms; rounds before it go
+	if p.maxAge > 0 {
+		cutoff = now.Add(-p.maxAge).UnixMilli()
+	}
+	if p.maxRows > 0 {
+		var oldestKept int64
+		err := h.db.QueryRow(`SELECT time FROM results ORDER BY time DESC LIMIT 1 OFFSET ?`, p.maxRows-1).Scan(&oldestKept)
+		if err != nil && err != sql.ErrNoRows {
+			return err
+		}
+		cutoff = max(cutoff, oldestKept)
+	}
+	if cutoff == 0 {
+		return nil
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if p.rollup != "" {
+		// Buckets follow local midnight (at the current UTC offset)
+		_, offset := now.Zone()
+		offsetMs := int64(offset) * 1000
+		periodMs := rollupPeriod(p.rollup).Milliseconds()
+		cutoff = (cutoff+offsetMs)/periodMs*periodMs - offsetMs
+
+		// A bucket only gets rolled up twice when rounds arrive out of
+		// order; averages are then merged weighted by rounds, which is
+		// exact when every round has all values
+		_, err := tx.Exec(`
+INSERT INTO rollups (period, start, server, rounds, failed,
+	download_avg, download_min, download_max, upload_avg, upload_min, upload_max,
+	latency_idle_avg, latency_loaded_avg)
+SELECT ?, (time + ?) / ? * ? - ?, server, COUNT(*), SUM(error != ''),
+	AVG(download_mbps), MIN(download_mbps), MAX(download_mbps),
+	AVG(upload_mbps), MIN(upload_mbps), MAX(upload_mbps),
+	AVG(json_extract(data, '$.latency_idle_ms')), AVG(json_extract(data, '$.latency_loaded_ms'))
+FROM results WHERE time < ?
+GROUP BY 2, 3
+ON CONFLICT (period, start, server) DO UPDATE SET
+	download_avg = (coalesce(download_avg * rounds, 0) + coalesce(excluded.download_avg * excluded.rounds, 0)) / (rounds + excluded.rounds),
+	upload_avg = (coalesce(upload_avg * rounds, 0) + coalesce(excluded.upload_avg * excluded.rounds, 0)) / (rounds + excluded.rounds),
+	latency_idle_avg = (coalesce(latency_idle_avg * rounds, 0) + coalesce(excluded.latency_idle_avg * excluded.rounds, 0)) / (rounds + excluded.rounds),
+	latency_loaded_avg = (coalesce(latency_loaded_avg * rounds, 0) + coalesce(excluded.latency_loaded_avg * excluded.rounds, 0)) / (rounds + excluded.rounds),
+	download_min = min(coalesce(download_min, excluded.download_min), coalesce(excluded.download_min, download_min)),
+	download_max = max(coalesce(download_max, excluded.download_max), coalesce(excluded.download_max, download_max)),
+	upload_min = min(coalesce(upload_min, excluded.upload_min), coalesce(excluded.upload_min, upload_min)),
+	upload_max = max(coalesce(upload_max, excluded.upload_max), coalesce(excluded.upload_max, upload_max)),
+	rounds = rounds + excluded.rounds,
+	failed = failed + excluded.failed`,
+			p.rollup, offsetMs, periodMs, periodMs, offsetMs, cutoff)
+		if err != nil {
+			return fmt.Errorf("rollup: %w", err)
+		}
+	}
+
+	if _, err := tx.Exec(`DELETE FROM results WHERE time < ?`, cutoff); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// storedRollup is a row of the rollups table
+type storedRollup struct {
+	Period           string    `json:"period"`
+	Start            time.Time `json:"start"`
+	Server           string    `json:"server"`
+	Rounds           int64     `json:"rounds"`
+	Failed           int64     `json:"failed"`
+	DownloadAvg      *float64  `json:"download_avg_mbps"`
+	DownloadMin      *float64  `json:"download_min_mbps"`
+	DownloadMax      *float64  `json:"download_max_mbps"`
+	UploadAvg        *float64  `json:"upload_avg_mbps"`
+	UploadMin        *float64  `json:"upload_min_mbps"`
+	UploadMax        *float64  `json:"upload_max_mbps"`
+	LatencyIdleAvg   *float64  `json:"latency_idle_avg_ms"`
+	LatencyLoadedAvg *float64  `json:"latency_loaded_avg_ms"`
+}
+
+// rollups returns the aggregates matching q oldest first; rollups are per
+// server, so name, tags, after and limit are ignored
+func (h *historyDB) rollups(q historyQuery) ([]storedRollup, error) {
+	where := []string{"1"}
+	var args []any
+	if !q.since.IsZero() {
+		where = append(where, "start >= ?")
+		args = append(args, q.since.UnixMilli())
+	}
+	if !q.until.IsZero() {
+		where = append(where, "start < ?")
+		args = append(args, q.until.UnixMilli())
+	}
+	if q.server != "" {
+		where = append(where, "server = ?")
+		args = append(args, q.server)
+	}
+
+	rows, err := h.db.Query(`SELECT period, start, server, rounds, failed,
+	download_avg, download_min, download_max, upload_avg, upload_min, upload_max,
+	latency_idle_avg, latency_loaded_avg
+FROM rollups WHERE `+strings.Join(where, " AND ")+` ORDER BY start, server, period`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []storedRollup
+	for rows.Next() {
+		var (
+			r     storedRollup
+			start int64
+		)
+		err := rows.Scan(&r.Period, &start, &r.Server, &r.Rounds, &r.Failed,
+			&r.DownloadAvg, &r.DownloadMin, &r.DownloadMax, &r.UploadAvg, &r.UploadMin, &r.UploadMax,
+			&r.LatencyIdleAvg, &r.LatencyLoadedAvg)
+		if err != nil {
+			return nil, err
+		}
+		r.Start = time.UnixMilli(start)
+		out = append(out, r)
+	}
+	return out, rows.Err()
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"io"
+	"mime"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// serverName is the Server header of every ethspeed response. A client
+// can tell an older ethspeed server without /__info from a web server by
+// it.
+const serverName = "ethspeed"
+
+// withServerName sets the Server header of every response
+func withServerName(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Server", serverName)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// ============== CLIENT SIDE ==============
+
+// notEthspeedError is the answer of a server that is not an ethspeed
+// server, to /__info or to a transfer: a test against it would time its
+// error or index page
+type notEthspeedError struct {
+	Server      string
+	Path        string
+	StatusCode  int
+	Status      string
+	ContentType string
+	Title       string // of an HTML page
+	Software    string // Server header
+}
+
+func (e *notEthspeedError) Error() string {
+	var seen []string
+	if e.ContentType != "" {
+		seen = append(seen, e.ContentType)
+	}
+	if e.Title != "" {
+		seen = append(seen, fmt.Sprintf("%q", e.Title))
+	}
+	if e.Software != "" {
+		seen = append(seen, "Server: "+e.Software)
+	}
+	msg := fmt.Sprintf("%s does not look like an ethspeed server: %s answered %s", e.Server, e.Path, e.Status)
+	if len(seen) > 0 {
+		msg += " (" + strings.Join(seen, ", ") + ")"
+	}
+	if e.StatusCode == http.StatusUnauthorized {
+		return msg + "; for a server behind an authenticating proxy, pass its credentials with -auth-bearer or -auth-basic"
+	}
+	return msg + "; a test would measure that page, not the link. Check -server, or use -no-identity-check for a compatible server without " + infoPath
+}
+
+var titlePattern = regexp.MustCompile(`(?is)<title[^>]*>(.*?)</title>`)
+
+// checkIdentity tells a response to /__info that is no server info from an
+// older ethspeed server, which answers it with its Server header, and
+// returns a *notEthspeedError for anything else
+func checkIdentity(config Config, resp *http.Response, body []byte) error {
+	if strings.HasPrefix(resp.Header.Get("Server"), serverName) {
+		return nil
+	}
+	return newNotEthspeedError(config, resp, body)
+}
+
+func newNotEthspeedError(config Config, resp *http.Response, body []byte) *notEthspeedError {
+	e := &notEthspeedError{
+		Server:     config.Server,
+		Path:       resp.Request.URL.Path,
+		StatusCode: resp.StatusCode,
+		Status:     resp.Status,
+		Software:   resp.Header.Get("Server"),
+	}
+	e.ContentType, _, _ = mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if m := titlePattern.FindSubmatch(body); m != nil {
+		e.Title = strings.Join(strings.Fields(html.UnescapeString(string(m[1]))), " ")
+	}
+	return e
+}
+
+// unidentifiedServer is set when /__info was answered by something other
+// than an ethspeed server. A compatible server without /__info, such as
+// the default public one, is still measured; its transfers decide.
+var unidentifiedServer bool
+
+// checkTransfer refuses the answer to a transfer that is a web page rather
+// than test data: HTML, or an error status from an unidentified server
+func checkTransfer(config Config, resp *http.Response) error {
+	if config.NoIdentityCheck {
+		return nil
+	}
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	page := mediaType == "text/html" || mediaType == "application/xhtml+xml"
+	if !page && (resp.StatusCode/100 == 2 || !unidentifiedServer) {
+		return nil
+	}
+	return newNotEthspeedError(config, resp, readPrefix(resp.Body, 64*1024))
+}
+
+// readPrefix reads up to n bytes of r, for a look at a page
+func readPrefix(r io.Reader, n int64) []byte {
+	b, _ := io.ReadAll(io.LimitReader(r, n))
+	return b
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"container/list"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+)
+
+// idleConns follows the keep-alive connections waiting for their next
+// request, oldest first. Browser-based tests leave thousands of them on
+// busy public servers; past -max-idle-conns the one idle the longest is
+// closed, like http.Transport's MaxIdleConns on the client side.
+type idleConns struct {
+	max int // 0 for no limit
+
+	mu    sync.Mutex
+	order *list.List // of net.Conn, longest idle first
+	elems map[net.Conn]*list.Element
+
+	closed atomic.Int64 // connections closed for the limit
+}
+
+var serverIdle = newIdleConns(0)
+
+func newIdleConns(max int) *idleConns {
+	return &idleConns{max: max, order: list.New(), elems: make(map[net.Conn]*list.Element)}
+}
+
+// connState is used as http.Server.ConnState
+func (c *idleConns) connState(conn net.Conn, state http.ConnState) {
+	var evict net.Conn
+	c.mu.Lock()
+	if e, ok := c.elems[conn]; ok {
+		c.order.Remove(e)
+		delete(c.elems, conn)
+	}
+	if state == http.StateIdle {
+		c.elems[conn] = c.order.PushBack(conn)
+		if c.max > 0 && c.order.Len() > c.max {
+			evict = c.order.Remove(c.order.Front()).(net.Conn)
+			delete(c.elems, evict)
+		}
+	}
+	c.mu.Unlock()
+
+	if evict != nil {
+		c.closed.Add(1)
+		evict.Close()
+	}
+}
+
+// count returns the connections idle right now
+func (c *idleConns) count() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
@@ -0,0 +1,80 @@
+package main
+
+import "fmt"
+
+// ifaceCounters is what the kernel counted on the test interface while
+// the transfers ran, next to what the application transferred. Much more
+// on the interface than in the application means tunnel encapsulation,
+// retransmissions or traffic of other programs on the link.
+type ifaceCounters struct {
+	RxBytes int64 `json:"rx_bytes"`
+	TxBytes int64 `json:"tx_bytes"`
+
+	// Body bytes of the transfers: downloads received, uploads sent
+	AppRxBytes int64 `json:"app_rx_bytes"`
+	AppTxBytes int64 `json:"app_tx_bytes"`
+}
+
+// ifaceSnapshot holds the counters of an interface at the start of a test
+type ifaceSnapshot struct {
+	name   string
+	rx, tx int64
+}
+
+// snapshotInterface reads the counters of the named interface; nil where
+// the platform does not provide them
+func snapshotInterface(name string) *ifaceSnapshot {
+	if name == "" {
+		return nil
+	}
+	rx, tx, ok := interfaceBytes(name)
+	if !ok {
+		return nil
+	}
+	return &ifaceSnapshot{name: name, rx: rx, tx: tx}
+}
+
+// since returns the counter deltas from the snapshot to now, with the body
+// bytes of runs; nil when the interface is gone or the counters wrapped
+func (s *ifaceSnapshot) since(runs []runResult) *ifaceCounters {
+	if s == nil {
+		return nil
+	}
+	rx, tx, ok := interfaceBytes(s.name)
+	if !ok || rx < s.rx || tx < s.tx {
+		return nil
+	}
+	c := &ifaceCounters{RxBytes: rx - s.rx, TxBytes: tx - s.tx}
+	for _, run := range runs {
+		c.AppRxBytes += run.Download.bodyBytes()
+		c.AppTxBytes += run.Upload.bodyBytes()
+	}
+	return c
+}
+
+// bodyBytes returns the HTTP body bytes a transfer moved, compressed ones
+// included as sent; 0 for a direction not tested
+func (t *transferResult) bodyBytes() int64 {
+	switch {
+	case t == nil:
+		return 0
+	case t.WireBytes > 0:
+		return t.WireBytes
+	}
+	return t.Bytes
+}
+
+func (c *ifaceCounters) String() string {
+	return fmt.Sprintf("rx %s (app %s%s) | tx %s (app %s%s)",
+		formatBytes(c.RxBytes), formatBytes(c.AppRxBytes), excessNote(c.RxBytes, c.AppRxBytes),
+		formatBytes(c.TxBytes), formatBytes(c.AppTxBytes), excessNote(c.TxBytes, c.AppTxBytes))
+}
+
+// excessNote returns how much more the interface moved than the
+// application, as a percentage suffix
+func excessNote(iface, app int64) string {
+	if app == 0 {
+		return ""
+	}
+	return fmt.Sprintf(", %+.1f%%", (float64(iface)/float64(app)-1)*100)
+}
@@ -0,0 +1,23 @@
+package main
+
+import (
+	"os"
+	"strconv"
+	"strings"
+)
+
+// interfaceBytes reads the received and sent byte counters of an interface
+// from sysfs, the same counters /proc/net/dev shows
+func interfaceBytes(name string) (rx, tx int64, ok bool) {
+	read := func(counter string) (int64, bool) {
+		b, err := os.ReadFile("/sys/class/net/" + name + "/statistics/" + counter)
+		if err != nil {
+			return 0, false
+		}
+		n, err := strconv.ParseInt(strings.TrimSpace(string(b)), 10, 64)
+		return n, err == nil
+	}
+	rx, okRx := read("rx_bytes")
+	tx, okTx := read("tx_bytes")
+	return rx, tx, okRx && okTx
+}
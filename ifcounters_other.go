@@ -0,0 +1,8 @@
+//go:build !linux
+
+package main
+
+// interfaceBytes is only implemented on Linux
+func interfaceBytes(name string) (rx, tx int64, ok bool) {
+	return 0, 0, false
+}
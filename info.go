@@ -0,0 +1,177 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// infoPath is where the server advertises its limits and features
+const infoPath = "/__info"
+
+// Features a server can advertise at /__info
+const (
+	featurePayloads    = "payloads"     // random and 0xNN payloads
+	featurePayloadFile = "payload_file" // downloads of the server's -payload file:
+	featureVerify      = "verify"       // -verify chunk CRCs
+	featureWSPing      = "ws_ping"      // /__ws_ping, for ws-ping and -latency
+	featureOWD         = "owd"          // one-way delay stamps
+	featureClock       = "clock"        // /__time for the clock check
+	featureUDPEcho     = "udp_echo"
+	featureH3          = "h3" // HTTP/3 and QUIC datagrams on the tls: ports
+	featureServeFile   = "serve_file"
+	featureHistory     = "history" // /api/results
+	featureObjects     = "objects" // /__obj for -test rps
+	featureChunked     = "chunked" // downloads without Content-Length on request
+	featureGzip        = "gzip"    // compress=gzip downloads and the text payload
+	featureResults     = "results" // POST /__results stores client results
+	featureNonce       = "nonce"   // download responses echo the nonce of their URL
+)
+
+// serverInfo is the /__info document
+type serverInfo struct {
+	Version  string   `json:"version"`
+	Commit   string   `json:"commit,omitempty"`
+	MinBytes int64    `json:"min_bytes"`
+	MaxBytes int64    `json:"max_bytes"`
+	Features []string `json:"features"`
+
+	UDPEchoPort  int  `json:"udp_echo_port,omitempty"`
+	AuthRequired bool `json:"auth_required"` // test endpoints need a -token
+
+	// The server's -read-timeout and -write-timeout, 0 for none. An upload
+	// must arrive within the first, a download must be sent within the
+	// second, so together with MaxBytes they set the slowest link on
+	// which the largest transfer still completes.
+	ReadTimeoutSeconds  float64 `json:"read_timeout_seconds"`
+	WriteTimeoutSeconds float64 `json:"write_timeout_seconds"`
+
+	// The server's -stall-timeout, 0 for none: /__down and /__up outlive
+	// the timeouts above as long as data moves at least this often
+	StallTimeoutSeconds float64 `json:"stall_timeout_seconds"`
+
+	// The server's -max-test-duration, 0 for none: /__down and /__up end
+	// after this long, or the max_seconds they ask for if that is shorter
+	MaxTestSeconds float64 `json:"max_test_seconds"`
+}
+
+// newServerInfo describes what a server started with config offers
+func newServerInfo(config Config) *serverInfo {
+	info := &serverInfo{
+		Version:      build.Version,
+		Commit:       build.Commit,
+		MinBytes:     minBytes,
+		MaxBytes:     maxBytes,
+		Features:     []string{featurePayloads, featureVerify, featureWSPing, featureOWD, featureClock, featureObjects, featureChunked, featureGzip, featureNonce},
+		AuthRequired: config.AuthTokens != "",
+
+		ReadTimeoutSeconds:  config.ReadTimeout.Seconds(),
+		WriteTimeoutSeconds: config.WriteTimeout.Seconds(),
+		StallTimeoutSeconds: config.StallTimeout.Seconds(),
+		MaxTestSeconds:      config.MaxTestDuration.Seconds(),
+	}
+	if serverPayload.kind == payloadFile {
+		info.Features = append(info.Features, featurePayloadFile)
+	}
+	if config.UDPEcho != "" {
+		info.Features = append(info.Features, featureUDPEcho)
+		if _, port, err := net.SplitHostPort(config.UDPEcho); err == nil {
+			info.UDPEchoPort, _ = strconv.Atoi(port)
+		}
+	}
+	if config.H3 {
+		info.Features = append(info.Features, featureH3)
+	}
+	if config.ServeFile != "" {
+		info.Features = append(info.Features, featureServeFile)
+	}
+	if config.DB != "" {
+		info.Features = append(info.Features, featureHistory)
+		if config.AdminToken != "" || config.AuthTokens != "" {
+			info.Features = append(info.Features, featureResults)
+		}
+	}
+	return info
+}
+
+func infoHandler(info *serverInfo) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			httpError(w, codeMethodNotAllowed, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(info)
+	}
+}
+
+// ============== CLIENT SIDE ==============
+
+// fetchServerInfo asks the server for /__info. Older ethspeed servers
+// without it give nil and no error; anything else that is not an ethspeed
+// server gives a *notEthspeedError.
+func fetchServerInfo(config Config) (*serverInfo, error) {
+	req, err := http.NewRequest(http.MethodGet, config.endpointURL(infoPath), nil)
+	if err != nil {
+		return nil, err
+	}
+	config.authorize(req)
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body := readPrefix(resp.Body, 64*1024)
+	var info serverInfo
+	if resp.StatusCode != http.StatusOK || json.Unmarshal(body, &info) != nil || info.MaxBytes == 0 {
+		return nil, checkIdentity(config, resp, body)
+	}
+	return &info, nil
+}
+
+// negotiate checks the test config asks for against what the server
+// advertises, so an unsupported option fails before any transfer with a
+// clear message. It also fills in the UDP echo port the server listens on.
+func negotiate(config *Config, info *serverInfo) error {
+	has := func(f string) bool { return slices.Contains(info.Features, f) }
+	server := fmt.Sprintf("server %s (ethspeed %s)", config.Server, info.Version)
+
+	var missing []string
+	need := func(cond bool, feature, option string) {
+		if cond && !has(feature) {
+			missing = append(missing, option)
+		}
+	}
+	need(clientPayload.kind == payloadRandom || clientPayload.kind == payloadByte, featurePayloads, "-payload "+config.Payload)
+	need(clientPayload.kind == payloadFile && config.Direction != directionUp, featurePayloadFile, "-payload file: downloads (the server has no -payload file:)")
+	need(config.Verify, featureVerify, "-verify")
+	need(config.Chunked && config.Direction != directionUp, featureChunked, "-chunked")
+	need(config.Compress && config.Direction != directionUp, featureGzip, "-compress")
+	need(clientPayload.kind == payloadText && config.Direction != directionUp, featureGzip, "-payload text")
+	need(config.Latency || config.Test == testWSPing, featureWSPing, "WebSocket ping")
+	need(config.Test == testOWD, featureOWD, "-test owd")
+	need(config.Test == testRPS, featureObjects, "-test rps")
+	need(config.Test == testUDPEcho, featureUDPEcho, "-test udp-echo (the server has no -udp-echo)")
+	need(config.Test == testQUICDgram, featureH3, "-test quic-dgram (the server has no -h3)")
+	need(config.RemoteFile, featureServeFile, "-remote-file (the server has no -serve-file)")
+	need(config.Report, featureResults, "-report (the server has no -db, or neither -admin-token nor -auth-tokens)")
+	if len(missing) > 0 {
+		return fmt.Errorf("%s does not support %s", server, strings.Join(missing, ", "))
+	}
+
+	if config.Test == testSpeed && int64(config.Size)*1_000_000 > info.MaxBytes {
+		return &apiError{codeSizeOutOfRange, fmt.Sprintf("%s accepts at most %s per transfer, lower -s", server, formatBytes(info.MaxBytes))}
+	}
+	if info.AuthRequired && config.Token == "" {
+		return &apiError{codeUnauthorized, fmt.Sprintf("%s requires a test token, set -token", server)}
+	}
+
+	if config.Test == testUDPEcho && config.UDPEcho == "" && info.UDPEchoPort > 0 {
+		config.UDPEcho = ":" + strconv.Itoa(info.UDPEchoPort)
+	}
+	return nil
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+// resultsPath is where clients POST finished results for the server's -db
+const resultsPath = "/__results"
+
+// maxResultsBody caps a /__results upload; a report with per-interval
+// samples of many runs stays well below it
+const maxResultsBody = 8 << 20
+
+// uploader returns who is allowed to store results: the -admin-token
+// holder or an -auth-tokens account. ok is false without either.
+func uploader(r *http.Request, adminToken string) (who string, ok bool) {
+	if adminToken != "" && validBearer(r, adminToken) {
+		return "admin", true
+	}
+	if a := findToken(r); a != nil {
+		return a.name, true
+	}
+	return "", false
+}
+
+// ingestHandler serves POST /__results: the body is a speed test report
+// (-json, or the summary line of -format jsonl) or -watch -json rounds,
+// one or more JSON documents. -watch rounds do not name the server, it is
+// taken from the server parameter for them. Every run is stored as a round in the -db,
+// where /api/results and ethspeed export see it next to the server's own
+// history, marked with who sent it. Uploads need a bearer token: the
+// -admin-token or one of -auth-tokens; without either the endpoint is off.
+func ingestHandler(h *historyDB, adminToken string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if adminToken == "" && tokens == nil {
+			httpError(w, codeAdminDisabled, "result upload disabled, set -admin-token or -auth-tokens", http.StatusForbidden)
+			return
+		}
+		who, ok := uploader(r, adminToken)
+		if !ok {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="ethspeed"`)
+			httpError(w, codeUnauthorized, "missing or invalid token", http.StatusUnauthorized)
+			return
+		}
+		if r.Method != http.MethodPost {
+			httpError(w, codeMethodNotAllowed, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		rounds, err := decodeResults(http.MaxBytesReader(w, r.Body, maxResultsBody), r.URL.Query().Get("server"), time.Now())
+		if err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				httpError(w, codeSizeOutOfRange, fmt.Sprintf("results must be at most %s", formatBytes(maxResultsBody)), http.StatusRequestEntityTooLarge)
+				return
+			}
+			writeError(w, err, codeBadRequest, http.StatusBadRequest)
+			return
+		}
+		source := fmt.Sprintf("%s (%s)", who, clientAddr(r))
+		for _, sr := range rounds {
+			sr.ReportedBy = source
+			if err := h.record(sr.Server, sr.watchRound); err != nil {
+				logger.Printf("[RESULTS] %s - store: %v", clientAddr(r), err)
+				httpError(w, codeInternal, "storing results failed", http.StatusInternalServerError)
+				return
+			}
+		}
+		atomic.AddInt64(&stats.resultsIngested, int64(len(rounds)))
+		logger.Printf("[RESULTS] %s - stored %d rounds from %s", clientAddr(r), len(rounds), who)
+
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"ok":true,"stored":%d}`, len(rounds))
+	}
+}
+
+// decodeResults turns uploaded documents into rounds for the history; a
+// document without a server is taken as one against server, one without a
+// time gets received
+func decodeResults(body io.Reader, server string, received time.Time) ([]storedResult, error) {
+	var rounds []storedResult
+	dec := json.NewDecoder(body)
+	for n := 1; ; n++ {
+		var raw json.RawMessage
+		err := dec.Decode(&raw)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid result document %d: %w", n, err)
+		}
+
+		// A report has runs, a -watch round carries its transfers itself
+		var probe struct {
+			Server string          `json:"server"`
+			Runs   json.RawMessage `json:"runs"`
+		}
+		if err := json.Unmarshal(raw, &probe); err != nil {
+			return nil, fmt.Errorf("invalid result document %d: %w", n, err)
+		}
+		if probe.Server == "" {
+			probe.Server = server
+		}
+		if probe.Server == "" {
+			return nil, fmt.Errorf("result document %d has no server, pass ?server=", n)
+		}
+		if probe.Runs == nil {
+			var round watchRound
+			if err := json.Unmarshal(raw, &round); err != nil {
+				return nil, fmt.Errorf("invalid -watch round %d: %w", n, err)
+			}
+			if round.Time.IsZero() {
+				round.Time = received
+			}
+			rounds = append(rounds, storedResult{Server: probe.Server, watchRound: round})
+			continue
+		}
+
+		var report speedReport
+		if err := json.Unmarshal(raw, &report); err != nil {
+			return nil, fmt.Errorf("invalid report %d: %w", n, err)
+		}
+		base := watchRound{Time: report.Time, Name: report.Name, Note: report.Note, Tags: report.Tags,
+			Environment: report.Environment, Error: report.Error,
+			LatencyIdleMs: medianOf(report.LatencyIdleMs), LatencyLoadedMs: medianOf(report.LatencyLoadedMs)}
+		if base.Time.IsZero() {
+			base.Time = received
+		}
+		if len(report.Runs) == 0 {
+			// A test that failed before its first run
+			rounds = append(rounds, storedResult{Server: probe.Server, watchRound: base})
+		}
+		for _, run := range report.Runs {
+			round := base
+			round.runResult = run
+			if run.Error != "" {
+				round.Error = run.Error
+			}
+			rounds = append(rounds, storedResult{Server: probe.Server, watchRound: round})
+		}
+	}
+	if len(rounds) == 0 {
+		return nil, fmt.Errorf("no result documents in the body")
+	}
+	return rounds, nil
+}
+
+// ============== CLIENT SIDE ==============
+
+// reportResult uploads a finished report or -watch round to the tested
+// server's /__results, so the operator sees the client's side of the
+// measurement, latencies and Server-Timing included. It returns the number
+// of rounds the server stored.
+func reportResult(config Config, result any) (int, error) {
+	body, err := json.Marshal(result)
+	if err != nil {
+		return 0, err
+	}
+	// -watch rounds do not name the server
+	target := config.endpointURL(resultsPath) + "?server=" + url.QueryEscape(config.Server)
+	req, err := http.NewRequest(http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	config.authorize(req)
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, statusError(resp)
+	}
+	var reply struct {
+		Stored int `json:"stored"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&reply); err != nil {
+		return 0, fmt.Errorf("invalid reply: %w", err)
+	}
+	return reply.Stored, nil
+}
+
+// sendReport runs reportResult for a finished speed test and tells the
+// user how it went, on stderr with JSON output
+func sendReport(config Config, report *speedReport) {
+	out := os.Stdout
+	if config.JSON {
+		out = os.Stderr
+	}
+	stored, err := reportResult(config, report)
+	if err != nil {
+		fmt.Fprintf(out, "ERROR: report: %v\n", err)
+		noteFailure(err)
+		return
+	}
+	fmt.Fprintf(out, "Result reported to %s (%d rounds stored)\n", config.Server, stored)
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
+)
+
+// sweepTarget is an interface of an -all-interfaces sweep and the address
+// its tests are sent from
+type sweepTarget struct {
+	iface net.Interface
+	ip    net.IP
+}
+
+// sweepTargets lists the up, running, non-loopback interfaces with an
+// address of the server's family (IPv4 first for host names). Link-local
+// addresses are skipped: they only reach the local segment.
+func sweepTargets(server string) ([]sweepTarget, error) {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil, err
+	}
+	host, _, _ := strings.Cut(serverHost(server), "%")
+	literal := net.ParseIP(host)
+
+	var targets []sweepTarget
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagRunning == 0 || iface.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		var v4, v6 net.IP
+		for _, addr := range addrs {
+			ipnet, ok := addr.(*net.IPNet)
+			if !ok || !ipnet.IP.IsGlobalUnicast() {
+				continue
+			}
+			if ipnet.IP.To4() != nil {
+				if v4 == nil {
+					v4 = ipnet.IP
+				}
+			} else if v6 == nil {
+				v6 = ipnet.IP
+			}
+		}
+		ip := v4
+		switch {
+		case literal != nil && literal.To4() == nil:
+			ip = v6
+		case literal == nil && ip == nil:
+			ip = v6
+		}
+		if ip != nil {
+			targets = append(targets, sweepTarget{iface: iface, ip: ip})
+		}
+	}
+	return targets, nil
+}
+
+// bindTo points the test connections of config at the interface of t:
+// its source address, and the device itself on Linux and macOS, so the
+// traffic leaves through it whatever the default route is
+func (t sweepTarget) bindTo(config *Config) {
+	config.SourceIP = t.ip
+	config.SourceDevice = t.iface.Name
+	httpClient.Transport = newTransport(*config)
+}
+
+// unboundWarning is a warning for systems that cannot bind a socket to an
+// interface: a source address alone leaves traffic to the default route,
+// so another interface than t may carry the test. "" when t is safe.
+func (t sweepTarget) unboundWarning(server string) string {
+	if bindDeviceSupported {
+		return ""
+	}
+	egress, _ := egressInterface(server)
+	if egress == nil || egress.Name == t.iface.Name {
+		return ""
+	}
+	return fmt.Sprintf("WARNING: test connections cannot be bound to %s here, and the route to the server leaves through %s; the results may be those of %s",
+		t.iface.Name, egress.Name, egress.Name)
+}
+
+// runInterfaceSweep runs the speed test from each interface in turn, with
+// the test connections bound to it, and compares the results. Laptops
+// with Ethernet, Wi-Fi and a VPN up at once see which path is the fast
+// one. Where sockets cannot be bound to a device, the source address
+// picks the interface only where the routing follows it (the usual weak
+// host model and VPN split routes), and a warning says so.
+func runInterfaceSweep(config Config, clockOffset *float64) {
+	targets, err := sweepTargets(config.Server)
+	if err != nil {
+		fail(fmt.Errorf("list interfaces: %w", err))
+		return
+	}
+	if len(targets) == 0 {
+		fail(fmt.Errorf("no active non-loopback interface with an address to test from"))
+		return
+	}
+
+	// Checked in Config.validate
+	tags, _ := parseTags(config.Tags)
+
+	if !config.JSON {
+		names := make([]string, len(targets))
+		for i, t := range targets {
+			names[i] = t.iface.Name
+		}
+		fmt.Printf("Speed Test - %d MB per run from each of: %s\n", config.Size, strings.Join(names, ", "))
+		fmt.Printf("Server: %s\n\n", config.Server)
+	}
+
+	var reports []*speedReport
+	for i, t := range targets {
+		t.bindTo(&config)
+
+		report := &speedReport{
+			Time:          time.Now(),
+			Name:          config.Name,
+			Note:          config.Note,
+			Tags:          tags,
+			Environment:   describeEnvironment(&t.iface, t.ip),
+			Server:        config.Server,
+			SizeMB:        config.Size,
+			Direction:     config.Direction,
+			ClockOffsetMs: clockOffset,
+			Runs:          []runResult{},
+		}
+		reports = append(reports, report)
+		if !config.JSON {
+			fmt.Printf("== %s %s ==\n", t.iface.Name, t.ip)
+			if link := report.Environment.Link; link != nil {
+				fmt.Printf("Link: %s\n", link)
+			}
+			if wifi := report.Environment.WiFi; wifi != nil {
+				fmt.Printf("Wi-Fi: %s\n", wifi)
+			}
+		}
+		if warning := t.unboundWarning(config.Server); warning != "" {
+			out := os.Stdout
+			if config.JSON {
+				out = os.Stderr
+			}
+			fmt.Fprintln(out, warning)
+		}
+
+		if err := runSpeedTests(config, report); err != nil && !config.JSON {
+			fmt.Printf("ERROR: %v\n\n", err)
+		}
+		if config.Report {
+			sendReport(config, report)
+		}
+		if i < len(targets)-1 {
+			time.Sleep(500 * time.Millisecond)
+		}
+	}
+
+	if config.JSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(struct {
+			Interfaces []*speedReport `json:"interfaces"`
+		}{reports})
+		return
+	}
+	printInterfaceComparison(reports)
+}
+
+// printInterfaceComparison prints the averages of every interface of a
+// sweep side by side
+func printInterfaceComparison(reports []*speedReport) {
+	heading := "Interface comparison"
+	if unit := displayUnit.label(); unit != "" {
+		heading += " (" + unit + ")"
+	}
+	fmt.Println(heading + ":")
+	fmt.Printf("%-16s %-26s %-8s %s\n", "interface", "address", "down", "up")
+	fmt.Println(strings.Repeat("-", 61))
+	for _, r := range reports {
+		env := r.Environment
+		if r.Error != "" {
+			fmt.Printf("%-16s %-26s ERROR: %s\n", env.Interface, env.LocalIP, r.Error)
+			continue
+		}
+		down, up := "-", "-"
+		if r.Direction != directionUp {
+			down = displayUnit.cell(r.AvgDownloadMbps)
+		}
+		if r.Direction != directionDown {
+			up = displayUnit.cell(r.AvgUploadMbps)
+		}
+		fmt.Printf("%-16s %-26s %-8s %s\n", env.Interface, env.LocalIP, down, up)
+	}
+	fmt.Println()
+}
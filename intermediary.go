@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// nonceHeader echoes the nonce of a download request. A response without it
+// was not produced by the ethspeed server for this request.
+const nonceHeader = "Ethspeed-Nonce"
+
+// echoNonce answers test requests with the nonce their URL carries
+func echoNonce(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if n := r.URL.Query().Get(nonceParam); validRequestID(n) {
+			w.Header().Set(nonceHeader, n)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// ============== CLIENT SIDE ==============
+
+// serverEchoesNonce is set when the server advertises featureNonce; older
+// servers do not echo it, and its absence proves nothing then
+var serverEchoesNonce bool
+
+// proxyHeaders are added by caches, CDNs and forward proxies, never by the
+// ethspeed server
+var proxyHeaders = []string{
+	"Via", "Age", "X-Cache", "X-Cache-Status", "X-Cache-Hits", "CF-Cache-Status",
+	"X-Served-By", "X-Proxy-Cache", "X-Squid-Error",
+}
+
+// detectIntermediary looks for signs that a download was answered or
+// altered by something between the client and the server: the nonce not
+// echoed, a body of another length than announced, or proxy headers. body
+// is the bytes received as sent, before any decompression.
+func detectIntermediary(req *http.Request, resp *http.Response, body int64) []string {
+	var signs []string
+	if sent := req.URL.Query().Get(nonceParam); sent != "" && serverEchoesNonce {
+		switch got := resp.Header.Get(nonceHeader); got {
+		case sent:
+		case "":
+			signs = append(signs, "the nonce was not echoed")
+		default:
+			signs = append(signs, "the echoed nonce belongs to another request")
+		}
+	}
+	if resp.ContentLength >= 0 && resp.ContentLength != body {
+		signs = append(signs, fmt.Sprintf("received %s of a Content-Length of %s",
+			formatByteCount(body), formatByteCount(resp.ContentLength)))
+	}
+	for _, h := range proxyHeaders {
+		if v := resp.Header.Get(h); v != "" {
+			signs = append(signs, h+": "+v)
+		}
+	}
+	return signs
+}
+
+// printIntermediaries warns about every transfer that appears to have been
+// served by an intermediary: its speed is that of a cache or proxy, not of
+// the path to the ethspeed server
+func (r *speedReport) printIntermediaries() {
+	for i, run := range r.Runs {
+		if run.Download != nil && len(run.Download.Intermediary) > 0 {
+			fmt.Printf("WARNING: download %d appears to have been served by a proxy or cache, not the ethspeed server (%s)\n",
+				i+1, strings.Join(run.Download.Intermediary, "; "))
+		}
+	}
+}
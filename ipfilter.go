@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// ipFilter is the -allow/-deny access list of the test endpoints. The most
+// specific matching prefix decides, -allow winning ties; addresses matching
+// neither are allowed only when no -allow prefixes are given.
+type ipFilter struct {
+	allow []netip.Prefix
+	deny  []netip.Prefix
+}
+
+// accessList is the server's ipFilter; nil allows every address
+var accessList *ipFilter
+
+// parseIPFilter parses -allow and -deny values: CIDR prefixes or single addresses
+func parseIPFilter(allow, deny []string) (*ipFilter, error) {
+	if len(allow) == 0 && len(deny) == 0 {
+		return nil, nil
+	}
+	parse := func(values []string) ([]netip.Prefix, error) {
+		prefixes := make([]netip.Prefix, 0, len(values))
+		for _, v := range values {
+			p, err := netip.ParsePrefix(v)
+			if err != nil {
+				addr, addrErr := netip.ParseAddr(v)
+				if addrErr != nil {
+					return nil, fmt.Errorf("invalid address or CIDR '%s'", v)
+				}
+				p = netip.PrefixFrom(addr, addr.BitLen())
+			}
+			prefixes = append(prefixes, p.Masked())
+		}
+		return prefixes, nil
+	}
+
+	f := &ipFilter{}
+	var err error
+	if f.allow, err = parse(allow); err != nil {
+		return nil, err
+	}
+	if f.deny, err = parse(deny); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// longestMatch returns the length of the longest prefix containing addr, or -1
+func longestMatch(prefixes []netip.Prefix, addr netip.Addr) int {
+	best := -1
+	for _, p := range prefixes {
+		if p.Bits() > best && p.Contains(addr) {
+			best = p.Bits()
+		}
+	}
+	return best
+}
+
+func (f *ipFilter) allows(addr netip.Addr) bool {
+	if f == nil {
+		return true
+	}
+	addr = addr.Unmap()
+	allow, deny := longestMatch(f.allow, addr), longestMatch(f.deny, addr)
+	if allow < 0 && deny < 0 {
+		return len(f.allow) == 0
+	}
+	return allow >= deny
+}
+
+// allowsNetAddr checks the address of a UDP or QUIC peer
+func (f *ipFilter) allowsNetAddr(a net.Addr) bool {
+	if f == nil {
+		return true
+	}
+	ap, err := netip.ParseAddrPort(a.String())
+	return err == nil && f.allows(ap.Addr())
+}
+
+// requestIP returns the client address of r. On unix socket listeners it is
+// taken from the reverse proxy's headers, as in clientAddr.
+func requestIP(r *http.Request) (netip.Addr, bool) {
+	s := r.RemoteAddr
+	if host, _, err := net.SplitHostPort(s); err == nil {
+		s = host
+	} else if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
+		s, _, _ = strings.Cut(xff, ",")
+	} else {
+		s = r.Header.Get("X-Real-IP")
+	}
+	addr, err := netip.ParseAddr(strings.TrimSpace(s))
+	return addr, err == nil
+}
+
+// filterIP rejects requests from addresses outside the -allow/-deny list
+func filterIP(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if accessList != nil {
+			if addr, ok := requestIP(r); !ok || !accessList.allows(addr) {
+				logger.Printf("[DENY] %s %s%s", clientAddr(r), r.URL.Path, requestIDNote(r))
+				httpError(w, codeForbidden, "forbidden", http.StatusForbidden)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
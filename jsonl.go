@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+)
+
+// Values of -format
+const (
+	formatText  = "text"
+	formatJSON  = "json"
+	formatJSONL = "jsonl"
+)
+
+// events streams -format jsonl output: every throughput sample, every
+// finished transfer and the final summary, one JSON object per line as it
+// happens. nil without -format jsonl; its methods are no-ops then.
+var events *eventStream
+
+type eventStream struct {
+	mu   sync.Mutex
+	enc  *json.Encoder
+	runs map[string]int // finished transfers per direction
+}
+
+func newEventStream(w io.Writer) *eventStream {
+	return &eventStream{enc: json.NewEncoder(w), runs: map[string]int{}}
+}
+
+// sampleEvent is one throughputWindow of a running transfer
+type sampleEvent struct {
+	Type      string    `json:"type"` // "sample"
+	Time      time.Time `json:"time"`
+	Direction string    `json:"direction"`
+	Run       int       `json:"run"`
+	Index     int       `json:"index"`
+	Mbps      float64   `json:"mbps"`
+}
+
+// phaseEvent is a finished transfer with its timings
+type phaseEvent struct {
+	Type      string    `json:"type"` // "phase"
+	Time      time.Time `json:"time"`
+	Direction string    `json:"direction"`
+	Run       int       `json:"run"`
+	*transferResult
+}
+
+func (s *eventStream) emit(v any) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// Encode writes each value with a trailing newline in one call
+	s.enc.Encode(v)
+}
+
+// sampler returns the hook for a throughputMeter of a transfer in
+// direction, or nil without a stream
+func (s *eventStream) sampler(direction string) func(index int, mbps float64) {
+	if s == nil {
+		return nil
+	}
+	return func(index int, mbps float64) {
+		s.mu.Lock()
+		run := s.runs[direction] + 1
+		s.mu.Unlock()
+		s.emit(sampleEvent{Type: "sample", Time: time.Now(), Direction: direction, Run: run, Index: index, Mbps: mbps})
+	}
+}
+
+// sampler returns the hook for a throughputMeter of a transfer in
+// direction: onSample when set, the event stream otherwise
+func (c *Config) sampler(direction string) func(index int, mbps float64) {
+	if c.onSample != nil {
+		return func(index int, mbps float64) { c.onSample(direction, index, mbps) }
+	}
+	return events.sampler(direction)
+}
+
+// phase reports a finished transfer in direction
+func (s *eventStream) phase(direction string, res *transferResult) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.runs[direction]++
+	run := s.runs[direction]
+	s.mu.Unlock()
+	s.emit(phaseEvent{Type: "phase", Time: time.Now(), Direction: direction, Run: run, transferResult: res})
+}
+
+// summary reports the final speed test report
+func (s *eventStream) summary(report *speedReport) {
+	s.emit(struct {
+		Type string `json:"type"` // "summary"
+		*speedReport
+	}{"summary", report})
+}
+
+// round reports a finished -watch round
+func (s *eventStream) round(r watchRound) {
+	s.emit(struct {
+		Type string `json:"type"` // "round"
+		watchRound
+	}{"round", r})
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// limitChunk is the most a limited connection reads or writes at once,
+	// so the pacing is smooth rather than a socket buffer at a time
+	limitChunk = 16 * 1024
+	// limitSlack is how far a pacer may fall behind and still catch up,
+	// which makes up for sleeps that overshoot; a pacer further behind was
+	// idle and starts afresh rather than sending a burst
+	limitSlack = 50 * time.Millisecond
+	// limitSustained is the share of -limit an average must reach to count
+	// as sustained
+	limitSustained = 0.95
+)
+
+// pacer spreads bytes at a fixed rate over all connections sharing it.
+// next is the time the bytes passed so far are due by.
+type pacer struct {
+	mu          sync.Mutex
+	bytesPerSec float64
+	next        time.Time
+}
+
+func newPacer(mbps float64) *pacer {
+	return &pacer{bytesPerSec: mbps * 1_000_000 / 8}
+}
+
+// wait blocks until n more bytes fit the rate, but not past deadline
+// (unless zero) or once closed is closed: the connection's own I/O then
+// fails as it would have without the limit
+func (p *pacer) wait(n int, deadline time.Time, closed <-chan struct{}) {
+	if n <= 0 {
+		return
+	}
+	p.mu.Lock()
+	now := time.Now()
+	if p.next.Before(now.Add(-limitSlack)) {
+		p.next = now
+	}
+	p.next = p.next.Add(time.Duration(float64(n) / p.bytesPerSec * float64(time.Second)))
+	due := p.next
+	p.mu.Unlock()
+
+	if !deadline.IsZero() && deadline.Before(due) {
+		due = deadline
+	}
+	d := time.Until(due)
+	if d <= 0 {
+		return
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-closed:
+	}
+}
+
+// bandwidthLimit is the -limit of the client: separate pacers for what it
+// sends and what it reads, each at the full rate, shared by all test
+// connections so parallel streams stay under the cap together
+type bandwidthLimit struct {
+	send, recv *pacer
+}
+
+// clientLimit paces the test connections of the client (-limit); nil for
+// no cap
+var clientLimit *bandwidthLimit
+
+func newBandwidthLimit(mbps float64) *bandwidthLimit {
+	return &bandwidthLimit{send: newPacer(mbps), recv: newPacer(mbps)}
+}
+
+// wrap returns conn with its reads and writes paced; conn as it is
+// without a limit
+func (l *bandwidthLimit) wrap(conn net.Conn) net.Conn {
+	if l == nil {
+		return conn
+	}
+	return &limitedConn{Conn: conn, limit: l, closed: make(chan struct{})}
+}
+
+// limitedConn paces a connection. Reading slower than the server sends
+// fills the receive window, and TCP flow control then slows the server
+// down to the limit. The pauses keep to the connection's deadlines and
+// end when it is closed.
+type limitedConn struct {
+	net.Conn
+	limit *bandwidthLimit
+
+	mu                          sync.Mutex
+	readDeadline, writeDeadline time.Time
+
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+func (c *limitedConn) Read(p []byte) (int, error) {
+	if len(p) > limitChunk {
+		p = p[:limitChunk]
+	}
+	n, err := c.Conn.Read(p)
+	c.mu.Lock()
+	deadline := c.readDeadline
+	c.mu.Unlock()
+	c.limit.recv.wait(n, deadline, c.closed)
+	return n, err
+}
+
+func (c *limitedConn) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		chunk := p[:min(len(p), limitChunk)]
+		c.mu.Lock()
+		deadline := c.writeDeadline
+		c.mu.Unlock()
+		c.limit.send.wait(len(chunk), deadline, c.closed)
+		n, err := c.Conn.Write(chunk)
+		written += n
+		if err != nil {
+			return written, err
+		}
+		p = p[n:]
+	}
+	return written, nil
+}
+
+func (c *limitedConn) Close() error {
+	c.closeOnce.Do(func() { close(c.closed) })
+	return c.Conn.Close()
+}
+
+func (c *limitedConn) SetDeadline(t time.Time) error {
+	c.mu.Lock()
+	c.readDeadline, c.writeDeadline = t, t
+	c.mu.Unlock()
+	return c.Conn.SetDeadline(t)
+}
+
+func (c *limitedConn) SetReadDeadline(t time.Time) error {
+	c.mu.Lock()
+	c.readDeadline = t
+	c.mu.Unlock()
+	return c.Conn.SetReadDeadline(t)
+}
+
+func (c *limitedConn) SetWriteDeadline(t time.Time) error {
+	c.mu.Lock()
+	c.writeDeadline = t
+	c.mu.Unlock()
+	return c.Conn.SetWriteDeadline(t)
+}
+
+// printLimit shows how close the averages came to the -limit, which tells
+// whether the path sustains that rate. The cap is shared by concurrent
+// runs, so their aggregate is compared with it.
+func (r *speedReport) printLimit() {
+	if r.LimitMbps == 0 {
+		return
+	}
+	down, up := r.AvgDownloadMbps, r.AvgUploadMbps
+	if r.Concurrency > 1 {
+		down, up = r.AggregateDownloadMbps, r.AggregateUploadMbps
+	}
+	var parts, short []string
+	for _, d := range []struct {
+		name string
+		mbps float64
+	}{{"down", down}, {"up", up}} {
+		if d.mbps == 0 {
+			continue
+		}
+		parts = append(parts, fmt.Sprintf("%s %.1f%%", d.name, d.mbps/r.LimitMbps*100))
+		if d.mbps < r.LimitMbps*limitSustained {
+			short = append(short, d.name)
+		}
+	}
+	fmt.Printf("Limit: %s per direction, paced by the client", displayUnit.format(r.LimitMbps))
+	if len(parts) > 0 {
+		fmt.Printf(" | %s of it", strings.Join(parts, " | "))
+	}
+	fmt.Println()
+	if len(short) > 0 {
+		fmt.Printf("WARNING: %s averaged below %.0f%% of the limit; the path does not sustain %s\n",
+			strings.Join(short, " and "), limitSustained*100, displayUnit.format(r.LimitMbps))
+	}
+}
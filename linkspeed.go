@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// linkInfo is the negotiated state of the egress NIC
+type linkInfo struct {
+	SpeedMbps int64  `json:"speed_mbps"`
+	Duplex    string `json:"duplex,omitempty"` // "full" or "half"
+
+	// Fastest mode the NIC supports, when the OS tells
+	MaxSpeedMbps int64 `json:"max_speed_mbps,omitempty"`
+}
+
+func (l *linkInfo) String() string {
+	s := fmt.Sprintf("%d Mbps", l.SpeedMbps)
+	if l.Duplex != "" {
+		s += " " + l.Duplex + " duplex"
+	}
+	return s
+}
+
+// linkPercent returns mbps as a percentage of the link speed, 0 when the
+// speed is unknown or nothing was measured
+func linkPercent(mbps float64, link *linkInfo) float64 {
+	if link == nil || mbps == 0 {
+		return 0
+	}
+	return mbps / float64(link.SpeedMbps) * 100
+}
+
+// printLink prints the averages as a share of the link speed and warns
+// about a port that negotiated below its capabilities
+func (r *speedReport) printLink() {
+	if r.Environment == nil || r.Environment.Link == nil {
+		return
+	}
+	link, name := r.Environment.Link, r.Environment.Interface
+
+	var parts []string
+	if r.DownloadLinkPercent > 0 {
+		parts = append(parts, fmt.Sprintf("down %.1f%%", r.DownloadLinkPercent))
+	}
+	if r.UploadLinkPercent > 0 {
+		parts = append(parts, fmt.Sprintf("up %.1f%%", r.UploadLinkPercent))
+	}
+	fmt.Printf("Link: %s %s", name, link)
+	if len(parts) > 0 {
+		fmt.Printf(" | %s of link speed", strings.Join(parts, " | "))
+	}
+	fmt.Println()
+
+	if link.MaxSpeedMbps > link.SpeedMbps {
+		fmt.Printf("WARNING: %s negotiated %d Mbps but supports %d Mbps; check the cable, the switch port and autonegotiation\n",
+			name, link.SpeedMbps, link.MaxSpeedMbps)
+	}
+	if link.Duplex == "half" {
+		fmt.Printf("WARNING: %s is at half duplex; a duplex mismatch with the switch means collisions and poor throughput\n", name)
+	}
+	fmt.Println()
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"net"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// linkSpeed reads the negotiated speed and duplex from sysfs and the
+// supported modes with the ethtool ioctl; nil for virtual NICs and links
+// that are down, which report a speed of -1
+func linkSpeed(iface *net.Interface) *linkInfo {
+	dir := "/sys/class/net/" + iface.Name + "/"
+	b, err := os.ReadFile(dir + "speed")
+	if err != nil {
+		return nil
+	}
+	speed, err := strconv.ParseInt(strings.TrimSpace(string(b)), 10, 64)
+	if err != nil || speed <= 0 {
+		return nil
+	}
+
+	link := &linkInfo{SpeedMbps: speed, MaxSpeedMbps: ethtoolMaxSpeed(iface.Name)}
+	if b, err := os.ReadFile(dir + "duplex"); err == nil {
+		if d := strings.TrimSpace(string(b)); d == "full" || d == "half" {
+			link.Duplex = d
+		}
+	}
+	return link
+}
+
+// ethtoolCmd is struct ethtool_cmd from linux/ethtool.h (ETHTOOL_GSET)
+type ethtoolCmd struct {
+	cmd, supported, advertising uint32
+
+	speed                                                   uint16
+	duplex, port, phyAddress, transceiver, autoneg, mdioSup uint8
+	maxTxPkt, maxRxPkt                                      uint32
+	speedHi                                                 uint16
+	mdix, mdixCtrl                                          uint8
+	lpAdvertising                                           uint32
+	reserved                                                [2]uint32
+}
+
+// ethtoolModeSpeeds maps the SUPPORTED_* bits of ethtool_cmd to Mbps
+var ethtoolModeSpeeds = map[uint]int64{
+	0: 10, 1: 10, // 10baseT half/full
+	2: 100, 3: 100, // 100baseT half/full
+	4: 1000, 5: 1000, // 1000baseT half/full
+	12: 10000,            // 10000baseT full
+	15: 2500,             // 2500baseX full
+	17: 1000,             // 1000baseKX full
+	18: 10000, 19: 10000, // 10000baseKX4/KR full
+	21: 20000, 22: 20000, // 20000baseMLD2/KR2 full
+	23: 40000, 24: 40000, 25: 40000, 26: 40000, // 40000baseKR4/CR4/SR4/LR4 full
+}
+
+// ethtoolMaxSpeed returns the fastest link mode the NIC supports, 0 when
+// the driver does not say (ETHTOOL_GSET needs no privileges)
+func ethtoolMaxSpeed(name string) int64 {
+	fd, err := unix.Socket(unix.AF_INET, unix.SOCK_DGRAM|unix.SOCK_CLOEXEC, 0)
+	if err != nil {
+		return 0
+	}
+	defer unix.Close(fd)
+
+	cmd := ethtoolCmd{cmd: unix.ETHTOOL_GSET}
+	var ifr struct {
+		name [unix.IFNAMSIZ]byte
+		data uintptr
+		_    [16]byte
+	}
+	copy(ifr.name[:unix.IFNAMSIZ-1], name)
+	ifr.data = uintptr(unsafe.Pointer(&cmd))
+	_, _, errno := unix.Syscall(unix.SYS_IOCTL, uintptr(fd), unix.SIOCETHTOOL, uintptr(unsafe.Pointer(&ifr)))
+	runtime.KeepAlive(&cmd)
+	if errno != 0 {
+		return 0
+	}
+
+	var max int64
+	for bit, speed := range ethtoolModeSpeeds {
+		if cmd.supported&(1<<bit) != 0 && speed > max {
+			max = speed
+		}
+	}
+	return max
+}
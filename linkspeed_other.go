@@ -0,0 +1,66 @@
+//go:build !linux && !windows
+
+package main
+
+import (
+	"context"
+	"net"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// mediaSpeed matches the speed of an ifconfig media type such as
+// 1000baseT, 100baseTX or 10Gbase-T
+var mediaSpeed = regexp.MustCompile(`(?i)\b(\d+)(g?)base`)
+
+// linkSpeed parses the active and supported media of "ifconfig -m" on
+// macOS and the BSDs; nil for Wi-Fi and other links without a media speed
+func linkSpeed(iface *net.Interface) *linkInfo {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, "ifconfig", "-m", iface.Name).Output()
+	if err != nil {
+		return nil
+	}
+
+	var link linkInfo
+	for _, line := range strings.Split(string(out), "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(line, "media:"):
+			// media: autoselect (1000baseT <full-duplex,flow-control>)
+			active := line
+			if i := strings.Index(line, "("); i >= 0 {
+				active = line[i:]
+			}
+			link.SpeedMbps = parseMediaSpeed(active)
+			if strings.Contains(active, "full-duplex") {
+				link.Duplex = "full"
+			} else if strings.Contains(active, "half-duplex") {
+				link.Duplex = "half"
+			}
+		case strings.HasPrefix(line, "media "):
+			// media 1000baseT mediaopt full-duplex (supported media)
+			link.MaxSpeedMbps = max(link.MaxSpeedMbps, parseMediaSpeed(line))
+		}
+	}
+	if link.SpeedMbps == 0 {
+		return nil
+	}
+	return &link
+}
+
+func parseMediaSpeed(s string) int64 {
+	m := mediaSpeed.FindStringSubmatch(s)
+	if m == nil {
+		return 0
+	}
+	n, _ := strconv.ParseInt(m[1], 10, 64)
+	if m[2] != "" {
+		n *= 1000
+	}
+	return n
+}
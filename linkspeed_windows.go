@@ -0,0 +1,33 @@
+package main
+
+import (
+	"net"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// linkSpeed returns the transmit speed Windows reports for the adapter;
+// duplex and supported modes are not exposed by GetAdaptersAddresses
+func linkSpeed(iface *net.Interface) *linkInfo {
+	size := uint32(16 * 1024)
+	for {
+		buf := make([]byte, size)
+		first := (*windows.IpAdapterAddresses)(unsafe.Pointer(&buf[0]))
+		err := windows.GetAdaptersAddresses(windows.AF_UNSPEC, windows.GAA_FLAG_SKIP_ANYCAST|windows.GAA_FLAG_SKIP_MULTICAST|windows.GAA_FLAG_SKIP_DNS_SERVER, 0, first, &size)
+		if err == windows.ERROR_BUFFER_OVERFLOW {
+			continue
+		}
+		if err != nil {
+			return nil
+		}
+		for a := first; a != nil; a = a.Next {
+			// ^0 means unknown
+			if a.IfIndex != uint32(iface.Index) || a.TransmitLinkSpeed == 0 || a.TransmitLinkSpeed == ^uint64(0) {
+				continue
+			}
+			return &linkInfo{SpeedMbps: int64(a.TransmitLinkSpeed / 1_000_000)}
+		}
+		return nil
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Kinds of per-request log lines that -log-sample thins out and
+// -log-summary counts, in the order of the summary line
+const (
+	logDownload = iota
+	logUpload
+	logFile
+	logWS
+	logDgram
+	numTestLogKinds
+)
+
+var (
+	testLogKinds = [numTestLogKinds]string{"DOWNLOAD", "UPLOAD", "FILE", "WS", "DGRAM"}
+	testLogNouns = [numTestLogKinds]string{"downloads", "uploads", "files", "WebSocket ping sessions", "QUIC datagram sessions"}
+)
+
+// testLog is the server's -log-sample and -log-summary. At thousands of
+// tests a minute a line per test fills disks, so successful tests can be
+// logged 1 in N and/or as one aggregate line per interval. Errors, denials
+// and corruption are never thinned out: they are logged with logger.
+var testLog = struct {
+	sample int64 // log 1 in sample, 0 for none
+	seen   [numTestLogKinds]atomic.Int64
+
+	mu      sync.Mutex
+	summary bool
+	counts  [numTestLogKinds]int64
+	bytes   [numTestLogKinds]int64
+}{sample: 1}
+
+// logTest logs the line of a successful test of one of the kinds above,
+// subject to -log-sample, and counts it and its bytes for -log-summary
+func logTest(kind int, n int64, format string, args ...any) {
+	if testLog.summary {
+		testLog.mu.Lock()
+		testLog.counts[kind]++
+		testLog.bytes[kind] += n
+		testLog.mu.Unlock()
+	}
+	if testLog.sample == 0 || (testLog.seen[kind].Add(1)-1)%testLog.sample != 0 {
+		return
+	}
+	logger.Printf("["+testLogKinds[kind]+"] "+format, args...)
+}
+
+// logSummaries writes the -log-summary line every interval, skipping
+// intervals without tests
+func logSummaries(interval time.Duration) {
+	for range time.Tick(interval) {
+		testLog.mu.Lock()
+		counts, bytes := testLog.counts, testLog.bytes
+		testLog.counts, testLog.bytes = [numTestLogKinds]int64{}, [numTestLogKinds]int64{}
+		testLog.mu.Unlock()
+
+		var parts []string
+		for i, noun := range testLogNouns {
+			if counts[i] == 0 {
+				continue
+			}
+			part := fmt.Sprintf("%d %s", counts[i], noun)
+			if bytes[i] > 0 {
+				part += " (" + formatBytes(bytes[i]) + ")"
+			}
+			parts = append(parts, part)
+		}
+		if len(parts) > 0 {
+			logger.Printf("[SUMMARY] last %v: %s", interval, strings.Join(parts, ", "))
+		}
+	}
+}
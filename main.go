@@ -2,35 +2,65 @@ package main
 
 import (
 	"bytes"
+	"cmp"
+	"compress/gzip"
 	"context"
+	"crypto/subtle"
+	"crypto/tls"
 	"embed"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
 	"io/fs"
 	"log"
+	"math/rand/v2"
+	"net"
 	"net/http"
+	"net/http/httptrace"
+	"net/url"
 	"os"
 	"os/signal"
+	"runtime"
+	"slices"
 	"strconv"
 	"strings"
 	"sync"
 	"sync/atomic"
 	"syscall"
 	"time"
+
+	"github.com/quic-go/quic-go"
 )
 
 const (
 	// Buffer sizes
-	downloadBufferSize = 1024 * 1024      // 1MB chunks for downloads
-	minBytes           = 1 * 1024 * 1024  // 1MB minimum
-	maxBytes           = 10 * 1024 * 1024 * 1024 // 10GB maximum
-
-	// Timeouts
-	defaultReadTimeout  = 30 * time.Second
-	defaultWriteTimeout = 30 * time.Second
+	downloadBufferSize = 1024 * 1024    // 1MB chunks for downloads
+	minBytes           = 1_000_000      // 1MB minimum
+	maxBytes           = 10_000_000_000 // 10GB maximum
+
+	// Timeouts. The server's read and write defaults let a maxBytes
+	// transfer finish at about 100 Mbps.
+	defaultReadTimeout  = 15 * time.Minute
+	defaultWriteTimeout = 15 * time.Minute
+	defaultIdleTimeout  = 2 * time.Minute
+	defaultStallTimeout = 30 * time.Second
 	defaultHTTPTimeout  = 5 * time.Minute
 
+	// Request headers arrive in one packet or two; a client that needs
+	// longer is a slowloris or broken
+	defaultReadHeaderTimeout = 10 * time.Second
+	defaultMaxHeaderBytes    = 64 * 1024
+
+	// How long an -expect-continue upload waits for 100 Continue before
+	// sending the body anyway; a -queue wait comes before the 100
+	expectContinueTimeout = 30 * time.Second
+
+	// QUIC datagrams must fit into the minimum QUIC packet size
+	maxDgramSize = 1150
+
 	// Modes
 	modeClient = "client"
 	modeServer = "server"
@@ -39,22 +69,233 @@ const (
 	directionDown = "down"
 	directionUp   = "up"
 	directionBoth = "both"
+
+	// Client tests
+	testSpeed     = "speed"
+	testQUICDgram = "quic-dgram"
+	testWSPing    = "ws-ping"
+	testUDPEcho   = "udp-echo"
+	testOWD       = "owd"
+	testRPS       = "rps"
+
+	testTLSHandshake = "tls-handshake"
+	testConnRate     = "conn-rate"
 )
 
 // Config represents application configuration
 type Config struct {
 	// Common
+	Version   bool   // print the build info and exit
 	Mode      string // "client" or "server"
 	Direction string // "down", "up", or "both"
 
+	LogSyslog         string // "local", "udp://host:port" or "tcp://host:port", empty for stdout
+	LogSyslogFacility string // syslog facility name
+
+	LogSample  int           // server: log 1 in N successful tests, 0 for none
+	LogSummary time.Duration // server: one aggregate line of the tests per interval, 0 for none
+
+	Payload string // "zeros", "random", "text", "0xNN" or "file:path"; client: uploads and requested downloads, server: default downloads
+	Chunked bool   // downloads without Content-Length; client: requested, server: for every download
+
+	Compress bool // request gzipped downloads and report wire throughput next to goodput
+
+	Unit   string // speeds shown in "mbps", "MBps" or "auto"
+	Binary bool   // 1024-based prefixes for speeds and sizes instead of 1000
+
+	Precision   int  // decimals of displayed speeds and sizes, -1 for the defaults
+	GroupDigits bool // thousands separators and decimal mark of the locale
+
+	DB string // SQLite results file; client: -watch rounds are stored, server: served at /api/results
+
+	// History retention, applied by -watch after each round
+	Retain     time.Duration // age after which rounds are pruned, 0 to keep them
+	RetainRows int           // rounds kept at most, 0 for no limit
+	Rollup     string        // "hourly" or "daily" aggregates of pruned rounds, empty to drop them
+
+	// Test socket options
+	SndBuf     int    // SO_SNDBUF in bytes, 0 for kernel default
+	RcvBuf     int    // SO_RCVBUF in bytes, 0 for kernel default
+	NoDelay    bool   // TCP_NODELAY; false enables Nagle
+	Congestion string // TCP congestion control algorithm (Linux only)
+	MPTCP      bool   // use Multipath TCP (Linux only)
+
 	// Client-specific
-	Count  int    // number of speed tests
-	Size   int    // file size in MB
-	Server string // server address
+	Count    int    // number of speed tests
+	Size     int    // file size in MB
+	Server   string // server address
+	Test     string // "speed", "quic-dgram", "ws-ping", "udp-echo", "owd", "rps", "tls-handshake" or "conn-rate"
+	TLS      bool   // use HTTPS (and wss) for HTTP-based tests
+	Insecure bool   // skip TLS certificate verification
+	Token    string // bearer token for servers with -auth-tokens
+	Latency  bool   // measure WebSocket RTT idle and under load during speed tests
+	Verify   bool   // check payload integrity with per-chunk CRCs
+	JSON     bool   // print the speed test report as JSON; set by -format json and jsonl too
+	Format   string // "text", "json" or "jsonl"
+
+	ExpectContinue bool // send uploads with Expect: 100-continue
+	Preconnect     bool // set up each transfer's connection before its clock starts
+	FromFirstByte  bool // start the throughput clock at the first payload byte
+	MTU            int  // packet size the on-the-wire estimate assumes
+
+	TLSClientCert string // client certificate for servers with -tls-client-ca
+	TLSClientKey  string // its private key
+
+	Concurrency int // -c iterations run at the same time, each over its own connections
+	Retries     int // times a failed sequential -c iteration is run again
+
+	KeepGoing bool // record a failed iteration and go on with the batch
+
+	AllInterfaces bool   // repeat the test from every active interface
+	SourceIP      net.IP // local address test connections are bound to; set per interface by AllInterfaces
+	SourceDevice  string // interface they are bound to as well, where the OS allows it
+
+	ComparePhysical bool // repeat the test bound to a physical interface when the route is a tunnel
+
+	Tags []string // key=value labels stored with every result
+	Name string   // session name stored with every result, e.g. "after router firmware 1.2"
+	Note string   // free-form note stored with every result
+
+	Report bool // upload results to the tested server's /__results
+
+	Profile     string // CPU profile file of the client run, empty for none
+	HeapProfile string // heap profile file written after the client run, empty for none
+
+	MaxClockSkew time.Duration // warn when the client clock is further off the server's, 0 to skip the check
+
+	RemoteFile bool // download the server's -serve-file instead of generated data
+	AllowCache bool // leave out the cache-busting nonce and no-transform of downloads
+
+	NoIdentityCheck bool // test a server that does not identify as ethspeed
+
+	// Credentials for a server behind an authenticating reverse proxy, sent
+	// with every request
+	AuthBearer string // bearer token
+	AuthBasic  string // user:password
+
+	CookieJar bool     // keep the cookies servers set for the rest of the run
+	Cookies   []string // cookies sent from the start, "name=value"
+
+	Limit float64 // Mbps the client sends and reads at most in each direction, 0 for no cap
+
+	// Test endpoints, for compatible servers on other URLs
+	DownPath   string // path of downloads, "/__down" on ethspeed servers
+	UpPath     string // path of uploads, "/__up" on ethspeed servers
+	BytesParam string // query parameter with the transfer size in bytes
+	DownURL    string // full download URL template for third-party servers, see expandURLTemplate
+	UpURL      string // full upload URL template
+
+	CompareProtocols bool // run the transfer over HTTP/1.1, HTTP/2 and HTTP/3 and compare
+
+	Plot       string // "", "ascii" (bars per run) or "gnuplot" (data file and script)
+	PlotPrefix string // path prefix of the -plot gnuplot files
+
+	// Continuous testing
+	Watch     bool          // keep testing until interrupted
+	Interval  time.Duration // time between test starts
+	Schedule  string        // cron expression for test starts, overrides Interval
+	WatchRows int           // results kept on screen
+
+	// Server name resolution in -watch mode
+	DNSTTL      time.Duration // pin the address of the first connection for this long
+	ResolveOnce bool          // pin it for the whole run
+	ReResolve   bool          // open new connections, and so look the name up again, every round
+
+	// Other traffic on the interface before a -watch round
+	SkipIfBusy float64       // Mbps in either direction above which the round is skipped
+	BusyWait   time.Duration // keep checking this long before skipping
+
+	// Alerting in -watch mode
+	Alerts        []string // rules such as "down < 100 for 3"
+	NotifyWebhook []string // URLs alert events are POSTed to as JSON
+	NotifyExec    []string // shell commands run for alert events
+
+	NotifySlack    []string // Slack incoming webhook URLs
+	NotifyDiscord  []string // Discord webhook URLs
+	NotifyTemplate string   // text/template for chat messages
+	NotifyResults  bool     // post every round's results to chat, not only alerts
+
+	NotifyEmail  []string // alert e-mail recipients
+	SMTPHost     string   // SMTP server host[:port], port 587 by default
+	SMTPUser     string   // SMTP username, empty for no authentication
+	SMTPPassword string   // SMTP password
+	SMTPFrom     string   // sender address, ethspeed@<hostname> by default
+	EmailSummary string   // time of day (HH:MM) for the daily summary mail, empty for none
+
+	GrafanaURL       string // Grafana base URL for test and alert annotations, empty for none
+	GrafanaToken     string // Grafana service account token
+	GrafanaDashboard string // dashboard UID for the annotations, empty for organization-wide
+
+	// Latency sampling (quic-dgram, ws-ping, udp-echo, -latency)
+	Samples        int           // number of probes
+	SampleInterval time.Duration // delay between probes
+	DgramSize      int           // probe size in bytes
+	UDPEcho        string        // server: UDP echo listen address; client: echo port or host:port
+
+	// Request and connection rate tests (rps, conn-rate)
+	Connections int           // parallel keep-alive connections (rps) or connecting workers (conn-rate)
+	Duration    time.Duration // how long the test runs
+	ObjectSize  int           // response size in bytes
+
+	Stress bool // saturate both directions over -connections transfers each for -duration
+
+	// Set by RunTest, sees every throughput sample in place of -output jsonl
+	onSample func(direction string, index int, mbps float64)
 
 	// Server-specific
-	Port string // listening port
-	Host string // listening host
+	Port    string   // listening port
+	Host    string   // listening host
+	Listen  []string // listen addresses, override Host/Port ("host:port", "tls:host:port", "unix:/path")
+	TLSCert string   // certificate file for tls: listeners
+	TLSKey  string   // private key file for tls: listeners
+
+	TLSMinVersion string   // minimum TLS version ("1.2", "1.3")
+	TLSCiphers    []string // allowed TLS 1.0-1.2 cipher suites, empty for Go defaults
+	TLSSelfSigned bool     // generate a self-signed certificate at startup
+	TLSCertCache  string   // file caching the self-signed certificate across restarts
+	TLSClientCA   string   // CA bundle client certificates must chain to (mTLS), empty for none
+
+	ReusePort int // SO_REUSEPORT sockets per TCP listener (0 = off, -1 = one per CPU)
+
+	AdminToken string // bearer token for admin endpoints such as /__drain
+	AuthTokens string // file of test tokens and quotas, empty for open test endpoints
+	ServeFile  string // file served at /__file for disk-to-network download tests
+	IPQuota    int64  // daily bytes per client IP (IPv6 /64), 0 for no limit
+
+	PayloadBlock int64 // random block precomputed for downloads, 0 to generate per request
+
+	Debug bool // log per-request details such as the copy path of /__file
+
+	MaxConcurrent int           // running transfers at most, 0 for no limit
+	Queue         int           // transfers waiting for a slot at most
+	QueueTimeout  time.Duration // longest wait in the queue
+
+	ReadTimeout  time.Duration // longest time to read a request, upload body included; 0 for none
+	WriteTimeout time.Duration // longest time from the end of the request headers to the end of the response; 0 for none
+	IdleTimeout  time.Duration // longest wait for the next request on a keep-alive connection
+	MaxIdleConns int           // keep-alive connections kept idle at most, 0 for no limit
+	NoKeepAlive  bool          // close HTTP/1.x connections after every response
+	StallTimeout time.Duration // /__down and /__up run on while data moves at least this often; 0 for the fixed timeouts
+
+	ReadHeaderTimeout time.Duration // longest time to read request headers, whatever the body timeouts
+	MaxHeaderBytes    int           // largest request header block
+	MaxHeaderConns    int           // connections still sending request headers at most, 0 for no limit
+
+	ShutdownTimeout time.Duration // how long running transfers may finish after a stop signal
+	MaxTestDuration time.Duration // client: max_seconds asked for per transfer; server: its ceiling; 0 for none
+
+	Allow []string // CIDRs allowed to use the test endpoints
+	Deny  []string // CIDRs denied the test endpoints; the most specific match wins
+
+	H3 bool // serve HTTP/3 and QUIC datagram tests on the UDP side of tls: listeners
+
+	SNMPListen    string // UDP address of the read-only SNMP agent, empty for none
+	SNMPCommunity string // SNMP v1/v2c community
+
+	GRPCListen string // TCP address of the gRPC control and stats API, empty for none
+
+	LatencyBuckets    string // bounds of the duration histograms, e.g. "10ms,100ms,1s"; empty for the defaults
+	ThroughputBuckets string // bounds of the throughput histogram in Mbps, e.g. "1,10,100"; empty for the defaults
 }
 
 // ServerStats tracks server statistics with thread-safe operations
@@ -69,12 +310,46 @@ type ServerStats struct {
 	lastRequestTime   time.Time
 	peakConcurrent    int64
 	currentConcurrent int64
+	currentQueued     int64 // transfers waiting for -max-concurrent
+	peakQueued        int64
+	queueRejected     int64 // transfers refused with a full queue or after -queue-timeout
+	corruptChunks     int64 // -verify upload chunks that failed their CRC
+	resultsIngested   int64 // rounds stored through /__results
+	truncated         int64 // /__down and /__up cut short by their time limit
+
+	requestSizes *histogram // requested bytes per transfer
+	durations    *histogram // seconds per completed transfer
+	concurrency  *histogram // transfers running when one starts
+	queueWaits   *histogram // seconds queued transfers waited
+	throughputs  *histogram // Mbps per completed transfer
+	tlsFull      *histogram // seconds per full TLS handshake
+	tlsResumed   *histogram // seconds per TLS handshake resuming a session
 }
 
 var (
 	stats = &ServerStats{
-		startTime: time.Now(),
+		startTime:    time.Now(),
+		requestSizes: newHistogram(sizeBuckets),
+		durations:    newHistogram(durationBuckets),
+		concurrency:  newHistogram(concurrencyBuckets),
+		queueWaits:   newHistogram(durationBuckets),
+		throughputs:  newHistogram(throughputBuckets),
+		tlsFull:      newHistogram(handshakeBuckets),
+		tlsResumed:   newHistogram(handshakeBuckets),
 	}
+	// serverChunked is the server's -chunked
+	serverChunked bool
+
+	// serverDebug is the server's -debug
+	serverDebug bool
+
+	// The server's -read-timeout, -write-timeout and -stall-timeout
+	serverReadTimeout, serverWriteTimeout, serverStallTimeout time.Duration
+
+	// draining is set while the server is being taken out of rotation:
+	// /readyz reports not ready, running transfers are left alone.
+	draining atomic.Bool
+
 	httpClient = &http.Client{
 		Timeout: defaultHTTPTimeout,
 	}
@@ -86,21 +361,87 @@ var (
 
 // main entry point
 func main() {
-	config := parseFlags()
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "service":
+			if err := runServiceCommand(os.Args[2:]); err != nil {
+				logger.Fatalf("service: %v", err)
+			}
+			return
+		case "install-service":
+			if err := runInstallService(os.Args[2:]); err != nil {
+				logger.Fatalf("install-service: %v", err)
+			}
+			return
+		case "export":
+			if err := runExport(os.Args[2:]); err != nil {
+				logger.Fatalf("export: %v", err)
+			}
+			return
+		}
+	}
+
+	config := parseFlags(os.Args[1:])
+
+	if config.Version {
+		fmt.Println(build)
+		return
+	}
 
 	if err := config.validate(); err != nil {
-		logger.Fatalf("Configuration error: %v", err)
+		logger.Printf("Configuration error: %v", err)
+		os.Exit(exitUsage)
+	}
+	setupDisplay(config)
+
+	if config.LogSyslog != "" {
+		if err := setupSyslog(config); err != nil {
+			logger.Fatalf("%v", err)
+		}
 	}
 
 	if config.Mode == modeServer {
-		runServer(config)
+		ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+		defer stop()
+		runServer(ctx, config)
 	} else {
 		runClient(config)
+		if clientExit != 0 {
+			os.Exit(clientExit)
+		}
 	}
 }
 
 // Config validation
 func (c *Config) validate() error {
+	if c.Congestion != "" && !congestionSupported {
+		return fmt.Errorf("-congestion is only supported on Linux")
+	}
+	if c.MPTCP && !mptcpSupported {
+		return fmt.Errorf("-mptcp is only supported on Linux")
+	}
+	if c.LogSyslog != "" {
+		if _, err := parseSyslogTarget(c.LogSyslog); err != nil {
+			return err
+		}
+		if _, ok := syslogFacilities[c.LogSyslogFacility]; !ok {
+			return fmt.Errorf("invalid log-syslog-facility '%s'", c.LogSyslogFacility)
+		}
+	}
+
+	if _, err := parsePayload(c.Payload); err != nil {
+		return err
+	}
+	if c.Unit != unitMbps && c.Unit != unitMBps && c.Unit != unitAuto {
+		return fmt.Errorf("invalid unit '%s', must be 'mbps', 'MBps' or 'auto'", c.Unit)
+	}
+	if c.Precision < -1 || c.Precision > 6 {
+		return fmt.Errorf("precision must be between 0 and 6, or -1 for the defaults, got %d", c.Precision)
+	}
+	if c.MaxTestDuration < 0 {
+		return fmt.Errorf("max-test-duration cannot be negative")
+	}
+
 	switch c.Mode {
 	case modeClient:
 		if c.Count < 1 {
@@ -112,10 +453,355 @@ func (c *Config) validate() error {
 		if !isValidDirection(c.Direction) {
 			return fmt.Errorf("invalid direction '%s', must be 'down', 'up', or 'both'", c.Direction)
 		}
-		if c.Server == "" {
+		if _, err := parseTags(c.Tags); err != nil {
+			return err
+		}
+		if c.Concurrency < 1 || c.Concurrency > c.Count {
+			return fmt.Errorf("concurrency must be between 1 and -c %d, got %d", c.Count, c.Concurrency)
+		}
+		if c.Concurrency > 1 && (c.Test != testSpeed || c.CompareProtocols || c.Watch || c.Format == formatJSONL) {
+			return fmt.Errorf("-concurrency only runs the iterations of a single -test speed, without -format jsonl")
+		}
+		if c.Retries < 0 {
+			return fmt.Errorf("retries cannot be negative, got %d", c.Retries)
+		}
+		if c.FromFirstByte && c.Direction == directionUp {
+			return fmt.Errorf("-from-first-byte only applies to downloads, an upload's first byte leaves with the request")
+		}
+		if c.KeepGoing && c.Concurrency > 1 {
+			return fmt.Errorf("-keep-going cannot be combined with -concurrency")
+		}
+		if c.Report && (c.Test != testSpeed || c.CompareProtocols) {
+			return fmt.Errorf("-report only uploads -test speed results")
+		}
+		if c.AllInterfaces && (c.Test != testSpeed || c.CompareProtocols || c.Watch || c.Latency || c.Format == formatJSONL || c.Plot != "") {
+			return fmt.Errorf("-all-interfaces only repeats a single -test speed, without -latency, -format jsonl or -plot")
+		}
+		if c.Stress {
+			if c.Test != testSpeed || c.CompareProtocols || c.Watch || c.AllInterfaces || c.ComparePhysical || c.Format == formatJSONL {
+				return fmt.Errorf("-stress replaces a single -test speed, without -watch, -all-interfaces, -compare-physical or -format jsonl")
+			}
+			if c.Connections < 1 {
+				return fmt.Errorf("connections must be at least 1, got %d", c.Connections)
+			}
+			if c.Duration <= 0 {
+				return fmt.Errorf("duration must be positive, got %v", c.Duration)
+			}
+		}
+		if c.ComparePhysical && (c.Test != testSpeed || c.CompareProtocols || c.Watch || c.AllInterfaces || c.Format == formatJSONL) {
+			return fmt.Errorf("-compare-physical only repeats a single -test speed, without -all-interfaces or -format jsonl")
+		}
+		for _, p := range []string{c.DownPath, c.UpPath} {
+			if !strings.HasPrefix(p, "/") {
+				return fmt.Errorf("endpoint path '%s' must start with /", p)
+			}
+		}
+		if _, err := parseCookies(c.Cookies); err != nil {
+			return err
+		}
+		// Only connections of dialContext are paced; the other tests
+		// measure latency or handshakes rather than throughput
+		if c.Limit > 0 && c.Test != testSpeed && c.Test != testRPS {
+			return fmt.Errorf("-limit applies to -test speed and rps only, not to -test %s", c.Test)
+		}
+		if c.Limit > 0 && c.CompareProtocols {
+			return fmt.Errorf("-limit cannot pace HTTP/3, so it cannot be combined with -compare-protocols")
+		}
+		if c.AuthBearer != "" && c.AuthBasic != "" {
+			return fmt.Errorf("-auth-bearer and -auth-basic cannot be combined")
+		}
+		if c.AuthBasic != "" && !strings.Contains(c.AuthBasic, ":") {
+			return fmt.Errorf("-auth-basic must be user:password")
+		}
+		if c.BytesParam == "" || strings.ContainsAny(c.BytesParam, "?&=#/ ") {
+			return fmt.Errorf("invalid bytes-param '%s'", c.BytesParam)
+		}
+		for _, t := range []struct{ flag, url string }{{"down-url", c.DownURL}, {"up-url", c.UpURL}} {
+			if t.url == "" {
+				continue
+			}
+			if err := checkURLTemplate(t.flag, t.url); err != nil {
+				return err
+			}
+			if c.Test != testSpeed || c.Verify || c.Compress || c.Chunked || c.RemoteFile || c.MaxTestDuration > 0 {
+				return fmt.Errorf("-%s only runs -test speed, without -verify, -compress, -chunked, -remote-file or -max-test-duration", t.flag)
+			}
+			if t.flag == "down-url" && c.Payload != "" {
+				return fmt.Errorf("-payload cannot be asked of a -down-url")
+			}
+		}
+		if c.RemoteFile && c.Verify {
+			return fmt.Errorf("-verify cannot check a -remote-file download")
+		}
+		switch c.Format {
+		case formatText, formatJSON:
+		case formatJSONL:
+			if c.Test != testSpeed || c.CompareProtocols {
+				return fmt.Errorf("-format jsonl only streams -test speed")
+			}
+		default:
+			return fmt.Errorf("invalid format '%s', must be 'text', 'json' or 'jsonl'", c.Format)
+		}
+		switch c.Plot {
+		case "", plotGnuplot:
+		case plotASCII:
+			if c.JSON {
+				return fmt.Errorf("-plot ascii cannot be used with JSON output")
+			}
+		default:
+			return fmt.Errorf("invalid plot '%s', must be 'ascii' or 'gnuplot'", c.Plot)
+		}
+		if c.Plot != "" && (c.Test != testSpeed || c.CompareProtocols || c.Watch) {
+			return fmt.Errorf("-plot only charts a single -test speed")
+		}
+		if c.RemoteFile && c.Compress {
+			return fmt.Errorf("-compress cannot be used with -remote-file")
+		}
+		switch c.Test {
+		case testSpeed, testWSPing, testOWD, testTLSHandshake:
+		case testQUICDgram, testUDPEcho:
+			if c.DgramSize > maxDgramSize {
+				return fmt.Errorf("dgram-size must be at most %d bytes, got %d", maxDgramSize, c.DgramSize)
+			}
+		case testRPS, testConnRate:
+			if c.Connections < 1 {
+				return fmt.Errorf("connections must be at least 1, got %d", c.Connections)
+			}
+			if c.Duration <= 0 {
+				return fmt.Errorf("duration must be positive, got %v", c.Duration)
+			}
+			if c.ObjectSize < 0 || c.ObjectSize > maxObjectSize {
+				return fmt.Errorf("object-size must be between 0 and %d bytes, got %d", maxObjectSize, c.ObjectSize)
+			}
+		default:
+			return fmt.Errorf("invalid test '%s', must be 'speed', 'quic-dgram', 'ws-ping', 'udp-echo', 'owd', 'rps', 'tls-handshake' or 'conn-rate'", c.Test)
+		}
+		if c.Samples < 1 {
+			return fmt.Errorf("samples must be at least 1, got %d", c.Samples)
+		}
+		if c.SampleInterval <= 0 {
+			return fmt.Errorf("sample-interval must be positive, got %v", c.SampleInterval)
+		}
+		if c.Server == "" || c.Server == srvPrefix {
 			return fmt.Errorf("server address cannot be empty")
 		}
+		if !strings.HasPrefix(c.Server, srvPrefix) {
+			check := *c
+			if err := check.resolveServer(); err != nil {
+				return err
+			}
+		}
+		if c.MaxClockSkew < 0 {
+			return fmt.Errorf("max-clock-skew cannot be negative, got %v", c.MaxClockSkew)
+		}
+		if c.MTU < 576 || c.MTU > 65535 {
+			return fmt.Errorf("mtu must be between 576 and 65535, got %d", c.MTU)
+		}
+		if (c.TLSClientCert == "") != (c.TLSClientKey == "") {
+			return fmt.Errorf("-tls-client-cert and -tls-client-key must be given together")
+		}
+		if c.TLSClientCert != "" {
+			if _, err := tls.LoadX509KeyPair(c.TLSClientCert, c.TLSClientKey); err != nil {
+				return fmt.Errorf("tls-client-cert: %w", err)
+			}
+		}
+		if c.Watch {
+			if c.Interval <= 0 {
+				return fmt.Errorf("interval must be positive, got %v", c.Interval)
+			}
+			if c.WatchRows < 1 {
+				return fmt.Errorf("watch-rows must be at least 1, got %d", c.WatchRows)
+			}
+			if c.Schedule != "" {
+				if _, err := parseCron(c.Schedule); err != nil {
+					return err
+				}
+			}
+		}
+		if c.Schedule != "" && !c.Watch {
+			return fmt.Errorf("-schedule requires -watch")
+		}
+		if c.DNSTTL < 0 {
+			return fmt.Errorf("dns-ttl cannot be negative, got %v", c.DNSTTL)
+		}
+		if (c.DNSTTL > 0 || c.ResolveOnce || c.ReResolve) && !c.Watch {
+			return fmt.Errorf("-dns-ttl, -resolve-once and -re-resolve require -watch")
+		}
+		if c.ReResolve && (c.DNSTTL > 0 || c.ResolveOnce) {
+			return fmt.Errorf("-re-resolve cannot be combined with -dns-ttl or -resolve-once")
+		}
+		if c.SkipIfBusy > 0 && !c.Watch {
+			return fmt.Errorf("-skip-if-busy requires -watch")
+		}
+		if c.BusyWait < 0 {
+			return fmt.Errorf("busy-wait cannot be negative, got %v", c.BusyWait)
+		}
+		if c.BusyWait > 0 && c.SkipIfBusy == 0 {
+			return fmt.Errorf("-busy-wait requires -skip-if-busy")
+		}
+		for _, a := range c.Alerts {
+			if _, err := parseAlertRule(a); err != nil {
+				return err
+			}
+		}
+		if c.DB != "" && !c.Watch {
+			return fmt.Errorf("-db requires -watch")
+		}
+		if (c.Retain > 0 || c.RetainRows != 0 || c.Rollup != "") && c.DB == "" {
+			return fmt.Errorf("-retain, -retain-rows and -rollup require -db")
+		}
+		if c.RetainRows < 0 {
+			return fmt.Errorf("retain-rows cannot be negative, got %d", c.RetainRows)
+		}
+		switch c.Rollup {
+		case "", rollupHourly, rollupDaily:
+		default:
+			return fmt.Errorf("invalid rollup '%s', must be 'hourly' or 'daily'", c.Rollup)
+		}
+		if c.Rollup != "" && c.Retain == 0 && c.RetainRows == 0 {
+			return fmt.Errorf("-rollup requires -retain or -retain-rows")
+		}
+		if len(c.Alerts) > 0 && !c.Watch {
+			return fmt.Errorf("-alert requires -watch")
+		}
+		if _, err := parseChatTemplate(c.NotifyTemplate); err != nil {
+			return err
+		}
+		if c.NotifyResults && len(c.NotifySlack)+len(c.NotifyDiscord) == 0 {
+			return fmt.Errorf("-notify-results requires -notify-slack or -notify-discord")
+		}
+		if len(c.NotifyEmail) > 0 && c.SMTPHost == "" {
+			return fmt.Errorf("-notify-email requires -smtp-host")
+		}
+		if c.EmailSummary != "" {
+			if len(c.NotifyEmail) == 0 {
+				return fmt.Errorf("-email-summary requires -notify-email")
+			}
+			if _, err := parseTimeOfDay(c.EmailSummary); err != nil {
+				return err
+			}
+		}
+		if c.GrafanaURL != "" {
+			if err := parseGrafanaURL(c.GrafanaURL); err != nil {
+				return err
+			}
+			if c.Test != testSpeed || c.CompareProtocols {
+				return fmt.Errorf("-grafana-url only annotates -test speed results")
+			}
+		}
 	case modeServer:
+		if c.ReusePort != 0 && !reusePortSupported {
+			return fmt.Errorf("-reuseport is only supported on Linux")
+		}
+		if c.ReusePort < -1 {
+			return fmt.Errorf("reuseport must be -1, 0 or a positive socket count, got %d", c.ReusePort)
+		}
+		if c.ServeFile != "" {
+			if err := checkServeFile(c.ServeFile); err != nil {
+				return err
+			}
+		}
+		if c.MaxConcurrent < 0 || c.Queue < 0 {
+			return fmt.Errorf("max-concurrent and queue cannot be negative")
+		}
+		if c.Queue > 0 && c.MaxConcurrent == 0 {
+			return fmt.Errorf("-queue requires -max-concurrent")
+		}
+		if c.MaxIdleConns < 0 {
+			return fmt.Errorf("max-idle-conns cannot be negative")
+		}
+		if c.ReadHeaderTimeout <= 0 {
+			return fmt.Errorf("read-header-timeout must be positive")
+		}
+		if c.MaxHeaderBytes < 4096 {
+			return fmt.Errorf("max-header-bytes must be at least 4K")
+		}
+		if c.MaxHeaderConns < 0 {
+			return fmt.Errorf("max-header-conns cannot be negative")
+		}
+		if c.ReadTimeout < 0 || c.WriteTimeout < 0 || c.IdleTimeout < 0 || c.StallTimeout < 0 || c.ShutdownTimeout < 0 {
+			return fmt.Errorf("read-timeout, write-timeout, idle-timeout, stall-timeout and shutdown-timeout cannot be negative")
+		}
+		if _, err := parseIPFilter(c.Allow, c.Deny); err != nil {
+			return err
+		}
+		if c.UDPEcho != "" {
+			if _, err := net.ResolveUDPAddr("udp", c.UDPEcho); err != nil {
+				return fmt.Errorf("invalid udp-echo address '%s': %v", c.UDPEcho, err)
+			}
+		}
+		if c.SNMPListen != "" {
+			if _, err := net.ResolveUDPAddr("udp", c.SNMPListen); err != nil {
+				return fmt.Errorf("invalid snmp-listen address '%s': %v", c.SNMPListen, err)
+			}
+			if c.SNMPCommunity == "" {
+				return fmt.Errorf("snmp-community cannot be empty")
+			}
+		}
+		if c.GRPCListen != "" {
+			if _, err := net.ResolveTCPAddr("tcp", c.GRPCListen); err != nil {
+				return fmt.Errorf("invalid grpc-listen address '%s': %v", c.GRPCListen, err)
+			}
+		}
+		if c.LatencyBuckets != "" {
+			if _, err := parseDurationBuckets(c.LatencyBuckets); err != nil {
+				return fmt.Errorf("latency-buckets: %w", err)
+			}
+		}
+		if c.ThroughputBuckets != "" {
+			if _, err := parseThroughputBuckets(c.ThroughputBuckets); err != nil {
+				return fmt.Errorf("throughput-buckets: %w", err)
+			}
+		}
+		if c.LogSample < 0 {
+			return fmt.Errorf("log-sample must not be negative")
+		}
+		if c.LogSummary < 0 {
+			return fmt.Errorf("log-summary must not be negative")
+		}
+		if c.PayloadBlock != 0 && (c.PayloadBlock < downloadBufferSize || c.PayloadBlock > maxPayloadBlock) {
+			return fmt.Errorf("payload-block must be between %s and %s", formatBytes(downloadBufferSize), formatBytes(maxPayloadBlock))
+		}
+		if len(c.Listen) > 0 {
+			for _, l := range c.Listen {
+				spec, err := parseListenAddr(l)
+				if err != nil {
+					return err
+				}
+				if spec.tls && !c.TLSSelfSigned && (c.TLSCert == "" || c.TLSKey == "") {
+					return fmt.Errorf("listener '%s' requires -tls-cert and -tls-key, or -tls-self-signed", l)
+				}
+			}
+			if c.H3 && !hasTLS(c.Listen) {
+				return fmt.Errorf("-h3 requires at least one tls: listener")
+			}
+			if c.TLSSelfSigned && (c.TLSCert != "" || c.TLSKey != "") {
+				return fmt.Errorf("-tls-self-signed cannot be combined with -tls-cert/-tls-key")
+			}
+			if c.TLSMinVersion != "" {
+				if _, err := parseTLSVersion(c.TLSMinVersion); err != nil {
+					return err
+				}
+			}
+			if _, err := parseCipherSuites(c.TLSCiphers); err != nil {
+				return err
+			}
+			if c.TLSClientCA != "" {
+				if !hasTLS(c.Listen) {
+					return fmt.Errorf("-tls-client-ca requires at least one tls: listener")
+				}
+				if _, err := loadClientCAs(c.TLSClientCA); err != nil {
+					return err
+				}
+			}
+			break
+		}
+		if c.H3 {
+			return fmt.Errorf("-h3 requires at least one tls: listener")
+		}
+		if c.TLSClientCA != "" {
+			return fmt.Errorf("-tls-client-ca requires at least one tls: listener")
+		}
 		if c.Port == "" || c.Port == "0" {
 			return fmt.Errorf("port cannot be empty")
 		}
@@ -128,15 +814,139 @@ func (c *Config) validate() error {
 	return nil
 }
 
+// socketOptions returns the options applied to test sockets
+func (c *Config) socketOptions() socketOptions {
+	return socketOptions{
+		SndBuf:     c.SndBuf,
+		RcvBuf:     c.RcvBuf,
+		Nagle:      !c.NoDelay,
+		Congestion: c.Congestion,
+		MPTCP:      c.MPTCP,
+		LocalIP:    c.SourceIP,
+		Device:     c.SourceDevice,
+	}
+}
+
+// newTransport returns an HTTP transport applying the test socket options
+func newTransport(config Config) *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = config.socketOptions().dialContext()
+	transport.TLSClientConfig = config.clientTLSConfig()
+	if config.ExpectContinue {
+		transport.ExpectContinueTimeout = expectContinueTimeout
+	}
+	return transport
+}
+
+// baseURL returns the scheme and address HTTP tests are sent to
+func (c *Config) baseURL() string {
+	// The zone of a link-local IPv6 address is escaped in URLs
+	server := strings.Replace(c.Server, "%", "%25", 1)
+	if c.TLS {
+		return "https://" + server
+	}
+	return "http://" + server
+}
+
+// endpointURL is the URL of an ethspeed endpoint such as /__info. Behind a
+// reverse proxy that prefixes the paths, the prefix of -down-path or
+// -up-path applies to it as well.
+func (c *Config) endpointURL(path string) string {
+	return c.baseURL() + c.pathPrefix() + path
+}
+
+// pathPrefix is what -down-path puts before /__down, or -up-path before
+// /__up; "" for paths that end otherwise
+func (c *Config) pathPrefix() string {
+	for _, p := range []struct{ path, endpoint string }{{c.DownPath, "/__down"}, {c.UpPath, "/__up"}} {
+		path, _, _ := strings.Cut(p.path, "?")
+		if prefix, ok := strings.CutSuffix(path, p.endpoint); ok {
+			return prefix
+		}
+	}
+	return ""
+}
+
+// downURL is the URL of a download of n bytes
+func (c *Config) downURL(n int64) string {
+	if c.DownURL != "" {
+		return expandURLTemplate(c.DownURL, n)
+	}
+	return c.transferURL(c.DownPath, n)
+}
+
+// upURL is the URL of an upload of n bytes
+func (c *Config) upURL(n int64) string {
+	if c.UpURL != "" {
+		return expandURLTemplate(c.UpURL, n)
+	}
+	return c.transferURL(c.UpPath, n)
+}
+
+// transferURL puts the size in the -bytes-param of path, which may have a
+// query of its own (-down-path, -up-path)
+func (c *Config) transferURL(path string, n int64) string {
+	sep := "?"
+	if strings.Contains(path, "?") {
+		sep = "&"
+	}
+	return fmt.Sprintf("%s%s%s%s=%d", c.baseURL(), path, sep, c.BytesParam, n)
+}
+
+// authorize adds the credentials of an authenticating reverse proxy
+// (-auth-bearer, -auth-basic) and the -token of the server, if any
+func (c *Config) authorize(req *http.Request) {
+	c.authorizeURL(req.URL, req.Header)
+}
+
+// authorizeURL is authorize for a request given as its URL and header.
+// When the proxy credentials take the Authorization header, the -token
+// goes in the token query parameter, which servers accept as well.
+func (c *Config) authorizeURL(u *url.URL, h http.Header) {
+	switch {
+	case c.AuthBearer != "":
+		h.Set("Authorization", "Bearer "+c.AuthBearer)
+	case c.AuthBasic != "":
+		h.Set("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(c.AuthBasic)))
+	case c.Token != "":
+		h.Set("Authorization", "Bearer "+c.Token)
+		return
+	}
+	if c.Token != "" {
+		// Appended as it is, a query of -down-url stays untouched
+		if u.RawQuery != "" {
+			u.RawQuery += "&"
+		}
+		u.RawQuery += "token=" + url.QueryEscape(c.Token)
+	}
+}
+
+// hasTLS reports whether any -listen value is a tls: listener
+func hasTLS(listen []string) bool {
+	for _, l := range listen {
+		if spec, err := parseListenAddr(l); err == nil && spec.tls {
+			return true
+		}
+	}
+	return false
+}
+
 func isValidDirection(d string) bool {
 	return d == directionDown || d == directionUp || d == directionBoth
 }
 
 // ============== SERVER IMPLEMENTATION ==============
 
-func runServer(config Config) {
-	addr := fmt.Sprintf("%s:%s", config.Host, config.Port)
-	logger.Printf("Starting speed test server on %s", addr)
+// runServer serves until ctx is cancelled, then shuts down gracefully
+func runServer(ctx context.Context, config Config) {
+	specs := []listenSpec{{network: "tcp", addr: fmt.Sprintf("%s:%s", config.Host, config.Port)}}
+	if len(config.Listen) > 0 {
+		specs = specs[:0]
+		for _, l := range config.Listen {
+			spec, _ := parseListenAddr(l)
+			specs = append(specs, spec)
+		}
+	}
 
 	mux := http.NewServeMux()
 
@@ -151,7 +961,7 @@ func runServer(config Config) {
 	mux.HandleFunc("/ethspeed", func(w http.ResponseWriter, r *http.Request) {
 		exe, err := os.Executable()
 		if err != nil {
-			http.Error(w, "cannot find executable", http.StatusInternalServerError)
+			httpError(w, codeInternal, "cannot find executable", http.StatusInternalServerError)
 			logger.Printf("os.Executable error: %v", err)
 			return
 		}
@@ -159,386 +969,1525 @@ func runServer(config Config) {
 		http.ServeFile(w, r, exe)
 	})
 
-	mux.HandleFunc("/__down", downloadHandler)
-	mux.HandleFunc("/__up", uploadHandler)
+	if config.AuthTokens != "" {
+		tokens, err = loadTokens(config.AuthTokens)
+		if err != nil {
+			logger.Fatalf("auth-tokens: %v", err)
+		}
+		logger.Printf("Test endpoints require a token (%d accounts)", len(tokens))
+	}
+
+	if config.IPQuota > 0 {
+		clientQuotas = newIPQuotas(config.IPQuota)
+		logger.Printf("Per-IP quota: %s per day", formatBytes(config.IPQuota))
+	}
+
+	if config.MaxConcurrent > 0 {
+		admit = newAdmission(config.MaxConcurrent, config.Queue, config.QueueTimeout)
+		logger.Printf("Transfers limited to %d at a time, %d queued", config.MaxConcurrent, config.Queue)
+	}
+
+	// Checked in Config.validate
+	accessList, _ = parseIPFilter(config.Allow, config.Deny)
+	serverPayload, _ = parsePayload(config.Payload)
+	if config.PayloadBlock > 0 {
+		payloadBlock = newPayloadBlock(config.PayloadBlock)
+		logger.Printf("Random downloads sliced from a %s precomputed block", formatBytes(config.PayloadBlock))
+	}
+	serverChunked = config.Chunked
+	serverDebug = config.Debug
+	testLog.sample = int64(config.LogSample)
+	if config.LogSummary > 0 {
+		testLog.summary = true
+		go logSummaries(config.LogSummary)
+	}
+	serverReadTimeout, serverWriteTimeout = config.ReadTimeout, config.WriteTimeout
+	serverStallTimeout = config.StallTimeout
+	serverMaxTest = config.MaxTestDuration
+
+	// Checked in Config.validate
+	if config.LatencyBuckets != "" {
+		bounds, _ := parseDurationBuckets(config.LatencyBuckets)
+		stats.durations, stats.queueWaits = newHistogram(bounds), newHistogram(bounds)
+	}
+	if config.ThroughputBuckets != "" {
+		bounds, _ := parseThroughputBuckets(config.ThroughputBuckets)
+		stats.throughputs = newHistogram(bounds)
+	}
+
+	// Test endpoints are subject to -allow/-deny and -auth-tokens, and
+	// closed during shutdown
+	testEndpoint := func(h http.Handler) http.Handler {
+		return withRequestID(echoNonce(refuseDuringShutdown(filterIP(tokenAuth(h)))))
+	}
+
+	// Only transfers queue: a -latency client keeps /__ws_ping open during them
+	mux.Handle("/__down", testEndpoint(admitTest(http.HandlerFunc(downloadHandler))))
+	mux.Handle("/__up", testEndpoint(admitTest(http.HandlerFunc(uploadHandler))))
+	if config.ServeFile != "" {
+		mux.Handle(serveFilePath, testEndpoint(admitTest(fileHandler(config.ServeFile))))
+		logger.Printf("Serving %s at %s", config.ServeFile, serveFilePath)
+	}
+	if config.DB != "" {
+		history, err := openHistory(config.DB)
+		if err != nil {
+			logger.Fatalf("%v", err)
+		}
+		defer history.Close()
+		mux.Handle("/api/results", filterIP(resultsHandler(history)))
+		mux.Handle(resultsPath, filterIP(ingestHandler(history, config.AdminToken)))
+		logger.Printf("Serving results from %s at /api/results", config.DB)
+	}
+	mux.HandleFunc(infoPath, infoHandler(newServerInfo(config)))
+	mux.HandleFunc("/__version", versionHandler)
+	mux.HandleFunc(timePath, timeHandler)
 	mux.HandleFunc("/__stats", statsHandler)
+	mux.HandleFunc("/metrics", metricsHandler)
+	mux.Handle("/__ws_ping", testEndpoint(wsPingHandler))
+	mux.Handle(objectPath, testEndpoint(http.HandlerFunc(objectHandler)))
 	mux.HandleFunc("/health", healthHandler)
+	mux.HandleFunc("/healthz", healthHandler)
+	mux.HandleFunc("/readyz", readyHandler)
+	mux.HandleFunc("/__drain", drainHandler(config.AdminToken))
 
 	server := &http.Server{
-		Addr:         addr,
-		Handler:      mux,
-		ReadTimeout:  defaultReadTimeout,
-		WriteTimeout: defaultWriteTimeout,
+		Handler:      withServerName(mux),
+		ReadTimeout:  config.ReadTimeout,
+		WriteTimeout: config.WriteTimeout,
+		IdleTimeout:  config.IdleTimeout,
+
+		// Slowloris: headers have to arrive quickly even though bodies
+		// may take -read-timeout
+		ReadHeaderTimeout: config.ReadHeaderTimeout,
+		MaxHeaderBytes:    config.MaxHeaderBytes,
 	}
 
-	// Graceful shutdown handling
-	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	server.ConnContext = config.socketOptions().connContext
+	serverIdle = newIdleConns(config.MaxIdleConns)
+	serverHeaders = newHeaderConns(config.MaxHeaderConns)
+	server.ConnState = func(c net.Conn, state http.ConnState) {
+		serverIdle.connState(c, state)
+		serverHeaders.connState(c, state)
+	}
+	if config.NoKeepAlive {
+		server.SetKeepAlivesEnabled(false)
+	}
 
+	// Cleartext HTTP/2 (prior knowledge) lets -compare-protocols separate
+	// HTTP/2 from TLS on plain listeners
+	server.Protocols = new(http.Protocols)
+	server.Protocols.SetHTTP1(true)
+	server.Protocols.SetHTTP2(true)
+	server.Protocols.SetUnencryptedHTTP2(true)
+
+	for _, spec := range specs {
+		if spec.tls {
+			tlsConfig, err := serverTLSConfig(config)
+			if err != nil {
+				logger.Fatalf("TLS configuration error: %v", err)
+			}
+			// What ServeTLS would offer for server.Protocols, set here so
+			// the per-handshake copies of timeHandshakes keep it
+			tlsConfig.NextProtos = []string{"h2", "http/1.1"}
+			timeHandshakes(tlsConfig)
+			server.TLSConfig = tlsConfig
+			break
+		}
+	}
+
+	var quicSrv *quicServer
+	if config.H3 {
+		quicSrv = newQUICServer(server.Handler, server.TLSConfig)
+		server.Handler = altSvcHandler(mux)
+	}
+	server.Handler = serverHeaders.served(server.Handler)
+
+	// Graceful shutdown handling
+	shutdownDone := make(chan struct{})
 	go func() {
-		<-sigChan
-		logger.Println("\nShutting down server gracefully...")
+		<-ctx.Done()
+		sdNotify("STOPPING=1")
+		shuttingDown.Store(true)
+
+		// The listeners stay open while running transfers finish, so new
+		// tests get a clear 503 instead of a refused connection
+		deadline := time.Now().Add(config.ShutdownTimeout)
+		if active := atomic.LoadInt64(&stats.currentConcurrent); active > 0 {
+			logger.Printf("Shutting down, waiting up to %v for %d running transfers...", config.ShutdownTimeout, active)
+		} else {
+			logger.Println("Shutting down...")
+		}
+		left := waitForTransfers(deadline)
+		if left > 0 {
+			logger.Printf("Shutdown timeout after %v, aborting %d running transfers", config.ShutdownTimeout, left)
+		}
+
+		if quicSrv != nil {
+			quicSrv.close()
+		}
 
-		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		shutdownCtx, cancel := context.WithDeadline(context.Background(), deadline)
 		defer cancel()
 
 		if err := server.Shutdown(shutdownCtx); err != nil {
-			logger.Printf("Server shutdown error: %v", err)
-			os.Exit(1)
+			// Cut-off transfers are logged above, this is any other request
+			if left == 0 {
+				logger.Printf("Shutdown timeout after %v, closing the remaining connections", config.ShutdownTimeout)
+			}
+			server.Close()
 		}
-		os.Exit(0)
+		close(shutdownDone)
 	}()
 
-	if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-		logger.Fatalf("Server error: %v", err)
+	reusePort := config.ReusePort
+	if reusePort == -1 {
+		reusePort = runtime.NumCPU()
+	}
+
+	// All listeners share one http.Server, so they share the mux, the
+	// stats and the shutdown path.
+	var listeners []listener
+	for _, spec := range specs {
+		sockets := 1
+		if spec.network == "tcp" && reusePort > 0 {
+			sockets = reusePort
+		}
+
+		for i := 0; i < sockets; i++ {
+			ln, err := listen(spec.network, spec.addr, sockets > 1, config.socketOptions())
+			if err != nil {
+				logger.Fatalf("Listen error on %s: %v", spec, err)
+			}
+			listeners = append(listeners, listener{spec, ln})
+		}
+
+		if sockets > 1 {
+			logger.Printf("Starting speed test server on %s (%d SO_REUSEPORT sockets)", spec, sockets)
+		} else {
+			logger.Printf("Starting speed test server on %s", spec)
+		}
 	}
+
+	var quicListeners []*quic.Listener
+	if quicSrv != nil {
+		for _, spec := range specs {
+			if !spec.tls {
+				continue
+			}
+			ln, err := quicSrv.listen(spec.addr)
+			if err != nil {
+				logger.Fatalf("Listen error on udp:%s: %v", spec.addr, err)
+			}
+			quicListeners = append(quicListeners, ln)
+			logger.Printf("Starting HTTP/3 and QUIC datagram server on udp:%s", spec.addr)
+		}
+	}
+
+	if config.UDPEcho != "" {
+		pc, err := net.ListenPacket("udp", config.UDPEcho)
+		if err != nil {
+			logger.Fatalf("Listen error on udp:%s: %v", config.UDPEcho, err)
+		}
+		logger.Printf("Starting UDP echo on udp:%s", pc.LocalAddr())
+		go serveUDPEcho(ctx, pc)
+	}
+
+	if config.SNMPListen != "" {
+		pc, err := net.ListenPacket("udp", config.SNMPListen)
+		if err != nil {
+			logger.Fatalf("Listen error on udp:%s: %v", config.SNMPListen, err)
+		}
+		logger.Printf("Starting SNMP agent on udp:%s (ETHSPEED-MIB at %s)", pc.LocalAddr(), formatOID(snmpEnterpriseOID))
+		go newSNMPAgent(config.SNMPCommunity).serve(ctx, pc)
+	}
+
+	if config.GRPCListen != "" {
+		ln, err := net.Listen("tcp", config.GRPCListen)
+		if err != nil {
+			logger.Fatalf("Listen error on %s: %v", config.GRPCListen, err)
+		}
+		logger.Printf("Starting gRPC API on %s", ln.Addr())
+		go serveGRPC(ctx, ln, config.AdminToken, server.TLSConfig)
+	}
+
+	for _, l := range listeners {
+		if tl, ok := l.ln.(*net.TCPListener); ok {
+			if info, err := readSocketInfo(tl); err == nil {
+				// TCP_NODELAY is set per accepted connection, not on the listener
+				info.NoDelay = config.NoDelay
+				logger.Printf("Socket options (effective): %s", info)
+				if config.MPTCP {
+					logger.Printf("Multipath TCP enabled, plain TCP clients fall back transparently")
+				}
+			}
+			break
+		}
+	}
+
+	sdNotify("READY=1")
+	go sdWatchdog(ctx)
+
+	errChan := make(chan error, len(listeners)+len(quicListeners))
+	for _, l := range listeners {
+		go func(l listener) {
+			if l.spec.tls {
+				errChan <- server.ServeTLS(l.ln, "", "")
+			} else {
+				errChan <- server.Serve(l.ln)
+			}
+		}(l)
+	}
+	for _, ln := range quicListeners {
+		go func(ln *quic.Listener) {
+			errChan <- quicSrv.serve(ln)
+		}(ln)
+	}
+
+	for range len(listeners) + len(quicListeners) {
+		if err := <-errChan; err != nil && err != http.ErrServerClosed {
+			logger.Fatalf("Server error: %v", err)
+		}
+	}
+	<-shutdownDone
+}
+
+// listenSpec describes one server socket parsed from a -listen value.
+type listenSpec struct {
+	network string // "tcp" or "unix"
+	addr    string
+	tls     bool
+}
+
+// listener is an open socket together with the spec it was created from.
+type listener struct {
+	spec listenSpec
+	ln   net.Listener
+}
+
+func (l listenSpec) String() string {
+	if l.tls {
+		return "tls:" + l.addr
+	}
+	return l.network + ":" + l.addr
+}
+
+// listen opens the server socket. Stale unix sockets left behind by a previous
+// run are removed first, and the new socket is made world-connectable so a
+// reverse proxy running as another user can reach it.
+func listen(network, addr string, reusePort bool, opts socketOptions) (net.Listener, error) {
+	if network != "unix" {
+		lc := net.ListenConfig{
+			Control: func(network, address string, c syscall.RawConn) error {
+				if reusePort {
+					if err := reusePortControl(network, address, c); err != nil {
+						return err
+					}
+				}
+				return opts.control(network, address, c)
+			},
+		}
+		lc.SetMultipathTCP(opts.MPTCP)
+		return lc.Listen(context.Background(), network, addr)
+	}
+
+	if fi, err := os.Stat(addr); err == nil && fi.Mode()&os.ModeSocket != 0 {
+		if err := os.Remove(addr); err != nil {
+			return nil, fmt.Errorf("remove stale socket: %w", err)
+		}
+	}
+
+	ln, err := net.Listen(network, addr)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(addr, 0o666); err != nil {
+		ln.Close()
+		return nil, fmt.Errorf("chmod socket: %w", err)
+	}
+	return ln, nil
 }
 
 // downloadHandler handles GET requests for download speed testing
 func downloadHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
-		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		httpError(w, codeMethodNotAllowed, "method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
 	numBytes, err := parseBytes(r)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		writeError(w, err, codeBadRequest, http.StatusBadRequest)
+		return
+	}
+
+	pattern, err := requestPayload(r)
+	if err != nil {
+		httpError(w, codeBadPayload, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	gzipped, err := requestCompression(r)
+	if err != nil {
+		httpError(w, codeUnsupportedEncoding, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	// Increment concurrent connections
-	atomic.AddInt64(&stats.currentConcurrent, 1)
-	defer atomic.AddInt64(&stats.currentConcurrent, -1)
+	limit, err := transferLimit(r)
+	if err != nil {
+		httpError(w, codeBadRequest, err.Error(), http.StatusBadRequest)
+		return
+	}
 
-	// Update peak concurrent
-	current := atomic.LoadInt64(&stats.currentConcurrent)
-	peak := atomic.LoadInt64(&stats.peakConcurrent)
-	for current > peak && !atomic.CompareAndSwapInt64(&stats.peakConcurrent, peak, current) {
-		peak = atomic.LoadInt64(&stats.peakConcurrent)
+	settle, ok := reserveTransfer(w, r, numBytes)
+	if !ok {
+		return
 	}
 
+	defer trackConcurrent()()
+	stats.requestSizes.observe(float64(numBytes))
+	start := time.Now()
+	timing := timingOf(r)
+
+	// Without a Content-Length the body streams in chunks (HTTP/1.1) or
+	// open-ended DATA frames (HTTP/2); some proxies buffer a fixed-length
+	// response whole, which hides how the link really streams. Nor is the
+	// length of a gzipped body known up front, or of one whose client asked
+	// for a time limit and so expects it to end early. Others keep their
+	// Content-Length; one cut off at the server's -max-test-duration ends
+	// with the connection instead.
+	chunked := serverChunked || r.URL.Query().Get("chunked") == "1" || gzipped || r.URL.Query().Has("max_seconds")
+
+	// The time spent sending the body can only follow it as a trailer,
+	// which HTTP/1.1 carries in chunked encoding only
+	trailers := acceptsTrailers(r) && (chunked || r.ProtoMajor >= 2)
+	verify := r.URL.Query().Get("verify") == "1"
+	if verify {
+		w.Header().Set(verifyHeader, "1")
+	}
 	w.Header().Set("Content-Type", "application/octet-stream")
-	w.Header().Set("Content-Length", strconv.FormatInt(numBytes, 10))
-	w.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
+	if gzipped {
+		w.Header().Set("Content-Encoding", compressGzip)
+	}
+	if !chunked {
+		w.Header().Set("Content-Length", strconv.FormatInt(numBytes, 10))
+	}
+	w.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate, no-transform")
+	w.Header().Set("Server-Timing", serverTiming(timingMetric{"queue", timing.queue}))
 
-	buffer := make([]byte, downloadBufferSize)
 	remaining := numBytes
+	var seq uint32
+	until := limitEnd(start, limit)
+	truncated := false
+
+	// Random data sliced from the -payload-block needs no filling at all,
+	// unless -verify writes its CRCs into it. Each download starts at a
+	// random offset, so parallel streams do not carry the same bytes.
+	var (
+		buffer []byte
+		src    io.Reader
+		block  []byte
+		off    int
+	)
+	if pattern.kind == payloadRandom && payloadBlock != nil && !verify {
+		block = payloadBlock
+		off = rand.IntN(len(block))
+	} else {
+		buffer = make([]byte, downloadBufferSize)
+		src = pattern.reader()
+		if pattern.static() {
+			io.ReadFull(src, buffer)
+		}
+	}
+
+	stall := newStallWriter(w)
+	defer stall.finish()
+
+	// Compressed on the fly; BestSpeed keeps the server's CPU from being
+	// the bottleneck on fast links
+	var out io.Writer = stall
+	var gz *gzip.Writer
+	if gzipped {
+		gz, _ = gzip.NewWriterLevel(stall, gzip.BestSpeed)
+		out = gz
+	}
 
 	for remaining > 0 {
+		if block != nil {
+			buffer = block[off:min(off+blockWriteSize, len(block))]
+			off = (off + len(buffer)) % len(block)
+		}
+		// The limit is checked between writes, then the body ends short of
+		// numBytes
+		if !until.IsZero() && !time.Now().Before(until) {
+			truncated = true
+			break
+		}
 		writeSize := int64(len(buffer))
 		if remaining < writeSize {
 			writeSize = remaining
 			buffer = buffer[:writeSize]
 		}
+		if block == nil && !pattern.static() {
+			io.ReadFull(src, buffer)
+		}
+		if verify {
+			seq = sealPayload(buffer, seq)
+		}
 
-		if _, err := w.Write(buffer); err != nil {
-			logger.Printf("Download write error for %s: %v", r.RemoteAddr, err)
+		if _, err := out.Write(buffer); err != nil {
+			logger.Printf("Download write error for %s%s: %v", clientAddr(r), requestIDNote(r), err)
+			settle(numBytes - remaining)
 			return
 		}
 
 		remaining -= writeSize
 	}
+	if gz != nil {
+		if err := gz.Close(); err != nil {
+			logger.Printf("Download write error for %s%s: %v", clientAddr(r), requestIDNote(r), err)
+			return
+		}
+	}
+
+	sent := numBytes - remaining
+	note := ""
+	if truncated {
+		settle(sent)
+		atomic.AddInt64(&stats.truncated, 1)
+		note = fmt.Sprintf(" (truncated after %v)", limit)
+	}
+	observeTransfer(sent, time.Since(start))
+	if trailers {
+		w.Header().Set(http.TrailerPrefix+"Server-Timing", serverTiming(
+			timingMetric{"gen", time.Since(start)}, timingMetric{"total", time.Since(timing.start)}))
+		if truncated {
+			w.Header().Set(http.TrailerPrefix+truncatedTrailer, "1")
+		}
+	}
 
 	// Update statistics
 	stats.mu.Lock()
 	stats.totalDownloads++
-	stats.totalBytesDown += numBytes
+	stats.totalBytesDown += sent
 	stats.lastRequestTime = time.Now()
 	stats.mu.Unlock()
 
-	logger.Printf("[DOWNLOAD] %s - %s", r.RemoteAddr, formatBytes(numBytes))
-}
+	logTest(logDownload, sent, "%s - %s%s%s%s", clientAddr(r), formatBytes(sent), note, mptcpNote(r), requestIDNote(r))
+}
+
+// uploadHandler handles POST requests for upload speed testing
+func uploadHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		httpError(w, codeMethodNotAllowed, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	expectedBytes, err := parseBytes(r)
+	if err != nil {
+		writeError(w, err, codeBadRequest, http.StatusBadRequest)
+		return
+	}
+
+	limit, err := transferLimit(r)
+	if err != nil {
+		httpError(w, codeBadRequest, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	settle, ok := reserveTransfer(w, r, expectedBytes)
+	if !ok {
+		return
+	}
+
+	defer trackConcurrent()()
+	stats.requestSizes.observe(float64(expectedBytes))
+	start := time.Now()
+	timing := timingOf(r)
+
+	var (
+		sink     io.Writer = io.Discard
+		verifier *chunkVerifier
+	)
+	if r.URL.Query().Get("verify") == "1" {
+		verifier = newChunkVerifier()
+		sink = verifier
+	}
+
+	body := newStallReader(w, r.Body, limitEnd(start, limit))
+	uploadedBytes, err := io.Copy(sink, body)
+	body.finish()
+	settle(uploadedBytes)
+	if err != nil && !body.truncated {
+		logger.Printf("Upload read error for %s%s: %v", clientAddr(r), requestIDNote(r), err)
+		httpError(w, codeInternal, "upload error", http.StatusInternalServerError)
+		return
+	}
+
+	// The client is still sending; the connection is closed after the reply
+	note, truncatedField := "", ""
+	if body.truncated {
+		atomic.AddInt64(&stats.truncated, 1)
+		note, truncatedField = fmt.Sprintf(" (truncated after %v)", limit), `,"truncated":true`
+	} else if uploadedBytes != expectedBytes {
+		logger.Printf("Warning: %s%s expected %s, received %s",
+			clientAddr(r), requestIDNote(r), formatByteCount(expectedBytes), formatByteCount(uploadedBytes))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Server-Timing", serverTiming(timingMetric{"queue", timing.queue},
+		timingMetric{"recv", time.Since(start)}, timingMetric{"total", time.Since(timing.start)}))
+	w.WriteHeader(http.StatusOK)
+	if verifier != nil {
+		integrity := verifier.finish()
+		atomic.AddInt64(&stats.corruptChunks, integrity.Corrupt)
+		if integrity.Corrupt > 0 {
+			logger.Printf("[CORRUPT] %s - upload: %s%s", clientAddr(r), integrity, requestIDNote(r))
+		}
+		fmt.Fprintf(w, `{"ok":true,"bytes":%d,"chunks":%d,"corrupt":%d%s,"request_id":"%s"}`,
+			uploadedBytes, integrity.Chunks, integrity.Corrupt, truncatedField, r.Header.Get(requestIDHeader))
+	} else {
+		fmt.Fprintf(w, `{"ok":true,"bytes":%d%s,"request_id":"%s"}`, uploadedBytes, truncatedField, r.Header.Get(requestIDHeader))
+	}
+
+	observeTransfer(uploadedBytes, time.Since(start))
+
+	// Update statistics
+	stats.mu.Lock()
+	stats.totalUploads++
+	stats.totalBytesUp += uploadedBytes
+	stats.totalConnections++
+	stats.lastRequestTime = time.Now()
+	stats.mu.Unlock()
+
+	logTest(logUpload, uploadedBytes, "%s - %s%s%s%s", clientAddr(r), formatBytes(uploadedBytes), note, mptcpNote(r), requestIDNote(r))
+}
+
+// statsHandler returns server statistics
+func statsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		httpError(w, codeMethodNotAllowed, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	stats.mu.RLock()
+	totalDownloads := stats.totalDownloads
+	totalUploads := stats.totalUploads
+	totalBytesDown := stats.totalBytesDown
+	totalBytesUp := stats.totalBytesUp
+	totalConnections := stats.totalConnections
+	uptime := time.Since(stats.startTime)
+	lastRequest := stats.lastRequestTime
+	peakConcurrent := stats.peakConcurrent
+	stats.mu.RUnlock()
+
+	histograms, _ := json.MarshalIndent(map[string]histogramSnapshot{
+		"request_bytes":      stats.requestSizes.snapshot(),
+		"duration_seconds":   stats.durations.snapshot(),
+		"concurrency":        stats.concurrency.snapshot(),
+		"queue_wait_seconds": stats.queueWaits.snapshot(),
+		"throughput_mbps":    stats.throughputs.snapshot(),
+
+		"tls_full_handshake_seconds":    stats.tlsFull.snapshot(),
+		"tls_resumed_handshake_seconds": stats.tlsResumed.snapshot(),
+	}, "  ", "  ")
+
+	// Per-token usage, only with -auth-tokens
+	var tokenStats string
+	if tokens != nil {
+		usages, _ := json.MarshalIndent(tokenUsages(), "  ", "  ")
+		tokenStats = fmt.Sprintf(",\n  \"tokens\": %s", usages)
+	}
+
+	// Per-certificate usage, only with -tls-client-ca
+	if certs := certUsageList(); len(certs) > 0 {
+		usages, _ := json.MarshalIndent(certs, "  ", "  ")
+		tokenStats += fmt.Sprintf(",\n  \"client_certs\": %s", usages)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprintf(w, `{
+  "ok": true,
+  "version": %q,
+  "commit": %q,
+  "total_downloads": %d,
+  "total_uploads": %d,
+  "total_bytes_down": %d,
+  "total_bytes_up": %d,
+  "total_bytes_down_text": %q,
+  "total_bytes_up_text": %q,
+  "total_connections": %d,
+  "total_data_gb": %.2f,
+  "uptime_seconds": %.0f,
+  "peak_concurrent": %d,
+  "queued": %d,
+  "peak_queued": %d,
+  "queue_rejected": %d,
+  "corrupt_chunks": %d,
+  "results_ingested": %d,
+  "truncated_transfers": %d,
+  "idle_connections": %d,
+  "idle_closed": %d,
+  "header_connections": %d,
+  "header_rejected": %d,
+  "last_request": "%s",
+  "histograms": %s%s
+}`,
+		build.Version,
+		build.Commit,
+		totalDownloads,
+		totalUploads,
+		totalBytesDown,
+		totalBytesUp,
+		formatByteCount(totalBytesDown),
+		formatByteCount(totalBytesUp),
+		totalConnections,
+		float64(totalBytesDown+totalBytesUp)/1_000_000_000,
+		uptime.Seconds(),
+		peakConcurrent,
+		atomic.LoadInt64(&stats.currentQueued),
+		atomic.LoadInt64(&stats.peakQueued),
+		atomic.LoadInt64(&stats.queueRejected),
+		atomic.LoadInt64(&stats.corruptChunks),
+		atomic.LoadInt64(&stats.resultsIngested),
+		atomic.LoadInt64(&stats.truncated),
+		serverIdle.count(),
+		serverIdle.closed.Load(),
+		serverHeaders.count(),
+		serverHeaders.rejected.Load(),
+		lastRequest.Format(time.RFC3339),
+		histograms,
+		tokenStats,
+	)
+}
+
+// healthHandler returns liveness status: the process is up and serving HTTP
+func healthHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprintf(w, `{"ok":true,"status":"healthy","timestamp":"%s"}`, time.Now().Format(time.RFC3339))
+}
+
+// readyHandler returns readiness status: whether new tests should be routed
+// to this server. It reports 503 while draining.
+func readyHandler(w http.ResponseWriter, r *http.Request) {
+	active := atomic.LoadInt64(&stats.currentConcurrent)
+
+	w.Header().Set("Content-Type", "application/json")
+	if shuttingDown.Load() {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		fmt.Fprintf(w, `{"ok":false,"status":"shutting_down","active_transfers":%d}`, active)
+		return
+	}
+	if draining.Load() {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		fmt.Fprintf(w, `{"ok":false,"status":"draining","active_transfers":%d}`, active)
+		return
+	}
+	fmt.Fprintf(w, `{"ok":true,"status":"ready","active_transfers":%d}`, active)
+}
+
+// drainHandler toggles drain mode: POST starts draining, DELETE returns the
+// server to rotation. Requests must carry the admin token as a bearer token;
+// without a configured token the endpoint is disabled.
+func drainHandler(token string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if token == "" {
+			httpError(w, codeAdminDisabled, "admin endpoints disabled, set -admin-token", http.StatusForbidden)
+			return
+		}
+		if !validBearer(r, token) {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			httpError(w, codeUnauthorized, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		switch r.Method {
+		case http.MethodPost:
+			draining.Store(true)
+			logger.Printf("[ADMIN] %s - drain started", clientAddr(r))
+		case http.MethodDelete:
+			draining.Store(false)
+			logger.Printf("[ADMIN] %s - drain cancelled", clientAddr(r))
+		default:
+			httpError(w, codeMethodNotAllowed, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"ok":true,"draining":%t,"active_transfers":%d}`,
+			draining.Load(), atomic.LoadInt64(&stats.currentConcurrent))
+	}
+}
+
+// validBearer reports whether the request carries the given bearer token
+func validBearer(r *http.Request, token string) bool {
+	got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return ok && subtle.ConstantTimeCompare([]byte(got), []byte(token)) == 1
+}
+
+// ============== CLIENT IMPLEMENTATION ==============
+
+func runClient(config Config) {
+	if name, ok := strings.CutPrefix(config.Server, srvPrefix); ok {
+		server, rtt, err := discoverServer(name)
+		if err != nil {
+			fail(err)
+			return
+		}
+		out := os.Stdout
+		if config.JSON {
+			out = os.Stderr
+		}
+		fmt.Fprintf(out, "Discovered %s through SRV %s (connect %.1f ms)\n", server, name, durationMs(rtt))
+		config.Server = server
+	} else {
+		// Checked in Config.validate
+		config.resolveServer()
+	}
+
+	// The handshake test always speaks TLS
+	if config.Test == testTLSHandshake {
+		config.TLS = true
+	}
+
+	if config.TLSClientCert != "" {
+		// Checked in Config.validate
+		cert, _ := tls.LoadX509KeyPair(config.TLSClientCert, config.TLSClientKey)
+		clientCertificates = []tls.Certificate{cert}
+	}
+
+	if config.Watch && (config.ResolveOnce || config.DNSTTL > 0) {
+		// -resolve-once overrides -dns-ttl
+		ttl := config.DNSTTL
+		if config.ResolveOnce {
+			ttl = 0
+		}
+		clientDNSCache = newDNSCache(ttl)
+	}
+
+	httpClient.Transport = newTransport(config)
+	// Checked in Config.validate
+	clientPayload, _ = parsePayload(config.Payload)
+	if config.CookieJar || len(config.Cookies) > 0 {
+		// Cookies checked in Config.validate
+		clientCookies, _ = newCookieJar(config)
+		httpClient.Jar = clientCookies
+	}
+	if config.Limit > 0 {
+		clientLimit = newBandwidthLimit(config.Limit)
+	}
+
+	// A server that cannot be reached fails in the test itself; URL
+	// templates are for servers other than ethspeed. A speed test leaves it
+	// to its first transfer, since a compatible server need not have /__info.
+	info, infoErr := fetchServerInfo(config)
+	var notEthspeed *notEthspeedError
+	if errors.As(infoErr, &notEthspeed) && !config.NoIdentityCheck && config.DownURL == "" && config.UpURL == "" {
+		if config.Test != testSpeed {
+			fail(infoErr)
+			return
+		}
+		unidentifiedServer = true
+	}
+	if info != nil {
+		if err := negotiate(&config, info); err != nil {
+			fail(err)
+			return
+		}
+		serverEchoesNonce = slices.Contains(info.Features, featureNonce)
+	}
+
+	if config.Profile != "" || config.HeapProfile != "" {
+		stop, err := startProfiling(config)
+		if err != nil {
+			fail(err)
+			return
+		}
+		defer stop()
+	}
+
+	switch config.Test {
+	case testQUICDgram:
+		if err := runQUICDatagramTest(config); err != nil {
+			fail(err)
+		}
+		return
+	case testWSPing:
+		if err := runWSPingTest(config); err != nil {
+			fail(err)
+		}
+		return
+	case testUDPEcho:
+		if err := runUDPEchoTest(config); err != nil {
+			fail(err)
+		}
+		return
+	case testOWD:
+		if err := runOWDTest(config); err != nil {
+			fail(err)
+		}
+		return
+	case testRPS:
+		if err := runRPSTest(config); err != nil {
+			fail(err)
+		}
+		return
+	case testTLSHandshake:
+		if err := runTLSHandshakeTest(config); err != nil {
+			fail(err)
+		}
+		return
+	case testConnRate:
+		if err := runConnRateTest(config); err != nil {
+			fail(err)
+		}
+		return
+	}
+
+	if config.Format == formatJSONL {
+		events = newEventStream(os.Stdout)
+	}
+
+	clockOffset := checkClock(config)
 
-// uploadHandler handles POST requests for upload speed testing
-func uploadHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	if config.CompareProtocols {
+		runProtocolComparison(config)
 		return
 	}
 
-	expectedBytes, err := parseBytes(r)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	if config.Stress {
+		if err := runStressTest(config); err != nil {
+			fail(err)
+		}
 		return
 	}
 
-	// Increment concurrent connections
-	atomic.AddInt64(&stats.currentConcurrent, 1)
-	defer atomic.AddInt64(&stats.currentConcurrent, -1)
-
-	// Update peak concurrent
-	current := atomic.LoadInt64(&stats.currentConcurrent)
-	peak := atomic.LoadInt64(&stats.peakConcurrent)
-	for current > peak && !atomic.CompareAndSwapInt64(&stats.peakConcurrent, peak, current) {
-		peak = atomic.LoadInt64(&stats.peakConcurrent)
+	if config.Watch {
+		ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+		defer stop()
+		// The first Ctrl-C lets the running test finish, a second one exits
+		context.AfterFunc(ctx, stop)
+		runWatch(ctx, config)
+		return
 	}
 
-	uploadedBytes, err := io.Copy(io.Discard, r.Body)
-	if err != nil {
-		logger.Printf("Upload read error for %s: %v", r.RemoteAddr, err)
-		http.Error(w, "upload error", http.StatusInternalServerError)
+	if config.AllInterfaces {
+		runInterfaceSweep(config, clockOffset)
 		return
 	}
 
-	if uploadedBytes != expectedBytes {
-		logger.Printf("Warning: %s expected %s, received %s",
-			r.RemoteAddr, formatBytes(expectedBytes), formatBytes(uploadedBytes))
+	// Checked in Config.validate
+	tags, _ := parseTags(config.Tags)
+
+	report := &speedReport{
+		Time:          time.Now(),
+		Name:          config.Name,
+		Note:          config.Note,
+		Tags:          tags,
+		Environment:   collectEnvironment(config.Server),
+		Server:        config.Server,
+		SizeMB:        config.Size,
+		Direction:     config.Direction,
+		ClockOffsetMs: clockOffset,
+		LimitMbps:     config.Limit,
+		Runs:          []runResult{},
+	}
+	if !config.JSON {
+		fmt.Printf("Speed Test - %d MB per run\n", config.Size)
+		if config.Name != "" {
+			fmt.Printf("Session: %s\n", config.Name)
+		}
+		if config.Note != "" {
+			fmt.Printf("Note: %s\n", config.Note)
+		}
+		fmt.Printf("Server: %s\n", config.Server)
+		fmt.Printf("Host: %s\n", report.Environment)
+		if config.Chunked {
+			fmt.Println("Downloads: chunked, no Content-Length")
+		}
+		if config.Compress {
+			fmt.Println("Downloads: gzip on the fly, speeds are decompressed goodput")
+		}
+		if tunnel := report.Environment.Tunnel; tunnel != "" {
+			fmt.Printf("WARNING: the route to the server goes through %s (%s); encapsulation and smaller packets may hold results below the link\n",
+				report.Environment.Interface, tunnel)
+		}
+		if wifi := report.Environment.WiFi; wifi != nil {
+			fmt.Printf("Wi-Fi: %s\n", wifi)
+			if wifi.RSSIdBm != 0 && wifi.RSSIdBm < weakRSSI {
+				fmt.Printf("WARNING: weak Wi-Fi signal (%d dBm), results are likely limited by the radio\n", wifi.RSSIdBm)
+			}
+		}
+		if tags != nil {
+			fmt.Printf("Tags: %s\n", formatTags(tags))
+		}
+		if config.Limit > 0 {
+			fmt.Printf("Limit: %s per direction\n", displayUnit.format(config.Limit))
+		}
+		fmt.Println()
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	fmt.Fprintf(w, `{"ok":true,"bytes":%d}`, uploadedBytes)
+	var (
+		pinger *wsPinger
+		idle   []float64
+	)
+	if config.Latency {
+		var err error
+		if pinger, err = startWSPinger(config, config.SampleInterval); err != nil {
+			fail(fmt.Errorf("latency: %w", err))
+			return
+		}
+		// Sample the idle link before any transfer starts
+		time.Sleep(time.Second)
+		idle = pinger.samples()
+	}
 
-	// Update statistics
-	stats.mu.Lock()
-	stats.totalUploads++
-	stats.totalBytesUp += uploadedBytes
-	stats.totalConnections++
-	stats.lastRequestTime = time.Now()
-	stats.mu.Unlock()
+	counters := snapshotInterface(report.Environment.Interface)
+	err := runSpeedTests(config, report)
+	report.Dial = takeDialReport()
+	report.InterfaceCounters = counters.since(report.Runs)
 
-	logger.Printf("[UPLOAD] %s - %s", r.RemoteAddr, formatBytes(uploadedBytes))
-}
+	if pinger != nil {
+		report.LatencyIdleMs = idle
+		report.LatencyLoadedMs = pinger.stop()[len(idle):]
+	}
 
-// statsHandler returns server statistics
-func statsHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
-		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
-		return
+	// Sent once the report has been printed
+	if config.Report {
+		defer sendReport(config, report)
+	}
+	if config.GrafanaURL != "" {
+		defer annotateTest(config, report)
 	}
 
-	stats.mu.RLock()
-	totalDownloads := stats.totalDownloads
-	totalUploads := stats.totalUploads
-	totalBytesDown := stats.totalBytesDown
-	totalBytesUp := stats.totalBytesUp
-	totalConnections := stats.totalConnections
-	uptime := time.Since(stats.startTime)
-	lastRequest := stats.lastRequestTime
-	peakConcurrent := stats.peakConcurrent
-	stats.mu.RUnlock()
+	if config.Plot == plotGnuplot && err == nil {
+		out := os.Stdout
+		if config.JSON {
+			out = os.Stderr
+		}
+		if err := report.writeGnuplot(config.PlotPrefix); err != nil {
+			fmt.Fprintf(out, "ERROR: %v\n", err)
+		} else {
+			fmt.Fprintf(out, "Plot written to %[1]s.dat and %[1]s.gp; render with: gnuplot %[1]s.gp\n\n", config.PlotPrefix)
+		}
+	}
 
-	w.Header().Set("Content-Type", "application/json")
-	fmt.Fprintf(w, `{
-  "ok": true,
-  "total_downloads": %d,
-  "total_uploads": %d,
-  "total_bytes_down": %d,
-  "total_bytes_up": %d,
-  "total_connections": %d,
-  "total_data_gb": %.2f,
-  "uptime_seconds": %.0f,
-  "peak_concurrent": %d,
-  "last_request": "%s"
-}`,
-		totalDownloads,
-		totalUploads,
-		totalBytesDown,
-		totalBytesUp,
-		totalConnections,
-		float64(totalBytesDown+totalBytesUp)/1_000_000_000,
-		uptime.Seconds(),
-		peakConcurrent,
-		lastRequest.Format(time.RFC3339),
-	)
-}
+	// Only after a run that passed, in both output modes
+	comparePhysical := config.ComparePhysical && err == nil
+	if config.JSON {
+		if events != nil {
+			events.summary(report)
+			return
+		}
+		if comparePhysical {
+			report.Physical = runPhysicalComparison(config, report)
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(report)
+		return
+	}
 
-// healthHandler returns health status
-func healthHandler(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-	fmt.Fprintf(w, `{"ok":true,"status":"healthy","timestamp":"%s"}`, time.Now().Format(time.RFC3339))
-}
+	if err != nil {
+		fmt.Printf("ERROR: %v\n", err)
+		return
+	}
 
-// ============== CLIENT IMPLEMENTATION ==============
+	report.printSparklines()
+	report.printIntermediaries()
+	if config.Plot == plotASCII {
+		report.printPlot()
+	}
+	report.printLink()
+	report.printLimit()
+	if report.Dial != nil {
+		fmt.Printf("Dial: %s\n", report.Dial)
+	}
+	if c := report.InterfaceCounters; c != nil {
+		fmt.Printf("Interface %s counters: %s\n", report.Environment.Interface, c)
+	}
+	if config.Verify {
+		report.printIntegrity()
+	}
 
-func runClient(config Config) {
-	fmt.Printf("Speed Test - %d MB per run\n", config.Size)
-	fmt.Printf("Server: %s\n\n", config.Server)
+	if pinger != nil {
+		fmt.Printf("Latency idle ms:       %s\n", formatRTTStats(report.LatencyIdleMs))
+		fmt.Printf("Latency under load ms: %s\n", formatRTTStats(report.LatencyLoadedMs))
+	}
+
+	if config.socketOptions().isSet() {
+		if info, ok := lastClientSocketInfo(); ok {
+			fmt.Printf("Socket options (effective): %s\n", info)
+		}
+	}
 
-	switch config.Direction {
-	case directionBoth:
-		runBothTests(config)
-	case directionDown:
-		runDownloadTests(config)
-	case directionUp:
-		runUploadTests(config)
+	if comparePhysical {
+		fmt.Println()
+		report.Physical = runPhysicalComparison(config, report)
 	}
 }
 
-func runBothTests(config Config) {
-	downloadSpeeds := make([]float64, config.Count)
-	uploadSpeeds := make([]float64, config.Count)
-	totalTime := time.Duration(0)
+// runSpeedTests runs the -c transfers of -direction into report and
+// records a failure in it
+func runSpeedTests(config Config, report *speedReport) error {
+	var err error
+	switch {
+	case config.Concurrency > 1:
+		err = runConcurrentTests(config, report)
+	case config.Direction == directionBoth:
+		err = runBothTests(config, report)
+	case config.Direction == directionDown:
+		err = runDownloadTests(config, report)
+	case config.Direction == directionUp:
+		err = runUploadTests(config, report)
+	}
+	if err != nil {
+		report.Error = err.Error()
+		var se *serverError
+		if errors.As(err, &se) {
+			report.ErrorCode = se.Code
+		}
+		noteFailure(err)
+	}
+	return err
+}
 
-	fmt.Printf("%-8s | %-8s | %s\n", "down", "up", "Mbps")
-	fmt.Println(strings.Repeat("-", 30))
+func runBothTests(config Config, report *speedReport) error {
+	if !config.JSON {
+		fmt.Printf("%-8s | %-8s | %s\n", "down", "up", displayUnit.label())
+		fmt.Println(strings.Repeat("-", 30))
+	}
 
 	for i := 0; i < config.Count; i++ {
-		downSpeed, downDur, err := runDownloadTest(config)
+		var down, up *transferResult
+		err := retryIteration(config, report, i, func() (err error) {
+			// A download that passed is kept when only the upload failed
+			if down == nil {
+				if down, err = runDownloadTest(config); err != nil {
+					return fmt.Errorf("download test %d: %w", i+1, err)
+				}
+			}
+			if up, err = runUploadTest(config); err != nil {
+				return fmt.Errorf("upload test %d: %w", i+1, err)
+			}
+			return nil
+		})
 		if err != nil {
-			fmt.Printf("ERROR: download test %d: %v\n", i+1, err)
-			return
-		}
-		downloadSpeeds[i] = downSpeed
-		totalTime += downDur
-
-		upSpeed, upDur, err := runUploadTest(config)
-		if err != nil {
-			fmt.Printf("ERROR: upload test %d: %v\n", i+1, err)
-			return
+			if err := keepGoing(config, report, err); err != nil {
+				return err
+			}
+		} else {
+			report.Runs = append(report.Runs, runResult{Download: down, Upload: up})
+			if !config.JSON {
+				fmt.Printf("%-8s | %-8s | %s\n", displayUnit.cell(down.Mbps), displayUnit.cell(up.Mbps), displayUnit.label())
+			}
 		}
-		uploadSpeeds[i] = upSpeed
-		totalTime += upDur
-
-		fmt.Printf("%-8.1f | %-8.1f | Mbps\n", downSpeed, upSpeed)
 
 		if i < config.Count-1 {
 			time.Sleep(500 * time.Millisecond)
 		}
 	}
 
-	avgDown := calculateAverage(downloadSpeeds)
-	avgUp := calculateAverage(uploadSpeeds)
-
-	fmt.Println(strings.Repeat("-", 30))
-	fmt.Printf("%-8.1f | %-8.1f | Avg\n", avgDown, avgUp)
-	fmt.Printf("Total time: %.2f seconds\n\n", totalTime.Seconds())
+	report.summarize()
+	if !config.JSON {
+		fmt.Println(strings.Repeat("-", 30))
+		fmt.Printf("%-8s | %-8s | Avg\n", displayUnit.cell(report.AvgDownloadMbps), displayUnit.cell(report.AvgUploadMbps))
+		report.printFailedRuns()
+		fmt.Printf("Total time: %.2f seconds\n\n", report.TotalSeconds)
+	}
+	return nil
 }
 
-func runDownloadTests(config Config) {
-	speeds := make([]float64, config.Count)
-	totalTime := time.Duration(0)
-
-	fmt.Printf("%-8s\n", "down")
-	fmt.Println(strings.Repeat("-", 18))
+func runDownloadTests(config Config, report *speedReport) error {
+	if !config.JSON {
+		fmt.Printf("%-8s\n", "down")
+		fmt.Println(strings.Repeat("-", 18))
+	}
 
 	for i := 0; i < config.Count; i++ {
-		speed, duration, err := runDownloadTest(config)
+		var down *transferResult
+		err := retryIteration(config, report, i, func() (err error) {
+			if down, err = runDownloadTest(config); err != nil {
+				return fmt.Errorf("test %d: %w", i+1, err)
+			}
+			return nil
+		})
 		if err != nil {
-			fmt.Printf("ERROR: test %d: %v\n", i+1, err)
-			return
+			if err := keepGoing(config, report, err); err != nil {
+				return err
+			}
+		} else {
+			report.Runs = append(report.Runs, runResult{Download: down})
+			if !config.JSON {
+				fmt.Printf("%-8s %s\n", displayUnit.cell(down.Mbps), displayUnit.label())
+			}
 		}
 
-		speeds[i] = speed
-		totalTime += duration
-		fmt.Printf("%-8.1f Mbps\n", speed)
-
 		if i < config.Count-1 {
 			time.Sleep(500 * time.Millisecond)
 		}
 	}
 
-	avgSpeed := calculateAverage(speeds)
-	fmt.Println(strings.Repeat("-", 18))
-	fmt.Printf("%-8.1f Avg\n", avgSpeed)
-	fmt.Printf("Total time: %.2f seconds\n\n", totalTime.Seconds())
+	report.summarize()
+	if !config.JSON {
+		fmt.Println(strings.Repeat("-", 18))
+		fmt.Printf("%-8s Avg\n", displayUnit.cell(report.AvgDownloadMbps))
+		report.printFailedRuns()
+		fmt.Printf("Total time: %.2f seconds\n\n", report.TotalSeconds)
+	}
+	return nil
 }
 
-func runUploadTests(config Config) {
-	speeds := make([]float64, config.Count)
-	totalTime := time.Duration(0)
-
-	fmt.Printf("%-8s\n", "up")
-	fmt.Println(strings.Repeat("-", 18))
+func runUploadTests(config Config, report *speedReport) error {
+	if !config.JSON {
+		fmt.Printf("%-8s\n", "up")
+		fmt.Println(strings.Repeat("-", 18))
+	}
 
 	for i := 0; i < config.Count; i++ {
-		speed, duration, err := runUploadTest(config)
+		var up *transferResult
+		err := retryIteration(config, report, i, func() (err error) {
+			if up, err = runUploadTest(config); err != nil {
+				return fmt.Errorf("test %d: %w", i+1, err)
+			}
+			return nil
+		})
 		if err != nil {
-			fmt.Printf("ERROR: test %d: %v\n", i+1, err)
-			return
+			if err := keepGoing(config, report, err); err != nil {
+				return err
+			}
+		} else {
+			report.Runs = append(report.Runs, runResult{Upload: up})
+			if !config.JSON {
+				fmt.Printf("%-8s %s\n", displayUnit.cell(up.Mbps), displayUnit.label())
+			}
 		}
 
-		speeds[i] = speed
-		totalTime += duration
-		fmt.Printf("%-8.1f Mbps\n", speed)
-
 		if i < config.Count-1 {
 			time.Sleep(500 * time.Millisecond)
 		}
 	}
 
-	avgSpeed := calculateAverage(speeds)
-	fmt.Println(strings.Repeat("-", 18))
-	fmt.Printf("%-8.1f Avg\n", avgSpeed)
-	fmt.Printf("Total time: %.2f seconds\n\n", totalTime.Seconds())
+	report.summarize()
+	if !config.JSON {
+		fmt.Println(strings.Repeat("-", 18))
+		fmt.Printf("%-8s Avg\n", displayUnit.cell(report.AvgUploadMbps))
+		report.printFailedRuns()
+		fmt.Printf("Total time: %.2f seconds\n\n", report.TotalSeconds)
+	}
+	return nil
+}
+
+func runDownloadTest(config Config) (*transferResult, error) {
+	return measureDownload(httpClient, config)
 }
 
-func runDownloadTest(config Config) (float64, time.Duration, error) {
+func measureDownload(client *http.Client, config Config) (*transferResult, error) {
 	numBytes := int64(config.Size) * 1_000_000
-	url := fmt.Sprintf("http://%s/__down?bytes=%d", config.Server, numBytes)
+	url := config.downURL(numBytes)
+	if config.Payload != "" {
+		url += "&payload=" + clientPayload.query()
+	}
+	if config.Verify {
+		url += "&verify=1"
+	}
+	if config.Chunked {
+		url += "&chunked=1"
+	}
+	if config.MaxTestDuration > 0 {
+		url += fmt.Sprintf("&max_seconds=%g", config.MaxTestDuration.Seconds())
+	}
+	if config.Compress {
+		url += "&compress=" + compressGzip
+		if config.Payload == "" {
+			url += "&payload=" + payloadText
+		}
+	}
+	if config.RemoteFile {
+		url = config.endpointURL(serveFilePath)
+	}
 
 	req, err := http.NewRequest(http.MethodGet, url, nil)
 	if err != nil {
-		return 0, 0, fmt.Errorf("request creation failed: %w", err)
+		return nil, fmt.Errorf("request creation failed: %w", err)
+	}
+	config.authorize(req)
+	config.bustCache(req)
+	requestID := newRequestID()
+	req.Header.Set(requestIDHeader, requestID)
+	req.Header.Set("TE", "trailers")
+	if config.Compress {
+		// Set by hand, the transport leaves the body compressed for us
+		req.Header.Set("Accept-Encoding", compressGzip)
+	}
+
+	var setupMs *float64
+	if config.Preconnect {
+		if setupMs, err = preconnect(client, config, req); err != nil {
+			return nil, err
+		}
 	}
 
+	var remote net.Addr
+	req = withRemoteAddr(req, &remote)
+
+	sampler := startResourceSampler()
+	defer sampler.finish()
 	startTime := time.Now()
-	resp, err := httpClient.Do(req)
+	resp, err := client.Do(req)
 	if err != nil {
-		return 0, 0, fmt.Errorf("download failed: %w", err)
+		return nil, fmt.Errorf("download failed: %w", err)
 	}
 	defer resp.Body.Close()
 
+	if err := checkTransfer(config, resp); err != nil {
+		return nil, err
+	}
 	if resp.StatusCode != http.StatusOK {
-		return 0, 0, fmt.Errorf("server returned status %d", resp.StatusCode)
+		return nil, statusError(resp)
+	}
+
+	var (
+		sink     io.Writer = io.Discard
+		verifier *chunkVerifier
+	)
+	if config.Verify {
+		if resp.Header.Get(verifyHeader) != "1" {
+			return nil, errVerifyUnsupported
+		}
+		verifier = newChunkVerifier()
+		sink = verifier
 	}
 
-	bytesDownloaded, err := io.Copy(io.Discard, resp.Body)
+	// The meter follows the decompressed goodput; the wire bytes are
+	// counted underneath the gzip reader
+	var body io.Reader = resp.Body
+	var wire *countingReader
+	if config.Compress {
+		if resp.Header.Get("Content-Encoding") != compressGzip {
+			return nil, errCompressUnsupported
+		}
+		wire = &countingReader{Reader: resp.Body}
+		gz, err := gzip.NewReader(wire)
+		if err != nil {
+			return nil, fmt.Errorf("read failed: %w", err)
+		}
+		body = gz
+	}
+
+	meter := newThroughputMeter(body)
+	meter.onSample = config.sampler(directionDown)
+	bytesDownloaded, err := io.Copy(sink, meter)
 	if err != nil {
-		return 0, 0, fmt.Errorf("read failed: %w", err)
+		return nil, fmt.Errorf("read failed: %w", err)
+	}
+
+	// A body of another size than asked for would give a plausible but
+	// wrong speed, unless the server ended it at its time limit. Servers
+	// before the trailer, and proxies that drop trailers, leave only
+	// -max-test-duration to go by.
+	truncated := false
+	if !config.RemoteFile && config.DownURL == "" && bytesDownloaded != numBytes {
+		switch {
+		case resp.Trailer.Get(truncatedTrailer) == "1":
+			truncated = true
+		case resp.Trailer.Get("Server-Timing") == "" && config.MaxTestDuration > 0 && bytesDownloaded < numBytes:
+			truncated = true
+		default:
+			return nil, fmt.Errorf("%w: received %s of %s", errShortBody, formatByteCount(bytesDownloaded), formatByteCount(numBytes))
+		}
 	}
 
-	elapsed := time.Since(startTime)
-	if elapsed == 0 {
-		return 0, 0, fmt.Errorf("test completed too quickly to measure")
+	// Time spent in the server's -queue is not transfer time
+	timing := parseServerTiming(resp.Header, resp.Trailer)
+	elapsed := time.Since(startTime) - time.Duration(timing["queue"]*float64(time.Millisecond))
+	if elapsed <= 0 {
+		return nil, fmt.Errorf("test completed too quickly to measure")
+	}
+	// Server think time before the first byte stays out with -from-first-byte
+	sinceRequest := elapsed
+	if config.FromFirstByte && !meter.first.IsZero() {
+		elapsed = time.Since(meter.first)
 	}
 
-	speedBytesPerSec := float64(bytesDownloaded) / elapsed.Seconds()
-	speedMbps := (speedBytesPerSec * 8) / 1_000_000
+	result := newTransferResult(bytesDownloaded, elapsed, meter.finish())
+	if config.FromFirstByte && !meter.first.IsZero() {
+		result.setFirstByte(meter.first.Sub(startTime), sinceRequest)
+	}
+	result.RequestID = requestID
+	result.SetupMs = setupMs
+	result.Resources = sampler.finish()
+	result.ServerTiming = timing
+	result.Chunked = resp.ContentLength < 0
+	result.Truncated = truncated
+	sentBody := bytesDownloaded
+	if wire != nil {
+		result.WireBytes = wire.n
+		result.WireMbps = float64(wire.n) * 8 / elapsed.Seconds() / 1_000_000
+		sentBody = wire.n
+	}
+	result.estimateLine(sentBody, headBytes(resp.Proto+" "+resp.Status, resp.Header), resp, remote, config.MTU)
+	result.Intermediary = detectIntermediary(req, resp, sentBody)
+	if verifier != nil {
+		result.Integrity = verifier.finish()
+	}
+	events.phase(directionDown, result)
+	return result, nil
+}
 
-	return speedMbps, elapsed, nil
+func runUploadTest(config Config) (*transferResult, error) {
+	return measureUpload(httpClient, config)
 }
 
-func runUploadTest(config Config) (float64, time.Duration, error) {
+func measureUpload(client *http.Client, config Config) (*transferResult, error) {
 	numBytes := int64(config.Size) * 1_000_000
-	url := fmt.Sprintf("http://%s/__up?bytes=%d", config.Server, numBytes)
+	url := config.upURL(numBytes)
 
 	data := make([]byte, numBytes)
+	if clientPayload.kind != payloadZeros {
+		io.ReadFull(clientPayload.reader(), data)
+	}
+	if config.Verify {
+		url += "&verify=1"
+		sealPayload(data, 0)
+	}
+	if config.MaxTestDuration > 0 {
+		url += fmt.Sprintf("&max_seconds=%g", config.MaxTestDuration.Seconds())
+	}
 
-	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(data))
+	// The meter sees the body as the transport consumes it, so its samples
+	// follow the send rate (plus socket buffering)
+	meter := newThroughputMeter(bytes.NewReader(data))
+	meter.onSample = config.sampler(directionUp)
+	req, err := http.NewRequest(http.MethodPost, url, meter)
 	if err != nil {
-		return 0, 0, fmt.Errorf("request creation failed: %w", err)
+		return nil, fmt.Errorf("request creation failed: %w", err)
 	}
 
+	req.ContentLength = numBytes
 	req.Header.Set("Content-Type", "application/octet-stream")
+	config.authorize(req)
+	requestID := newRequestID()
+	req.Header.Set(requestIDHeader, requestID)
+
+	// With Expect: 100-continue the body waits for the server's go-ahead;
+	// that round trip is reported on its own, not as transfer time
+	var wroteHeaders, continued time.Time
+	if config.ExpectContinue {
+		req.Header.Set("Expect", "100-continue")
+		req = req.WithContext(httptrace.WithClientTrace(req.Context(), &httptrace.ClientTrace{
+			WroteHeaders: func() { wroteHeaders = time.Now() },
+			Got100Continue: func() {
+				continued = time.Now()
+				// Called before the body is written
+				meter.start = continued
+			},
+		}))
+	}
+
+	var setupMs *float64
+	if config.Preconnect {
+		if setupMs, err = preconnect(client, config, req); err != nil {
+			return nil, err
+		}
+	}
 
+	var remote net.Addr
+	req = withRemoteAddr(req, &remote)
+
+	sampler := startResourceSampler()
+	defer sampler.finish()
 	startTime := time.Now()
-	resp, err := httpClient.Do(req)
+	meter.start = startTime
+	resp, err := client.Do(req)
 	if err != nil {
-		return 0, 0, fmt.Errorf("upload failed: %w", err)
+		return nil, fmt.Errorf("upload failed: %w", err)
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return 0, 0, fmt.Errorf("server returned status %d", resp.StatusCode)
+	if err := checkTransfer(config, resp); err != nil {
+		return nil, err
+	}
+	// Third-party endpoints may answer with any success status
+	if resp.StatusCode != http.StatusOK && (config.UpURL == "" || resp.StatusCode/100 != 2) {
+		return nil, statusError(resp)
 	}
 
+	var reply struct {
+		Bytes     int64  `json:"bytes"`
+		Truncated bool   `json:"truncated"`
+		Chunks    *int64 `json:"chunks"`
+		Corrupt   int64  `json:"corrupt"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&reply)
+	if config.Verify && (err != nil || reply.Chunks == nil) {
+		return nil, errVerifyUnsupported
+	}
 	io.Copy(io.Discard, resp.Body)
-
-	elapsed := time.Since(startTime)
-	if elapsed == 0 {
-		return 0, 0, fmt.Errorf("test completed too quickly to measure")
+	if (config.UpURL != "" || unidentifiedServer) && (err != nil || reply.Bytes == 0) {
+		// Third-party endpoints and compatible servers without /__info
+		// need not report a count
+		reply.Bytes, err = numBytes, nil
+	}
+	// The server's count is what the speed is based on
+	switch {
+	case err != nil:
+		return nil, fmt.Errorf("%w: no byte count in the server's reply", errShortBody)
+	case !reply.Truncated && reply.Bytes != numBytes:
+		return nil, fmt.Errorf("%w: the server received %s of %s", errShortBody, formatByteCount(reply.Bytes), formatByteCount(numBytes))
 	}
 
-	speedBytesPerSec := float64(numBytes) / elapsed.Seconds()
-	speedMbps := (speedBytesPerSec * 8) / 1_000_000
+	timing := parseServerTiming(resp.Header)
+	queue := time.Duration(timing["queue"] * float64(time.Millisecond))
+	elapsed := time.Since(startTime) - queue
+	var continueWait time.Duration
+	if !continued.IsZero() {
+		// The server sends 100 Continue once it starts reading, after the queue
+		continueWait = max(continued.Sub(wroteHeaders)-queue, 0)
+		elapsed = time.Since(continued)
+	}
+	if elapsed <= 0 {
+		return nil, fmt.Errorf("test completed too quickly to measure")
+	}
 
-	return speedMbps, elapsed, nil
+	// Cut off at its time limit, the upload counts what the server got
+	received := numBytes
+	if reply.Truncated {
+		received = reply.Bytes
+	}
+	// -from-first-byte is download-only: the transport sends the first
+	// byte of an upload along with the request
+	result := newTransferResult(received, elapsed, meter.finish())
+	result.Truncated = reply.Truncated
+	result.RequestID = requestID
+	result.estimateLine(received, headBytes(req.Method+" "+req.URL.RequestURI()+" "+req.Proto, req.Header), resp, remote, config.MTU)
+	result.SetupMs = setupMs
+	result.Resources = sampler.finish()
+	result.ServerTiming = timing
+	if !continued.IsZero() {
+		ms := durationMs(continueWait)
+		result.ContinueMs = &ms
+	}
+	if reply.Chunks != nil {
+		result.Integrity = &integrityResult{Chunks: *reply.Chunks, Corrupt: reply.Corrupt}
+	}
+	events.phase(directionUp, result)
+	return result, nil
 }
 
 // ============== UTILITY FUNCTIONS ==============
 
+// statusError describes an unexpected response, with the server's message
+// (e.g. a quota error) when there is one
+func statusError(resp *http.Response) error {
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	id := resp.Header.Get(requestIDHeader)
+	var env errorEnvelope
+	if json.Unmarshal(msg, &env) == nil && env.Code != "" {
+		return &serverError{Status: resp.StatusCode, Code: env.Code, Msg: env.Msg, RequestID: id}
+	}
+	return &serverError{Status: resp.StatusCode, Msg: strings.TrimSpace(string(msg)), RequestID: id}
+}
+
 func calculateAverage(speeds []float64) float64 {
 	if len(speeds) == 0 {
 		return 0
@@ -552,6 +2501,21 @@ func calculateAverage(speeds []float64) float64 {
 	return sum / float64(len(speeds))
 }
 
+// percentile returns the p-th percentile (0-100) of sorted values using
+// linear interpolation between closest ranks.
+func percentile(sorted []float64, p float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := p / 100 * float64(len(sorted)-1)
+	lower := int(rank)
+	if lower >= len(sorted)-1 {
+		return sorted[len(sorted)-1]
+	}
+	frac := rank - float64(lower)
+	return sorted[lower] + frac*(sorted[lower+1]-sorted[lower])
+}
+
 func parseBytes(r *http.Request) (int64, error) {
 	bytesParam := r.URL.Query().Get("bytes")
 	if bytesParam == "" {
@@ -564,90 +2528,671 @@ func parseBytes(r *http.Request) (int64, error) {
 	}
 
 	if numBytes < minBytes || numBytes > maxBytes {
-		return 0, fmt.Errorf("bytes must be between %s and %s",
-			formatBytes(minBytes), formatBytes(maxBytes))
+		return 0, &apiError{codeSizeOutOfRange, fmt.Sprintf("bytes must be between %s and %s",
+			formatBytes(minBytes), formatBytes(maxBytes))}
 	}
 
 	return numBytes, nil
 }
 
+// parseListenAddr parses a -listen value. Accepted forms are "host:port",
+// "tcp:host:port", "tls:host:port" and "unix:/path/to.sock".
+func parseListenAddr(s string) (listenSpec, error) {
+	spec := listenSpec{network: "tcp"}
+	switch {
+	case strings.HasPrefix(s, "unix:"):
+		spec.network = "unix"
+		spec.addr = strings.TrimPrefix(s, "unix:")
+		if spec.addr == "" {
+			return spec, fmt.Errorf("listen: unix socket path cannot be empty")
+		}
+		return spec, nil
+	case strings.HasPrefix(s, "tls:"):
+		spec.tls = true
+		s = strings.TrimPrefix(s, "tls:")
+	case strings.HasPrefix(s, "tcp:"):
+		s = strings.TrimPrefix(s, "tcp:")
+	}
+
+	if _, _, err := net.SplitHostPort(s); err != nil {
+		return spec, fmt.Errorf("listen: invalid address '%s': %v", s, err)
+	}
+	spec.addr = s
+	return spec, nil
+}
+
+// stringList is a flag.Value collecting every occurrence of a repeatable
+// flag. Comma-separated values are split as well.
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(v string) error {
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			*l = append(*l, item)
+		}
+	}
+	return nil
+}
+
+// flagAliases maps each short flag to the long flag it stands for
+var flagAliases = map[string]string{}
+
+// aliasFlag registers short as another name of the already defined long
+// flag. Both share one flag.Value, so whichever is given last wins, just as
+// for a flag repeated under the same name.
+func aliasFlag(short, long string) {
+	f := flag.Lookup(long)
+	flag.Var(f.Value, short, f.Usage)
+	flagAliases[short] = long
+}
+
+// printUsage is flag.PrintDefaults with every alias on the line of its
+// long flag ("-c, -count int")
+func printUsage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintf(out, "Usage of %s:\n", os.Args[0])
+
+	shorts := map[string]string{}
+	for short, long := range flagAliases {
+		shorts[long] = short
+	}
+	merged := flag.NewFlagSet("", flag.ContinueOnError)
+	merged.SetOutput(out)
+	flag.VisitAll(func(f *flag.Flag) {
+		if _, ok := flagAliases[f.Name]; ok {
+			return
+		}
+		name := f.Name
+		if short, ok := shorts[f.Name]; ok {
+			name = short + ", -" + f.Name
+		}
+		merged.Var(f.Value, name, f.Usage)
+		// The value may already be parsed when usage is printed for an error
+		merged.Lookup(name).DefValue = f.DefValue
+	})
+	merged.PrintDefaults()
+}
+
+// clientAddr returns the peer address for logging. Connections accepted on a
+// unix socket carry no IP in RemoteAddr, so the address forwarded by the
+// reverse proxy is used instead when present.
+func clientAddr(r *http.Request) string {
+	if _, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return r.RemoteAddr + peerNote(r)
+	}
+
+	if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
+		first, _, _ := strings.Cut(xff, ",")
+		return strings.TrimSpace(first) + " (unix)"
+	}
+	if ip := r.Header.Get("X-Real-IP"); ip != "" {
+		return ip + " (unix)"
+	}
+	return "unix"
+}
+
+// deadlineAfter is the deadline d from now, or none for d == 0
+func deadlineAfter(d time.Duration) time.Time {
+	if d == 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(d)
+}
+
+// formatBytes uses the prefixes speeds are shown with: powers of 1000 (KB,
+// MB, GB) by default, like -s and Mbps, and of 1024 (KiB, MiB, GiB) with
+// -binary
 func formatBytes(bytes int64) string {
-	const (
-		kb = 1024
-		mb = kb * 1024
-		gb = mb * 1024
-	)
+	base := displayUnit.base()
+	prefixes := []string{"KB", "MB", "GB", "TB"}
+	if displayUnit.binary {
+		prefixes = []string{"KiB", "MiB", "GiB", "TiB"}
+	}
+	if float64(bytes) < base {
+		return numbers.count(bytes) + " B"
+	}
 
-	switch {
-	case bytes >= gb:
-		return fmt.Sprintf("%.2f GB", float64(bytes)/float64(gb))
-	case bytes >= mb:
-		return fmt.Sprintf("%.2f MB", float64(bytes)/float64(mb))
-	case bytes >= kb:
-		return fmt.Sprintf("%.2f KB", float64(bytes)/float64(kb))
-	default:
-		return fmt.Sprintf("%d B", bytes)
+	v, i := float64(bytes)/base, 0
+	for v >= base && i < len(prefixes)-1 {
+		v /= base
+		i++
 	}
+	return numbers.format(v, 2) + " " + prefixes[i]
+}
+
+// formatByteCount writes the exact count, grouped with -group-digits, where
+// a prefix would round a difference away, e.g. "received 9,999,999 B of
+// 10,000,000 B"
+func formatByteCount(bytes int64) string {
+	return numbers.count(bytes) + " B"
 }
 
-func parseFlags() Config {
+func parseFlags(args []string) Config {
 	// Mode flags
 	mode := flag.String("mode", modeClient,
 		"operation mode: 'client' or 'server'")
+	showVersion := flag.Bool("version", false,
+		"print the version, commit and build date and exit")
 
 	// Server-specific flags
 	port := flag.String("port", "8080",
 		"server listening port")
 	host := flag.String("host", "0.0.0.0",
 		"server listening host")
+	var listenAddrs stringList
+	flag.Var(&listenAddrs, "listen",
+		"server listen address, repeatable; overrides -host/-port ('host:port', 'tls:host:port' or 'unix:/path.sock')")
+	tlsCert := flag.String("tls-cert", "",
+		"TLS certificate file for tls: listeners")
+	tlsKey := flag.String("tls-key", "",
+		"TLS private key file for tls: listeners")
+	tlsMinVersion := flag.String("tls-min-version", "1.2",
+		"minimum TLS version for tls: listeners (1.0, 1.1, 1.2, 1.3)")
+	var tlsCiphers stringList
+	flag.Var(&tlsCiphers, "tls-ciphers",
+		"comma-separated TLS 1.0-1.2 cipher suites, e.g. TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256 (TLS 1.3 suites are fixed)")
+	tlsSelfSigned := flag.Bool("tls-self-signed", false,
+		"generate a self-signed certificate for tls: listeners at startup")
+	tlsCertCache := flag.String("tls-cert-cache", "",
+		"file to cache the -tls-self-signed certificate in, so it survives restarts")
+	tlsClientCA := flag.String("tls-client-ca", "",
+		"require tls: clients to present a certificate signed by a CA in this PEM file (mTLS); logs and /__stats then name the certificate")
+	reusePort := flag.Int("reuseport", 0,
+		"open N SO_REUSEPORT sockets per TCP listener, -1 for one per CPU (Linux only)")
+	adminToken := flag.String("admin-token", "",
+		"bearer token protecting admin endpoints (/__drain); empty disables them")
+	var allow, deny stringList
+	flag.Var(&allow, "allow",
+		"CIDR or address allowed to use the test endpoints, repeatable; others are denied unless only -deny is given")
+	flag.Var(&deny, "deny",
+		"CIDR or address denied the test endpoints, repeatable; the most specific -allow/-deny match wins")
+	debugLog := flag.Bool("debug", false,
+		"server: log per-request details, such as whether "+serveFilePath+" downloads took the sendfile fast path")
+	serveFile := flag.String("serve-file", "",
+		"serve this file at "+serveFilePath+" for download tests through the disk (sendfile on plain TCP)")
+	authTokens := flag.String("auth-tokens", "",
+		"file of '<name> <token> [bytes=N] [tests=N] [period=daily|monthly]' lines; test endpoints then require a token")
+	maxConcurrent := flag.Int("max-concurrent", 0,
+		"maximum simultaneous /__down and /__up transfers, 0 for no limit; above it the server answers 503")
+	queue := flag.Int("queue", 0,
+		"with -max-concurrent, let up to N transfers wait for a free slot instead of answering 503")
+	queueTimeout := flag.Duration("queue-timeout", time.Minute,
+		"longest wait in the -queue before answering 503")
+	readTimeout := flag.Duration("read-timeout", defaultReadTimeout,
+		"longest time to read a request including an upload body, 0 for none; the default fits the maximum transfer at about 100 Mbps")
+	writeTimeout := flag.Duration("write-timeout", defaultWriteTimeout,
+		"longest time to write a response such as a download, 0 for none; the default fits the maximum transfer at about 100 Mbps")
+	stallTimeout := flag.Duration("stall-timeout", defaultStallTimeout,
+		"keep /__down and /__up transfers alive past -read-timeout/-write-timeout while data moves, and cut them off once it stalls this long; 0 for the fixed timeouts only")
+	shutdownTimeout := flag.Duration("shutdown-timeout", 30*time.Second,
+		"on SIGINT/SIGTERM, let running transfers finish for up to this long while new tests get 503, then abort the rest")
+	maxTestDuration := flag.Duration("max-test-duration", 0,
+		"client: ask the server to end each transfer after this long, counting it as truncated; server: the longest any /__down or /__up may run; 0 for no limit")
+	idleTimeout := flag.Duration("idle-timeout", defaultIdleTimeout,
+		"how long an idle keep-alive connection is kept open, 0 to use -read-timeout")
+	maxIdleConns := flag.Int("max-idle-conns", 0,
+		"keep at most this many keep-alive connections idle, closing the one idle the longest; 0 for no limit")
+	noKeepAlive := flag.Bool("no-keepalive", false,
+		"close HTTP/1.x connections after every response instead of keeping them alive")
+	readHeaderTimeout := flag.Duration("read-header-timeout", defaultReadHeaderTimeout,
+		"longest time to read the headers of a request, independent of -read-timeout for bodies")
+	var maxHeaderBytes byteSize = defaultMaxHeaderBytes
+	flag.Var(&maxHeaderBytes, "max-header-bytes",
+		"largest request header block, e.g. 64K; larger requests get 431")
+	maxHeaderConns := flag.Int("max-header-conns", 0,
+		"close new connections while this many are still sending their request headers; 0 for no limit")
+	var payloadBlockSize byteSize
+	flag.Var(&payloadBlockSize, "payload-block",
+		"generate this much random data at startup, e.g. 256M, and serve random downloads by slicing it instead of generating them per request; 0 for off")
+	var ipQuota byteSize
+	flag.Var(&ipQuota, "ip-quota",
+		"daily transfer limit per client IP (IPv6: per /64), e.g. 50G; 0 for none")
+
+	// Client-specific flags (long names with short aliases)
+	count := flag.Int("count", 1, "number of speed tests to run")
+	aliasFlag("c", "count")
+	allInterfaces := flag.Bool("all-interfaces", false,
+		"run the test from each up, non-loopback interface in turn (bound to its address) and compare them")
+	comparePhysical := flag.Bool("compare-physical", false,
+		"when the route to the server goes through a VPN/tunnel interface, repeat the test bound to a physical interface and compare")
+	concurrency := flag.Int("concurrency", 1,
+		"run up to N of the -c iterations at the same time, each over its own connections, like N users testing at once")
+	retries := flag.Int("retries", 2,
+		"run a -c iteration that failed on a network error again up to N times, on new connections, instead of ending the batch")
+	keepGoing := flag.Bool("keep-going", false,
+		"record a -c iteration that still fails as an error row and go on with the batch; the average covers the runs that passed")
+
+	size := flag.Int("size", 100, "file size per test in MB")
+	aliasFlag("s", "size")
+
+	server := flag.String("server", "speed.cloudflare.com",
+		"server address for tests, or srv:<name> to pick one from DNS SRV records")
+	aliasFlag("S", "server")
+
+	test := flag.String("test", testSpeed,
+		"client test: 'speed' (HTTP throughput), 'quic-dgram' (QUIC datagram latency/loss), 'ws-ping' (WebSocket RTT), 'udp-echo' (UDP RTT/loss), 'owd' (one-way delays idle and under load) 'rps' (small-object requests/s and latency) 'tls-handshake' (full and resumed TLS handshake latency) or 'conn-rate' (new TCP/TLS connections per second)")
+	useTLS := flag.Bool("tls", false,
+		"connect to the server over HTTPS")
+	compareProtocols := flag.Bool("compare-protocols", false,
+		"run the transfer over HTTP/1.1, HTTP/2 and HTTP/3 and print a comparison")
+	plot := flag.String("plot", "",
+		"chart the per-run speeds: 'ascii' (bars in the terminal) or 'gnuplot' (write -plot-prefix .dat and .gp files)")
+	plotPrefix := flag.String("plot-prefix", "ethspeed-plot",
+		"path prefix of the -plot gnuplot data file and script")
+	jsonOut := flag.Bool("json", false,
+		"print the speed test report, including per-interval samples, as JSON (same as -format json)")
+	format := flag.String("format", formatText,
+		"client output: 'text', 'json' (the report at the end) or 'jsonl' (every sample, finished transfer and the summary as a JSON line as it happens)")
+	watch := flag.Bool("watch", false,
+		"keep running tests every -interval until interrupted, with a rolling table of results")
+	interval := flag.Duration("interval", time.Minute,
+		"time between test starts in -watch mode")
+	schedule := flag.String("schedule", "",
+		"cron expression for -watch test starts in local time, e.g. '*/30 8-22 * * *'; overrides -interval")
+	db := flag.String("db", "",
+		"SQLite results file: -watch stores every round in it, a server serves it at /api/results")
+	var retain time.Duration
+	flag.Func("retain", "prune -db rounds older than this, e.g. 90d or 12h (default: keep all)", func(v string) error {
+		d, err := parseAge(v)
+		retain = d
+		return err
+	})
+	retainRows := flag.Int("retain-rows", 0,
+		"keep at most this many rounds in -db (default: no limit)")
+	rollup := flag.String("rollup", "",
+		"keep pruned rounds as 'hourly' or 'daily' aggregates in -db (default: drop them)")
+	watchRows := flag.Int("watch-rows", 20,
+		"number of recent results shown in -watch mode")
+	dnsTTL := flag.Duration("dns-ttl", 0,
+		"in -watch mode, keep testing the address the server name first resolved to for this long (default: resolve for every connection)")
+	resolveOnce := flag.Bool("resolve-once", false,
+		"in -watch mode, resolve the server name once and test that address for the whole run")
+	reResolve := flag.Bool("re-resolve", false,
+		"in -watch mode, start every round on new connections so the server name is resolved again (DNS load balancing)")
+	var skipIfBusy bitRate
+	flag.Var(&skipIfBusy, "skip-if-busy",
+		"in -watch mode, skip a round when the interface already carries more than this rate, e.g. 50mbps (Linux)")
+	busyWait := flag.Duration("busy-wait", 0,
+		"with -skip-if-busy, keep checking for this long for the interface to quieten before skipping")
+	var tags stringList
+	flag.Var(&tags, "tag",
+		"key=value label stored with every result, e.g. site=office (repeatable)")
+	name := flag.String("name", "",
+		"session name stored with every result, e.g. 'after router firmware 1.2'")
+	note := flag.String("note", "",
+		"free-form note stored with every result")
+	profile := flag.String("profile", "",
+		"write a CPU profile of the client run to this file, for 'go tool pprof'")
+	heapProfile := flag.String("heap-profile", "",
+		"write a heap profile to this file after the client run, for 'go tool pprof'")
+	report := flag.Bool("report", false,
+		"upload every result to the tested server's /__results (needs its -db and a -token it accepts)")
+	var alerts stringList
+	flag.Var(&alerts, "alert",
+		"alert rule for -watch, e.g. 'down < 100 for 3' or 'error for 2' (repeatable)")
+	// URLs and commands may contain commas, so these are not split
+	var notifyWebhook, notifyExec []string
+	flag.Func("notify-webhook", "URL alert events are POSTed to as JSON (repeatable)", func(v string) error {
+		notifyWebhook = append(notifyWebhook, v)
+		return nil
+	})
+	flag.Func("notify-exec", "shell command run for alert events, with ETHSPEED_ALERT_* variables and JSON on stdin (repeatable)", func(v string) error {
+		notifyExec = append(notifyExec, v)
+		return nil
+	})
+	var notifySlack, notifyDiscord stringList
+	flag.Var(&notifySlack, "notify-slack",
+		"Slack incoming webhook URL for alerts (repeatable)")
+	flag.Var(&notifyDiscord, "notify-discord",
+		"Discord webhook URL for alerts (repeatable)")
+	notifyTemplate := flag.String("notify-template", "",
+		"Go text/template for Slack/Discord messages (default \""+defaultChatTemplate+"\")")
+	notifyResults := flag.Bool("notify-results", false,
+		"post every -watch result to Slack/Discord, not only alerts")
+	var notifyEmail stringList
+	flag.Var(&notifyEmail, "notify-email",
+		"e-mail address alerts are sent to (repeatable)")
+	smtpHost := flag.String("smtp-host", "",
+		"SMTP server for -notify-email, host[:port] (port 465 uses implicit TLS, default 587)")
+	smtpUser := flag.String("smtp-user", "",
+		"SMTP username (default: no authentication)")
+	smtpPassword := flag.String("smtp-password", os.Getenv("ETHSPEED_SMTP_PASSWORD"),
+		"SMTP password (default: $ETHSPEED_SMTP_PASSWORD)")
+	smtpFrom := flag.String("smtp-from", "",
+		"sender address for e-mails (default: ethspeed@<hostname>)")
+	emailSummary := flag.String("email-summary", "",
+		"send a daily summary e-mail at this local time, e.g. 08:00")
+	grafanaURL := flag.String("grafana-url", "",
+		"Grafana base URL: annotate every speed test and -watch alert on its dashboards")
+	grafanaToken := flag.String("grafana-token", os.Getenv("ETHSPEED_GRAFANA_TOKEN"),
+		"Grafana service account token (default: $ETHSPEED_GRAFANA_TOKEN)")
+	grafanaDashboard := flag.String("grafana-dashboard", "",
+		"UID of the dashboard to annotate (default: organization-wide annotations tagged 'ethspeed')")
+	remoteFile := flag.Bool("remote-file", false,
+		"download the server's -serve-file ("+serveFilePath+") instead of generated data; -size is ignored for downloads")
+	allowCache := flag.Bool("allow-cache", false,
+		"send downloads without the random nonce and no-cache, no-transform headers, to test a cache or CDN in the path on purpose")
+	noIdentityCheck := flag.Bool("no-identity-check", false,
+		"test a server that does not identify as ethspeed, instead of refusing to measure its error pages")
+	downPath := flag.String("down-path", "/__down",
+		"path downloads are requested from, e.g. /speed/__down behind a path-prefixing reverse proxy; may carry a query")
+	upPath := flag.String("up-path", "/__up",
+		"path uploads are posted to; may carry a query")
+	bytesParam := flag.String("bytes-param", "bytes",
+		"query parameter that carries the transfer size in bytes")
+	downURL := flag.String("down-url", "",
+		"download from this URL instead of the server's, with {bytes}, {kb}, {mb}, {kib} or {mib} for the size, e.g. 'https://host/garbage?ckSize={mib}'")
+	upURL := flag.String("up-url", "",
+		"post uploads to this URL instead of the server's, with the same placeholders as -down-url")
+	expectContinue := flag.Bool("expect-continue", false,
+		"send uploads with Expect: 100-continue and report the round trip it adds")
+	preConnect := flag.Bool("preconnect", false,
+		"set up each transfer's connection (DNS, TCP, TLS) before its clock starts and report the setup time separately")
+	fromFirstByte := flag.Bool("from-first-byte", false,
+		"start the download throughput clock at the first payload byte instead of the request, reporting the time to it and both speeds")
+	mtu := flag.Int("mtu", defaultMTU,
+		"IP packet size of the path, for the on-the-wire rate estimated from goodput (9000 for jumbo frames)")
+	verify := flag.Bool("verify", false,
+		"frame the payload into CRC-32C checked chunks and report corruption in both directions")
+	maxClockSkew := flag.Duration("max-clock-skew", time.Second,
+		"warn when the client clock differs from the server's by more than this (0 to skip the check)")
+	latency := flag.Bool("latency", false,
+		"measure WebSocket RTT idle and under load during speed tests and -watch rounds")
+	insecure := flag.Bool("insecure", false,
+		"skip TLS certificate verification (self-signed servers)")
+	tlsClientCert := flag.String("tls-client-cert", "",
+		"client certificate file for servers with -tls-client-ca")
+	tlsClientKey := flag.String("tls-client-key", "",
+		"private key file of -tls-client-cert")
+	token := flag.String("token", "",
+		"bearer token for servers started with -auth-tokens")
+	authBearer := flag.String("auth-bearer", "",
+		"bearer token sent with every request, for a server behind an authenticating reverse proxy")
+	authBasic := flag.String("auth-basic", "",
+		"user:password sent as HTTP Basic auth with every request, for a server behind an authenticating reverse proxy")
+	cookieJar := flag.Bool("cookies", false,
+		"keep cookies the server sets, e.g. the session cookie of an SSO portal on the first request, and send them with the tests")
+	var cookies stringList
+	flag.Var(&cookies, "cookie",
+		"name=value cookie sent with every request, e.g. a session copied from the browser (repeatable; implies -cookies)")
+	var limit bitRate
+	flag.Var(&limit, "limit",
+		"pace the client's own sending and reading to this rate per direction, e.g. 200M, to test on shared or metered links")
+	samples := flag.Int("samples", 100,
+		"number of latency probes to send")
+	sampleInterval := flag.Duration("sample-interval", 10*time.Millisecond,
+		"delay between latency probes")
+	dgramSize := flag.Int("dgram-size", 64,
+		"latency probe size in bytes")
+	udpEcho := flag.String("udp-echo", "",
+		"server: UDP echo listen address, e.g. :9000 (default: off); client: echo port or host:port for -test udp-echo (default: server host, port "+defaultUDPEchoPort+")")
+	connections := flag.Int("connections", 4,
+		"parallel keep-alive connections for -test rps, workers opening connections for -test conn-rate, transfers per direction for -stress")
+	duration := flag.Duration("duration", 10*time.Second,
+		"how long -test rps, -test conn-rate and -stress run")
+	stress := flag.Bool("stress", false,
+		"run -connections downloads and uploads of -s MB at once for -duration and report client CPU and GC pauses next to the rates")
+	objectSize := flag.Int("object-size", 1024,
+		"response size in bytes for -test rps")
+	snmpListen := flag.String("snmp-listen", "",
+		"UDP address for a read-only SNMP v1/v2c agent exposing server stats, e.g. :161 (default: off)")
+	snmpCommunity := flag.String("snmp-community", "public",
+		"SNMP community for -snmp-listen")
+	grpcListen := flag.String("grpc-listen", "",
+		"TCP address for the gRPC control and stats API, e.g. :9090 (default: off); RunTest needs -admin-token")
+	latencyBuckets := flag.String("latency-buckets", "",
+		"bounds of the transfer duration and queue wait histograms, e.g. 10ms,100ms,1s,10s (default 100ms to 2m)")
+	throughputBuckets := flag.String("throughput-buckets", "",
+		"bounds of the transfer throughput histogram in Mbps, e.g. 1,5,10,25,50 (default 1 to 10000)")
+	h3 := flag.Bool("h3", false,
+		"also serve HTTP/3 and QUIC datagram tests on the UDP port of each tls: listener")
+
+	direction := flag.String("direction", directionBoth,
+		"test direction: 'down', 'up', or 'both'")
+	aliasFlag("d", "direction")
+
+	var sndBuf, rcvBuf byteSize
+	flag.Var(&sndBuf, "sndbuf",
+		"SO_SNDBUF for test sockets, e.g. 4M (default: kernel default)")
+	flag.Var(&rcvBuf, "rcvbuf",
+		"SO_RCVBUF for test sockets, e.g. 4M (default: kernel default)")
+	noDelay := flag.Bool("nodelay", true,
+		"set TCP_NODELAY on test sockets; -nodelay=false enables Nagle's algorithm")
+	congestion := flag.String("congestion", "",
+		"TCP congestion control algorithm for test sockets, e.g. cubic or bbr (Linux only)")
+	mptcp := flag.Bool("mptcp", false,
+		"use Multipath TCP for test sockets where the kernel supports it (Linux only)")
+
+	logSyslog := flag.String("log-syslog", "",
+		"send the log to syslog: 'local', 'udp://host[:port]' or 'tcp://host[:port]' (RFC 5424)")
+	logSyslogFacility := flag.String("log-syslog-facility", "daemon",
+		"syslog facility, e.g. daemon or local0")
+	logSample := flag.Int("log-sample", 1,
+		"server: log 1 in N successful tests, 0 for none; errors are always logged")
+	logSummary := flag.Duration("log-summary", 0,
+		"server: log one line with the number and bytes of tests per interval, e.g. 1m; 0 for none")
+
+	payload := flag.String("payload", "",
+		"payload pattern: zeros, random, text, 0xNN or file:path; client: uploads and downloads, server: downloads that do not ask for one (default zeros)")
+	chunked := flag.Bool("chunked", false,
+		"stream downloads with chunked transfer-encoding and no Content-Length; client: request it, server: for every download")
+	unit := flag.String("unit", unitMbps,
+		"show speeds in 'mbps' (megabits/s), 'MBps' (megabytes/s) or 'auto' (the prefix that fits each value); JSON stays in Mbps")
+	binary := flag.Bool("binary", false,
+		"use 1024-based prefixes (Mibit/s, MiB) for speeds and sizes instead of 1000-based ones")
+	precision := flag.Int("precision", -1,
+		"decimals of displayed speeds and sizes (default 1 for speeds, 2 for sizes)")
+	groupDigits := flag.Bool("group-digits", false,
+		"group thousands in displayed numbers, with the separators of the locale (LC_ALL, LC_NUMERIC, LANG)")
+	compress := flag.Bool("compress", false,
+		"have the server gzip downloads on the fly (text payload unless -payload is given) and report wire throughput and goodput")
+
+	flag.Usage = printUsage
+	flag.CommandLine.Parse(args)
+
+	// -json is short for -format json
+	finalFormat := *format
+	if *jsonOut && finalFormat == formatText {
+		finalFormat = formatJSON
+	}
 
-	// Client-specific flags (short and long versions)
-	count := flag.Int("c", 1, "number of speed tests to run")
-	countLong := flag.Int("count", 1, "number of speed tests to run")
+	// With URL templates the report names their host, unless -server is given
+	serverAddr := *server
+	explicit := map[string]bool{}
+	flag.Visit(func(f *flag.Flag) { explicit[f.Name] = true })
+	if t := cmp.Or(*downURL, *upURL); t != "" && !explicit["server"] && !explicit["S"] {
+		serverAddr = cmp.Or(templateHost(t), serverAddr)
+	}
 
-	size := flag.Int("s", 100, "file size per test in MB")
-	sizeLong := flag.Int("size", 100, "file size per test in MB")
+	return Config{
+		Version: *showVersion,
 
-	server := flag.String("S", "speed.cloudflare.com",
-		"server address for tests")
-	serverLong := flag.String("server", "speed.cloudflare.com",
-		"server address for tests")
+		LogSyslog:         *logSyslog,
+		LogSyslogFacility: *logSyslogFacility,
 
-	direction := flag.String("d", directionBoth,
-		"test direction: 'down', 'up', or 'both'")
-	directionLong := flag.String("direction", directionBoth,
-		"test direction: 'down', 'up', or 'both'")
+		LogSample:  *logSample,
+		LogSummary: *logSummary,
 
-	flag.Parse()
+		Payload: *payload,
+		Chunked: *chunked,
 
-	// Resolve flags (prefer long versions if explicitly set)
-	finalCount := *count
-	if *countLong != 1 {
-		finalCount = *countLong
-	}
+		Compress: *compress,
 
-	finalSize := *size
-	if *sizeLong != 100 {
-		finalSize = *sizeLong
-	}
+		Unit:   *unit,
+		Binary: *binary,
 
-	finalServer := *server
-	if *serverLong != "speed.cloudflare.com" {
-		finalServer = *serverLong
-	}
+		Precision:   *precision,
+		GroupDigits: *groupDigits,
 
-	finalDirection := *direction
-	if *directionLong != directionBoth {
-		finalDirection = *directionLong
-	}
+		DB:         *db,
+		Retain:     retain,
+		RetainRows: *retainRows,
+		Rollup:     *rollup,
 
-	return Config{
 		Mode:      *mode,
+		Count:     *count,
+		Size:      *size,
+		Server:    serverAddr,
+		Direction: *direction,
+		Test:      *test,
+		TLS:       *useTLS,
+		Insecure:  *insecure,
+		Token:     *token,
+		Latency:   *latency,
+		Verify:    *verify,
+		JSON:      finalFormat != formatText,
+		Format:    finalFormat,
+		SndBuf:    int(sndBuf),
+		RcvBuf:    int(rcvBuf),
+
+		ExpectContinue: *expectContinue,
+		Preconnect:     *preConnect,
+		FromFirstByte:  *fromFirstByte,
+		MTU:            *mtu,
+
+		TLSClientCert: *tlsClientCert,
+		TLSClientKey:  *tlsClientKey,
+
+		Concurrency: *concurrency,
+		Retries:     *retries,
+		KeepGoing:   *keepGoing,
+
+		AllInterfaces: *allInterfaces,
+
+		ComparePhysical: *comparePhysical,
+
+		NoDelay:    *noDelay,
+		Congestion: *congestion,
+		MPTCP:      *mptcp,
+
+		RemoteFile: *remoteFile,
+		AllowCache: *allowCache,
+
+		NoIdentityCheck: *noIdentityCheck,
+
+		AuthBearer: *authBearer,
+		AuthBasic:  *authBasic,
+
+		CookieJar: *cookieJar,
+		Cookies:   cookies,
+
+		Limit: float64(limit),
+
+		DownPath:   *downPath,
+		UpPath:     *upPath,
+		BytesParam: *bytesParam,
+		DownURL:    *downURL,
+		UpURL:      *upURL,
+
+		MaxClockSkew: *maxClockSkew,
+
+		CompareProtocols: *compareProtocols,
+
+		Plot:       *plot,
+		PlotPrefix: *plotPrefix,
+
+		Watch:     *watch,
+		Interval:  *interval,
+		Schedule:  *schedule,
+		WatchRows: *watchRows,
+
+		DNSTTL:      *dnsTTL,
+		ResolveOnce: *resolveOnce,
+		ReResolve:   *reResolve,
+
+		SkipIfBusy: float64(skipIfBusy),
+		BusyWait:   *busyWait,
+
+		Tags:          tags,
+		Name:          *name,
+		Note:          *note,
+		Report:        *report,
+		Profile:       *profile,
+		HeapProfile:   *heapProfile,
+		Alerts:        alerts,
+		NotifyWebhook: notifyWebhook,
+		NotifyExec:    notifyExec,
+
+		NotifySlack:    notifySlack,
+		NotifyDiscord:  notifyDiscord,
+		NotifyTemplate: *notifyTemplate,
+		NotifyResults:  *notifyResults,
+
+		NotifyEmail:  notifyEmail,
+		SMTPHost:     *smtpHost,
+		SMTPUser:     *smtpUser,
+		SMTPPassword: *smtpPassword,
+		SMTPFrom:     *smtpFrom,
+		EmailSummary: *emailSummary,
+
+		GrafanaURL:       *grafanaURL,
+		GrafanaToken:     *grafanaToken,
+		GrafanaDashboard: *grafanaDashboard,
+
 		Port:      *port,
 		Host:      *host,
-		Count:     finalCount,
-		Size:      finalSize,
-		Server:    finalServer,
-		Direction: finalDirection,
+		Listen:    listenAddrs,
+		ReusePort: *reusePort,
+
+		TLSCert:       *tlsCert,
+		TLSKey:        *tlsKey,
+		TLSMinVersion: *tlsMinVersion,
+		TLSCiphers:    tlsCiphers,
+		TLSSelfSigned: *tlsSelfSigned,
+		TLSCertCache:  *tlsCertCache,
+		TLSClientCA:   *tlsClientCA,
+
+		AdminToken: *adminToken,
+		AuthTokens: *authTokens,
+		ServeFile:  *serveFile,
+		IPQuota:    int64(ipQuota),
+
+		PayloadBlock: int64(payloadBlockSize),
+
+		Debug: *debugLog,
+
+		MaxConcurrent: *maxConcurrent,
+		Queue:         *queue,
+		QueueTimeout:  *queueTimeout,
+		H3:            *h3,
+
+		ReadTimeout:  *readTimeout,
+		WriteTimeout: *writeTimeout,
+		IdleTimeout:  *idleTimeout,
+		MaxIdleConns: *maxIdleConns,
+		NoKeepAlive:  *noKeepAlive,
+		StallTimeout: *stallTimeout,
+
+		ReadHeaderTimeout: *readHeaderTimeout,
+		MaxHeaderBytes:    int(maxHeaderBytes),
+		MaxHeaderConns:    *maxHeaderConns,
+
+		ShutdownTimeout: *shutdownTimeout,
+		MaxTestDuration: *maxTestDuration,
+
+		Allow: allow,
+		Deny:  deny,
+
+		SNMPListen:    *snmpListen,
+		SNMPCommunity: *snmpCommunity,
+
+		GRPCListen: *grpcListen,
+
+		LatencyBuckets:    *latencyBuckets,
+		ThroughputBuckets: *throughputBuckets,
+
+		Samples:        *samples,
+		SampleInterval: *sampleInterval,
+		DgramSize:      *dgramSize,
+		UDPEcho:        *udpEcho,
+
+		Connections: *connections,
+		Stress:      *stress,
+		Duration:    *duration,
+		ObjectSize:  *objectSize,
 	}
 }
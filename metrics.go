@@ -0,0 +1,227 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Default histogram buckets (upper bounds, inclusive). -latency-buckets
+// and -throughput-buckets replace the duration and throughput ones.
+var (
+	sizeBuckets        = []float64{1e6, 5e6, 10e6, 25e6, 50e6, 100e6, 250e6, 500e6, 1e9, 5e9}
+	durationBuckets    = []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120}
+	concurrencyBuckets = []float64{1, 2, 4, 8, 16, 32, 64, 128, 256}
+	throughputBuckets  = []float64{1, 10, 50, 100, 250, 500, 1000, 2500, 5000, 10000}
+	handshakeBuckets   = []float64{0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1}
+)
+
+// parseDurationBuckets parses a -latency-buckets list such as
+// "5ms,50ms,500ms,5s" into seconds
+func parseDurationBuckets(s string) ([]float64, error) {
+	return parseBuckets(s, func(v string) (float64, error) {
+		d, err := time.ParseDuration(v)
+		return d.Seconds(), err
+	})
+}
+
+// parseThroughputBuckets parses a -throughput-buckets list of Mbps such as
+// "1,10,100,1000"
+func parseThroughputBuckets(s string) ([]float64, error) {
+	return parseBuckets(s, func(v string) (float64, error) {
+		return strconv.ParseFloat(v, 64)
+	})
+}
+
+// parseBuckets parses a comma-separated list of increasing, positive
+// bucket bounds
+func parseBuckets(s string, parse func(string) (float64, error)) ([]float64, error) {
+	var bounds []float64
+	for _, item := range strings.Split(s, ",") {
+		v, err := parse(strings.TrimSpace(item))
+		if err != nil || v <= 0 || math.IsInf(v, 0) || math.IsNaN(v) {
+			return nil, fmt.Errorf("invalid bucket '%s'", item)
+		}
+		if len(bounds) > 0 && v <= bounds[len(bounds)-1] {
+			return nil, fmt.Errorf("buckets must increase, '%s' does not", item)
+		}
+		bounds = append(bounds, v)
+	}
+	return bounds, nil
+}
+
+// histogram counts observations into fixed buckets, Prometheus style
+type histogram struct {
+	mu     sync.Mutex
+	bounds []float64
+	counts []uint64 // per bucket, not cumulative; the last one is +Inf
+	sum    float64
+	count  uint64
+}
+
+func newHistogram(bounds []float64) *histogram {
+	return &histogram{bounds: bounds, counts: make([]uint64, len(bounds)+1)}
+}
+
+func (h *histogram) observe(v float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	i := 0
+	for i < len(h.bounds) && v > h.bounds[i] {
+		i++
+	}
+	h.counts[i]++
+	h.sum += v
+	h.count++
+}
+
+// histogramBucket is one cumulative bucket; the +Inf bucket is left out,
+// it always equals Count
+type histogramBucket struct {
+	LE    float64 `json:"le"`
+	Count uint64  `json:"count"`
+}
+
+// histogramSnapshot is a consistent copy of a histogram, as served by /__stats
+type histogramSnapshot struct {
+	Buckets []histogramBucket `json:"buckets"`
+	Count   uint64            `json:"count"`
+	Sum     float64           `json:"sum"`
+}
+
+func (h *histogram) snapshot() histogramSnapshot {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	s := histogramSnapshot{Buckets: make([]histogramBucket, len(h.bounds)), Count: h.count, Sum: h.sum}
+	var cumulative uint64
+	for i, le := range h.bounds {
+		cumulative += h.counts[i]
+		s.Buckets[i] = histogramBucket{LE: le, Count: cumulative}
+	}
+	return s
+}
+
+// writePrometheus writes the snapshot in the Prometheus text format
+func (s histogramSnapshot) writePrometheus(w http.ResponseWriter, name, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", name, help, name)
+	for _, b := range s.Buckets {
+		fmt.Fprintf(w, "%s_bucket{le=\"%s\"} %d\n", name, formatPromFloat(b.LE), b.Count)
+	}
+	fmt.Fprintf(w, "%s_bucket{le=\"+Inf\"} %d\n", name, s.Count)
+	fmt.Fprintf(w, "%s_sum %s\n", name, formatPromFloat(s.Sum))
+	fmt.Fprintf(w, "%s_count %d\n", name, s.Count)
+}
+
+func formatPromFloat(v float64) string {
+	if math.IsInf(v, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// observeTransfer records a completed transfer of n bytes in the duration
+// and throughput histograms
+func observeTransfer(n int64, elapsed time.Duration) {
+	stats.durations.observe(elapsed.Seconds())
+	if elapsed > 0 {
+		stats.throughputs.observe(float64(n) * 8 / elapsed.Seconds() / 1_000_000)
+	}
+}
+
+// trackConcurrent counts a transfer as running until the returned function
+// is called, updating the peak and the concurrency histogram
+func trackConcurrent() (done func()) {
+	current := atomic.AddInt64(&stats.currentConcurrent, 1)
+	peak := atomic.LoadInt64(&stats.peakConcurrent)
+	for current > peak && !atomic.CompareAndSwapInt64(&stats.peakConcurrent, peak, current) {
+		peak = atomic.LoadInt64(&stats.peakConcurrent)
+	}
+	stats.concurrency.observe(float64(current))
+	return func() { atomic.AddInt64(&stats.currentConcurrent, -1) }
+}
+
+// metricsHandler serves server statistics in the Prometheus text format
+func metricsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		httpError(w, codeMethodNotAllowed, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	stats.mu.RLock()
+	totalDownloads := stats.totalDownloads
+	totalUploads := stats.totalUploads
+	totalBytesDown := stats.totalBytesDown
+	totalBytesUp := stats.totalBytesUp
+	totalConnections := stats.totalConnections
+	startTime := stats.startTime
+	stats.mu.RUnlock()
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+
+	counter := func(name, help string, v int64) {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n%s %d\n", name, help, name, name, v)
+	}
+	gauge := func(name, help string, v float64) {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n%s %s\n", name, help, name, name, formatPromFloat(v))
+	}
+
+	counter("ethspeed_downloads_total", "Download tests served.", totalDownloads)
+	counter("ethspeed_uploads_total", "Upload tests served.", totalUploads)
+	counter("ethspeed_download_bytes_total", "Bytes sent in download tests.", totalBytesDown)
+	counter("ethspeed_upload_bytes_total", "Bytes received in upload tests.", totalBytesUp)
+	counter("ethspeed_connections_total", "Connections counted by the server.", totalConnections)
+	gauge("ethspeed_transfers_current", "Transfers in progress.", float64(atomic.LoadInt64(&stats.currentConcurrent)))
+	gauge("ethspeed_transfers_peak", "Highest number of simultaneous transfers since start.", float64(atomic.LoadInt64(&stats.peakConcurrent)))
+	gauge("ethspeed_queue_depth", "Transfers waiting for a -max-concurrent slot.", float64(atomic.LoadInt64(&stats.currentQueued)))
+	counter("ethspeed_queue_rejected_total", "Transfers refused with 503 by -max-concurrent/-queue.", atomic.LoadInt64(&stats.queueRejected))
+	counter("ethspeed_results_ingested_total", "Client result rounds stored through /__results.", atomic.LoadInt64(&stats.resultsIngested))
+	gauge("ethspeed_idle_connections", "Keep-alive connections waiting for their next request.", float64(serverIdle.count()))
+	counter("ethspeed_idle_closed_total", "Idle keep-alive connections closed for -max-idle-conns.", serverIdle.closed.Load())
+	gauge("ethspeed_header_connections", "Connections still sending their request headers.", float64(serverHeaders.count()))
+	counter("ethspeed_header_rejected_total", "Connections closed for -max-header-conns.", serverHeaders.rejected.Load())
+	counter("ethspeed_truncated_transfers_total", "/__down and /__up transfers cut short by their time limit.", atomic.LoadInt64(&stats.truncated))
+	counter("ethspeed_corrupt_chunks_total", "-verify upload chunks that failed their CRC.", atomic.LoadInt64(&stats.corruptChunks))
+	gauge("ethspeed_start_time_seconds", "Unix time the server started.", float64(startTime.UnixNano())/float64(time.Second))
+	fmt.Fprintf(w, "# HELP ethspeed_build_info Build of the running server, always 1.\n# TYPE ethspeed_build_info gauge\nethspeed_build_info{version=%q,commit=%q,go_version=%q} 1\n",
+		build.Version, build.Commit, build.GoVersion)
+
+	stats.requestSizes.snapshot().writePrometheus(w, "ethspeed_request_size_bytes", "Requested transfer sizes.")
+	stats.durations.snapshot().writePrometheus(w, "ethspeed_transfer_duration_seconds", "Durations of completed transfers.")
+	stats.throughputs.snapshot().writePrometheus(w, "ethspeed_transfer_throughput_mbps", "Server-side throughput of completed transfers in Mbps.")
+	stats.concurrency.snapshot().writePrometheus(w, "ethspeed_concurrent_transfers", "Transfers running when a transfer started, itself included.")
+	stats.queueWaits.snapshot().writePrometheus(w, "ethspeed_queue_wait_seconds", "Time queued transfers waited for a slot.")
+	stats.tlsFull.snapshot().writePrometheus(w, "ethspeed_tls_full_handshake_seconds", "Server-side durations of full TLS handshakes.")
+	stats.tlsResumed.snapshot().writePrometheus(w, "ethspeed_tls_resumed_handshake_seconds", "Server-side durations of TLS handshakes that resumed a session.")
+
+	if tokens != nil {
+		usages := tokenUsages()
+		perToken := func(name, kind, help string, value func(tokenUsage) int64) {
+			fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+			for _, u := range usages {
+				fmt.Fprintf(w, "%s{token=%q} %d\n", name, u.Name, value(u))
+			}
+		}
+		perToken("ethspeed_token_bytes_total", "counter", "Bytes transferred per token.", func(u tokenUsage) int64 { return u.TotalBytes })
+		perToken("ethspeed_token_tests_total", "counter", "Tests run per token.", func(u tokenUsage) int64 { return u.TotalTests })
+		perToken("ethspeed_token_period_bytes", "gauge", "Bytes transferred per token in the current quota period.", func(u tokenUsage) int64 { return u.Bytes })
+		perToken("ethspeed_token_period_tests", "gauge", "Tests run per token in the current quota period.", func(u tokenUsage) int64 { return u.Tests })
+	}
+
+	if certs := certUsageList(); len(certs) > 0 {
+		perCert := func(name, help string, value func(certUsage) int64) {
+			fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", name, help, name)
+			for _, u := range certs {
+				fmt.Fprintf(w, "%s{cn=%q,fingerprint=%q} %d\n", name, u.Name, u.Fingerprint, value(u))
+			}
+		}
+		perCert("ethspeed_client_cert_bytes_total", "Bytes transferred per client certificate.", func(u certUsage) int64 { return u.TotalBytes })
+		perCert("ethspeed_client_cert_tests_total", "Tests run per client certificate.", func(u certUsage) int64 { return u.TotalTests })
+	}
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	mptcpSupported = true
+
+	mptcpInfoOpt = 1 // MPTCP_INFO from linux/mptcp.h
+)
+
+// mptcpSubflows returns the number of additional subflows of an MPTCP
+// socket (mptcp_info.mptcpi_subflows, the initial subflow is not counted).
+func mptcpSubflows(fd uintptr) (int, error) {
+	// struct mptcp_info starts with __u8 mptcpi_subflows; the kernel copies
+	// at most len bytes, so a short buffer is fine.
+	var buf [64]byte
+	size := uint32(len(buf))
+	_, _, errno := unix.Syscall6(unix.SYS_GETSOCKOPT, fd, unix.SOL_MPTCP, mptcpInfoOpt,
+		uintptr(unsafe.Pointer(&buf[0])), uintptr(unsafe.Pointer(&size)), 0)
+	if errno != 0 {
+		return 0, errno
+	}
+	return int(buf[0]), nil
+}
@@ -0,0 +1,11 @@
+//go:build !linux
+
+package main
+
+import "fmt"
+
+const mptcpSupported = false
+
+func mptcpSubflows(fd uintptr) (int, error) {
+	return 0, fmt.Errorf("MPTCP is only supported on Linux")
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"sync"
+)
+
+// clientCertificates is the client's -tls-client-cert and -tls-client-key,
+// presented to servers that require one (-tls-client-ca)
+var clientCertificates []tls.Certificate
+
+// clientTLSConfig is the TLS configuration of the client's test connections
+func (c Config) clientTLSConfig() *tls.Config {
+	return &tls.Config{InsecureSkipVerify: c.Insecure, Certificates: clientCertificates}
+}
+
+// loadClientCAs reads the -tls-client-ca bundle of PEM certificates
+func loadClientCAs(path string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("tls-client-ca: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("tls-client-ca: no PEM certificates in %s", path)
+	}
+	return pool, nil
+}
+
+// peerIdentity returns the common name and SHA-256 fingerprint of a
+// request's client certificate, empty without mTLS
+func peerIdentity(r *http.Request) (cn, fingerprint string) {
+	if r.TLS == nil || len(r.TLS.PeerCertificates) == 0 {
+		return "", ""
+	}
+	cert := r.TLS.PeerCertificates[0]
+	return cert.Subject.CommonName, certFingerprint(cert.Raw)
+}
+
+// peerNote returns a log suffix naming the client certificate, so that
+// sites behind one NAT address can be told apart; "" without mTLS
+func peerNote(r *http.Request) string {
+	cn, fingerprint := peerIdentity(r)
+	switch {
+	case fingerprint == "":
+		return ""
+	case cn == "":
+		return " [cert " + fingerprint[:16] + "]"
+	}
+	return fmt.Sprintf(" [cert %q %s]", cn, fingerprint[:16])
+}
+
+// certUsage is the /__stats view of the tests run with one client
+// certificate
+type certUsage struct {
+	Name        string `json:"cn"`
+	Fingerprint string `json:"fingerprint"`
+	TotalBytes  int64  `json:"total_bytes"`
+	TotalTests  int64  `json:"total_tests"`
+}
+
+// certUsages accounts transfers per client certificate, by fingerprint
+var certUsages = struct {
+	sync.Mutex
+	byFingerprint map[string]*certUsage
+}{byFingerprint: make(map[string]*certUsage)}
+
+// chargeCert counts a transfer of n bytes against the request's client
+// certificate and returns the function that corrects it to the bytes
+// actually transferred; both do nothing without mTLS
+func chargeCert(r *http.Request, n int64) (settle func(actual int64)) {
+	cn, fingerprint := peerIdentity(r)
+	if fingerprint == "" {
+		return func(int64) {}
+	}
+	certUsages.Lock()
+	u, ok := certUsages.byFingerprint[fingerprint]
+	if !ok {
+		u = &certUsage{Name: cn, Fingerprint: fingerprint}
+		certUsages.byFingerprint[fingerprint] = u
+	}
+	u.TotalTests++
+	u.TotalBytes += n
+	certUsages.Unlock()
+
+	return func(actual int64) {
+		certUsages.Lock()
+		u.TotalBytes += actual - n
+		certUsages.Unlock()
+	}
+}
+
+// certUsageList returns the per-certificate usage sorted by name
+func certUsageList() []certUsage {
+	certUsages.Lock()
+	defer certUsages.Unlock()
+	list := make([]certUsage, 0, len(certUsages.byFingerprint))
+	for _, u := range certUsages.byFingerprint {
+		list = append(list, *u)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Name != list[j].Name {
+			return list[i].Name < list[j].Name
+		}
+		return list[i].Fingerprint < list[j].Fingerprint
+	})
+	return list
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// Chat services with incoming webhooks
+const (
+	chatSlack   = "slack"
+	chatDiscord = "discord"
+)
+
+// defaultChatTemplate renders both alerts and result summaries
+const defaultChatTemplate = `ethspeed {{.Server}}: {{.Text}}`
+
+var slackEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+// chatMessage is the data -notify-template is executed with. Kind is
+// "alert" (Alert set) or "result" (Round set); Text is the default
+// one-line rendering of either.
+type chatMessage struct {
+	Kind   string
+	Server string
+	Time   time.Time
+	Text   string
+	Alert  *alertEvent
+	Round  *watchRound
+}
+
+// chatNotifier posts to a Slack or Discord incoming webhook
+type chatNotifier struct {
+	service string
+	url     string
+	tmpl    *template.Template
+}
+
+// parseChatTemplate parses a -notify-template value, or the default
+func parseChatTemplate(text string) (*template.Template, error) {
+	if text == "" {
+		text = defaultChatTemplate
+	}
+	tmpl, err := template.New("notify").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid notify-template: %w", err)
+	}
+	return tmpl, nil
+}
+
+func (n chatNotifier) String() string { return n.service + " webhook" }
+
+func (n chatNotifier) notify(ctx context.Context, e alertEvent) error {
+	return n.post(ctx, chatMessage{Kind: "alert", Server: e.Server, Time: e.Time, Text: e.String(), Alert: &e})
+}
+
+func (n chatNotifier) notifyResult(ctx context.Context, server string, r watchRound) error {
+	return n.post(ctx, chatMessage{Kind: "result", Server: server, Time: r.Time, Text: roundSummary(r), Round: &r})
+}
+
+func (n chatNotifier) post(ctx context.Context, msg chatMessage) error {
+	var text strings.Builder
+	if err := n.tmpl.Execute(&text, msg); err != nil {
+		return fmt.Errorf("notify-template: %w", err)
+	}
+
+	// Both services take a JSON object with the message in one field.
+	// Slack treats <...> as links, so rule texts like "down < 100" are escaped.
+	field, content := "text", slackEscaper.Replace(text.String())
+	if n.service == chatDiscord {
+		field, content = "content", text.String()
+	}
+	body, err := json.Marshal(map[string]string{field: content})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("%s returned status %d", n.service, resp.StatusCode)
+	}
+	return nil
+}
+
+// roundSummary is the one-line rendering of a -watch round
+func roundSummary(r watchRound) string {
+	if r.Error != "" {
+		return "test failed: " + r.Error
+	}
+	var parts []string
+	if r.Download != nil {
+		parts = append(parts, fmt.Sprintf("down %.1f Mbps", r.Download.Mbps))
+	}
+	if r.Upload != nil {
+		parts = append(parts, fmt.Sprintf("up %.1f Mbps", r.Upload.Mbps))
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// emailNotifier sends alerts and daily summaries over SMTP. Port 465 uses
+// implicit TLS; on other ports STARTTLS is used when the server offers it.
+type emailNotifier struct {
+	addr     string // host:port
+	user     string
+	password string
+	from     string
+	to       []string
+}
+
+func (n emailNotifier) String() string { return "email " + strings.Join(n.to, ",") }
+
+func (n emailNotifier) notify(ctx context.Context, e alertEvent) error {
+	subject := fmt.Sprintf("[ethspeed] %s: %s", e.Server, e)
+
+	var body strings.Builder
+	fmt.Fprintf(&body, "%s\n\n", e)
+	fmt.Fprintf(&body, "Server: %s\n", e.Server)
+	fmt.Fprintf(&body, "Rule:   %s\n", e.Rule)
+	fmt.Fprintf(&body, "State:  %s\n", e.State)
+	if e.Metric != "error" {
+		fmt.Fprintf(&body, "Value:  %.1f Mbps\n", e.Value)
+	}
+	if e.Error != "" {
+		fmt.Fprintf(&body, "Error:  %s\n", e.Error)
+	}
+	fmt.Fprintf(&body, "Time:   %s\n", e.Time.Format(time.RFC1123Z))
+
+	return n.send(ctx, subject, body.String())
+}
+
+// send delivers one plain-text message to all recipients
+func (n emailNotifier) send(ctx context.Context, subject, body string) error {
+	host, port, err := net.SplitHostPort(n.addr)
+	if err != nil {
+		return err
+	}
+
+	dialer := &net.Dialer{}
+	var conn net.Conn
+	if port == "465" {
+		conn, err = (&tls.Dialer{NetDialer: dialer, Config: &tls.Config{ServerName: host}}).DialContext(ctx, "tcp", n.addr)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", n.addr)
+	}
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	if _, isTLS := conn.(*tls.Conn); !isTLS {
+		if ok, _ := c.Extension("STARTTLS"); ok {
+			if err := c.StartTLS(&tls.Config{ServerName: host}); err != nil {
+				return err
+			}
+		}
+	}
+	if n.user != "" {
+		// PlainAuth refuses to send credentials without TLS, except to localhost
+		if err := c.Auth(smtp.PlainAuth("", n.user, n.password, host)); err != nil {
+			return err
+		}
+	}
+
+	if err := c.Mail(n.from); err != nil {
+		return err
+	}
+	for _, rcpt := range n.to {
+		if err := c.Rcpt(rcpt); err != nil {
+			return err
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+
+	headers := []string{
+		"From: " + n.from,
+		"To: " + strings.Join(n.to, ", "),
+		"Subject: " + mime.QEncoding.Encode("utf-8", subject),
+		"Date: " + time.Now().Format(time.RFC1123Z),
+		"MIME-Version: 1.0",
+		"Content-Type: text/plain; charset=utf-8",
+	}
+	msg := strings.Join(headers, "\r\n") + "\r\n\r\n" + strings.ReplaceAll(body, "\n", "\r\n")
+	if _, err := w.Write([]byte(msg)); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+// dailySummary collects -watch rounds and mails a digest once a day at
+// the configured time of day
+type dailySummary struct {
+	email  emailNotifier
+	server string
+	at     time.Duration // offset from local midnight
+	next   time.Time
+
+	since  time.Time
+	stats  watchStats
+	alerts []string
+}
+
+// parseTimeOfDay parses "HH:MM" into an offset from midnight
+func parseTimeOfDay(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time of day '%s', expected HH:MM", s)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+func newDailySummary(email emailNotifier, server string, at time.Duration) *dailySummary {
+	now := time.Now()
+	s := &dailySummary{email: email, server: server, at: at, since: now}
+	s.next = s.nextAfter(now)
+	return s
+}
+
+func (s *dailySummary) nextAfter(t time.Time) time.Time {
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	next := midnight.Add(s.at)
+	if !next.After(t) {
+		next = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location()).Add(s.at)
+	}
+	return next
+}
+
+// add records a round and the alert messages it raised; once the summary
+// time has passed the digest is sent and collection starts over.
+func (s *dailySummary) add(ctx context.Context, r watchRound, alerts []string) error {
+	s.stats.add(r)
+	s.alerts = append(s.alerts, alerts...)
+
+	if r.Time.Before(s.next) {
+		return nil
+	}
+
+	subject := fmt.Sprintf("[ethspeed] %s: daily summary, %d tests, %d failed", s.server, s.stats.rounds, s.stats.failed)
+
+	var body strings.Builder
+	fmt.Fprintf(&body, "Server: %s\n", s.server)
+	fmt.Fprintf(&body, "Period: %s - %s\n\n", s.since.Format(time.RFC1123Z), r.Time.Format(time.RFC1123Z))
+	fmt.Fprintf(&body, "Tests:  %d (%d failed)\n\n", s.stats.rounds, s.stats.failed)
+	fmt.Fprintf(&body, "%-5s | %-8s | %-8s\n", displayUnit.label(), "down", "up")
+	fmt.Fprintf(&body, "%-5s | %-8s | %-8s\n", "avg", formatMbpsCell(calculateAverage(s.stats.downs)), formatMbpsCell(calculateAverage(s.stats.ups)))
+	fmt.Fprintf(&body, "%-5s | %-8s | %-8s\n", "min", formatMbpsCell(minOf(s.stats.downs)), formatMbpsCell(minOf(s.stats.ups)))
+	fmt.Fprintf(&body, "%-5s | %-8s | %-8s\n", "max", formatMbpsCell(maxOf(s.stats.downs)), formatMbpsCell(maxOf(s.stats.ups)))
+	if len(s.alerts) > 0 {
+		fmt.Fprintf(&body, "\nAlerts:\n")
+		for _, a := range s.alerts {
+			fmt.Fprintf(&body, "  %s\n", a)
+		}
+	}
+
+	*s = dailySummary{email: s.email, server: s.server, at: s.at, since: r.Time, next: s.nextAfter(r.Time)}
+	return s.email.send(ctx, subject, body.String())
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// grafanaNotifier creates Grafana annotations through its HTTP API, so
+// tests and alerts show up as markers on existing dashboards. Without a
+// dashboard the annotations are organization-wide and appear on every
+// dashboard with an annotation query for the "ethspeed" tag.
+type grafanaNotifier struct {
+	url       string // Grafana base URL
+	token     string // service account token or API key
+	dashboard string // dashboard UID, empty for organization-wide
+}
+
+// grafanaAnnotation is the body of POST /api/annotations
+type grafanaAnnotation struct {
+	DashboardUID string   `json:"dashboardUID,omitempty"`
+	Time         int64    `json:"time"` // Unix milliseconds
+	Tags         []string `json:"tags"`
+	Text         string   `json:"text"`
+}
+
+// parseGrafanaURL checks a -grafana-url value
+func parseGrafanaURL(s string) error {
+	u, err := url.Parse(s)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid grafana-url '%s', expected http(s)://host[:port][/path]", s)
+	}
+	return nil
+}
+
+func (n grafanaNotifier) String() string { return "grafana " + n.url }
+
+func (n grafanaNotifier) notify(ctx context.Context, e alertEvent) error {
+	return n.annotate(ctx, e.Time, e.Server, e.Tags, []string{"alert", e.State}, e.String())
+}
+
+func (n grafanaNotifier) notifyResult(ctx context.Context, server string, r watchRound) error {
+	kind := "test"
+	if r.Error != "" {
+		kind = "error"
+	}
+	return n.annotate(ctx, r.Time, server, r.Tags, []string{kind}, "ethspeed "+roundSummary(r))
+}
+
+// annotateReport marks a single (non -watch) speed test
+func (n grafanaNotifier) annotateReport(ctx context.Context, r *speedReport) error {
+	text, kind := "test failed: "+r.Error, "error"
+	if r.Error == "" {
+		var parts []string
+		if r.AvgDownloadMbps > 0 {
+			parts = append(parts, fmt.Sprintf("down %.1f Mbps", r.AvgDownloadMbps))
+		}
+		if r.AvgUploadMbps > 0 {
+			parts = append(parts, fmt.Sprintf("up %.1f Mbps", r.AvgUploadMbps))
+		}
+		text, kind = strings.Join(parts, ", "), "test"
+	}
+	if r.Name != "" {
+		text += " (" + r.Name + ")"
+	}
+	return n.annotate(ctx, r.Time, r.Server, r.Tags, []string{kind}, "ethspeed "+text)
+}
+
+// annotate posts one annotation. Its tags are "ethspeed", the kinds, the
+// server and the -tag labels as key:value, Grafana's usual tag form.
+func (n grafanaNotifier) annotate(ctx context.Context, at time.Time, server string, labels map[string]string, kinds []string, text string) error {
+	tags := append([]string{"ethspeed"}, kinds...)
+	tags = append(tags, "server:"+server)
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		tags = append(tags, k+":"+labels[k])
+	}
+
+	body, err := json.Marshal(grafanaAnnotation{DashboardUID: n.dashboard, Time: at.UnixMilli(), Tags: tags, Text: text})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(n.url, "/")+"/api/annotations", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if n.token != "" {
+		req.Header.Set("Authorization", "Bearer "+n.token)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("grafana returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// annotateTest marks a finished single speed test in Grafana and tells
+// the user when that failed, on stderr with JSON output
+func annotateTest(config Config, report *speedReport) {
+	n := grafanaNotifier{config.GrafanaURL, config.GrafanaToken, config.GrafanaDashboard}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := n.annotateReport(ctx, report); err != nil {
+		out := os.Stdout
+		if config.JSON {
+			out = os.Stderr
+		}
+		fmt.Fprintf(out, "ERROR: grafana annotation: %v\n", err)
+	}
+}
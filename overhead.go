@@ -0,0 +1,107 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+)
+
+// Framing added to a transfer's body on its way over Ethernet. A saturated
+// gigabit link carries about 940 Mbps of goodput: the rest is headers.
+const (
+	defaultMTU = 1500
+
+	// Per frame: MAC header 14, FCS 4, preamble 8 and inter-frame gap 12
+	ethernetFraming = 38
+	// TCP header with the timestamp option, on by default on Linux and macOS
+	tcpHeader = 32
+
+	tlsMaxRecord  = 16384
+	http2MaxFrame = 16384
+	http2Frame    = 9 // frame header
+)
+
+// tlsRecordOverhead is the record header, AEAD tag and, before TLS 1.3,
+// explicit nonce of an AES-GCM or ChaCha20 record
+func tlsRecordOverhead(version uint16) int64 {
+	if version >= tls.VersionTLS13 {
+		return 5 + 16 + 1
+	}
+	return 5 + 8 + 16
+}
+
+// lineBytes estimates the bytes on the wire for body bytes of one direction
+// of an HTTP exchange, whose message head took head bytes
+func lineBytes(body, head int64, http2 bool, tlsVersion uint16, ipv6 bool, mtu int) int64 {
+	n := body + head
+	if http2 {
+		n += ceilDiv(body, http2MaxFrame) * http2Frame
+	}
+	if tlsVersion != 0 {
+		n += ceilDiv(n, tlsMaxRecord) * tlsRecordOverhead(tlsVersion)
+	}
+	ipHeader := int64(20)
+	if ipv6 {
+		ipHeader = 40
+	}
+	mss := int64(mtu) - ipHeader - tcpHeader
+	return n + ceilDiv(n, mss)*(ipHeader+tcpHeader+ethernetFraming)
+}
+
+func ceilDiv(a, b int64) int64 {
+	return (a + b - 1) / b
+}
+
+// headBytes approximates the size of an HTTP/1.1 message head with the
+// given start line; HPACK makes HTTP/2 heads smaller still
+func headBytes(startLine string, h http.Header) int64 {
+	n := int64(len(startLine)) + 2
+	for k, vs := range h {
+		for _, v := range vs {
+			n += int64(len(k)+len(v)) + 4
+		}
+	}
+	return n + 2
+}
+
+// withRemoteAddr returns req traced to store the address of the connection
+// it is sent on in *remote
+func withRemoteAddr(req *http.Request, remote *net.Addr) *http.Request {
+	return req.WithContext(httptrace.WithClientTrace(req.Context(), &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) { *remote = info.Conn.RemoteAddr() },
+	}))
+}
+
+// estimateLine fills in the estimated wire figures of a transfer whose body
+// took body bytes over HTTP/1.1 or HTTP/2 (QUIC is left out)
+func (t *transferResult) estimateLine(body, head int64, resp *http.Response, remote net.Addr, mtu int) {
+	if resp.ProtoMajor > 2 || t.Duration <= 0 {
+		return
+	}
+	var tlsVersion uint16
+	if resp.TLS != nil {
+		tlsVersion = resp.TLS.Version
+	}
+	ipv6 := false
+	if a, ok := remote.(*net.TCPAddr); ok {
+		ipv6 = a.IP.To4() == nil
+	}
+	t.LineBytes = lineBytes(body, head, resp.ProtoMajor == 2, tlsVersion, ipv6, mtu)
+	t.LineMbps = float64(t.LineBytes) * 8 / t.Duration.Seconds() / 1_000_000
+}
+
+// overheadNote describes the estimated wire rate of a transfer for its
+// sparkline, "" without an estimate
+func (t *transferResult) overheadNote() string {
+	body := t.Bytes
+	if t.WireBytes > 0 {
+		body = t.WireBytes
+	}
+	if t.LineBytes == 0 || body == 0 {
+		return ""
+	}
+	return fmt.Sprintf(" | line ~%s (+%.1f%% framing)", displayUnit.format(t.LineMbps),
+		(float64(t.LineBytes)/float64(body)-1)*100)
+}
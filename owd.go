@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// owdStamp holds the timestamps of one WebSocket probe in unix nanoseconds:
+// client send, server receive (the echo follows at once) and client receive
+type owdStamp struct {
+	sent, server, received int64
+}
+
+func (s owdStamp) rtt() int64 { return s.received - s.sent }
+
+// offset is the server clock minus the client clock under the assumption
+// that both directions took equally long
+func (s owdStamp) offset() int64 { return s.server - (s.sent+s.received)/2 }
+
+// estimateClockOffset works like NTP's clock filter: the probes with the
+// lowest RTT had the least queueing, so their symmetric-path assumption is
+// the most accurate. It returns the median offset of the best tenth and
+// the largest RTT among them.
+func estimateClockOffset(stamps []owdStamp) (offset, rtt time.Duration) {
+	sorted := append([]owdStamp(nil), stamps...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].rtt() < sorted[j].rtt() })
+	best := sorted[:max(1, len(sorted)/10)]
+
+	offsets := make([]float64, len(best))
+	for i, s := range best {
+		offsets[i] = float64(s.offset())
+	}
+	sort.Float64s(offsets)
+	return time.Duration(percentile(offsets, 50)), time.Duration(best[len(best)-1].rtt())
+}
+
+// oneWayDelays splits probes into upstream and downstream delays in ms
+func oneWayDelays(stamps []owdStamp, offset time.Duration) (up, down []float64) {
+	for _, s := range stamps {
+		up = append(up, durationMs(time.Duration(s.server-s.sent)-offset))
+		down = append(down, durationMs(time.Duration(s.received-s.server)+offset))
+	}
+	return up, down
+}
+
+// runOWDTest measures one-way delays over the WebSocket pinger while the
+// link is idle and during the transfers of -direction. Bufferbloat on the
+// uplink shows up as growing upstream delay, which an RTT cannot tell
+// apart from downlink queueing.
+func runOWDTest(config Config) error {
+	fmt.Printf("One-way delay test - probes every %v, %d MB transfers\n", config.SampleInterval, config.Size)
+	fmt.Printf("Server: %s\n\n", config.Server)
+
+	pinger, err := startWSPinger(config, config.SampleInterval)
+	if err != nil {
+		return err
+	}
+
+	deadline := time.Now().Add(time.Duration(config.Samples)*config.SampleInterval + 5*time.Second)
+	for len(pinger.timestamps()) < config.Samples && time.Now().Before(deadline) {
+		time.Sleep(config.SampleInterval)
+	}
+	idle := pinger.timestamps()
+	if len(idle) == 0 {
+		pinger.stop()
+		return fmt.Errorf("no probe answered")
+	}
+	if idle[0].server == 0 {
+		pinger.stop()
+		return fmt.Errorf("server does not send timestamps")
+	}
+
+	type phase struct {
+		name   string
+		stamps []owdStamp
+	}
+	phases := []phase{{name: fmt.Sprintf("Idle (%d probes)", len(idle)), stamps: idle}}
+
+	run := func(name string, test func(Config) (*transferResult, error)) error {
+		start := len(pinger.timestamps())
+		result, err := test(config)
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		stamps := pinger.timestamps()[start:]
+		phases = append(phases, phase{
+			name:   fmt.Sprintf("%s %.1f Mbps (%d probes)", name, result.Mbps, len(stamps)),
+			stamps: stamps,
+		})
+		return nil
+	}
+	if config.Direction != directionUp {
+		err = run("Download", runDownloadTest)
+	}
+	if err == nil && config.Direction != directionDown {
+		err = run("Upload", runUploadTest)
+	}
+	pinger.stop()
+
+	offset, rtt := estimateClockOffset(idle)
+	fmt.Printf("Clock offset (server - client): %+.3f ms, from the fastest idle probes (RTT <= %.3f ms)\n\n",
+		durationMs(offset), durationMs(rtt))
+
+	for _, p := range phases {
+		if len(p.stamps) == 0 {
+			continue
+		}
+		up, down := oneWayDelays(p.stamps, offset)
+		fmt.Println(p.name)
+		fmt.Printf("  up ms:   %s\n", formatRTTStats(up))
+		fmt.Printf("  down ms: %s\n", formatRTTStats(down))
+	}
+	fmt.Println("\nAbsolute values assume a symmetric idle path; the growth under load is exact.")
+	return err
+}
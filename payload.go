@@ -0,0 +1,253 @@
+package main
+
+import (
+	crand "crypto/rand"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Payload kinds of -payload
+const (
+	payloadZeros  = "zeros"
+	payloadRandom = "random"
+	payloadByte   = "byte" // a repeated byte such as 0x55
+	payloadFile   = "file"
+	payloadText   = "text" // log-like lines that gzip about 5:1
+)
+
+// payloadSpec is a parsed -payload value: "zeros", "random", "text", a
+// byte such as "0x55", or "file:path". Patterns exercise middleboxes
+// differently: zeros compress and dedup perfectly, random data not at all,
+// text like real-world logs and JSON, and 0x55 (alternating bits) stresses
+// PHY scrambling.
+type payloadSpec struct {
+	kind string
+	fill byte
+	data []byte // file contents
+}
+
+// maxPayloadFile bounds -payload file:, which is kept in memory
+const maxPayloadFile = 256 * 1024 * 1024
+
+func parsePayload(s string) (payloadSpec, error) {
+	switch {
+	case s == "" || s == payloadZeros:
+		return payloadSpec{kind: payloadZeros}, nil
+	case s == payloadRandom:
+		return payloadSpec{kind: payloadRandom}, nil
+	case s == payloadText:
+		return payloadSpec{kind: payloadText}, nil
+	case strings.HasPrefix(s, "0x"):
+		b, err := strconv.ParseUint(s[2:], 16, 8)
+		if err != nil {
+			return payloadSpec{}, fmt.Errorf("invalid payload byte '%s'", s)
+		}
+		return payloadSpec{kind: payloadByte, fill: byte(b)}, nil
+	case strings.HasPrefix(s, payloadFile+":"):
+		data, err := loadPayloadFile(strings.TrimPrefix(s, payloadFile+":"))
+		if err != nil {
+			return payloadSpec{}, err
+		}
+		return payloadSpec{kind: payloadFile, data: data}, nil
+	}
+	return payloadSpec{}, fmt.Errorf("invalid payload '%s', expected zeros, random, text, 0xNN or file:path", s)
+}
+
+// payloadFiles keeps what loadPayloadFile read: Config.validate parses
+// -payload before the client or server setup parses it again
+var payloadFiles = struct {
+	sync.Mutex
+	byPath map[string][]byte
+}{byPath: make(map[string][]byte)}
+
+// loadPayloadFile returns the contents of a -payload file:, reading it on
+// first use only
+func loadPayloadFile(path string) ([]byte, error) {
+	payloadFiles.Lock()
+	defer payloadFiles.Unlock()
+	if data, ok := payloadFiles.byPath[path]; ok {
+		return data, nil
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("payload: %w", err)
+	}
+	if info.Size() == 0 || info.Size() > maxPayloadFile {
+		return nil, fmt.Errorf("payload file must be between 1 byte and %s", formatBytes(maxPayloadFile))
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("payload: %w", err)
+	}
+	payloadFiles.byPath[path] = data
+	return data, nil
+}
+
+// query is the payload parameter asking the server for this pattern
+func (p payloadSpec) query() string {
+	switch p.kind {
+	case payloadByte:
+		return fmt.Sprintf("0x%02x", p.fill)
+	default:
+		return p.kind
+	}
+}
+
+// static reports whether every buffer of the pattern is the same, so a
+// filled buffer can be sent over and over
+func (p payloadSpec) static() bool {
+	return p.kind == payloadZeros || p.kind == payloadByte
+}
+
+// reader returns an endless stream of the pattern
+func (p payloadSpec) reader() io.Reader {
+	switch p.kind {
+	case payloadRandom:
+		var seed [32]byte
+		crand.Read(seed[:])
+		return rand.NewChaCha8(seed)
+	case payloadFile:
+		return &repeatReader{data: p.data}
+	case payloadText:
+		return newTextReader()
+	default:
+		return &repeatReader{data: []byte{p.fill}}
+	}
+}
+
+// textReader yields endless access-log lines with random fields, a
+// stand-in for the logs, JSON and HTML that compressing middleboxes see
+type textReader struct {
+	rng  *rand.Rand
+	line []byte
+	off  int
+}
+
+var (
+	textLevels  = []string{"INFO", "INFO", "INFO", "WARN", "DEBUG", "ERROR"}
+	textMethods = []string{"GET", "GET", "GET", "POST", "PUT", "DELETE"}
+	textPaths   = []string{"/api/v1/items/", "/api/v1/users/", "/static/js/app.", "/api/v2/orders/", "/health", "/images/thumb/"}
+	textAgents  = []string{"Mozilla/5.0", "curl/8.5.0", "okhttp/4.12.0", "Go-http-client/2.0"}
+)
+
+func newTextReader() *textReader {
+	return &textReader{rng: rand.New(rand.NewPCG(rand.Uint64(), rand.Uint64()))}
+}
+
+func (t *textReader) Read(p []byte) (int, error) {
+	n := 0
+	for n < len(p) {
+		if t.off == len(t.line) {
+			t.nextLine()
+		}
+		c := copy(p[n:], t.line[t.off:])
+		n += c
+		t.off += c
+	}
+	return n, nil
+}
+
+func (t *textReader) nextLine() {
+	r := t.rng
+	b := t.line[:0]
+	b = append(b, "2026-01-"...)
+	b = strconv.AppendInt(b, 10+r.Int64N(18), 10)
+	b = append(b, 'T', '1')
+	b = strconv.AppendInt(b, r.Int64N(10), 10)
+	b = append(b, ':', '4')
+	b = strconv.AppendInt(b, r.Int64N(10), 10)
+	b = append(b, ':', '1')
+	b = strconv.AppendInt(b, r.Int64N(10), 10)
+	b = append(b, '.')
+	b = strconv.AppendInt(b, 100+r.Int64N(900), 10)
+	b = append(b, "Z "...)
+	b = append(b, textLevels[r.IntN(len(textLevels))]...)
+	b = append(b, " request method="...)
+	b = append(b, textMethods[r.IntN(len(textMethods))]...)
+	b = append(b, " path="...)
+	b = append(b, textPaths[r.IntN(len(textPaths))]...)
+	b = strconv.AppendInt(b, r.Int64N(100000), 10)
+	b = append(b, " status="...)
+	b = strconv.AppendInt(b, []int64{200, 200, 200, 201, 304, 404, 500}[r.IntN(7)], 10)
+	b = append(b, " bytes="...)
+	b = strconv.AppendInt(b, r.Int64N(50000), 10)
+	b = append(b, " duration_ms="...)
+	b = strconv.AppendInt(b, r.Int64N(2000), 10)
+	b = append(b, " user_agent=\""...)
+	b = append(b, textAgents[r.IntN(len(textAgents))]...)
+	b = append(b, "\"\n"...)
+	t.line, t.off = b, 0
+}
+
+// repeatReader yields data over and over
+type repeatReader struct {
+	data []byte
+	off  int
+}
+
+func (r *repeatReader) Read(p []byte) (int, error) {
+	if len(r.data) == 1 && len(p) > 0 {
+		p[0] = r.data[0]
+		for filled := 1; filled < len(p); filled *= 2 {
+			copy(p[filled:], p[:filled])
+		}
+		return len(p), nil
+	}
+	n := 0
+	for n < len(p) {
+		c := copy(p[n:], r.data[r.off:])
+		n += c
+		r.off = (r.off + c) % len(r.data)
+	}
+	return n, nil
+}
+
+// maxPayloadBlock bounds -payload-block, which is kept in memory
+const maxPayloadBlock = 1024 * 1024 * 1024
+
+// blockWriteSize is the write size of downloads sliced from the
+// -payload-block; fewer, larger writes are what 40G and up needs
+const blockWriteSize = 4 * 1024 * 1024
+
+// payloadBlock is the server's -payload-block: random data generated once
+// at startup, which random downloads are sliced from instead of running
+// ChaCha8 for every byte. nil without -payload-block.
+var payloadBlock []byte
+
+func newPayloadBlock(size int64) []byte {
+	block := make([]byte, size)
+	io.ReadFull(payloadSpec{kind: payloadRandom}.reader(), block)
+	return block
+}
+
+var (
+	// serverPayload is the server's -payload, used for downloads that do
+	// not ask for a pattern and for payload=file
+	serverPayload = payloadSpec{kind: payloadZeros}
+
+	// clientPayload is the client's -payload for uploads
+	clientPayload = payloadSpec{kind: payloadZeros}
+)
+
+// requestPayload returns the download pattern a request asks for
+func requestPayload(r *http.Request) (payloadSpec, error) {
+	q := r.URL.Query().Get("payload")
+	switch {
+	case q == "":
+		return serverPayload, nil
+	case q == payloadFile:
+		if serverPayload.kind != payloadFile {
+			return payloadSpec{}, fmt.Errorf("server has no -payload file")
+		}
+		return serverPayload, nil
+	case strings.HasPrefix(q, payloadFile+":"):
+		return payloadSpec{}, fmt.Errorf("invalid payload '%s'", q)
+	}
+	return parsePayload(q)
+}
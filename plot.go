@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"strings"
+)
+
+// Values of -plot
+const (
+	plotASCII   = "ascii"
+	plotGnuplot = "gnuplot"
+)
+
+const plotBarWidth = 50
+
+// printPlot draws the speed of every run as horizontal bars on one scale,
+// so runs and directions compare at a glance
+func (r *speedReport) printPlot() {
+	peak := 0.0
+	for _, run := range r.Runs {
+		if run.Download != nil {
+			peak = max(peak, run.Download.Mbps)
+		}
+		if run.Upload != nil {
+			peak = max(peak, run.Upload.Mbps)
+		}
+	}
+	if peak == 0 {
+		return
+	}
+
+	if unit := displayUnit.label(); unit != "" {
+		fmt.Printf("Speed per run (%s):\n", unit)
+	} else {
+		fmt.Println("Speed per run:")
+	}
+	for i, run := range r.Runs {
+		for _, t := range []struct {
+			dir string
+			res *transferResult
+		}{{"down", run.Download}, {"up", run.Upload}} {
+			if t.res == nil {
+				continue
+			}
+			n := int(math.Round(t.res.Mbps / peak * plotBarWidth))
+			fmt.Printf("%3d %-4s %s%s %s\n", i+1, t.dir,
+				strings.Repeat("█", n), strings.Repeat(" ", plotBarWidth-n), displayUnit.cell(t.res.Mbps))
+		}
+	}
+	fmt.Println()
+}
+
+// writeGnuplot writes the runs to prefix.dat and a script, prefix.gp, that
+// renders them to prefix.png as a clustered bar chart
+func (r *speedReport) writeGnuplot(prefix string) error {
+	// One axis needs one unit; -unit auto plots Mbps
+	unit := displayUnit
+	if unit.kind == unitAuto {
+		unit.kind = unitMbps
+	}
+
+	var data strings.Builder
+	fmt.Fprintf(&data, "# run download upload, in %s\n", unit.label())
+	for i, run := range r.Runs {
+		fmt.Fprintf(&data, "%d %s %s\n", i+1, unit.plotValue(run.Download), unit.plotValue(run.Upload))
+	}
+
+	var plots []string
+	if r.Direction != directionUp {
+		plots = append(plots, fmt.Sprintf("'%s.dat' using 2:xtic(1) title 'down'", prefix))
+	}
+	if r.Direction != directionDown {
+		plots = append(plots, fmt.Sprintf("'%s.dat' using 3:xtic(1) title 'up'", prefix))
+	}
+	script := fmt.Sprintf(`# ethspeed results; render with: gnuplot %[1]s.gp
+set terminal pngcairo size 900,450
+set output '%[1]s.png'
+set title 'ethspeed %[2]s, %[3]d MB per run'
+set style data histograms
+set style histogram clustered gap 1
+set style fill solid 0.8 border -1
+set datafile missing 'NaN'
+set xlabel 'run'
+set ylabel '%[5]s'
+set yrange [0:*]
+set key outside top right
+plot %[4]s
+`, prefix, r.Server, r.SizeMB, strings.Join(plots, ", \\\n     "), unit.label())
+
+	if err := os.WriteFile(prefix+".dat", []byte(data.String()), 0o644); err != nil {
+		return fmt.Errorf("plot: %w", err)
+	}
+	if err := os.WriteFile(prefix+".gp", []byte(script), 0o644); err != nil {
+		return fmt.Errorf("plot: %w", err)
+	}
+	return nil
+}
+
+func (u speedUnit) plotValue(res *transferResult) string {
+	if res == nil {
+		return "NaN"
+	}
+	v, _ := u.scale(res.Mbps)
+	return fmt.Sprintf("%.2f", v)
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptrace"
+	"time"
+)
+
+// preconnect sets up the connection of the next transfer before its clock
+// starts (-preconnect), with a /__time request, or a HEAD of transfer when
+// the transfer goes to another host (-down-url, -up-url): DNS, the TCP
+// handshake and the TLS handshake otherwise count as transfer time on a
+// fresh connection, which skews short tests. Idle connections, such as the
+// one of /__info, are closed first so that the setup is measured. It
+// returns the setup time in ms, 0 when a busy HTTP/2 connection was
+// shared, or nil when the transport does not report connections (HTTP/3).
+func preconnect(client *http.Client, config Config, transfer *http.Request) (*float64, error) {
+	var (
+		start, got time.Time
+		reused     bool
+	)
+	ctx := httptrace.WithClientTrace(context.Background(), &httptrace.ClientTrace{
+		GetConn: func(string) { start = time.Now() },
+		GotConn: func(info httptrace.GotConnInfo) {
+			got, reused = time.Now(), info.Reused
+		},
+	})
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, config.endpointURL(timePath), nil)
+	if err != nil {
+		return nil, fmt.Errorf("request creation failed: %w", err)
+	}
+	config.authorize(req)
+	if req.URL.Host != transfer.URL.Host {
+		// Authorized already, like the transfer itself
+		req = transfer.Clone(ctx)
+		req.Method, req.Body, req.GetBody, req.ContentLength = http.MethodHead, nil, nil, 0
+	}
+	client.CloseIdleConnections()
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("preconnect failed: %w", err)
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+
+	if got.IsZero() {
+		return nil, nil
+	}
+	var ms float64
+	if !reused {
+		ms = durationMs(got.Sub(start))
+	}
+	return &ms, nil
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"runtime/pprof"
+)
+
+// startProfiling starts the -profile CPU profile of a client run; the
+// returned function stops it and writes the -heap-profile, both for
+// "go tool pprof". At 25GbE and up the client itself can be the bottleneck,
+// and this shows where without a rebuild.
+func startProfiling(config Config) (stop func(), err error) {
+	var cpu *os.File
+	if config.Profile != "" {
+		if cpu, err = os.Create(config.Profile); err != nil {
+			return nil, fmt.Errorf("profile: %w", err)
+		}
+		if err := pprof.StartCPUProfile(cpu); err != nil {
+			cpu.Close()
+			return nil, fmt.Errorf("profile: %w", err)
+		}
+	}
+
+	return func() {
+		out := os.Stdout
+		if config.JSON {
+			out = os.Stderr
+		}
+		if cpu != nil {
+			pprof.StopCPUProfile()
+			if err := cpu.Close(); err != nil {
+				fmt.Fprintf(out, "ERROR: profile: %v\n", err)
+			} else {
+				fmt.Fprintf(out, "CPU profile written to %[1]s; inspect with: go tool pprof %[1]s\n", config.Profile)
+			}
+		}
+		if config.HeapProfile != "" {
+			if err := writeHeapProfile(config.HeapProfile); err != nil {
+				fmt.Fprintf(out, "ERROR: heap profile: %v\n", err)
+			} else {
+				fmt.Fprintf(out, "Heap profile written to %[1]s; inspect with: go tool pprof %[1]s\n", config.HeapProfile)
+			}
+		}
+	}, nil
+}
+
+func writeHeapProfile(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	// Up-to-date statistics of what is still live
+	runtime.GC()
+	if err := pprof.WriteHeapProfile(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
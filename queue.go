@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	errQueueFull    = &apiError{codeQueueFull, "server at capacity, try again later"}
+	errQueueTimeout = &apiError{codeQueueTimeout, "timed out waiting in the test queue"}
+)
+
+// admission limits running transfers to -max-concurrent and lets up to
+// -queue more wait for a free slot, so that a burst of clients is measured
+// one after another instead of all at once with a share of the link each.
+// Blocked channel sends are served in arrival order.
+type admission struct {
+	slots    chan struct{}
+	maxQueue int64
+	timeout  time.Duration
+}
+
+// admit is the server's admission control; nil for no limit
+var admit *admission
+
+func newAdmission(maxConcurrent, maxQueue int, timeout time.Duration) *admission {
+	return &admission{
+		slots:    make(chan struct{}, maxConcurrent),
+		maxQueue: int64(maxQueue),
+		timeout:  timeout,
+	}
+}
+
+// acquire takes a slot, queueing if allowed, and returns how long it waited
+func (a *admission) acquire(ctx context.Context) (time.Duration, error) {
+	select {
+	case a.slots <- struct{}{}:
+		return 0, nil
+	default:
+	}
+
+	if atomic.AddInt64(&stats.currentQueued, 1) > a.maxQueue {
+		atomic.AddInt64(&stats.currentQueued, -1)
+		return 0, errQueueFull
+	}
+	defer atomic.AddInt64(&stats.currentQueued, -1)
+
+	queued := atomic.LoadInt64(&stats.currentQueued)
+	peak := atomic.LoadInt64(&stats.peakQueued)
+	for queued > peak && !atomic.CompareAndSwapInt64(&stats.peakQueued, peak, queued) {
+		peak = atomic.LoadInt64(&stats.peakQueued)
+	}
+
+	start := time.Now()
+	timer := time.NewTimer(a.timeout)
+	defer timer.Stop()
+
+	select {
+	case a.slots <- struct{}{}:
+		wait := time.Since(start)
+		stats.queueWaits.observe(wait.Seconds())
+		return wait, nil
+	case <-timer.C:
+		return time.Since(start), errQueueTimeout
+	case <-ctx.Done():
+		return time.Since(start), ctx.Err()
+	}
+}
+
+func (a *admission) release() {
+	<-a.slots
+}
+
+// admitTest runs next once admission control lets the transfer start; the
+// server answers 503 when the queue is full or the wait times out
+func admitTest(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		timing := requestTiming{start: time.Now()}
+		if admit == nil {
+			next.ServeHTTP(w, withTiming(r, timing))
+			return
+		}
+		wait, err := admit.acquire(r.Context())
+		if err != nil {
+			if r.Context().Err() != nil {
+				return // client gave up waiting
+			}
+			atomic.AddInt64(&stats.queueRejected, 1)
+			logger.Printf("[QUEUE] %s - %v (waited %v)%s", clientAddr(r), err, wait.Round(time.Millisecond), requestIDNote(r))
+			w.Header().Set("Retry-After", "5")
+			w.Header().Set("Server-Timing", serverTiming(timingMetric{"queue", wait}))
+			writeError(w, err, codeQueueFull, http.StatusServiceUnavailable)
+			return
+		}
+		defer admit.release()
+
+		// The server's deadlines started with the request, not the transfer
+		if wait > 0 {
+			rc := http.NewResponseController(w)
+			rc.SetReadDeadline(deadlineAfter(serverReadTimeout))
+			rc.SetWriteDeadline(deadlineAfter(serverWriteTimeout))
+		}
+		timing.queue = wait
+		next.ServeHTTP(w, withTiming(r, timing))
+	})
+}
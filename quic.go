@@ -0,0 +1,378 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/http3"
+)
+
+// dgramALPN selects the datagram latency/loss test on a QUIC connection.
+// It shares the UDP port with HTTP/3, so only one port has to be open.
+const dgramALPN = "ethspeed-dgram"
+
+// Datagram layout (big-endian):
+//
+//	[0]     type (dgramPing or dgramPong)
+//	[1:5]   sequence number
+//	[5:13]  client send time, unix nanoseconds
+//	[13:21] server receive time, unix nanoseconds (pong only)
+//
+// Pings may be padded to the requested datagram size; pongs echo the
+// padding back so both directions carry the same load.
+const (
+	dgramPing       = 1
+	dgramPong       = 2
+	dgramHeaderSize = 21
+)
+
+// ============== SERVER SIDE ==============
+
+// quicServer accepts QUIC connections on the UDP side of tls: listeners and
+// dispatches them by ALPN: "h3" to HTTP/3, dgramALPN to the datagram echo.
+type quicServer struct {
+	h3        *http3.Server
+	tlsConfig *tls.Config
+
+	mu        sync.Mutex
+	listeners []*quic.Listener
+	closed    bool
+}
+
+func newQUICServer(handler http.Handler, tlsConfig *tls.Config) *quicServer {
+	tlsConfig = tlsConfig.Clone()
+	tlsConfig.NextProtos = []string{http3.NextProtoH3, dgramALPN}
+	tlsConfig.MinVersion = tls.VersionTLS13
+	timeHandshakes(tlsConfig)
+
+	return &quicServer{
+		h3:        &http3.Server{Handler: handler},
+		tlsConfig: tlsConfig,
+	}
+}
+
+func (s *quicServer) listen(addr string) (*quic.Listener, error) {
+	ln, err := quic.ListenAddr(addr, s.tlsConfig, &quic.Config{EnableDatagrams: true})
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	s.listeners = append(s.listeners, ln)
+	s.mu.Unlock()
+	return ln, nil
+}
+
+// serve accepts connections until the server is closed, then returns
+// http.ErrServerClosed like http.Server.Serve.
+func (s *quicServer) serve(ln *quic.Listener) error {
+	for {
+		conn, err := ln.Accept(context.Background())
+		if err != nil {
+			s.mu.Lock()
+			closed := s.closed
+			s.mu.Unlock()
+			if closed {
+				return http.ErrServerClosed
+			}
+			return err
+		}
+
+		switch conn.ConnectionState().TLS.NegotiatedProtocol {
+		case http3.NextProtoH3:
+			go s.h3.ServeQUICConn(conn)
+		case dgramALPN:
+			if !accessList.allowsNetAddr(conn.RemoteAddr()) {
+				conn.CloseWithError(0, "forbidden")
+				continue
+			}
+			go serveDatagramConn(conn)
+		default:
+			conn.CloseWithError(0, "unsupported protocol")
+		}
+	}
+}
+
+func (s *quicServer) close() {
+	s.mu.Lock()
+	s.closed = true
+	listeners := s.listeners
+	s.mu.Unlock()
+
+	s.h3.Close()
+	for _, ln := range listeners {
+		ln.Close()
+	}
+}
+
+// altSvcHandler advertises HTTP/3 on responses served over TLS, pointing
+// browsers and HTTP/3-capable clients at the same port over UDP.
+func altSvcHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS != nil && r.ProtoMajor < 3 {
+			if addr, ok := r.Context().Value(http.LocalAddrContextKey).(net.Addr); ok {
+				if _, port, err := net.SplitHostPort(addr.String()); err == nil {
+					w.Header().Set("Alt-Svc", fmt.Sprintf(`h3=":%s"; ma=86400`, port))
+				}
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// serveDatagramConn echoes ping datagrams back as pongs stamped with the
+// server receive time. The client's control stream is answered with the
+// number of pings received, which separates upstream from downstream loss.
+func serveDatagramConn(conn *quic.Conn) {
+	ctx := conn.Context()
+	addr := conn.RemoteAddr().String()
+	var received atomic.Uint32
+
+	go func() {
+		stream, err := conn.AcceptStream(ctx)
+		if err != nil {
+			return
+		}
+		defer stream.Close()
+
+		// The client writes one byte once it has stopped sending
+		var done [1]byte
+		if _, err := io.ReadFull(stream, done[:]); err != nil {
+			return
+		}
+		var count [4]byte
+		binary.BigEndian.PutUint32(count[:], received.Load())
+		stream.Write(count[:])
+	}()
+
+	for {
+		msg, err := conn.ReceiveDatagram(ctx)
+		if err != nil {
+			break
+		}
+		if len(msg) < dgramHeaderSize || msg[0] != dgramPing {
+			continue
+		}
+		received.Add(1)
+
+		msg[0] = dgramPong
+		binary.BigEndian.PutUint64(msg[13:21], uint64(time.Now().UnixNano()))
+		conn.SendDatagram(msg)
+	}
+
+	logTest(logDgram, 0, "%s - %d datagrams echoed", addr, received.Load())
+}
+
+// ============== CLIENT SIDE ==============
+
+// dgramSample is one answered ping
+type dgramSample struct {
+	rtt  time.Duration
+	up   time.Duration // server receive - client send, includes clock offset
+	down time.Duration // client receive - server receive, includes clock offset
+}
+
+// runQUICDatagramTest sends config.Samples pings over QUIC datagrams and
+// reports round-trip latency, loss per direction, reordering and one-way
+// delays.
+func runQUICDatagramTest(config Config) error {
+	addr := withDefaultPort(config.Server, "443")
+	host, _, _ := net.SplitHostPort(addr)
+
+	ctx, cancel := context.WithTimeout(context.Background(), defaultHTTPTimeout)
+	defer cancel()
+
+	tlsConfig := config.clientTLSConfig()
+	tlsConfig.ServerName = host
+	tlsConfig.NextProtos = []string{dgramALPN}
+	conn, err := quic.DialAddr(ctx, addr, tlsConfig, &quic.Config{EnableDatagrams: true})
+	if err != nil {
+		return fmt.Errorf("QUIC dial failed: %w", err)
+	}
+	defer conn.CloseWithError(0, "")
+
+	if !conn.ConnectionState().SupportsDatagrams.Remote {
+		return fmt.Errorf("server does not support QUIC datagrams")
+	}
+
+	control, err := conn.OpenStreamSync(ctx)
+	if err != nil {
+		return fmt.Errorf("open control stream: %w", err)
+	}
+
+	size := max(config.DgramSize, dgramHeaderSize)
+	fmt.Printf("QUIC datagram test - %d x %d bytes every %v\n", config.Samples, size, config.SampleInterval)
+	fmt.Printf("Server: %s\n\n", addr)
+
+	var (
+		mu      sync.Mutex
+		samples []dgramSample
+		seqs    = newSeqTracker()
+	)
+	recvDone := make(chan struct{})
+	recvCtx, stopRecv := context.WithCancel(ctx)
+	defer stopRecv()
+	go func() {
+		defer close(recvDone)
+		for {
+			msg, err := conn.ReceiveDatagram(recvCtx)
+			if err != nil {
+				return
+			}
+			now := time.Now()
+			if len(msg) < dgramHeaderSize || msg[0] != dgramPong {
+				continue
+			}
+
+			seq := binary.BigEndian.Uint32(msg[1:5])
+			sent := time.Unix(0, int64(binary.BigEndian.Uint64(msg[5:13])))
+			serverRecv := time.Unix(0, int64(binary.BigEndian.Uint64(msg[13:21])))
+
+			mu.Lock()
+			if seqs.observe(seq) {
+				samples = append(samples, dgramSample{
+					rtt:  now.Sub(sent),
+					up:   serverRecv.Sub(sent),
+					down: now.Sub(serverRecv),
+				})
+			}
+			mu.Unlock()
+		}
+	}()
+
+	buf := make([]byte, size)
+	buf[0] = dgramPing
+	sentCount := 0
+	for i := 0; i < config.Samples; i++ {
+		binary.BigEndian.PutUint32(buf[1:5], uint32(i))
+		binary.BigEndian.PutUint64(buf[5:13], uint64(time.Now().UnixNano()))
+		if err := conn.SendDatagram(buf); err != nil {
+			return fmt.Errorf("send datagram: %w", err)
+		}
+		sentCount++
+		time.Sleep(config.SampleInterval)
+	}
+
+	// Give late pongs a chance before counting them as lost
+	time.Sleep(time.Second)
+	stopRecv()
+	<-recvDone
+
+	if _, err := control.Write([]byte{1}); err != nil {
+		return fmt.Errorf("control stream: %w", err)
+	}
+	var count [4]byte
+	if _, err := io.ReadFull(control, count[:]); err != nil {
+		return fmt.Errorf("control stream: %w", err)
+	}
+	serverReceived := int(binary.BigEndian.Uint32(count[:]))
+
+	mu.Lock()
+	defer mu.Unlock()
+	printDatagramReport(sentCount, serverReceived, samples, seqs)
+	return nil
+}
+
+func printDatagramReport(sent, serverReceived int, samples []dgramSample, seqs *seqTracker) {
+	received := len(samples)
+	upLost := sent - serverReceived
+	downLost := serverReceived - received
+
+	fmt.Printf("Sent: %d, server received: %d, echoed back: %d\n", sent, serverReceived, received)
+	fmt.Printf("Loss: up %.2f%% (%d), down %.2f%% (%d)\n",
+		lossPercent(upLost, sent), upLost, lossPercent(downLost, serverReceived), downLost)
+
+	if received == 0 {
+		return
+	}
+
+	rtts := make([]float64, received)
+	for i, s := range samples {
+		rtts[i] = durationMs(s.rtt)
+	}
+	fmt.Printf("RTT ms: %s\n", formatRTTStats(rtts))
+	fmt.Println(seqs)
+
+	// Estimate the clock offset from the fastest round trip, where queueing
+	// is smallest and the path is most likely symmetric (as NTP does).
+	best := samples[0]
+	for _, s := range samples {
+		if s.rtt < best.rtt {
+			best = s
+		}
+	}
+	offset := (best.up - best.down) / 2
+
+	ups := make([]float64, received)
+	downs := make([]float64, received)
+	for i, s := range samples {
+		ups[i] = durationMs(s.up - offset)
+		downs[i] = durationMs(s.down + offset)
+	}
+	sort.Float64s(ups)
+	sort.Float64s(downs)
+
+	fmt.Printf("One-way ms (p50): up %.3f | down %.3f (clock offset %.3f ms, estimated)\n",
+		percentile(ups, 50), percentile(downs, 50), durationMs(offset))
+}
+
+func lossPercent(lost, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(lost) / float64(total) * 100
+}
+
+func durationMs(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// formatRTTStats summarizes round-trip times in milliseconds, given in the
+// order they were measured (jitter depends on the order).
+func formatRTTStats(rtts []float64) string {
+	if len(rtts) == 0 {
+		return "no samples"
+	}
+
+	sorted := append([]float64(nil), rtts...)
+	sort.Float64s(sorted)
+
+	return fmt.Sprintf("min %.3f | avg %.3f | p50 %.3f | p95 %.3f | p99 %.3f | max %.3f | jitter %.3f",
+		sorted[0], calculateAverage(sorted), percentile(sorted, 50), percentile(sorted, 95),
+		percentile(sorted, 99), sorted[len(sorted)-1], jitter(rtts))
+}
+
+// jitter is the mean absolute difference between consecutive RTTs (RFC 3550 style)
+func jitter(rtts []float64) float64 {
+	if len(rtts) < 2 {
+		return 0
+	}
+	sum := 0.0
+	for i := 1; i < len(rtts); i++ {
+		d := rtts[i] - rtts[i-1]
+		if d < 0 {
+			d = -d
+		}
+		sum += d
+	}
+	return sum / float64(len(rtts)-1)
+}
+
+// withDefaultPort appends port to a host without one
+func withDefaultPort(server, port string) string {
+	if _, _, err := net.SplitHostPort(server); err == nil {
+		return server
+	}
+	return net.JoinHostPort(strings.Trim(server, "[]"), port)
+}
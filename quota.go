@@ -0,0 +1,184 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Quota periods
+const (
+	quotaDaily   = "daily"
+	quotaMonthly = "monthly"
+)
+
+// quota counts bytes and tests against per-period limits. Periods follow
+// the server's local calendar and reset on first use after they roll over.
+type quota struct {
+	period   string // quotaDaily or quotaMonthly
+	maxBytes int64  // per period, 0 = unlimited
+	maxTests int64  // per period, 0 = unlimited
+
+	mu          sync.Mutex
+	periodStart string // periodKey of the current period
+	bytes       int64  // in the current period, including running transfers
+	tests       int64  // in the current period
+	totalBytes  int64
+	totalTests  int64
+}
+
+// periodKey names the quota period t falls into
+func (q *quota) periodKey(t time.Time) string {
+	if q.period == quotaMonthly {
+		return t.Format("2006-01")
+	}
+	return t.Format("2006-01-02")
+}
+
+// periodEnd returns when the period containing t rolls over
+func (q *quota) periodEnd(t time.Time) time.Time {
+	if q.period == quotaMonthly {
+		return time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+	}
+	return time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+}
+
+// reserve counts a test of n bytes against the quota and returns the
+// period it was counted in, or reports why it does not fit
+func (q *quota) reserve(n int64) (period string, err error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if key := q.periodKey(time.Now()); key != q.periodStart {
+		q.periodStart, q.bytes, q.tests = key, 0, 0
+	}
+	if q.maxTests > 0 && q.tests >= q.maxTests {
+		return "", fmt.Errorf("%s test quota of %d exhausted", q.period, q.maxTests)
+	}
+	if q.maxBytes > 0 && q.bytes+n > q.maxBytes {
+		return "", fmt.Errorf("%s byte quota exceeded: %s of %s used", q.period, formatBytes(q.bytes), formatBytes(q.maxBytes))
+	}
+	q.tests++
+	q.totalTests++
+	q.bytes += n
+	q.totalBytes += n
+	return q.periodStart, nil
+}
+
+// settle corrects a reservation made in period once the actual transfer
+// size is known. After a rollover only the totals change: the reservation
+// is not part of the new period's count.
+func (q *quota) settle(period string, reserved, actual int64) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if period == q.periodStart {
+		q.bytes += actual - reserved
+	}
+	q.totalBytes += actual - reserved
+}
+
+// release takes back a reservation made in period whose test did not run
+func (q *quota) release(period string, reserved int64) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if period == q.periodStart {
+		q.bytes -= reserved
+		q.tests--
+	}
+	q.totalBytes -= reserved
+	q.totalTests--
+}
+
+// reservation is a test counted against a quota in one of its periods
+type reservation struct {
+	*quota
+	period string
+}
+
+// ipQuotas holds the -ip-quota usage of each client. IPv6 clients are
+// counted per /64, which is what a single site usually gets.
+type ipQuotas struct {
+	maxBytes int64
+
+	mu      sync.Mutex
+	day     string
+	clients map[netip.Addr]*quota
+}
+
+// clientQuotas is the server's ipQuotas; nil for no per-IP limit
+var clientQuotas *ipQuotas
+
+func newIPQuotas(maxBytes int64) *ipQuotas {
+	return &ipQuotas{maxBytes: maxBytes, clients: make(map[netip.Addr]*quota)}
+}
+
+// get returns the quota of addr. All entries are dropped when the day
+// changes: their periods are over and the map would otherwise only grow.
+func (q *ipQuotas) get(addr netip.Addr) *quota {
+	addr = addr.Unmap()
+	if addr.Is6() {
+		addr = netip.PrefixFrom(addr, 64).Masked().Addr()
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if day := time.Now().Format("2006-01-02"); day != q.day {
+		q.day = day
+		clear(q.clients)
+	}
+	c, ok := q.clients[addr]
+	if !ok {
+		c = &quota{period: quotaDaily, maxBytes: q.maxBytes}
+		q.clients[addr] = c
+	}
+	return c
+}
+
+// reserveTransfer charges a transfer of n bytes to the client's -ip-quota
+// and the request's token. It writes 429 and returns false when a quota is
+// exhausted; the returned function settles the reservations with the bytes
+// actually transferred.
+func reserveTransfer(w http.ResponseWriter, r *http.Request, n int64) (settle func(actual int64), ok bool) {
+	var charged []reservation
+	reject := func(who string, q *quota, err error) {
+		for _, c := range charged {
+			c.release(c.period, n)
+		}
+		now := time.Now()
+		w.Header().Set("Retry-After", strconv.Itoa(int(q.periodEnd(now).Sub(now).Seconds())+1))
+		logger.Printf("[QUOTA] %s - %s: %v%s", clientAddr(r), who, err, requestIDNote(r))
+		httpError(w, codeQuotaExceeded, err.Error(), http.StatusTooManyRequests)
+	}
+
+	if clientQuotas != nil {
+		if addr, ok := requestIP(r); ok {
+			q := clientQuotas.get(addr)
+			period, err := q.reserve(n)
+			if err != nil {
+				reject("client", q, err)
+				return nil, false
+			}
+			charged = append(charged, reservation{q, period})
+		}
+	}
+	if a, _ := r.Context().Value(tokenKey{}).(*tokenAccount); a != nil {
+		period, err := a.reserve(n)
+		if err != nil {
+			reject("token "+a.name, &a.quota, err)
+			return nil, false
+		}
+		charged = append(charged, reservation{&a.quota, period})
+	}
+
+	settleCert := chargeCert(r, n)
+	return func(actual int64) {
+		for _, c := range charged {
+			c.settle(c.period, n, actual)
+		}
+		settleCert(actual)
+	}, true
+}
@@ -0,0 +1,46 @@
+package main
+
+import "fmt"
+
+// seqTracker follows the sequence numbers of echoed probes. A probe that
+// arrives after a higher-numbered one is reordered, and its depth is how
+// far it fell behind the highest number seen so far. Bonded links and
+// per-packet load balancing reorder heavily; real-time traffic treats a
+// late packet the same as a lost one.
+type seqTracker struct {
+	seen    map[uint32]bool
+	highest uint32
+
+	received   int
+	duplicates int
+	reordered  int
+	maxDepth   uint32
+}
+
+func newSeqTracker() *seqTracker {
+	return &seqTracker{seen: make(map[uint32]bool)}
+}
+
+// observe records an arriving sequence number and reports whether it is
+// the first copy
+func (t *seqTracker) observe(seq uint32) bool {
+	if t.seen[seq] {
+		t.duplicates++
+		return false
+	}
+	t.seen[seq] = true
+	t.received++
+
+	if t.received > 1 && seq < t.highest {
+		t.reordered++
+		t.maxDepth = max(t.maxDepth, t.highest-seq)
+	} else {
+		t.highest = seq
+	}
+	return true
+}
+
+func (t *seqTracker) String() string {
+	return fmt.Sprintf("Reordered: %d (%.2f%%), max depth %d | duplicates: %d",
+		t.reordered, lossPercent(t.reordered, t.received), t.maxDepth, t.duplicates)
+}
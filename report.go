@@ -0,0 +1,357 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+// throughputWindow is the interval per-transfer throughput is sampled at
+const throughputWindow = 100 * time.Millisecond
+
+// speedReport collects a client speed test run; it is printed as a table
+// while running, or emitted as a whole with -json.
+type speedReport struct {
+	Time      time.Time   `json:"time"` // start of the test
+	Server    string      `json:"server"`
+	SizeMB    int         `json:"size_mb"`
+	Direction string      `json:"direction"`
+	Runs      []runResult `json:"runs"`
+
+	Name        string            `json:"name,omitempty"`
+	Note        string            `json:"note,omitempty"`
+	Tags        map[string]string `json:"tags,omitempty"`
+	Environment *environment      `json:"environment,omitempty"`
+
+	// Server clock minus client clock from the pre-test check
+	ClockOffsetMs *float64 `json:"clock_offset_ms,omitempty"`
+
+	// -limit the client paced itself to in each direction
+	LimitMbps float64 `json:"limit_mbps,omitempty"`
+
+	// Address selection of the first connection, for dual-stack names
+	Dial *dialReport `json:"dial,omitempty"`
+
+	AvgDownloadMbps float64 `json:"avg_download_mbps,omitempty"`
+	AvgUploadMbps   float64 `json:"avg_upload_mbps,omitempty"`
+
+	// Averages as a share of the egress NIC link speed
+	DownloadLinkPercent float64 `json:"download_link_percent,omitempty"`
+	UploadLinkPercent   float64 `json:"upload_link_percent,omitempty"`
+	TotalSeconds        float64 `json:"total_seconds"`
+
+	// With -concurrency: iterations run at once, the combined throughput
+	// over the time a direction was in use and Jain's fairness index of the
+	// per-run speeds (1 when all runs got the same share)
+	Concurrency           int     `json:"concurrency,omitempty"`
+	AggregateDownloadMbps float64 `json:"aggregate_download_mbps,omitempty"`
+	AggregateUploadMbps   float64 `json:"aggregate_upload_mbps,omitempty"`
+	DownloadFairness      float64 `json:"download_fairness,omitempty"`
+	UploadFairness        float64 `json:"upload_fairness,omitempty"`
+
+	LatencyIdleMs   []float64 `json:"latency_idle_ms,omitempty"`
+	LatencyLoadedMs []float64 `json:"latency_loaded_ms,omitempty"`
+
+	// Failed attempts of iterations that were run again (-retries)
+	Retries []retryRecord `json:"retries,omitempty"`
+	// Iterations recorded as errors with -keep-going, left out of the averages
+	FailedRuns int `json:"failed_runs,omitempty"`
+
+	// Kernel counters of the test interface over the runs (Linux)
+	InterfaceCounters *ifaceCounters `json:"interface_counters,omitempty"`
+
+	// With -compare-physical through a tunnel: the same test bound to a
+	// physical interface
+	Physical *speedReport `json:"physical,omitempty"`
+
+	Error string `json:"error,omitempty"`
+	// Stable code of a server error response, see errors.go
+	ErrorCode string `json:"error_code,omitempty"`
+}
+
+// runResult is one iteration of -c; a direction not tested is nil, and
+// both are for an iteration that failed with -keep-going
+type runResult struct {
+	Download *transferResult `json:"download,omitempty"`
+	Upload   *transferResult `json:"upload,omitempty"`
+	Error    string          `json:"error,omitempty"`
+}
+
+// transferResult is one measured transfer
+type transferResult struct {
+	Mbps     float64       `json:"mbps"`
+	Bytes    int64         `json:"bytes"`
+	Duration time.Duration `json:"-"`
+	Seconds  float64       `json:"seconds"`
+
+	// Throughput per throughputWindow, in Mbps
+	Samples []float64 `json:"samples_mbps"`
+
+	// ID of the transfer in the server's log (X-Request-ID)
+	RequestID string `json:"request_id,omitempty"`
+
+	// Server-Timing metrics of the response in milliseconds, e.g. the
+	// time spent in the server's queue (already left out of Seconds)
+	ServerTiming map[string]float64 `json:"server_timing_ms,omitempty"`
+
+	// Chunk check of a -verify transfer
+	Integrity *integrityResult `json:"integrity,omitempty"`
+
+	// Download streamed without a Content-Length
+	Chunked bool `json:"chunked,omitempty"`
+
+	// Ended early by the server at the transfer's time limit
+	// (-max-test-duration); Bytes is what got through
+	Truncated bool `json:"truncated,omitempty"`
+
+	// With -preconnect: DNS, TCP and TLS setup of the transfer's connection,
+	// done before the clock started; 0 for a kept-alive connection
+	SetupMs *float64 `json:"setup_ms,omitempty"`
+
+	// Round trip an Expect: 100-continue upload waited for the go-ahead
+	ContinueMs *float64 `json:"continue_ms,omitempty"`
+
+	// Compressed size and throughput of a -compress download; Bytes and
+	// Mbps are the decompressed goodput
+	WireBytes int64   `json:"wire_bytes,omitempty"`
+	WireMbps  float64 `json:"wire_mbps,omitempty"`
+
+	// With -from-first-byte, where Mbps and Seconds start at the first
+	// payload byte: the time to it from sending the request, and the
+	// throughput counted from the request as without the flag
+	TTFBMs      *float64 `json:"ttfb_ms,omitempty"`
+	RequestMbps float64  `json:"request_mbps,omitempty"`
+
+	// Estimated bytes and rate on the wire: the body with HTTP, TLS, TCP/IP
+	// and Ethernet framing for -mtu sized packets (not for HTTP/3)
+	LineBytes int64   `json:"line_bytes,omitempty"`
+	LineMbps  float64 `json:"line_mbps,omitempty"`
+
+	// Client CPU load and NIC traffic while the transfer ran
+	Resources *resourceUsage `json:"resources,omitempty"`
+
+	// Signs that a download was served by a proxy or cache rather than the
+	// ethspeed server, see detectIntermediary
+	Intermediary []string `json:"intermediary,omitempty"`
+}
+
+func newTransferResult(bytes int64, elapsed time.Duration, samples []float64) *transferResult {
+	return &transferResult{
+		Mbps:     float64(bytes) * 8 / elapsed.Seconds() / 1_000_000,
+		Bytes:    bytes,
+		Duration: elapsed,
+		Seconds:  elapsed.Seconds(),
+		Samples:  samples,
+	}
+}
+
+// setFirstByte records the -from-first-byte figures of a transfer whose
+// clock started at its first payload byte
+func (t *transferResult) setFirstByte(ttfb, sinceRequest time.Duration) {
+	ms := durationMs(ttfb)
+	t.TTFBMs = &ms
+	t.RequestMbps = float64(t.Bytes) * 8 / sinceRequest.Seconds() / 1_000_000
+}
+
+// summarize fills in the averages, their share of the link speed and the
+// total time from the runs
+func (r *speedReport) summarize() {
+	var downs, ups []float64
+	var total time.Duration
+	for _, run := range r.Runs {
+		if run.Download != nil {
+			downs = append(downs, run.Download.Mbps)
+			total += run.Download.Duration
+		}
+		if run.Upload != nil {
+			ups = append(ups, run.Upload.Mbps)
+			total += run.Upload.Duration
+		}
+	}
+	if len(downs) > 0 {
+		r.AvgDownloadMbps = calculateAverage(downs)
+	}
+	if len(ups) > 0 {
+		r.AvgUploadMbps = calculateAverage(ups)
+	}
+	r.TotalSeconds = total.Seconds()
+	if r.Environment != nil {
+		r.DownloadLinkPercent = linkPercent(r.AvgDownloadMbps, r.Environment.Link)
+		r.UploadLinkPercent = linkPercent(r.AvgUploadMbps, r.Environment.Link)
+	}
+}
+
+// printSparklines shows the throughput course of every transfer, which
+// makes throttling, roaming dips and token-bucket shaping visible, along
+// with the notes on each transfer. Transfers shorter than one sample get
+// the notes alone.
+func (r *speedReport) printSparklines() {
+	var lines []string
+	for i, run := range r.Runs {
+		for _, t := range []struct {
+			dir string
+			res *transferResult
+		}{{"down", run.Download}, {"up", run.Upload}} {
+			if t.res == nil {
+				continue
+			}
+			notes := t.res.notes()
+			if len(t.res.Samples) == 0 {
+				if notes != "" {
+					lines = append(lines, fmt.Sprintf("%3d %-4s %s", i+1, t.dir, strings.TrimPrefix(notes, " | ")))
+				}
+				continue
+			}
+			sorted := append([]float64(nil), t.res.Samples...)
+			sort.Float64s(sorted)
+			lines = append(lines, fmt.Sprintf("%3d %-4s %s  min %s | p50 %s | max %s%s", i+1, t.dir,
+				sparkline(t.res.Samples, sparklineWidth), displayUnit.cell(sorted[0]),
+				displayUnit.cell(percentile(sorted, 50)), displayUnit.cell(sorted[len(sorted)-1]), notes))
+		}
+	}
+	if len(lines) == 0 {
+		return
+	}
+
+	heading := fmt.Sprintf("%v samples", throughputWindow)
+	if unit := displayUnit.label(); unit != "" {
+		heading += ", " + unit
+	}
+	fmt.Printf("Throughput over time (%s):\n", heading)
+	for _, line := range lines {
+		fmt.Println(line)
+	}
+	fmt.Println()
+}
+
+// notes returns the sparkline notes on a transfer, each after " | "
+func (t *transferResult) notes() string {
+	var b strings.Builder
+	if queue := t.ServerTiming["queue"]; queue > 0 {
+		fmt.Fprintf(&b, " | queued %.0f ms", queue)
+	}
+	if t.SetupMs != nil && *t.SetupMs > 0 {
+		fmt.Fprintf(&b, " | setup %.1f ms", *t.SetupMs)
+	}
+	if t.TTFBMs != nil {
+		fmt.Fprintf(&b, " | first byte after %.1f ms, %s from request", *t.TTFBMs, displayUnit.format(t.RequestMbps))
+	}
+	if t.ContinueMs != nil {
+		fmt.Fprintf(&b, " | 100-continue %.1f ms", *t.ContinueMs)
+	}
+	if t.Truncated {
+		fmt.Fprintf(&b, " | truncated after %s", formatBytes(t.Bytes))
+	}
+	if t.WireBytes > 0 {
+		fmt.Fprintf(&b, " | wire %s (%.1f:1)", displayUnit.format(t.WireMbps),
+			float64(t.Bytes)/float64(t.WireBytes))
+	}
+	b.WriteString(t.overheadNote())
+	if u := t.Resources; u != nil && u.CPUBound {
+		fmt.Fprintf(&b, " | CPU max %.0f%%, possibly CPU-bound", u.CPUMaxPercent)
+	}
+	return b.String()
+}
+
+const sparklineWidth = 60
+
+var sparkTicks = []rune("▁▂▃▄▅▆▇█")
+
+// sparkline renders values scaled from zero to their maximum, averaging
+// neighbours when there are more values than width.
+func sparkline(values []float64, width int) string {
+	if len(values) > width {
+		buckets := make([]float64, width)
+		for i := range buckets {
+			from, to := i*len(values)/width, (i+1)*len(values)/width
+			buckets[i] = calculateAverage(values[from:to])
+		}
+		values = buckets
+	}
+
+	peak := 0.0
+	for _, v := range values {
+		peak = max(peak, v)
+	}
+
+	var b strings.Builder
+	for _, v := range values {
+		idx := 0
+		if peak > 0 {
+			idx = int(v / peak * float64(len(sparkTicks)-1))
+		}
+		b.WriteRune(sparkTicks[idx])
+	}
+	return b.String()
+}
+
+// throughputMeter counts bytes passing through a reader and records the
+// throughput of each throughputWindow.
+type throughputMeter struct {
+	r       io.Reader
+	start   time.Time
+	first   time.Time // of the first byte, zero before it
+	bytes   int64     // in the current window
+	samples []float64
+
+	// onSample, if set, sees every sample as it is taken
+	onSample func(index int, mbps float64)
+}
+
+func newThroughputMeter(r io.Reader) *throughputMeter {
+	return &throughputMeter{r: r, start: time.Now()}
+}
+
+func (m *throughputMeter) Read(p []byte) (int, error) {
+	n, err := m.r.Read(p)
+	m.bytes += int64(n)
+	if n > 0 && m.first.IsZero() {
+		m.first = time.Now()
+	}
+
+	if elapsed := time.Since(m.start); elapsed >= throughputWindow {
+		m.sample(elapsed)
+		m.start = m.start.Add(elapsed)
+		m.bytes = 0
+	}
+	return n, err
+}
+
+// finish returns the samples, including a trailing window when it covers
+// at least half a window (shorter ones are too noisy to show).
+func (m *throughputMeter) finish() []float64 {
+	if elapsed := time.Since(m.start); m.bytes > 0 && elapsed >= throughputWindow/2 {
+		m.sample(elapsed)
+	}
+	return m.samples
+}
+
+func (m *throughputMeter) sample(elapsed time.Duration) {
+	mbps := float64(m.bytes) * 8 / elapsed.Seconds() / 1_000_000
+	m.samples = append(m.samples, mbps)
+	if m.onSample != nil {
+		m.onSample(len(m.samples)-1, mbps)
+	}
+}
+
+// printIntegrity sums the -verify chunk checks of all runs per direction
+func (r *speedReport) printIntegrity() {
+	var down, up integrityResult
+	for _, run := range r.Runs {
+		if run.Download != nil && run.Download.Integrity != nil {
+			down.Chunks += run.Download.Integrity.Chunks
+			down.Corrupt += run.Download.Integrity.Corrupt
+		}
+		if run.Upload != nil && run.Upload.Integrity != nil {
+			up.Chunks += run.Upload.Integrity.Chunks
+			up.Corrupt += run.Upload.Integrity.Corrupt
+		}
+	}
+	fmt.Printf("Integrity (CRC-32C per %d KB chunk): down %s | up %s\n", verifyChunkSize/1024, down, up)
+	if down.Corrupt+up.Corrupt > 0 {
+		fmt.Println("WARNING: payload corrupted in transit; check NICs, cables and offload settings")
+	}
+	fmt.Println()
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	crand "crypto/rand"
+	"encoding/hex"
+	"net/http"
+)
+
+// requestIDHeader carries the ID of a test transfer. The client sends one
+// with every transfer and keeps it with the result; the server logs it and
+// echoes it, so a bad measurement can be found in both logs.
+const requestIDHeader = "X-Request-ID"
+
+// maxRequestID bounds an ID taken over from a client or proxy
+const maxRequestID = 64
+
+func newRequestID() string {
+	var b [8]byte
+	crand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// validRequestID accepts the IDs of clients and proxies that are safe to
+// put in a log line
+func validRequestID(s string) bool {
+	if s == "" || len(s) > maxRequestID {
+		return false
+	}
+	for _, c := range s {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_' || c == '.') {
+			return false
+		}
+	}
+	return true
+}
+
+// withRequestID gives every request an ID: the client's, or a new one when
+// it sent none or an unusable one. The ID is echoed in the response and left
+// in the request header, where requestIDNote finds it.
+func withRequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+			r.Header.Set(requestIDHeader, id)
+		}
+		w.Header().Set(requestIDHeader, id)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// requestIDNote returns a log suffix with the request's ID, or "" for
+// requests without one
+func requestIDNote(r *http.Request) string {
+	if id := r.Header.Get(requestIDHeader); validRequestID(id) {
+		return " [id=" + id + "]"
+	}
+	return ""
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// resourceSampleInterval is how often CPU load is sampled during a
+	// transfer; the kernel counts CPU time in 10 ms ticks, so shorter
+	// windows are too coarse to tell 90% from 100%
+	resourceSampleInterval = 500 * time.Millisecond
+
+	// cpuBoundPercent is the busiest sample at which a transfer is flagged
+	// as possibly limited by the client's CPU
+	cpuBoundPercent = 95
+)
+
+// resourceUsage is the client's CPU load and NIC traffic during a transfer.
+// CPU is system-wide on Linux and the process's own share of all cores
+// elsewhere; NIC figures need Linux interface counters.
+type resourceUsage struct {
+	CPUAvgPercent float64 `json:"cpu_avg_percent"`
+	CPUMaxPercent float64 `json:"cpu_max_percent"`
+	CPUBound      bool    `json:"cpu_bound,omitempty"`
+
+	NICRxMbps  float64 `json:"nic_rx_mbps,omitempty"`
+	NICTxMbps  float64 `json:"nic_tx_mbps,omitempty"`
+	NICPercent float64 `json:"nic_percent,omitempty"` // busier direction, of the link speed
+}
+
+// sampledInterface is the environment of the test running now, whose
+// interface the resource samplers read
+var sampledInterface atomic.Pointer[environment]
+
+// resourceSampler samples resources from its start until finish
+type resourceSampler struct {
+	start     time.Time
+	busy, all uint64 // CPU counters at start
+	iface     *ifaceSnapshot
+	env       *environment
+
+	stop chan struct{}
+	wg   sync.WaitGroup
+	max  float64
+	done bool
+}
+
+func startResourceSampler() *resourceSampler {
+	s := &resourceSampler{start: time.Now(), stop: make(chan struct{})}
+	s.busy, s.all, _ = cpuCounters()
+	if s.env = sampledInterface.Load(); s.env != nil {
+		s.iface = snapshotInterface(s.env.Interface)
+	}
+	s.wg.Go(func() {
+		busy, all := s.busy, s.all
+		tick := time.NewTicker(resourceSampleInterval)
+		defer tick.Stop()
+		for {
+			select {
+			case <-s.stop:
+				return
+			case <-tick.C:
+			}
+			b, a, ok := cpuCounters()
+			if ok && a > all {
+				s.max = max(s.max, float64(b-busy)/float64(a-all)*100)
+			}
+			busy, all = b, a
+		}
+	})
+	return s
+}
+
+// finish stops the sampler and returns the usage over its lifetime; later
+// calls return nil, so it can also be deferred for the error paths
+func (s *resourceSampler) finish() *resourceUsage {
+	if s.done {
+		return nil
+	}
+	s.done = true
+	close(s.stop)
+	s.wg.Wait()
+	elapsed := time.Since(s.start)
+
+	busy, all, ok := cpuCounters()
+	if !ok || all <= s.all {
+		return nil
+	}
+	u := &resourceUsage{CPUAvgPercent: float64(busy-s.busy) / float64(all-s.all) * 100}
+	// Transfers shorter than a sample only have the average
+	u.CPUMaxPercent = max(s.max, u.CPUAvgPercent)
+	u.CPUBound = u.CPUMaxPercent >= cpuBoundPercent
+
+	if c := s.iface.since(nil); c != nil && elapsed > 0 {
+		u.NICRxMbps = float64(c.RxBytes) * 8 / elapsed.Seconds() / 1_000_000
+		u.NICTxMbps = float64(c.TxBytes) * 8 / elapsed.Seconds() / 1_000_000
+		if link := s.env.Link; link != nil {
+			u.NICPercent = max(u.NICRxMbps, u.NICTxMbps) / float64(link.SpeedMbps) * 100
+		}
+	}
+	return u
+}
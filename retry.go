@@ -0,0 +1,82 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// retryBackoff is the pause before the first retry of an iteration; it
+// doubles with every further attempt
+const retryBackoff = time.Second
+
+// retryRecord is a failed attempt of an iteration that was run again
+type retryRecord struct {
+	Iteration int    `json:"iteration"` // 1-based, as in the error messages
+	Error     string `json:"error"`
+}
+
+// retryable reports whether an iteration that failed with err may pass when
+// run again: network errors and a busy server, not a refused or invalid
+// request or a server that is not ethspeed
+func retryable(err error) bool {
+	var notEthspeed *notEthspeedError
+	if errors.As(err, &notEthspeed) {
+		return false
+	}
+	switch exitCodeOf(err) {
+	case exitFailure, exitRetry:
+		return true
+	}
+	return false
+}
+
+// retryIteration runs iteration i of a sequential -c batch, running it
+// again up to -retries times on new connections after a retryable failure,
+// so that one dropped connection does not cost the runs already done. run
+// keeps what it measured before failing and only repeats the rest. Before
+// the first iteration has completed nothing is retried: a server that
+// cannot be reached at all is likely the wrong one.
+func retryIteration(config Config, report *speedReport, i int, run func() error) error {
+	for attempt := 0; ; attempt++ {
+		err := run()
+		if err == nil || attempt >= config.Retries || len(report.Runs) == report.FailedRuns || !retryable(err) {
+			return err
+		}
+		report.Retries = append(report.Retries, retryRecord{Iteration: i + 1, Error: err.Error()})
+		if !config.JSON {
+			fmt.Printf("%v - retrying (%d/%d)\n", err, attempt+1, config.Retries)
+		}
+		// A connection the failure left behind would fail again
+		httpClient.CloseIdleConnections()
+		time.Sleep(retryBackoff << attempt)
+	}
+}
+
+// keepGoing records an iteration that failed for good as an error row and
+// returns nil with -keep-going, so unattended batches keep the runs that
+// pass. It returns err to end the batch without the flag, and once every
+// iteration has failed.
+func keepGoing(config Config, report *speedReport, err error) error {
+	if !config.KeepGoing {
+		return err
+	}
+	report.Runs = append(report.Runs, runResult{Error: err.Error()})
+	report.FailedRuns++
+	if report.FailedRuns == config.Count {
+		return err
+	}
+	// The exit code still tells that the batch was not clean
+	noteFailure(err)
+	if !config.JSON {
+		fmt.Printf("ERROR: %v\n", err)
+	}
+	return nil
+}
+
+// printFailedRuns notes the iterations -keep-going went past
+func (r *speedReport) printFailedRuns() {
+	if r.FailedRuns > 0 {
+		fmt.Printf("Failed: %d of %d runs, left out of the average\n", r.FailedRuns, len(r.Runs))
+	}
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// objectPath serves the small responses of -test rps
+const objectPath = "/__obj"
+
+// maxObjectSize keeps /__obj a request-rate endpoint; bulk transfers go
+// through /__down and its queue
+const maxObjectSize = 1024 * 1024
+
+// objectHandler serves GET /__obj?bytes=N (0 to maxObjectSize) as cheaply
+// as possible, so the client measures the path rather than the server
+func objectHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		httpError(w, codeMethodNotAllowed, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	n, err := strconv.Atoi(r.URL.Query().Get("bytes"))
+	if err != nil || n < 0 || n > maxObjectSize {
+		httpError(w, codeSizeOutOfRange, fmt.Sprintf("bytes must be between 0 and %d", maxObjectSize), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Length", strconv.Itoa(n))
+	w.Header().Set("Cache-Control", "no-store")
+	w.Write(objectBody[:n])
+}
+
+var objectBody = make([]byte, maxObjectSize)
+
+// ============== CLIENT SIDE ==============
+
+// runRPSTest issues -object-size requests back to back over -connections
+// keep-alive HTTP/1.1 connections for -duration. A link with good
+// throughput but a slow round trip or an overloaded proxy in the path
+// shows up here as low requests/s and a long latency tail.
+func runRPSTest(config Config) error {
+	fmt.Printf("Request rate test - %d byte objects over %d connections for %v\n",
+		config.ObjectSize, config.Connections, config.Duration)
+	fmt.Printf("Server: %s\n\n", config.Server)
+
+	transport := newTransport(config)
+	// One request per connection at a time: HTTP/2 would multiplex all
+	// workers over a single connection
+	transport.ForceAttemptHTTP2 = false
+	transport.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+	transport.MaxConnsPerHost = config.Connections
+	transport.MaxIdleConnsPerHost = config.Connections
+	client := &http.Client{Transport: transport, Timeout: defaultHTTPTimeout, Jar: clientCookies}
+	defer client.CloseIdleConnections()
+
+	url := fmt.Sprintf("%s?bytes=%d", config.endpointURL(objectPath), config.ObjectSize)
+	get := func() error {
+		req, err := http.NewRequest(http.MethodGet, url, nil)
+		if err != nil {
+			return err
+		}
+		config.authorize(req)
+		resp, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return statusError(resp)
+		}
+		_, err = io.Copy(io.Discard, resp.Body)
+		return err
+	}
+
+	// A first request per connection keeps connection setup out of the
+	// measured latencies and fails fast against servers without /__obj
+	var wg sync.WaitGroup
+	errs := make([]error, config.Connections)
+	for i := range config.Connections {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = get()
+		}()
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return fmt.Errorf("warm-up request failed: %w", err)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), config.Duration)
+	defer cancel()
+	var (
+		mu        sync.Mutex
+		latencies []float64
+		failed    int
+		lastErr   error
+	)
+	start := time.Now()
+	for range config.Connections {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var local []float64
+			for ctx.Err() == nil {
+				t := time.Now()
+				err := get()
+				elapsed := time.Since(t)
+				mu.Lock()
+				if err != nil {
+					failed++
+					lastErr = err
+				}
+				mu.Unlock()
+				if err == nil {
+					local = append(local, durationMs(elapsed))
+				}
+			}
+			mu.Lock()
+			latencies = append(latencies, local...)
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	elapsed := time.Since(start)
+
+	if len(latencies) == 0 {
+		return fmt.Errorf("no request succeeded: %v", lastErr)
+	}
+	rate := float64(len(latencies)) / elapsed.Seconds()
+	fmt.Printf("Requests: %d in %.1f s, %d failed\n", len(latencies)+failed, elapsed.Seconds(), failed)
+	fmt.Printf("Rate: %.0f requests/s (%.0f per connection), %.1f Mbps of payload\n",
+		rate, rate/float64(config.Connections), rate*float64(config.ObjectSize)*8/1_000_000)
+	fmt.Printf("Latency ms: %s\n", formatRTTStats(latencies))
+	if failed > 0 {
+		fmt.Printf("Last error: %v\n", lastErr)
+	}
+	return nil
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// serveFilePath is the stable URL of -serve-file
+const serveFilePath = "/__file"
+
+// checkServeFile makes sure -serve-file is a readable regular file
+func checkServeFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("serve-file: %w", err)
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return fmt.Errorf("serve-file: %w", err)
+	}
+	if !info.Mode().IsRegular() {
+		return fmt.Errorf("serve-file: %s is not a regular file", path)
+	}
+	return nil
+}
+
+// countingWriter counts the body bytes of a response. It passes ReadFrom
+// through, so the server can still sendfile(2) a file.
+type countingWriter struct {
+	http.ResponseWriter
+	n int64
+
+	readFrom bool // the body went through the connection's ReadFrom
+	fromFile bool // straight from an *os.File, as sendfile needs
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(p)
+	w.n += int64(n)
+	return n, err
+}
+
+func (w *countingWriter) ReadFrom(r io.Reader) (int64, error) {
+	rf, ok := w.ResponseWriter.(io.ReaderFrom)
+	if !ok {
+		// HTTP/2 and HTTP/3 writers; hide ReadFrom so Copy uses Write
+		return io.Copy(struct{ io.Writer }{w}, r)
+	}
+	w.readFrom = true
+	src := r
+	if lr, ok := r.(*io.LimitedReader); ok {
+		src = lr.R
+	}
+	_, w.fromFile = src.(*os.File)
+	n, err := rf.ReadFrom(r)
+	w.n += n
+	return n, err
+}
+
+// copyPath describes how a response body got to the socket, for -debug:
+// net/http passes an *os.File on to sendfile(2) only on plain HTTP/1.x,
+// while HTTP/2, HTTP/3 and TLS copy it through buffers in user space
+func (w *countingWriter) copyPath(r *http.Request) string {
+	switch {
+	case r.ProtoMajor >= 2:
+		return fmt.Sprintf("buffered copy (HTTP/%d)", r.ProtoMajor)
+	case r.TLS != nil:
+		return "buffered copy (TLS)"
+	case !w.readFrom:
+		return "buffered copy (no ReadFrom)"
+	case !w.fromFile:
+		return "buffered copy (multipart ranges)"
+	}
+	if _, ok := connFromRequest(r).(io.ReaderFrom); !ok {
+		return "buffered copy (connection without ReadFrom)"
+	}
+	return "sendfile"
+}
+
+func (w *countingWriter) Unwrap() http.ResponseWriter { return w.ResponseWriter }
+
+// fileHandler serves -serve-file for download tests that should cover the
+// whole disk -> page cache -> socket path instead of generated bytes.
+// http.ServeContent handles Range requests and uses sendfile on plain TCP.
+func fileHandler(path string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			httpError(w, codeMethodNotAllowed, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		f, err := os.Open(path)
+		if err != nil {
+			logger.Printf("serve-file: %v", err)
+			httpError(w, codeInternal, "file unavailable", http.StatusInternalServerError)
+			return
+		}
+		defer f.Close()
+		info, err := f.Stat()
+		if err != nil {
+			logger.Printf("serve-file: %v", err)
+			httpError(w, codeInternal, "file unavailable", http.StatusInternalServerError)
+			return
+		}
+
+		size := info.Size()
+		if r.Method == http.MethodHead {
+			size = 0
+		}
+		settle, ok := reserveTransfer(w, r, size)
+		if !ok {
+			return
+		}
+
+		defer trackConcurrent()()
+		stats.requestSizes.observe(float64(size))
+		start := time.Now()
+		timing := timingOf(r)
+
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filepath.Base(path)))
+		w.Header().Set("Server-Timing", serverTiming(timingMetric{"queue", timing.queue}))
+
+		cw := &countingWriter{ResponseWriter: w}
+		http.ServeContent(cw, r, info.Name(), info.ModTime(), f)
+		settle(cw.n)
+		if r.Method == http.MethodHead {
+			return
+		}
+
+		observeTransfer(cw.n, time.Since(start))
+
+		stats.mu.Lock()
+		stats.totalDownloads++
+		stats.totalBytesDown += cw.n
+		stats.lastRequestTime = time.Now()
+		stats.mu.Unlock()
+
+		logTest(logFile, cw.n, "%s - %s%s%s", clientAddr(r), formatBytes(cw.n), mptcpNote(r), requestIDNote(r))
+		if serverDebug {
+			logger.Printf("[DEBUG] [FILE] %s - %s%s", clientAddr(r), cw.copyPath(r), requestIDNote(r))
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// parseServer normalizes a -server value: host, host:port, IPv6 literals
+// with or without brackets ("fd00::1", "[fd00::1]:8080") and http:// or
+// https:// URLs. It returns the address as it goes into a URL, with IPv6
+// in brackets and the port only when one was given, so that every test
+// still applies its own default port, and the scheme if there was one.
+func parseServer(s string) (addr, scheme string, err error) {
+	if strings.Contains(s, "://") {
+		u, err := url.Parse(s)
+		if err != nil {
+			return "", "", fmt.Errorf("invalid server '%s': %w", s, err)
+		}
+		scheme = strings.ToLower(u.Scheme)
+		if scheme != "http" && scheme != "https" {
+			return "", "", fmt.Errorf("invalid server '%s': scheme must be http or https", s)
+		}
+		if (u.Path != "" && u.Path != "/") || u.RawQuery != "" || u.User != nil {
+			return "", "", fmt.Errorf("invalid server '%s': only scheme, host and port are allowed", s)
+		}
+		s = u.Host
+	}
+
+	host, port, err := net.SplitHostPort(s)
+	if err != nil {
+		// No port, or an IPv6 literal without brackets
+		host, port = strings.Trim(s, "[]"), ""
+	}
+	if host == "" {
+		return "", "", fmt.Errorf("invalid server '%s': no host", s)
+	}
+	if strings.Contains(host, ":") {
+		ip, _, _ := strings.Cut(host, "%") // zone of a link-local address
+		if net.ParseIP(ip) == nil {
+			return "", "", fmt.Errorf("invalid server '%s': bad IPv6 address (with a port, write [address]:port)", s)
+		}
+	}
+	if port == "" {
+		if strings.Contains(host, ":") {
+			return "[" + host + "]", scheme, nil
+		}
+		return host, scheme, nil
+	}
+	if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+		return "", "", fmt.Errorf("invalid server '%s': bad port '%s'", s, port)
+	}
+	return net.JoinHostPort(host, port), scheme, nil
+}
+
+// resolveServer replaces -server with its normalized address; an https://
+// URL turns on -tls
+func (c *Config) resolveServer() error {
+	addr, scheme, err := parseServer(c.Server)
+	if err != nil {
+		return err
+	}
+	if scheme == "http" && c.TLS {
+		return fmt.Errorf("server '%s' is http:// but -tls is set", c.Server)
+	}
+	c.Server = addr
+	c.TLS = c.TLS || scheme == "https"
+	return nil
+}
+
+// serverHost is the host of a normalized server address, without port and
+// brackets
+func serverHost(server string) string {
+	if host, _, err := net.SplitHostPort(server); err == nil {
+		return host
+	}
+	return strings.Trim(server, "[]")
+}
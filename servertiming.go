@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// requestTiming records where the server's time for a test request went;
+// it is reported back in Server-Timing
+type requestTiming struct {
+	start time.Time     // request reached admission control
+	queue time.Duration // waiting for a -max-concurrent slot
+}
+
+type timingKey struct{}
+
+func withTiming(r *http.Request, t requestTiming) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), timingKey{}, t))
+}
+
+// timingOf returns the request's timing, starting now if none was recorded
+func timingOf(r *http.Request) requestTiming {
+	if t, ok := r.Context().Value(timingKey{}).(requestTiming); ok {
+		return t
+	}
+	return requestTiming{start: time.Now()}
+}
+
+// timingMetric is one Server-Timing entry
+type timingMetric struct {
+	name string
+	dur  time.Duration
+}
+
+// serverTiming formats metrics as a Server-Timing value
+func serverTiming(metrics ...timingMetric) string {
+	parts := make([]string, len(metrics))
+	for i, m := range metrics {
+		parts[i] = fmt.Sprintf("%s;dur=%.3f", m.name, float64(m.dur)/float64(time.Millisecond))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// acceptsTrailers reports whether the client asked for trailers, which
+// download responses use to report the time spent sending the body
+func acceptsTrailers(r *http.Request) bool {
+	for _, v := range r.Header.Values("TE") {
+		for _, te := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(te), "trailers") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// parseServerTiming returns the durations in milliseconds of all
+// Server-Timing metrics in the given headers; later values win
+func parseServerTiming(headers ...http.Header) map[string]float64 {
+	var timing map[string]float64
+	for _, h := range headers {
+		for _, v := range h.Values("Server-Timing") {
+			for _, metric := range strings.Split(v, ",") {
+				params := strings.Split(metric, ";")
+				name := strings.TrimSpace(params[0])
+				for _, p := range params[1:] {
+					key, value, _ := strings.Cut(strings.TrimSpace(p), "=")
+					if key != "dur" || name == "" {
+						continue
+					}
+					if ms, err := strconv.ParseFloat(strings.Trim(value, `"`), 64); err == nil {
+						if timing == nil {
+							timing = make(map[string]float64)
+						}
+						timing[name] = ms
+					}
+				}
+			}
+		}
+	}
+	return timing
+}
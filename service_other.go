@@ -0,0 +1,9 @@
+//go:build !windows
+
+package main
+
+import "fmt"
+
+func runServiceCommand(args []string) error {
+	return fmt.Errorf("service management is only supported on Windows, use install-service for systemd")
+}
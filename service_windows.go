@@ -0,0 +1,265 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/sys/windows"
+	"golang.org/x/sys/windows/svc"
+	"golang.org/x/sys/windows/svc/eventlog"
+	"golang.org/x/sys/windows/svc/mgr"
+)
+
+const (
+	serviceName        = "ethspeed"
+	serviceDisplayName = "EthSpeed speed test server"
+	serviceDescription = "Self-hosted HTTP speed test server"
+)
+
+// runServiceCommand implements "ethspeed service install|uninstall|start|stop|run".
+// Flags after "install" are stored in the service command line and used as
+// the server configuration when the service control manager starts it.
+func runServiceCommand(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: ethspeed service install|uninstall|start|stop [server flags]")
+	}
+
+	switch args[0] {
+	case "install":
+		return installService(args[1:])
+	case "uninstall", "remove":
+		return uninstallService()
+	case "start":
+		return startService()
+	case "stop":
+		return stopService()
+	case "run":
+		return runService(args[1:])
+	default:
+		return fmt.Errorf("unknown service command '%s'", args[0])
+	}
+}
+
+func installService(flags []string) error {
+	// Validate the flags now rather than when the SCM starts the service
+	config := parseFlags(flags)
+	config.Mode = modeServer
+	if err := config.validate(); err != nil {
+		return fmt.Errorf("configuration error: %w", err)
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("cannot find executable: %w", err)
+	}
+
+	m, err := mgr.Connect()
+	if err != nil {
+		return fmt.Errorf("connect to service manager: %w", err)
+	}
+	defer m.Disconnect()
+
+	if s, err := m.OpenService(serviceName); err == nil {
+		s.Close()
+		return fmt.Errorf("service %s already exists", serviceName)
+	}
+
+	s, err := m.CreateService(serviceName, exe, mgr.Config{
+		DisplayName: serviceDisplayName,
+		Description: serviceDescription,
+		StartType:   mgr.StartAutomatic,
+	}, append([]string{"service", "run"}, flags...)...)
+	if err != nil {
+		return fmt.Errorf("create service: %w", err)
+	}
+	defer s.Close()
+
+	if err := eventlog.InstallAsEventCreate(serviceName, eventlog.Error|eventlog.Warning|eventlog.Info); err != nil {
+		s.Delete()
+		return fmt.Errorf("install event log source: %w", err)
+	}
+
+	fmt.Printf("Service %s installed: %s service run %s\n", serviceName, exe, strings.Join(flags, " "))
+	return nil
+}
+
+func uninstallService() error {
+	m, err := mgr.Connect()
+	if err != nil {
+		return fmt.Errorf("connect to service manager: %w", err)
+	}
+	defer m.Disconnect()
+
+	s, err := m.OpenService(serviceName)
+	if err != nil {
+		return fmt.Errorf("service %s is not installed", serviceName)
+	}
+	defer s.Close()
+
+	if err := s.Delete(); err != nil {
+		return fmt.Errorf("delete service: %w", err)
+	}
+	eventlog.Remove(serviceName)
+
+	fmt.Printf("Service %s removed\n", serviceName)
+	return nil
+}
+
+func startService() error {
+	m, err := mgr.Connect()
+	if err != nil {
+		return fmt.Errorf("connect to service manager: %w", err)
+	}
+	defer m.Disconnect()
+
+	s, err := m.OpenService(serviceName)
+	if err != nil {
+		return fmt.Errorf("service %s is not installed", serviceName)
+	}
+	defer s.Close()
+
+	if err := s.Start(); err != nil {
+		return fmt.Errorf("start service: %w", err)
+	}
+
+	fmt.Printf("Service %s started\n", serviceName)
+	return nil
+}
+
+func stopService() error {
+	m, err := mgr.Connect()
+	if err != nil {
+		return fmt.Errorf("connect to service manager: %w", err)
+	}
+	defer m.Disconnect()
+
+	s, err := m.OpenService(serviceName)
+	if err != nil {
+		return fmt.Errorf("service %s is not installed", serviceName)
+	}
+	defer s.Close()
+
+	status, err := s.Control(svc.Stop)
+	if err != nil {
+		return fmt.Errorf("stop service: %w", err)
+	}
+
+	deadline := time.Now().Add(stopWait(s))
+	for status.State != svc.Stopped {
+		if time.Now().After(deadline) {
+			return fmt.Errorf("timed out waiting for service to stop")
+		}
+		time.Sleep(300 * time.Millisecond)
+		if status, err = s.Query(); err != nil {
+			return fmt.Errorf("query service: %w", err)
+		}
+	}
+
+	fmt.Printf("Service %s stopped\n", serviceName)
+	return nil
+}
+
+// stopServiceMargin is the time stop allows the service beyond its
+// -shutdown-timeout, as TimeoutStopSec does in the systemd unit
+const stopServiceMargin = 15 * time.Second
+
+// stopWait is how long stop waits for the service: the -shutdown-timeout
+// it was installed with, for running transfers to finish, plus a margin
+func stopWait(s *mgr.Service) time.Duration {
+	var flags []string
+	if c, err := s.Config(); err == nil {
+		// The command line is "<exe> service run [server flags]"
+		args, err := windows.DecomposeCommandLine(c.BinaryPathName)
+		if err == nil && len(args) >= 3 && args[1] == "service" && args[2] == "run" {
+			flags = args[3:]
+		}
+	}
+	return parseFlags(flags).ShutdownTimeout + stopServiceMargin
+}
+
+// runService is the entry point used by the service control manager
+func runService(flags []string) error {
+	isService, err := svc.IsWindowsService()
+	if err != nil {
+		return err
+	}
+	if !isService {
+		return fmt.Errorf("'service run' must be started by the service control manager")
+	}
+
+	config := parseFlags(flags)
+	config.Mode = modeServer
+	if err := config.validate(); err != nil {
+		return fmt.Errorf("configuration error: %w", err)
+	}
+	setupDisplay(config)
+
+	// There is no console under the SCM, send the log to the event log
+	// unless it is sent to syslog
+	if config.LogSyslog != "" {
+		if err := setupSyslog(config); err != nil {
+			return err
+		}
+	} else if el, err := eventlog.Open(serviceName); err == nil {
+		defer el.Close()
+		logger.SetOutput(eventlogWriter{el})
+		logger.SetFlags(0)
+	}
+
+	return svc.Run(serviceName, &serviceHandler{config: config})
+}
+
+// serviceHandler runs the speed test server under the service control manager
+type serviceHandler struct {
+	config Config
+}
+
+func (h *serviceHandler) Execute(args []string, requests <-chan svc.ChangeRequest, status chan<- svc.Status) (bool, uint32) {
+	const accepted = svc.AcceptStop | svc.AcceptShutdown
+
+	status <- svc.Status{State: svc.StartPending}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	done := make(chan struct{})
+	go func() {
+		runServer(ctx, h.config)
+		close(done)
+	}()
+
+	status <- svc.Status{State: svc.Running, Accepts: accepted}
+
+	for {
+		select {
+		case req := <-requests:
+			switch req.Cmd {
+			case svc.Interrogate:
+				status <- req.CurrentStatus
+			case svc.Stop, svc.Shutdown:
+				status <- svc.Status{State: svc.StopPending}
+				cancel()
+				<-done
+				return false, 0
+			}
+		case <-done:
+			// The server stopped without being asked to
+			return false, 1
+		}
+	}
+}
+
+// eventlogWriter adapts the Windows event log to an io.Writer for logger
+type eventlogWriter struct {
+	el *eventlog.Log
+}
+
+func (w eventlogWriter) Write(p []byte) (int, error) {
+	if err := w.el.Info(1, strings.TrimSpace(string(p))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// shuttingDown is set once the server got a stop signal: running
+// transfers may finish within -shutdown-timeout, new tests are refused.
+var shuttingDown atomic.Bool
+
+// refuseDuringShutdown answers new test requests with 503 once the server
+// is shutting down, and closes the connection so that the client's retry
+// goes to a fresh one, e.g. a restarted server or another backend.
+func refuseDuringShutdown(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if shuttingDown.Load() {
+			w.Header().Set("Connection", "close")
+			w.Header().Set("Retry-After", "10")
+			httpError(w, codeShuttingDown, "server shutting down, try again later", http.StatusServiceUnavailable)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// waitForTransfers waits until no /__down or /__up transfer runs any more
+// or the deadline passes, and returns how many still run
+func waitForTransfers(deadline time.Time) int64 {
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		active := atomic.LoadInt64(&stats.currentConcurrent)
+		if active == 0 || !time.Now().Before(deadline) {
+			return active
+		}
+		<-ticker.C
+	}
+}
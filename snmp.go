@@ -0,0 +1,462 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// A minimal read-only SNMP agent (v1 and v2c, Get/GetNext/GetBulk) that
+// serves the system group and ServerStats under ETHSPEED-MIB, so existing
+// NMS platforms can poll the server. See ETHSPEED-MIB.txt.
+
+// snmpEnterpriseOID is the ETHSPEED-MIB root. 32473 is the enterprise
+// number IANA reserves for documentation and examples (RFC 5612).
+var snmpEnterpriseOID = []uint32{1, 3, 6, 1, 4, 1, 32473, 1}
+
+// BER/SNMP tags
+const (
+	berInteger     = 0x02
+	berOctetString = 0x04
+	berNull        = 0x05
+	berOID         = 0x06
+	berSequence    = 0x30
+
+	snmpCounter32 = 0x41
+	snmpGauge32   = 0x42
+	snmpTimeTicks = 0x43
+	snmpCounter64 = 0x46
+
+	snmpNoSuchObject   = 0x80
+	snmpNoSuchInstance = 0x81
+	snmpEndOfMibView   = 0x82
+
+	pduGetRequest     = 0xa0
+	pduGetNextRequest = 0xa1
+	pduResponse       = 0xa2
+	pduSetRequest     = 0xa3
+	pduGetBulkRequest = 0xa5
+)
+
+// SNMP versions as encoded on the wire, and error-status values
+const (
+	snmpV1  = 0
+	snmpV2c = 1
+
+	snmpErrNoSuchName  = 2
+	snmpErrGenErr      = 5
+	snmpErrNotWritable = 17
+
+	// GetBulk answers are capped to stay within one UDP datagram
+	snmpMaxBulkVarbinds = 64
+)
+
+// snmpValue is an encoded BER value: tag plus content octets
+type snmpValue struct {
+	tag     byte
+	content []byte
+}
+
+// snmpObject is a scalar in the agent's view, listed in OID order
+type snmpObject struct {
+	oid   []uint32
+	value func() snmpValue
+}
+
+func snmpObjects() []snmpObject {
+	stat := func(n uint32) []uint32 {
+		return append(slices.Clone(snmpEnterpriseOID), 1, n, 0)
+	}
+	counter := func(f func() int64) func() snmpValue {
+		return func() snmpValue {
+			stats.mu.RLock()
+			defer stats.mu.RUnlock()
+			return snmpValue{snmpCounter64, berUint(uint64(f()))}
+		}
+	}
+	gauge := func(p *int64) func() snmpValue {
+		return func() snmpValue { return snmpValue{snmpGauge32, berUint(uint64(uint32(atomic.LoadInt64(p))))} }
+	}
+	uptime := func() snmpValue {
+		// TimeTicks are hundredths of a second
+		return snmpValue{snmpTimeTicks, berUint(uint64(uint32(time.Since(stats.startTime) / (10 * time.Millisecond))))}
+	}
+	hostname, _ := os.Hostname()
+
+	objects := []snmpObject{
+		// SNMPv2-MIB system group
+		{[]uint32{1, 3, 6, 1, 2, 1, 1, 1, 0}, func() snmpValue {
+			return snmpValue{berOctetString, []byte(fmt.Sprintf("ethspeed speed test server, %s/%s", runtime.GOOS, runtime.GOARCH))}
+		}},
+		{[]uint32{1, 3, 6, 1, 2, 1, 1, 2, 0}, func() snmpValue { return snmpValue{berOID, berOIDContent(snmpEnterpriseOID)} }},
+		{[]uint32{1, 3, 6, 1, 2, 1, 1, 3, 0}, uptime},
+		{[]uint32{1, 3, 6, 1, 2, 1, 1, 5, 0}, func() snmpValue { return snmpValue{berOctetString, []byte(hostname)} }},
+
+		// ETHSPEED-MIB::ethspeedStats
+		{stat(1), counter(func() int64 { return stats.totalDownloads })},
+		{stat(2), counter(func() int64 { return stats.totalUploads })},
+		{stat(3), counter(func() int64 { return stats.totalBytesDown })},
+		{stat(4), counter(func() int64 { return stats.totalBytesUp })},
+		{stat(5), counter(func() int64 { return stats.totalConnections })},
+		{stat(6), gauge(&stats.currentConcurrent)},
+		{stat(7), gauge(&stats.peakConcurrent)},
+		{stat(8), uptime},
+		{stat(9), func() snmpValue {
+			// TruthValue: true(1), false(2)
+			if draining.Load() {
+				return snmpValue{berInteger, berInt(1)}
+			}
+			return snmpValue{berInteger, berInt(2)}
+		}},
+	}
+	slices.SortFunc(objects, func(a, b snmpObject) int { return slices.Compare(a.oid, b.oid) })
+	return objects
+}
+
+// snmpAgent answers SNMP requests on one UDP socket
+type snmpAgent struct {
+	community []byte
+	objects   []snmpObject
+}
+
+func newSNMPAgent(community string) *snmpAgent {
+	return &snmpAgent{community: []byte(community), objects: snmpObjects()}
+}
+
+// serve answers requests until ctx is cancelled
+func (a *snmpAgent) serve(ctx context.Context, pc net.PacketConn) {
+	go func() {
+		<-ctx.Done()
+		pc.Close()
+	}()
+
+	buf := make([]byte, 64*1024)
+	for {
+		n, addr, err := pc.ReadFrom(buf)
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				logger.Printf("[SNMP] read error: %v", err)
+			}
+			return
+		}
+		// Malformed requests and wrong communities are dropped silently,
+		// as agents usually do
+		if resp, err := a.handle(buf[:n]); err == nil && resp != nil {
+			pc.WriteTo(resp, addr)
+		}
+	}
+}
+
+// handle decodes one request message and returns the encoded response
+func (a *snmpAgent) handle(msg []byte) ([]byte, error) {
+	tag, body, _, err := berRead(msg)
+	if err != nil || tag != berSequence {
+		return nil, errors.New("not an SNMP message")
+	}
+
+	tag, versionRaw, body, err := berRead(body)
+	if err != nil || tag != berInteger {
+		return nil, errors.New("bad version")
+	}
+	version := berParseInt(versionRaw)
+	if version != snmpV1 && version != snmpV2c {
+		return nil, fmt.Errorf("unsupported SNMP version %d", version)
+	}
+
+	tag, community, body, err := berRead(body)
+	if err != nil || tag != berOctetString {
+		return nil, errors.New("bad community")
+	}
+	if subtle.ConstantTimeCompare(community, a.community) != 1 {
+		return nil, errors.New("wrong community")
+	}
+
+	pduType, pdu, _, err := berRead(body)
+	if err != nil {
+		return nil, err
+	}
+
+	var fields [3][]byte // request-id, error-status/non-repeaters, error-index/max-repetitions
+	for i := range fields {
+		if tag, fields[i], pdu, err = berRead(pdu); err != nil || tag != berInteger {
+			return nil, errors.New("bad PDU header")
+		}
+	}
+	tag, varbindList, _, err := berRead(pdu)
+	if err != nil || tag != berSequence {
+		return nil, errors.New("bad varbind list")
+	}
+
+	var oids [][]uint32
+	for len(varbindList) > 0 {
+		var vb []byte
+		if tag, vb, varbindList, err = berRead(varbindList); err != nil || tag != berSequence {
+			return nil, errors.New("bad varbind")
+		}
+		tag, oidRaw, _, err := berRead(vb)
+		if err != nil || tag != berOID {
+			return nil, errors.New("bad varbind OID")
+		}
+		oid, err := berParseOID(oidRaw)
+		if err != nil {
+			return nil, err
+		}
+		oids = append(oids, oid)
+	}
+
+	var (
+		varbinds          []byte
+		errStatus, errIdx int
+	)
+	switch pduType {
+	case pduGetRequest, pduGetNextRequest:
+		for i, oid := range oids {
+			respOID, val, ok := a.lookup(oid, pduType == pduGetNextRequest, version)
+			if !ok && version == snmpV1 {
+				errStatus, errIdx = snmpErrNoSuchName, i+1
+			}
+			varbinds = append(varbinds, berVarbind(respOID, val)...)
+		}
+		if errStatus != 0 {
+			// v1 returns the request's varbinds unchanged on error
+			varbinds = nil
+			for _, oid := range oids {
+				varbinds = append(varbinds, berVarbind(oid, snmpValue{berNull, nil})...)
+			}
+		}
+
+	case pduGetBulkRequest:
+		if version == snmpV1 {
+			return nil, errors.New("GetBulk in SNMPv1")
+		}
+		nonRepeaters := min(max(int(berParseInt(fields[1])), 0), len(oids))
+		maxReps := max(int(berParseInt(fields[2])), 0)
+		// The cap is checked before every varbind; RFC 3416 lets a
+		// response end early
+		count := 0
+		for _, oid := range oids[:nonRepeaters] {
+			if count == snmpMaxBulkVarbinds {
+				break
+			}
+			respOID, val, _ := a.lookup(oid, true, version)
+			varbinds = append(varbinds, berVarbind(respOID, val)...)
+			count++
+		}
+		cursor := slices.Clone(oids[nonRepeaters:])
+	repeat:
+		for rep := 0; rep < maxReps && len(cursor) > 0; rep++ {
+			for j, oid := range cursor {
+				if count == snmpMaxBulkVarbinds {
+					break repeat
+				}
+				respOID, val, _ := a.lookup(oid, true, version)
+				varbinds = append(varbinds, berVarbind(respOID, val)...)
+				cursor[j] = respOID
+				count++
+			}
+		}
+
+	case pduSetRequest:
+		errStatus, errIdx = snmpErrNotWritable, 1
+		if version == snmpV1 {
+			errStatus = snmpErrNoSuchName
+		}
+		for _, oid := range oids {
+			varbinds = append(varbinds, berVarbind(oid, snmpValue{berNull, nil})...)
+		}
+
+	default:
+		return nil, fmt.Errorf("unsupported PDU type 0x%x", pduType)
+	}
+
+	respPDU := berTLV(berInteger, fields[0])
+	respPDU = append(respPDU, berTLV(berInteger, berInt(int64(errStatus)))...)
+	respPDU = append(respPDU, berTLV(berInteger, berInt(int64(errIdx)))...)
+	respPDU = append(respPDU, berTLV(berSequence, varbinds)...)
+
+	resp := berTLV(berInteger, versionRaw)
+	resp = append(resp, berTLV(berOctetString, community)...)
+	resp = append(resp, berTLV(pduResponse, respPDU)...)
+	return berTLV(berSequence, resp), nil
+}
+
+// lookup resolves oid exactly (Get) or to its successor (GetNext). When
+// nothing matches, ok is false and val carries the v2c exception.
+// Counter64 does not exist in SNMPv1, so v1 managers do not see it.
+func (a *snmpAgent) lookup(oid []uint32, next bool, version int64) (respOID []uint32, val snmpValue, ok bool) {
+	for _, obj := range a.objects {
+		cmp := slices.Compare(obj.oid, oid)
+		if cmp < 0 || (next && cmp == 0) {
+			continue
+		}
+		if !next && cmp > 0 {
+			break
+		}
+		v := obj.value()
+		if version == snmpV1 && v.tag == snmpCounter64 {
+			if next {
+				continue
+			}
+			break
+		}
+		return obj.oid, v, true
+	}
+
+	switch {
+	case next:
+		return oid, snmpValue{snmpEndOfMibView, nil}, false
+	case slices.ContainsFunc(a.objects, func(o snmpObject) bool {
+		return len(o.oid) > 0 && slices.Equal(o.oid[:len(o.oid)-1], oid)
+	}):
+		return oid, snmpValue{snmpNoSuchInstance, nil}, false
+	default:
+		return oid, snmpValue{snmpNoSuchObject, nil}, false
+	}
+}
+
+// ============== BER ENCODING ==============
+
+// berRead splits the first TLV off b
+func berRead(b []byte) (tag byte, content, rest []byte, err error) {
+	if len(b) < 2 {
+		return 0, nil, nil, errors.New("short BER value")
+	}
+	tag, b = b[0], b[1:]
+
+	length := int(b[0])
+	b = b[1:]
+	if length&0x80 != 0 {
+		n := length & 0x7f
+		if n == 0 || n > 4 || len(b) < n {
+			return 0, nil, nil, errors.New("bad BER length")
+		}
+		length = 0
+		for _, c := range b[:n] {
+			length = length<<8 | int(c)
+		}
+		b = b[n:]
+	}
+	if length < 0 || length > len(b) {
+		return 0, nil, nil, errors.New("truncated BER value")
+	}
+	return tag, b[:length], b[length:], nil
+}
+
+func berTLV(tag byte, content []byte) []byte {
+	out := []byte{tag}
+	switch n := len(content); {
+	case n < 0x80:
+		out = append(out, byte(n))
+	case n <= 0xff:
+		out = append(out, 0x81, byte(n))
+	default:
+		out = append(out, 0x82, byte(n>>8), byte(n))
+	}
+	return append(out, content...)
+}
+
+func berVarbind(oid []uint32, v snmpValue) []byte {
+	vb := berTLV(berOID, berOIDContent(oid))
+	vb = append(vb, berTLV(v.tag, v.content)...)
+	return berTLV(berSequence, vb)
+}
+
+// berInt encodes a two's complement integer in the fewest octets
+func berInt(v int64) []byte {
+	out := []byte{byte(v)}
+	for v > 0x7f || v < -0x80 {
+		v >>= 8
+		out = append([]byte{byte(v)}, out...)
+	}
+	return out
+}
+
+// berUint encodes an unsigned value (Counter, Gauge, TimeTicks)
+func berUint(v uint64) []byte {
+	out := []byte{byte(v)}
+	for v >>= 8; v > 0; v >>= 8 {
+		out = append([]byte{byte(v)}, out...)
+	}
+	if out[0]&0x80 != 0 {
+		out = append([]byte{0}, out...)
+	}
+	return out
+}
+
+func berParseInt(b []byte) int64 {
+	if len(b) == 0 || len(b) > 8 {
+		return 0
+	}
+	v := int64(int8(b[0]))
+	for _, c := range b[1:] {
+		v = v<<8 | int64(c)
+	}
+	return v
+}
+
+func berOIDContent(oid []uint32) []byte {
+	if len(oid) < 2 {
+		return []byte{0}
+	}
+	out := berBase128(oid[0]*40 + oid[1])
+	for _, n := range oid[2:] {
+		out = append(out, berBase128(n)...)
+	}
+	return out
+}
+
+func berBase128(n uint32) []byte {
+	out := []byte{byte(n & 0x7f)}
+	for n >>= 7; n > 0; n >>= 7 {
+		out = append([]byte{byte(n&0x7f) | 0x80}, out...)
+	}
+	return out
+}
+
+func berParseOID(b []byte) ([]uint32, error) {
+	if len(b) == 0 {
+		return nil, errors.New("empty OID")
+	}
+	var (
+		oid []uint32
+		n   uint32
+	)
+	for i, c := range b {
+		if n > 1<<25 {
+			return nil, errors.New("OID arc too large")
+		}
+		n = n<<7 | uint32(c&0x7f)
+		if c&0x80 != 0 {
+			if i == len(b)-1 {
+				return nil, errors.New("truncated OID")
+			}
+			continue
+		}
+		if len(oid) == 0 {
+			first := min(n/40, 2)
+			oid = append(oid, first, n-first*40)
+		} else {
+			oid = append(oid, n)
+		}
+		n = 0
+	}
+	return oid, nil
+}
+
+// formatOID renders an OID in dotted notation
+func formatOID(oid []uint32) string {
+	parts := make([]string, len(oid))
+	for i, n := range oid {
+		parts[i] = strconv.FormatUint(uint64(n), 10)
+	}
+	return strings.Join(parts, ".")
+}
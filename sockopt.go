@@ -0,0 +1,277 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+// socketOptions are applied to every test socket, through net.Dialer.Control
+// on the client and net.ListenConfig.Control on the server (accepted sockets
+// inherit them from the listener).
+type socketOptions struct {
+	SndBuf     int    // SO_SNDBUF in bytes, 0 leaves the kernel default
+	RcvBuf     int    // SO_RCVBUF in bytes, 0 leaves the kernel default
+	Nagle      bool   // clear TCP_NODELAY (Go sets it on every TCP connection)
+	Congestion string // TCP_CONGESTION algorithm (Linux only), empty for the system default
+	MPTCP      bool   // create Multipath TCP sockets (Linux only, falls back to TCP)
+	LocalIP    net.IP // client source address, nil to let the routing table choose
+	Device     string // interface client sockets are bound to (Linux, macOS), empty for none
+}
+
+// isSet reports whether any option differs from the defaults
+func (o socketOptions) isSet() bool {
+	return o.SndBuf > 0 || o.RcvBuf > 0 || o.Nagle || o.Congestion != "" || o.MPTCP
+}
+
+func (o socketOptions) control(network, address string, c syscall.RawConn) error {
+	var sockErr error
+	err := c.Control(func(fd uintptr) {
+		if o.Device != "" && bindDeviceSupported {
+			if err := bindToDevice(fd, o.Device, strings.HasSuffix(network, "6")); err != nil {
+				sockErr = fmt.Errorf("bind to interface %s: %w", o.Device, err)
+				return
+			}
+		}
+		if o.SndBuf > 0 {
+			if err := setsockoptInt(fd, solSocket, soSndBuf, o.SndBuf); err != nil {
+				sockErr = fmt.Errorf("set SO_SNDBUF: %w", err)
+				return
+			}
+		}
+		if o.RcvBuf > 0 {
+			if err := setsockoptInt(fd, solSocket, soRcvBuf, o.RcvBuf); err != nil {
+				sockErr = fmt.Errorf("set SO_RCVBUF: %w", err)
+				return
+			}
+		}
+		if o.Congestion != "" {
+			if err := setCongestion(fd, o.Congestion); err != nil {
+				sockErr = fmt.Errorf("set TCP_CONGESTION %s: %w", o.Congestion, err)
+				return
+			}
+		}
+	})
+	if err != nil {
+		return err
+	}
+	return sockErr
+}
+
+// applyConn sets the options that Go overrides after the socket is
+// connected, so they cannot go through control.
+func (o socketOptions) applyConn(conn net.Conn) {
+	if tc, ok := conn.(*tls.Conn); ok {
+		conn = tc.NetConn()
+	}
+	if tcp, ok := conn.(*net.TCPConn); ok && o.Nagle {
+		tcp.SetNoDelay(false)
+	}
+}
+
+// socketInfo holds the effective values the kernel applied to a socket.
+// Linux, for one, doubles requested buffer sizes and clamps them to
+// net.core.[rw]mem_max.
+type socketInfo struct {
+	SndBuf     int
+	RcvBuf     int
+	NoDelay    bool
+	Congestion string // empty where the platform cannot report it
+	MPTCP      bool   // connection negotiated Multipath TCP
+	Subflows   int    // additional MPTCP subflows
+}
+
+func (i socketInfo) String() string {
+	s := fmt.Sprintf("sndbuf %s, rcvbuf %s", formatBytes(int64(i.SndBuf)), formatBytes(int64(i.RcvBuf)))
+	if i.NoDelay {
+		s += ", nodelay on"
+	} else {
+		s += ", nodelay off (Nagle)"
+	}
+	if i.Congestion != "" {
+		s += ", congestion " + i.Congestion
+	}
+	if i.MPTCP {
+		s += fmt.Sprintf(", mptcp subflows %d", i.Subflows)
+	}
+	return s
+}
+
+// readSocketInfo queries the effective options of a connection or listener
+func readSocketInfo(sc syscall.Conn) (socketInfo, error) {
+	var info socketInfo
+
+	rc, err := sc.SyscallConn()
+	if err != nil {
+		return info, err
+	}
+
+	if tcp, ok := sc.(*net.TCPConn); ok {
+		info.MPTCP, _ = tcp.MultipathTCP()
+	}
+
+	var sockErr error
+	err = rc.Control(func(fd uintptr) {
+		if info.SndBuf, sockErr = getsockoptInt(fd, solSocket, soSndBuf); sockErr != nil {
+			return
+		}
+		if info.RcvBuf, sockErr = getsockoptInt(fd, solSocket, soRcvBuf); sockErr != nil {
+			return
+		}
+		var noDelay int
+		if noDelay, sockErr = getsockoptInt(fd, ipprotoTCP, tcpNoDelay); sockErr != nil {
+			return
+		}
+		info.NoDelay = noDelay != 0
+		info.Congestion, _ = getCongestion(fd)
+		if info.MPTCP {
+			info.Subflows, _ = mptcpSubflows(fd)
+		}
+	})
+	if err != nil {
+		return info, err
+	}
+	return info, sockErr
+}
+
+// clientSocket records the most recent client connection so its effective
+// options can be reported with the results.
+var clientSocket struct {
+	sync.Mutex
+	conn  net.Conn
+	info  socketInfo // as of dial time
+	valid bool
+}
+
+// lastClientSocketInfo returns the effective options of the most recent
+// client connection. They are re-read when the connection is still open,
+// since values such as the MPTCP subflow count change after dialing.
+func lastClientSocketInfo() (socketInfo, bool) {
+	clientSocket.Lock()
+	defer clientSocket.Unlock()
+
+	if sc, ok := clientSocket.conn.(syscall.Conn); ok {
+		if info, err := readSocketInfo(sc); err == nil {
+			return info, true
+		}
+	}
+	return clientSocket.info, clientSocket.valid
+}
+
+// dialContext returns a DialContext function applying the socket options to
+// every outgoing connection and recording their effective values.
+func (o socketOptions) dialContext() func(ctx context.Context, network, addr string) (net.Conn, error) {
+	dialer := &net.Dialer{Control: o.control}
+	dialer.SetMultipathTCP(o.MPTCP)
+	if o.LocalIP != nil {
+		dialer.LocalAddr = &net.TCPAddr{IP: o.LocalIP}
+	}
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		dialAddr := addr
+		if clientDNSCache != nil {
+			dialAddr = clientDNSCache.lookup(addr)
+		}
+		ctx, trace := traceDial(ctx, dialAddr)
+		conn, err := dialer.DialContext(ctx, network, dialAddr)
+		if err != nil {
+			return nil, err
+		}
+		trace.finish(conn)
+		if clientDNSCache != nil {
+			clientDNSCache.pin(addr, conn)
+		}
+		o.applyConn(conn)
+		if sc, ok := conn.(syscall.Conn); ok {
+			if info, err := readSocketInfo(sc); err == nil {
+				clientSocket.Lock()
+				clientSocket.conn = conn
+				clientSocket.info, clientSocket.valid = info, true
+				clientSocket.Unlock()
+			}
+		}
+		return clientLimit.wrap(conn), nil
+	}
+}
+
+type connContextKey struct{}
+
+// connContext is used as http.Server.ConnContext: it applies the
+// post-connect socket options and stores the connection in the request
+// context for connFromRequest.
+func (o socketOptions) connContext(ctx context.Context, c net.Conn) context.Context {
+	o.applyConn(c)
+	return context.WithValue(ctx, connContextKey{}, c)
+}
+
+// connFromRequest returns the server-side connection a request arrived on
+func connFromRequest(r *http.Request) net.Conn {
+	conn, _ := r.Context().Value(connContextKey{}).(net.Conn)
+	if tc, ok := conn.(*tls.Conn); ok {
+		return tc.NetConn()
+	}
+	return conn
+}
+
+// mptcpNote returns a log suffix describing MPTCP use on the request's
+// connection, or "" for plain TCP.
+func mptcpNote(r *http.Request) string {
+	tcp, ok := connFromRequest(r).(*net.TCPConn)
+	if !ok {
+		return ""
+	}
+	if mp, _ := tcp.MultipathTCP(); !mp {
+		return ""
+	}
+	info, err := readSocketInfo(tcp)
+	if err != nil {
+		return " [mptcp]"
+	}
+	return fmt.Sprintf(" [mptcp subflows=%d]", info.Subflows)
+}
+
+// byteSize is a flag.Value accepting sizes such as "512K", "4M" or "1G"
+// (1024-based). A plain number is taken as bytes.
+type byteSize int64
+
+func (b *byteSize) String() string {
+	return strconv.FormatInt(int64(*b), 10)
+}
+
+func (b *byteSize) Set(v string) error {
+	n, err := parseByteSize(v)
+	if err != nil {
+		return err
+	}
+	*b = byteSize(n)
+	return nil
+}
+
+func parseByteSize(v string) (int64, error) {
+	s := strings.ToUpper(strings.TrimSpace(v))
+	s = strings.TrimSuffix(s, "B")
+
+	multiplier := int64(1)
+	switch {
+	case strings.HasSuffix(s, "K"):
+		multiplier = 1024
+	case strings.HasSuffix(s, "M"):
+		multiplier = 1024 * 1024
+	case strings.HasSuffix(s, "G"):
+		multiplier = 1024 * 1024 * 1024
+	}
+	if multiplier > 1 {
+		s = s[:len(s)-1]
+	}
+
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size '%s'", v)
+	}
+	return n * multiplier, nil
+}
@@ -0,0 +1,22 @@
+//go:build unix
+
+package main
+
+import "golang.org/x/sys/unix"
+
+const (
+	solSocket = unix.SOL_SOCKET
+	soSndBuf  = unix.SO_SNDBUF
+	soRcvBuf  = unix.SO_RCVBUF
+
+	ipprotoTCP = unix.IPPROTO_TCP
+	tcpNoDelay = unix.TCP_NODELAY
+)
+
+func setsockoptInt(fd uintptr, level, opt, value int) error {
+	return unix.SetsockoptInt(int(fd), level, opt, value)
+}
+
+func getsockoptInt(fd uintptr, level, opt int) (int, error) {
+	return unix.GetsockoptInt(int(fd), level, opt)
+}
@@ -0,0 +1,20 @@
+package main
+
+import "golang.org/x/sys/windows"
+
+const (
+	solSocket = windows.SOL_SOCKET
+	soSndBuf  = windows.SO_SNDBUF
+	soRcvBuf  = windows.SO_RCVBUF
+
+	ipprotoTCP = windows.IPPROTO_TCP
+	tcpNoDelay = windows.TCP_NODELAY
+)
+
+func setsockoptInt(fd uintptr, level, opt, value int) error {
+	return windows.SetsockoptInt(windows.Handle(fd), level, opt, value)
+}
+
+func getsockoptInt(fd uintptr, level, opt int) (int, error) {
+	return windows.GetsockoptInt(windows.Handle(fd), level, opt)
+}
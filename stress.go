@@ -0,0 +1,215 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// stressCPUBound is the share of all cores above which the client, not the
+// network, is taken to limit a -stress run
+const stressCPUBound = 90
+
+// stressReport is the result of a -stress run
+type stressReport struct {
+	Time        time.Time `json:"time"`
+	Server      string    `json:"server"`
+	Connections int       `json:"connections"` // per direction
+	Seconds     float64   `json:"seconds"`
+
+	DownloadMbps float64 `json:"download_mbps"`
+	UploadMbps   float64 `json:"upload_mbps"`
+	BytesDown    int64   `json:"bytes_down"`
+	BytesUp      int64   `json:"bytes_up"`
+	Transfers    int64   `json:"transfers"`
+	Failed       int64   `json:"failed"`
+	LastError    string  `json:"last_error,omitempty"`
+
+	// Client resources over the run: process CPU time, as a share of all
+	// cores, and the garbage collector's stop-the-world pauses
+	Cores          int     `json:"cores"`
+	CPUSeconds     float64 `json:"cpu_seconds"`
+	CPUPercent     float64 `json:"cpu_percent"`
+	GCCount        uint32  `json:"gc_count"`
+	GCPauseTotalMs float64 `json:"gc_pause_total_ms"`
+	GCPauseMaxMs   float64 `json:"gc_pause_max_ms"`
+	CPUBound       bool    `json:"cpu_bound"`
+}
+
+// countingBody counts the bytes read through it into n
+type countingBody struct {
+	io.Reader
+	n *atomic.Int64
+}
+
+func (c countingBody) Read(p []byte) (int, error) {
+	k, err := c.Reader.Read(p)
+	c.n.Add(int64(k))
+	return k, err
+}
+
+// runStressTest runs -connections downloads and as many uploads of -s MB
+// back to back for -duration (-stress) and reports what the client's CPU
+// and garbage collector went through. A client at full CPU measures its
+// own limit; one with cores to spare measures the network or the server.
+func runStressTest(config Config) error {
+	transport := newTransport(config)
+	// A connection per transfer: HTTP/2 would put them all on one
+	transport.ForceAttemptHTTP2 = false
+	transport.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+	transport.MaxIdleConnsPerHost = 2 * config.Connections
+	client := &http.Client{Transport: transport, Jar: clientCookies}
+	defer client.CloseIdleConnections()
+
+	numBytes := int64(config.Size) * 1_000_000
+	data := make([]byte, numBytes)
+	if clientPayload.kind != payloadZeros {
+		io.ReadFull(clientPayload.reader(), data)
+	}
+	downURL := config.downURL(numBytes)
+	upURL := config.upURL(numBytes)
+
+	if !config.JSON {
+		fmt.Printf("Stress test - %d downloads and %d uploads of %d MB at a time for %v\n",
+			config.Connections, config.Connections, config.Size, config.Duration)
+		fmt.Printf("Server: %s\n\n", config.Server)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), config.Duration)
+	defer cancel()
+
+	var (
+		down, up          atomic.Int64
+		transfers, failed atomic.Int64
+		errMu             sync.Mutex
+		lastErr           error
+	)
+	transfer := func(method, url string, body io.Reader) {
+		req, err := http.NewRequestWithContext(ctx, method, url, body)
+		if err == nil {
+			config.authorize(req)
+			if body != nil {
+				req.ContentLength = numBytes
+				req.Header.Set("Content-Type", "application/octet-stream")
+			} else {
+				config.bustCache(req)
+			}
+			var resp *http.Response
+			if resp, err = client.Do(req); err == nil {
+				if resp.StatusCode != http.StatusOK {
+					err = statusError(resp)
+				} else {
+					var r io.Reader = resp.Body
+					if body == nil {
+						r = countingBody{resp.Body, &down}
+					}
+					_, err = io.Copy(io.Discard, r)
+				}
+				resp.Body.Close()
+			}
+		}
+		switch {
+		case ctx.Err() != nil:
+			// Cut off at the end of the run
+		case err != nil:
+			failed.Add(1)
+			errMu.Lock()
+			lastErr = err
+			errMu.Unlock()
+			// Keep a failing server from being hammered in a tight loop
+			time.Sleep(100 * time.Millisecond)
+		default:
+			transfers.Add(1)
+		}
+	}
+
+	var before runtime.MemStats
+	runtime.ReadMemStats(&before)
+	cpuBefore := processCPUTime()
+	start := time.Now()
+
+	var wg sync.WaitGroup
+	for range config.Connections {
+		wg.Go(func() {
+			for ctx.Err() == nil {
+				transfer(http.MethodGet, downURL, nil)
+			}
+		})
+		wg.Go(func() {
+			for ctx.Err() == nil {
+				transfer(http.MethodPost, upURL, countingBody{bytes.NewReader(data), &up})
+			}
+		})
+	}
+	wg.Wait()
+
+	elapsed := time.Since(start)
+	cpu := processCPUTime() - cpuBefore
+	var after runtime.MemStats
+	runtime.ReadMemStats(&after)
+
+	report := stressReport{
+		Time:        start,
+		Server:      config.Server,
+		Connections: config.Connections,
+		Seconds:     elapsed.Seconds(),
+		BytesDown:   down.Load(),
+		BytesUp:     up.Load(),
+		Transfers:   transfers.Load(),
+		Failed:      failed.Load(),
+		Cores:       runtime.GOMAXPROCS(0),
+		CPUSeconds:  cpu.Seconds(),
+		GCCount:     after.NumGC - before.NumGC,
+	}
+	report.DownloadMbps = float64(report.BytesDown) * 8 / elapsed.Seconds() / 1_000_000
+	report.UploadMbps = float64(report.BytesUp) * 8 / elapsed.Seconds() / 1_000_000
+	report.CPUPercent = cpu.Seconds() / elapsed.Seconds() / float64(report.Cores) * 100
+	report.CPUBound = report.CPUPercent >= stressCPUBound
+	report.GCPauseTotalMs = float64(after.PauseTotalNs-before.PauseTotalNs) / 1e6
+	// PauseNs is a ring of the most recent 256 pauses
+	for i := uint32(0); i < min(report.GCCount, uint32(len(after.PauseNs))); i++ {
+		pause := after.PauseNs[(after.NumGC-1-i)%uint32(len(after.PauseNs))]
+		report.GCPauseMaxMs = max(report.GCPauseMaxMs, float64(pause)/1e6)
+	}
+	if lastErr != nil {
+		report.LastError = lastErr.Error()
+	}
+
+	if config.JSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(report)
+	} else {
+		report.print()
+	}
+	if report.BytesDown+report.BytesUp == 0 {
+		return fmt.Errorf("no data transferred: %v", lastErr)
+	}
+	return nil
+}
+
+func (r *stressReport) print() {
+	fmt.Printf("Achieved: down %s | up %s | total %s over %.1f s\n",
+		displayUnit.format(r.DownloadMbps), displayUnit.format(r.UploadMbps),
+		displayUnit.format(r.DownloadMbps+r.UploadMbps), r.Seconds)
+	fmt.Printf("Transfers: %d completed, %d failed\n", r.Transfers, r.Failed)
+	if r.LastError != "" {
+		fmt.Printf("Last error: %s\n", r.LastError)
+	}
+	fmt.Printf("Client CPU: %.1f s, %.0f%% of %d cores\n", r.CPUSeconds, r.CPUPercent, r.Cores)
+	fmt.Printf("GC: %d collections, %.1f ms paused in total, longest %.2f ms\n", r.GCCount, r.GCPauseTotalMs, r.GCPauseMaxMs)
+	if r.CPUBound {
+		fmt.Println("WARNING: the client's CPU was saturated; the rates are the limit of this machine, not of the network")
+	} else {
+		fmt.Println("The client had CPU to spare: the network or the server is the limit")
+	}
+}
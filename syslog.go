@@ -0,0 +1,161 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// syslogFacilities maps -log-syslog-facility names to facility codes
+var syslogFacilities = map[string]int{
+	"kern": 0, "user": 1, "mail": 2, "daemon": 3, "auth": 4, "syslog": 5,
+	"lpr": 6, "news": 7, "uucp": 8, "cron": 9, "authpriv": 10, "ftp": 11,
+	"local0": 16, "local1": 17, "local2": 18, "local3": 19,
+	"local4": 20, "local5": 21, "local6": 22, "local7": 23,
+}
+
+// syslogSeverityInfo is the severity of every log line; the logger does not
+// distinguish levels
+const syslogSeverityInfo = 6
+
+// syslogLocalPaths are tried in order for -log-syslog local
+var syslogLocalPaths = []string{"/dev/log", "/var/run/syslog", "/var/run/log"}
+
+// syslogTarget is a parsed -log-syslog value
+type syslogTarget struct {
+	network string // "unixgram", "udp" or "tcp"
+	addr    string // empty for the local daemon
+}
+
+// parseSyslogTarget accepts "local", "udp://host[:port]" and "tcp://host[:port]"
+func parseSyslogTarget(s string) (syslogTarget, error) {
+	if s == "local" {
+		return syslogTarget{network: "unixgram"}, nil
+	}
+	u, err := url.Parse(s)
+	if err != nil || (u.Scheme != "udp" && u.Scheme != "tcp") || u.Host == "" {
+		return syslogTarget{}, fmt.Errorf("invalid log-syslog '%s', expected 'local', 'udp://host[:port]' or 'tcp://host[:port]'", s)
+	}
+	return syslogTarget{network: u.Scheme, addr: withDefaultPort(u.Host, "514")}, nil
+}
+
+// syslogWriter is an io.Writer for log.Logger that sends every line as one
+// syslog message: RFC 5424 to remote collectors (octet-counted over TCP,
+// RFC 6587) and the traditional RFC 3164 format to the local daemon, which
+// is what /dev/log readers such as journald parse best.
+type syslogWriter struct {
+	target   syslogTarget
+	facility int
+	hostname string
+	app      string
+
+	mu   sync.Mutex
+	conn net.Conn
+}
+
+func newSyslogWriter(target syslogTarget, facility int) (*syslogWriter, error) {
+	hostname, _ := os.Hostname()
+	if hostname == "" {
+		hostname = "-" // NILVALUE
+	}
+	w := &syslogWriter{
+		target:   target,
+		facility: facility,
+		hostname: hostname,
+		app:      strings.TrimSuffix(filepath.Base(os.Args[0]), ".exe"),
+	}
+	if err := w.dial(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+func (w *syslogWriter) dial() error {
+	if w.target.addr != "" {
+		conn, err := net.DialTimeout(w.target.network, w.target.addr, 5*time.Second)
+		if err != nil {
+			return fmt.Errorf("syslog: %w", err)
+		}
+		w.conn = conn
+		return nil
+	}
+
+	var lastErr error
+	for _, path := range syslogLocalPaths {
+		conn, err := net.Dial("unixgram", path)
+		if err == nil {
+			w.conn = conn
+			return nil
+		}
+		lastErr = err
+	}
+	return fmt.Errorf("syslog: no local syslog daemon: %w", lastErr)
+}
+
+func (w *syslogWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for _, line := range bytes.Split(p, []byte("\n")) {
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		msg := w.format(time.Now(), line)
+
+		// Reconnect once, e.g. after the collector or daemon restarted
+		if err := w.send(msg); err != nil {
+			if w.conn != nil {
+				w.conn.Close()
+			}
+			if err := w.dial(); err != nil {
+				return 0, err
+			}
+			if err := w.send(msg); err != nil {
+				return 0, err
+			}
+		}
+	}
+	return len(p), nil
+}
+
+func (w *syslogWriter) send(msg []byte) error {
+	w.conn.SetWriteDeadline(time.Now().Add(5 * time.Second))
+	_, err := w.conn.Write(msg)
+	return err
+}
+
+func (w *syslogWriter) format(t time.Time, line []byte) []byte {
+	pri := w.facility*8 + syslogSeverityInfo
+
+	if w.target.addr == "" {
+		return fmt.Appendf(nil, "<%d>%s %s[%d]: %s", pri, t.Format(time.Stamp), w.app, os.Getpid(), line)
+	}
+
+	// <PRI>VERSION TIMESTAMP HOSTNAME APP-NAME PROCID MSGID STRUCTURED-DATA MSG
+	msg := fmt.Appendf(nil, "<%d>1 %s %s %s %d - - %s",
+		pri, t.Format(time.RFC3339Nano), w.hostname, w.app, os.Getpid(), line)
+	if w.target.network == "tcp" {
+		return append(fmt.Appendf(nil, "%d ", len(msg)), msg...)
+	}
+	return msg
+}
+
+// setupSyslog points the logger at the -log-syslog target
+func setupSyslog(config Config) error {
+	// Both values are checked in Config.validate
+	target, _ := parseSyslogTarget(config.LogSyslog)
+	w, err := newSyslogWriter(target, syslogFacilities[config.LogSyslogFacility])
+	if err != nil {
+		return err
+	}
+	// The syslog header carries the timestamp
+	logger.SetOutput(w)
+	logger.SetFlags(0)
+	return nil
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const defaultUnitFile = "/etc/systemd/system/ethspeed.service"
+
+// systemdUnit is the unit written by install-service. The server runs as
+// a dynamic user with the filesystem locked down: it may write only to its
+// state directory, the working directory relative -db and -tls-cert-cache
+// paths resolve in, and to the directories of absolute ones.
+const systemdUnit = `[Unit]
+Description=EthSpeed speed test server
+Documentation=https://github.com/sshtome/ethspeed
+Wants=network-online.target
+After=network-online.target
+
+[Service]
+Type=notify
+ExecStart=%s
+Restart=on-failure
+RestartSec=2
+WatchdogSec=30
+TimeoutStopSec=45
+
+DynamicUser=yes
+RuntimeDirectory=ethspeed
+StateDirectory=ethspeed
+WorkingDirectory=/var/lib/ethspeed
+%sAmbientCapabilities=CAP_NET_BIND_SERVICE
+CapabilityBoundingSet=CAP_NET_BIND_SERVICE
+NoNewPrivileges=yes
+ProtectSystem=strict
+ProtectHome=yes
+PrivateTmp=yes
+PrivateDevices=yes
+ProtectClock=yes
+ProtectHostname=yes
+ProtectKernelTunables=yes
+ProtectKernelModules=yes
+ProtectKernelLogs=yes
+ProtectControlGroups=yes
+RestrictAddressFamilies=AF_INET AF_INET6 AF_UNIX
+RestrictNamespaces=yes
+RestrictRealtime=yes
+RestrictSUIDSGID=yes
+LockPersonality=yes
+MemoryDenyWriteExecute=yes
+SystemCallArchitectures=native
+SystemCallFilter=@system-service
+LimitNOFILE=65536
+
+[Install]
+WantedBy=multi-user.target
+`
+
+// runInstallService implements "ethspeed install-service [-unit-file path] [server flags]"
+func runInstallService(args []string) error {
+	unitFile := defaultUnitFile
+	if len(args) > 0 {
+		switch {
+		case args[0] == "-unit-file" || args[0] == "--unit-file":
+			if len(args) < 2 {
+				return fmt.Errorf("-unit-file requires a path")
+			}
+			unitFile, args = args[1], args[2:]
+		case strings.HasPrefix(args[0], "-unit-file=") || strings.HasPrefix(args[0], "--unit-file="):
+			_, unitFile, _ = strings.Cut(args[0], "=")
+			args = args[1:]
+		}
+	}
+
+	config := parseFlags(args)
+	config.Mode = modeServer
+	if err := config.validate(); err != nil {
+		return fmt.Errorf("configuration error: %w", err)
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("cannot find executable: %w", err)
+	}
+
+	cmdline := []string{systemdQuote(exe), "-mode", "server"}
+	for _, arg := range args {
+		cmdline = append(cmdline, systemdQuote(arg))
+	}
+	var writable strings.Builder
+	for _, path := range []string{config.DB, config.TLSCertCache} {
+		if filepath.IsAbs(path) {
+			// The directory, for SQLite journals and atomic replacement
+			fmt.Fprintf(&writable, "ReadWritePaths=%s\n", systemdQuote(filepath.Dir(path)))
+		}
+	}
+	unit := fmt.Sprintf(systemdUnit, strings.Join(cmdline, " "), writable.String())
+
+	tmp := unitFile + ".tmp"
+	if err := os.WriteFile(tmp, []byte(unit), 0o644); err != nil {
+		return fmt.Errorf("write unit: %w", err)
+	}
+	if err := os.Rename(tmp, unitFile); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("write unit: %w", err)
+	}
+
+	fmt.Printf("Wrote %s\n", unitFile)
+	fmt.Println("Enable it with: systemctl daemon-reload && systemctl enable --now ethspeed")
+	return nil
+}
+
+// systemdQuote quotes a command line argument for ExecStart
+func systemdQuote(arg string) string {
+	if arg != "" && !strings.ContainsAny(arg, " \t\"'\\$%;") {
+		return arg
+	}
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, `$`, `$$`, `%`, `%%`)
+	return `"` + r.Replace(arg) + `"`
+}
+
+// sdNotify sends a state update to systemd. It is a no-op when the process
+// is not supervised by systemd (NOTIFY_SOCKET unset).
+func sdNotify(state string) {
+	addr := os.Getenv("NOTIFY_SOCKET")
+	if addr == "" {
+		return
+	}
+
+	conn, err := net.Dial("unixgram", addr)
+	if err != nil {
+		logger.Printf("sd_notify: %v", err)
+		return
+	}
+	defer conn.Close()
+
+	if _, err := conn.Write([]byte(state)); err != nil {
+		logger.Printf("sd_notify: %v", err)
+	}
+}
+
+// sdWatchdog pings the systemd watchdog at half the configured interval
+// until ctx is cancelled. It returns immediately when no watchdog is set.
+func sdWatchdog(ctx context.Context) {
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return
+	}
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return
+	}
+
+	ticker := time.NewTicker(time.Duration(usec) * time.Microsecond / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			sdNotify("WATCHDOG=1")
+		}
+	}
+}
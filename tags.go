@@ -0,0 +1,41 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// tagKey limits -tag names to what label-based systems accept
+var tagKey = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// parseTags turns -tag key=value items into a map; a later value for the
+// same key wins
+func parseTags(items []string) (map[string]string, error) {
+	if len(items) == 0 {
+		return nil, nil
+	}
+	tags := make(map[string]string, len(items))
+	for _, item := range items {
+		key, value, ok := strings.Cut(item, "=")
+		if !ok || value == "" {
+			return nil, fmt.Errorf("invalid tag '%s', expected key=value", item)
+		}
+		if !tagKey.MatchString(key) {
+			return nil, fmt.Errorf("invalid tag name '%s', use letters, digits and _", key)
+		}
+		tags[key] = value
+	}
+	return tags, nil
+}
+
+// formatTags renders tags as sorted "key=value" pairs separated by spaces
+func formatTags(tags map[string]string) string {
+	pairs := make([]string, 0, len(tags))
+	for k, v := range tags {
+		pairs = append(pairs, k+"="+v)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, " ")
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"strings"
+	"time"
+)
+
+const selfSignedValidity = 365 * 24 * time.Hour
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// parseTLSVersion maps a -tls-min-version value such as "1.2" to its constant
+func parseTLSVersion(v string) (uint16, error) {
+	version, ok := tlsVersions[strings.TrimPrefix(strings.ToLower(v), "tls")]
+	if !ok {
+		return 0, fmt.Errorf("invalid TLS version '%s', must be 1.0, 1.1, 1.2 or 1.3", v)
+	}
+	return version, nil
+}
+
+// parseCipherSuites maps cipher suite names (as printed by Go, e.g.
+// TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256) to their IDs. Only TLS 1.0-1.2
+// suites are configurable; TLS 1.3 suites are fixed by crypto/tls.
+func parseCipherSuites(names []string) ([]uint16, error) {
+	known := make(map[string]uint16)
+	for _, suite := range append(tls.CipherSuites(), tls.InsecureCipherSuites()...) {
+		known[suite.Name] = suite.ID
+	}
+
+	ids := make([]uint16, 0, len(names))
+	for _, name := range names {
+		id, ok := known[strings.ToUpper(name)]
+		if !ok {
+			return nil, fmt.Errorf("unknown cipher suite '%s'", name)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// serverTLSConfig builds the TLS configuration shared by all tls: listeners
+func serverTLSConfig(config Config) (*tls.Config, error) {
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	if config.TLSMinVersion != "" {
+		version, err := parseTLSVersion(config.TLSMinVersion)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.MinVersion = version
+	}
+
+	if len(config.TLSCiphers) > 0 {
+		suites, err := parseCipherSuites(config.TLSCiphers)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.CipherSuites = suites
+	}
+
+	var (
+		cert tls.Certificate
+		err  error
+	)
+	if config.TLSSelfSigned {
+		cert, err = selfSignedCertificate(config.TLSCertCache)
+	} else {
+		cert, err = tls.LoadX509KeyPair(config.TLSCert, config.TLSKey)
+	}
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig.Certificates = []tls.Certificate{cert}
+
+	if config.TLSClientCA != "" {
+		pool, err := loadClientCAs(config.TLSClientCA)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+		tlsConfig.ClientCAs = pool
+	}
+
+	return tlsConfig, nil
+}
+
+// timeHandshakes makes the handshakes on c record how long they took from
+// the ClientHello and whether a session ticket saved the full exchange.
+// Behind a load balancer that shows whether tickets actually work. Each
+// handshake runs on a copy of c, so c must be the listener's final config,
+// ALPN protocols included.
+func timeHandshakes(c *tls.Config) {
+	verify := c.VerifyConnection
+	c.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+		start := time.Now()
+		hc := c.Clone()
+		hc.GetConfigForClient = nil
+		// Called once the handshake is done, resumed ones included
+		hc.VerifyConnection = func(cs tls.ConnectionState) error {
+			if verify != nil {
+				if err := verify(cs); err != nil {
+					return err
+				}
+			}
+			if cs.DidResume {
+				stats.tlsResumed.observe(time.Since(start).Seconds())
+			} else {
+				stats.tlsFull.observe(time.Since(start).Seconds())
+			}
+			return nil
+		}
+		return hc, nil
+	}
+}
+
+// selfSignedCertificate returns a self-signed certificate for this host.
+// With a cache path the certificate is stored there and reused across
+// restarts until it expires, so clients can pin its fingerprint.
+func selfSignedCertificate(cachePath string) (tls.Certificate, error) {
+	if cachePath != "" {
+		if data, err := os.ReadFile(cachePath); err == nil {
+			cert, err := tls.X509KeyPair(data, data)
+			if err == nil && time.Now().Before(cert.Leaf.NotAfter) {
+				logger.Printf("Using cached self-signed certificate %s (SHA-256 %s)",
+					cachePath, certFingerprint(cert.Leaf.Raw))
+				return cert, nil
+			}
+		}
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("generate key: %w", err)
+	}
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("generate serial: %w", err)
+	}
+
+	hostname, _ := os.Hostname()
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: hostname, Organization: []string{"ethspeed self-signed"}},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(selfSignedValidity),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		DNSNames:              []string{"localhost"},
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback},
+	}
+	if hostname != "" {
+		template.DNSNames = append(template.DNSNames, hostname)
+	}
+	if addrs, err := net.InterfaceAddrs(); err == nil {
+		for _, addr := range addrs {
+			if ipNet, ok := addr.(*net.IPNet); ok && !ipNet.IP.IsLoopback() {
+				template.IPAddresses = append(template.IPAddresses, ipNet.IP)
+			}
+		}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("create certificate: %w", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("marshal key: %w", err)
+	}
+
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+
+	if cachePath != "" {
+		if err := os.WriteFile(cachePath, append(certPEM, keyPEM...), 0o600); err != nil {
+			logger.Printf("Warning: cannot cache self-signed certificate: %v", err)
+		}
+	}
+
+	logger.Printf("Generated self-signed certificate for %s (SHA-256 %s)",
+		strings.Join(template.DNSNames, ", "), certFingerprint(der))
+
+	return tls.X509KeyPair(certPEM, keyPEM)
+}
+
+// certFingerprint formats the SHA-256 fingerprint of a DER certificate
+func certFingerprint(der []byte) string {
+	sum := sha256.Sum256(der)
+	return strings.ToUpper(hex.EncodeToString(sum[:]))
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bufio"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+)
+
+// handshakeSample is one connection of -test tls-handshake, in ms
+type handshakeSample struct {
+	connect, handshake float64
+	resumed            bool
+}
+
+// runTLSHandshakeTest times -samples full TLS handshakes and as many
+// resumed ones against the server's TLS listener. The TCP connect time is
+// the baseline: a TLS 1.3 handshake costs one round trip on top of it, so
+// much more than that points at a TLS-inspecting middlebox or a slow CPU
+// on either end.
+func runTLSHandshakeTest(config Config) error {
+	addr := withDefaultPort(config.Server, "443")
+	host, _, _ := net.SplitHostPort(addr)
+	fmt.Printf("TLS handshake test - %d full and %d resumed handshakes\n", config.Samples, config.Samples)
+	fmt.Printf("Server: %s\n\n", addr)
+
+	base := config.clientTLSConfig()
+	base.ServerName = host
+	dialer := &net.Dialer{Timeout: 5 * time.Second}
+
+	handshake := func(tlsConfig *tls.Config) (handshakeSample, *tls.Conn, error) {
+		start := time.Now()
+		raw, err := dialer.Dial("tcp", addr)
+		if err != nil {
+			return handshakeSample{}, nil, err
+		}
+		connected := time.Now()
+		conn := tls.Client(raw, tlsConfig)
+		conn.SetDeadline(time.Now().Add(10 * time.Second))
+		if err := conn.Handshake(); err != nil {
+			raw.Close()
+			return handshakeSample{}, nil, fmt.Errorf("handshake: %w", err)
+		}
+		return handshakeSample{
+			connect:   durationMs(connected.Sub(start)),
+			handshake: durationMs(time.Since(connected)),
+			resumed:   conn.ConnectionState().DidResume,
+		}, conn, nil
+	}
+
+	// collectTicket makes a request so the client reads the TLS 1.3
+	// session tickets, which the server sends after the handshake
+	collectTicket := func(conn *tls.Conn) {
+		req, _ := http.NewRequest(http.MethodGet, "https://"+addr+"/health", nil)
+		req.Header.Set("Connection", "close")
+		config.authorize(req)
+		if c := cookieHeader(req.URL.String()); c != "" {
+			req.Header.Set("Cookie", c)
+		}
+		if req.Write(conn) == nil {
+			if resp, err := http.ReadResponse(bufio.NewReader(conn), req); err == nil {
+				resp.Body.Close()
+			}
+		}
+	}
+
+	var full, resumed []handshakeSample
+	var state tls.ConnectionState
+	for range config.Samples {
+		s, conn, err := handshake(base.Clone())
+		if err != nil {
+			return err
+		}
+		state = conn.ConnectionState()
+		conn.Close()
+		full = append(full, s)
+		time.Sleep(config.SampleInterval)
+	}
+
+	resumable := base.Clone()
+	resumable.ClientSessionCache = tls.NewLRUClientSessionCache(1)
+	_, conn, err := handshake(resumable)
+	if err != nil {
+		return err
+	}
+	collectTicket(conn)
+	conn.Close()
+	for range config.Samples {
+		s, conn, err := handshake(resumable)
+		if err != nil {
+			return err
+		}
+		// A ticket may be single-use, so fetch a fresh one every time
+		collectTicket(conn)
+		conn.Close()
+		resumed = append(resumed, s)
+		time.Sleep(config.SampleInterval)
+	}
+
+	fmt.Printf("Protocol: %s, %s\n\n", tls.VersionName(state.Version), tls.CipherSuiteName(state.CipherSuite))
+
+	pick := func(samples []handshakeSample, f func(handshakeSample) float64) []float64 {
+		values := make([]float64, len(samples))
+		for i, s := range samples {
+			values[i] = f(s)
+		}
+		return values
+	}
+	connect := pick(append(full, resumed...), func(s handshakeSample) float64 { return s.connect })
+	fullMs := pick(full, func(s handshakeSample) float64 { return s.handshake })
+	resumedMs := pick(resumed, func(s handshakeSample) float64 { return s.handshake })
+
+	fmt.Printf("TCP connect ms:       %s\n", formatRTTStats(connect))
+	fmt.Printf("Full handshake ms:    %s\n", formatRTTStats(fullMs))
+	fmt.Printf("Resumed handshake ms: %s\n", formatRTTStats(resumedMs))
+
+	var didResume int
+	for _, s := range resumed {
+		if s.resumed {
+			didResume++
+		}
+	}
+	fmt.Printf("\n%d of %d resumption attempts resumed", didResume, len(resumed))
+	if didResume < len(resumed) {
+		fmt.Print(" (the server or a middlebox refuses session tickets)")
+	}
+	fmt.Println()
+
+	rtt := medianValue(connect)
+	if rtt > 0 {
+		fmt.Printf("Median handshake vs TCP connect: full %.1fx, resumed %.1fx\n",
+			medianValue(fullMs)/rtt, medianValue(resumedMs)/rtt)
+	}
+	return nil
+}
+
+func medianValue(values []float64) float64 {
+	if m := medianOf(values); m != nil {
+		return *m
+	}
+	return 0
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// tokenAccount is one entry of the -auth-tokens file together with its usage
+type tokenAccount struct {
+	name  string
+	token string
+	quota
+}
+
+// tokenUsage is the /__stats view of a token account; the secret is never shown
+type tokenUsage struct {
+	Name       string `json:"name"`
+	Period     string `json:"period"`
+	Since      string `json:"period_start"`
+	Bytes      int64  `json:"bytes"`
+	Tests      int64  `json:"tests"`
+	MaxBytes   int64  `json:"max_bytes,omitempty"`
+	MaxTests   int64  `json:"max_tests,omitempty"`
+	TotalBytes int64  `json:"total_bytes"`
+	TotalTests int64  `json:"total_tests"`
+}
+
+// tokens holds the -auth-tokens accounts; nil leaves the test endpoints open
+var tokens []*tokenAccount
+
+// loadTokens reads an -auth-tokens file. Each line is
+//
+//	<name> <token> [bytes=<size>] [tests=<n>] [period=daily|monthly]
+//
+// where size takes the K/M/G suffixes of -sndbuf. Blank lines and lines
+// starting with # are ignored.
+func loadTokens(path string) ([]*tokenAccount, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var accounts []*tokenAccount
+	names, secrets := make(map[string]bool), make(map[string]bool)
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		if len(fields) < 2 {
+			return nil, fmt.Errorf("%s:%d: expected '<name> <token> [options]'", path, line)
+		}
+
+		a := &tokenAccount{name: fields[0], token: fields[1], quota: quota{period: quotaDaily}}
+		if names[a.name] || secrets[a.token] {
+			return nil, fmt.Errorf("%s:%d: duplicate name or token", path, line)
+		}
+		names[a.name], secrets[a.token] = true, true
+
+		for _, opt := range fields[2:] {
+			key, value, _ := strings.Cut(opt, "=")
+			switch key {
+			case "bytes":
+				a.maxBytes, err = parseByteSize(value)
+			case "tests":
+				a.maxTests, err = strconv.ParseInt(value, 10, 64)
+				if err == nil && a.maxTests < 0 {
+					err = fmt.Errorf("negative test count")
+				}
+			case "period":
+				a.period = value
+				if value != quotaDaily && value != quotaMonthly {
+					err = fmt.Errorf("period must be '%s' or '%s'", quotaDaily, quotaMonthly)
+				}
+			default:
+				err = fmt.Errorf("unknown option")
+			}
+			if err != nil {
+				return nil, fmt.Errorf("%s:%d: invalid '%s': %v", path, line, opt, err)
+			}
+		}
+		accounts = append(accounts, a)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(accounts) == 0 {
+		return nil, fmt.Errorf("%s: no tokens", path)
+	}
+	return accounts, nil
+}
+
+func (a *tokenAccount) usage() tokenUsage {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return tokenUsage{
+		Name: a.name, Period: a.period, Since: a.periodStart,
+		Bytes: a.bytes, Tests: a.tests, MaxBytes: a.maxBytes, MaxTests: a.maxTests,
+		TotalBytes: a.totalBytes, TotalTests: a.totalTests,
+	}
+}
+
+// tokenUsages returns the usage of all accounts in file order
+func tokenUsages() []tokenUsage {
+	usages := make([]tokenUsage, len(tokens))
+	for i, a := range tokens {
+		usages[i] = a.usage()
+	}
+	return usages
+}
+
+// requestToken returns the token query parameter, which the web UI and
+// clients behind an authenticating proxy use, or else the bearer token
+func requestToken(r *http.Request) string {
+	if token := r.URL.Query().Get("token"); token != "" {
+		return token
+	}
+	if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		return token
+	}
+	return ""
+}
+
+// findToken returns the account of the request's token, or nil
+func findToken(r *http.Request) *tokenAccount {
+	got := []byte(requestToken(r))
+	for _, a := range tokens {
+		if subtle.ConstantTimeCompare(got, []byte(a.token)) == 1 {
+			return a
+		}
+	}
+	return nil
+}
+
+type tokenKey struct{}
+
+// tokenAuth rejects requests without a valid token when -auth-tokens is set
+// and passes the account on in the request context
+func tokenAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if tokens == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		a := findToken(r)
+		if a == nil {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="ethspeed"`)
+			httpError(w, codeUnauthorized, "missing or invalid token", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), tokenKey{}, a)))
+	})
+}
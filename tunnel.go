@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strings"
+)
+
+// tunnelPrefixes are the names VPN and tunnel interfaces get on Linux,
+// macOS and Windows clients
+var tunnelPrefixes = []string{
+	"tun", "tap", "wg", "ppp", "utun", "ipsec", "gre", "gif", "stf",
+	"tailscale", "zt", "nordlynx", "proton", "mullvad",
+}
+
+// isTunnel reports whether iface looks like a VPN or tunnel: a known name,
+// or a point-to-point link
+func isTunnel(iface *net.Interface) bool {
+	if iface.Flags&net.FlagPointToPoint != 0 {
+		return true
+	}
+	name := strings.ToLower(iface.Name)
+	for _, p := range tunnelPrefixes {
+		if strings.HasPrefix(name, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// tunnelNote explains why results through iface may be below the link:
+// encapsulation, or an MTU under Ethernet's 1500. Empty for a plain link.
+func tunnelNote(iface *net.Interface) string {
+	var parts []string
+	if isTunnel(iface) {
+		parts = append(parts, "tunnel/VPN interface")
+	}
+	if iface.MTU > 0 && iface.MTU < defaultMTU {
+		parts = append(parts, fmt.Sprintf("MTU %d", iface.MTU))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// runPhysicalComparison repeats the test bound to the first interface that
+// is not a tunnel (-compare-physical), when the route to the server goes
+// through one. Split-tunnel VPNs let it reach the server directly; with a
+// full tunnel that forces all traffic, it fails or takes the VPN as well.
+func runPhysicalComparison(config Config, report *speedReport) *speedReport {
+	egress, err := net.InterfaceByName(report.Environment.Interface)
+	if err != nil || !isTunnel(egress) {
+		return nil
+	}
+	targets, err := sweepTargets(config.Server)
+	if err != nil {
+		return nil
+	}
+	var target *sweepTarget
+	for i := range targets {
+		if !isTunnel(&targets[i].iface) {
+			target = &targets[i]
+			break
+		}
+	}
+	if target == nil {
+		if !config.JSON {
+			fmt.Println("No physical interface to compare the tunnel with")
+		}
+		return nil
+	}
+
+	transport := httpClient.Transport
+	defer func() { httpClient.Transport = transport }()
+	target.bindTo(&config)
+
+	physical := &speedReport{
+		Time:        report.Time,
+		Environment: describeEnvironment(&target.iface, target.ip),
+		Server:      config.Server,
+		SizeMB:      config.Size,
+		Direction:   config.Direction,
+		Runs:        []runResult{},
+	}
+	if !config.JSON {
+		fmt.Printf("== %s %s (physical, bypassing %s) ==\n", target.iface.Name, target.ip, report.Environment.Interface)
+	}
+	if warning := target.unboundWarning(config.Server); warning != "" {
+		out := os.Stdout
+		if config.JSON {
+			out = os.Stderr
+		}
+		fmt.Fprintln(out, warning)
+	}
+	if err := runSpeedTests(config, physical); err != nil && !config.JSON {
+		fmt.Printf("ERROR: %v\n\n", err)
+	}
+	if !config.JSON {
+		printInterfaceComparison([]*speedReport{report, physical})
+	}
+	return physical
+}
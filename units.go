@@ -0,0 +1,169 @@
+package main
+
+import (
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Values of -unit
+const (
+	unitMbps = "mbps"
+	unitMBps = "MBps"
+	unitAuto = "auto"
+)
+
+// speedUnit is how speeds and sizes are displayed: -unit picks megabits
+// or megabytes per second, or a prefix that fits each value, and -binary
+// switches every prefix from 1000 to 1024. Measurements are kept, stored
+// and printed as JSON in Mbps (10^6 bit/s) regardless.
+type speedUnit struct {
+	kind   string
+	binary bool
+}
+
+// displayUnit is the -unit and -binary of this run
+var displayUnit = speedUnit{kind: unitMbps}
+
+func (u speedUnit) base() float64 {
+	if u.binary {
+		return 1024
+	}
+	return 1000
+}
+
+// scale converts a speed in Mbps into the unit and returns the unit name
+func (u speedUnit) scale(mbps float64) (float64, string) {
+	bits := mbps * 1_000_000
+	base := u.base()
+	switch u.kind {
+	case unitMBps:
+		if u.binary {
+			return bits / 8 / base / base, "MiB/s"
+		}
+		return bits / 8 / base / base, "MB/s"
+	case unitAuto:
+		names := []string{"bps", "Kbps", "Mbps", "Gbps", "Tbps"}
+		if u.binary {
+			names = []string{"bit/s", "Kibit/s", "Mibit/s", "Gibit/s", "Tibit/s"}
+		}
+		i := 0
+		for bits >= base && i < len(names)-1 {
+			bits /= base
+			i++
+		}
+		return bits, names[i]
+	default:
+		if u.binary {
+			return bits / base / base, "Mibit/s"
+		}
+		return bits / base / base, "Mbps"
+	}
+}
+
+// label is the unit of table columns; empty for -unit auto, where every
+// cell carries its own
+func (u speedUnit) label() string {
+	if u.kind == unitAuto {
+		return ""
+	}
+	_, name := u.scale(0)
+	return name
+}
+
+// format renders a speed with its unit, e.g. "941.3 Mbps"
+func (u speedUnit) format(mbps float64) string {
+	v, name := u.scale(mbps)
+	return numbers.format(v, 1) + " " + name
+}
+
+// cell renders a speed for a table column headed by label
+func (u speedUnit) cell(mbps float64) string {
+	if u.kind == unitAuto {
+		return u.format(mbps)
+	}
+	v, _ := u.scale(mbps)
+	return numbers.format(v, 1)
+}
+
+// numberStyle is how displayed speeds and sizes are written: -precision
+// decimals, and with -group-digits the thousands separator and decimal
+// mark of the locale
+type numberStyle struct {
+	precision int    // decimals, -1 for the default of each value
+	group     string // thousands separator, empty for none
+	decimal   string
+}
+
+// numbers is the -precision and -group-digits of this run
+var numbers = numberStyle{precision: -1, decimal: "."}
+
+// setupDisplay applies -unit, -binary, -precision and -group-digits; every
+// entry point that runs a client or server calls it after validation
+func setupDisplay(config Config) {
+	displayUnit = speedUnit{kind: config.Unit, binary: config.Binary}
+	numbers.precision = config.Precision
+	if config.GroupDigits {
+		numbers = localeNumberStyle(config.Precision)
+	}
+}
+
+// format writes v with precision decimals unless -precision overrides it
+func (s numberStyle) format(v float64, precision int) string {
+	if s.precision >= 0 {
+		precision = s.precision
+	}
+	str := strconv.FormatFloat(v, 'f', precision, 64)
+	if s.group == "" {
+		return str
+	}
+
+	whole, frac, hasFrac := strings.Cut(str, ".")
+	sign := ""
+	if strings.HasPrefix(whole, "-") {
+		sign, whole = "-", whole[1:]
+	}
+	var b strings.Builder
+	b.WriteString(sign)
+	for i, c := range whole {
+		if i > 0 && (len(whole)-i)%3 == 0 {
+			b.WriteString(s.group)
+		}
+		b.WriteRune(c)
+	}
+	if hasFrac {
+		b.WriteString(s.decimal)
+		b.WriteString(frac)
+	}
+	return b.String()
+}
+
+// count writes a whole number such as a byte count, without decimals
+// whatever -precision says
+func (s numberStyle) count(n int64) string {
+	s.precision = -1
+	return s.format(float64(n), 0)
+}
+
+// localeNumberStyle picks the separators of the locale in LC_ALL,
+// LC_NUMERIC or LANG: "1,234.5" for English and unknown locales,
+// "1.234,5" and "1 234,5" for the usual continental conventions
+func localeNumberStyle(precision int) numberStyle {
+	locale := ""
+	for _, env := range []string{"LC_ALL", "LC_NUMERIC", "LANG"} {
+		if locale = os.Getenv(env); locale != "" {
+			break
+		}
+	}
+	lang, _, _ := strings.Cut(strings.ToLower(locale), "_")
+	lang, _, _ = strings.Cut(lang, ".")
+
+	style := numberStyle{precision: precision, group: ",", decimal: "."}
+	switch lang {
+	case "de", "es", "it", "nl", "pt", "id", "tr", "da", "el":
+		style.group, style.decimal = ".", ","
+	case "ru", "uk", "be", "fr", "pl", "cs", "sk", "sv", "fi", "nb", "nn", "hu", "bg", "lt", "lv", "et":
+		style.group, style.decimal = " ", ","
+	}
+	return style
+}
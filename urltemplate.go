@@ -0,0 +1,39 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// expandURLTemplate fills in the placeholders of a -down-url or -up-url for
+// a transfer of n bytes: {bytes}, and the size rounded up in {kb}, {mb}
+// (powers of 1000) or {kib}, {mib} (powers of 1024), for third-party
+// endpoints that take the size in their own unit
+func expandURLTemplate(t string, n int64) string {
+	in := func(unit int64) string { return strconv.FormatInt(ceilDiv(n, unit), 10) }
+	return strings.NewReplacer(
+		"{bytes}", strconv.FormatInt(n, 10),
+		"{kb}", in(1000), "{mb}", in(1000*1000),
+		"{kib}", in(1024), "{mib}", in(1024*1024),
+	).Replace(t)
+}
+
+// checkURLTemplate accepts an absolute http or https URL template
+func checkURLTemplate(flagName, t string) error {
+	u, err := url.Parse(expandURLTemplate(t, 1))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("-%s must be an http:// or https:// URL, got '%s'", flagName, t)
+	}
+	return nil
+}
+
+// templateHost is the host:port a URL template points at
+func templateHost(t string) string {
+	u, err := url.Parse(expandURLTemplate(t, 1))
+	if err != nil {
+		return ""
+	}
+	return u.Host
+}
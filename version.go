@@ -0,0 +1,97 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+)
+
+// Set at link time by release builds:
+//
+//	go build -ldflags "-X main.version=v1.4.0 -X main.commit=$(git rev-parse HEAD) -X main.buildDate=$(date -u +%FT%TZ)"
+//
+// and otherwise taken from the build info the Go toolchain embeds.
+var (
+	version   string
+	commit    string
+	buildDate string
+)
+
+// buildInfo identifies the running binary
+type buildInfo struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit,omitempty"`
+	BuildDate string `json:"build_date,omitempty"`
+	Modified  bool   `json:"modified,omitempty"` // built from a dirty checkout
+	GoVersion string `json:"go_version"`
+	Platform  string `json:"platform"`
+}
+
+var build = readBuildInfo()
+
+func readBuildInfo() buildInfo {
+	b := buildInfo{
+		Version:   "unknown",
+		GoVersion: runtime.Version(),
+		Platform:  runtime.GOOS + "/" + runtime.GOARCH,
+	}
+	if info, ok := debug.ReadBuildInfo(); ok {
+		if info.Main.Version != "" {
+			b.Version = info.Main.Version
+		}
+		for _, s := range info.Settings {
+			switch s.Key {
+			case "vcs.revision":
+				b.Commit = s.Value
+			case "vcs.time":
+				b.BuildDate = s.Value
+			case "vcs.modified":
+				b.Modified = s.Value == "true"
+			}
+		}
+	}
+	if version != "" {
+		b.Version = version
+	}
+	if commit != "" {
+		b.Commit, b.Modified = commit, false
+	}
+	if buildDate != "" {
+		b.BuildDate = buildDate
+	}
+	return b
+}
+
+// shortCommit is the commit abbreviated as git does
+func (b buildInfo) shortCommit() string {
+	if len(b.Commit) > 12 {
+		return b.Commit[:12]
+	}
+	return b.Commit
+}
+
+// String is the -version output
+func (b buildInfo) String() string {
+	s := "ethspeed " + b.Version
+	if b.Commit != "" {
+		s += " commit " + b.shortCommit()
+		if b.Modified {
+			s += "-dirty"
+		}
+	}
+	if b.BuildDate != "" {
+		s += " built " + b.BuildDate
+	}
+	return fmt.Sprintf("%s (%s, %s)", s, b.GoVersion, b.Platform)
+}
+
+func versionHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		httpError(w, codeMethodNotAllowed, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(build)
+}
@@ -0,0 +1,354 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// watchAlertRows is how many recent alert messages stay on screen
+const watchAlertRows = 5
+
+// watchRound is one scheduled test in -watch mode
+type watchRound struct {
+	Time        time.Time         `json:"time"`
+	Name        string            `json:"name,omitempty"`
+	Note        string            `json:"note,omitempty"`
+	Tags        map[string]string `json:"tags,omitempty"`
+	Environment *environment      `json:"environment,omitempty"`
+	runResult
+	Error string `json:"error,omitempty"`
+
+	// Median WebSocket RTT before and during the transfers, with -latency
+	LatencyIdleMs   *float64 `json:"latency_idle_ms,omitempty"`
+	LatencyLoadedMs *float64 `json:"latency_loaded_ms,omitempty"`
+
+	// Who uploaded the round to a server's /__results, empty for rounds
+	// the -watch client stored itself
+	ReportedBy string `json:"reported_by,omitempty"`
+}
+
+// watchStats keeps running averages over every round since start
+type watchStats struct {
+	rounds, failed int
+	skipped        int // rounds left out by -skip-if-busy
+	downs, ups     []float64
+}
+
+func (s *watchStats) add(r watchRound) {
+	s.rounds++
+	if r.Error != "" {
+		s.failed++
+	}
+	if r.Download != nil {
+		s.downs = append(s.downs, r.Download.Mbps)
+	}
+	if r.Upload != nil {
+		s.ups = append(s.ups, r.Upload.Mbps)
+	}
+}
+
+// runWatch runs one test per interval until ctx is cancelled, showing the
+// last config.WatchRows results and running averages. On a terminal the
+// table is redrawn in place; otherwise rows are appended as they come.
+func runWatch(ctx context.Context, config Config) {
+	tty := isTerminal(os.Stdout)
+	var (
+		recent []watchRound
+		stats  watchStats
+		alerts []string
+	)
+	alerter := newAlerter(config)
+
+	var history *historyDB
+	if config.DB != "" {
+		var err error
+		if history, err = openHistory(config.DB); err != nil {
+			fail(err)
+			return
+		}
+		defer history.Close()
+	}
+	policy := retention{maxAge: config.Retain, maxRows: config.RetainRows, rollup: config.Rollup}
+
+	if !config.JSON && !tty {
+		printWatchHeader(config)
+	}
+
+	// With -schedule every round, the first included, waits for its slot;
+	// otherwise rounds start right away and then every -interval
+	var (
+		schedule *cronSchedule
+		tick     <-chan time.Time
+	)
+	if config.Schedule != "" {
+		// Checked in Config.validate
+		schedule, _ = parseCron(config.Schedule)
+	} else {
+		ticker := time.NewTicker(config.Interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	// nextRound waits out the -interval, false once ctx is cancelled
+	nextRound := func() bool {
+		if schedule != nil {
+			return true
+		}
+		select {
+		case <-ctx.Done():
+			return false
+		case <-tick:
+			return true
+		}
+	}
+
+loop:
+	for {
+		if schedule != nil {
+			next := schedule.next(time.Now())
+			if !config.JSON && len(recent) == 0 {
+				if tty {
+					printWatchHeader(config)
+				}
+				fmt.Printf("First test at %s\n", next.Format("2006-01-02 15:04"))
+			}
+			select {
+			case <-ctx.Done():
+				break loop
+			case <-time.After(time.Until(next)):
+			}
+		}
+
+		if config.SkipIfBusy > 0 {
+			if reason := waitForQuiet(ctx, config); reason != "" && ctx.Err() == nil {
+				stats.skipped++
+				msg := fmt.Sprintf("%-9s | skipped: %s", time.Now().Format("15:04:05"), reason)
+				switch {
+				case events != nil || config.JSON:
+					fmt.Fprintln(os.Stderr, msg)
+				case tty:
+					alerts = append(alerts, msg)
+					if len(alerts) > watchAlertRows {
+						alerts = alerts[len(alerts)-watchAlertRows:]
+					}
+					fmt.Println(msg)
+				default:
+					fmt.Println(msg)
+				}
+				if !nextRound() {
+					break
+				}
+				continue
+			}
+		}
+
+		round := runWatchRound(ctx, config)
+		if ctx.Err() != nil {
+			break
+		}
+		stats.add(round)
+		if history != nil {
+			if err := history.record(config.Server, round); err != nil {
+				fmt.Fprintf(os.Stderr, "ERROR: db: %v\n", err)
+			}
+			if err := history.prune(policy, time.Now()); err != nil {
+				fmt.Fprintf(os.Stderr, "ERROR: db prune: %v\n", err)
+			}
+		}
+		if config.Report {
+			if _, err := reportResult(config, round); err != nil {
+				fmt.Fprintf(os.Stderr, "ERROR: report: %v\n", err)
+			}
+		}
+		recent = append(recent, round)
+		if len(recent) > config.WatchRows {
+			recent = recent[1:]
+		}
+		raised := alerter.check(ctx, round)
+		alerts = append(alerts, raised...)
+		if len(alerts) > watchAlertRows {
+			alerts = alerts[len(alerts)-watchAlertRows:]
+		}
+
+		switch {
+		case events != nil:
+			events.round(round)
+			for _, msg := range raised {
+				fmt.Fprintln(os.Stderr, msg)
+			}
+		case config.JSON:
+			json.NewEncoder(os.Stdout).Encode(round)
+			for _, msg := range raised {
+				fmt.Fprintln(os.Stderr, msg)
+			}
+		case tty:
+			// Clear the screen and redraw the whole table
+			fmt.Print("\033[H\033[2J")
+			printWatchHeader(config)
+			for _, r := range recent {
+				printWatchRow(r)
+			}
+			printWatchSummary(&stats)
+			if len(alerts) > 0 {
+				fmt.Println()
+				for _, msg := range alerts {
+					fmt.Println(msg)
+				}
+			}
+		default:
+			printWatchRow(round)
+			for _, msg := range raised {
+				fmt.Println(msg)
+			}
+		}
+
+		if !nextRound() {
+			break
+		}
+	}
+
+	if !config.JSON && !tty {
+		printWatchSummary(&stats)
+	}
+}
+
+// runWatchRound runs one download and/or upload per config.Direction
+func runWatchRound(ctx context.Context, config Config) (round watchRound) {
+	// Checked in Config.validate
+	tags, _ := parseTags(config.Tags)
+	// Collected every round: a laptop may move between networks
+	round = watchRound{Time: time.Now(), Name: config.Name, Note: config.Note, Tags: tags, Environment: collectEnvironment(config.Server)}
+
+	if config.ReResolve {
+		// Kept-alive connections would skip the lookup
+		httpClient.CloseIdleConnections()
+	}
+
+	if config.Latency {
+		pinger, err := startWSPinger(config, config.SampleInterval)
+		if err != nil {
+			round.Error = fmt.Sprintf("latency: %v", err)
+			return round
+		}
+		// Sample the idle link before the transfers, as a single test does
+		time.Sleep(time.Second)
+		idle := pinger.samples()
+		defer func() {
+			round.LatencyIdleMs = medianOf(idle)
+			round.LatencyLoadedMs = medianOf(pinger.stop()[len(idle):])
+		}()
+	}
+
+	if config.Direction != directionUp {
+		res, err := runDownloadTest(config)
+		if err != nil {
+			round.Error = fmt.Sprintf("download: %v", err)
+			return round
+		}
+		round.Download = res
+	}
+	if ctx.Err() != nil {
+		return round
+	}
+	if config.Direction != directionDown {
+		res, err := runUploadTest(config)
+		if err != nil {
+			round.Error = fmt.Sprintf("upload: %v", err)
+			return round
+		}
+		round.Upload = res
+	}
+	return round
+}
+
+// medianOf returns the median of RTTs in ms, nil for none
+func medianOf(rtts []float64) *float64 {
+	if len(rtts) == 0 {
+		return nil
+	}
+	sorted := append([]float64(nil), rtts...)
+	sort.Float64s(sorted)
+	m := percentile(sorted, 50)
+	return &m
+}
+
+func printWatchHeader(config Config) {
+	when := fmt.Sprintf("every %v", config.Interval)
+	if config.Schedule != "" {
+		when = fmt.Sprintf("on schedule '%s'", config.Schedule)
+	}
+	fmt.Printf("Watching %s %s, %d MB per test (Ctrl-C to stop)\n\n", config.Server, when, config.Size)
+	fmt.Printf("%-9s | %-8s | %-8s | %s\n", "time", "down", "up", displayUnit.label())
+	fmt.Println(strings.Repeat("-", 40))
+}
+
+func printWatchRow(r watchRound) {
+	ts := r.Time.Format("15:04:05")
+	if r.Error != "" {
+		fmt.Printf("%-9s | ERROR: %s\n", ts, r.Error)
+		return
+	}
+	fmt.Printf("%-9s | %-8s | %-8s |", ts, formatMbpsCell(mbpsOf(r.Download)), formatMbpsCell(mbpsOf(r.Upload)))
+	if r.LatencyIdleMs != nil {
+		fmt.Printf(" ping %.1f ms", *r.LatencyIdleMs)
+		if r.LatencyLoadedMs != nil {
+			fmt.Printf(", loaded %.1f ms", *r.LatencyLoadedMs)
+		}
+	}
+	if r.Environment != nil && r.Environment.WiFi != nil && r.Environment.WiFi.RSSIdBm != 0 {
+		fmt.Printf(" Wi-Fi %d dBm", r.Environment.WiFi.RSSIdBm)
+	}
+	if r.Download != nil && len(r.Download.Intermediary) > 0 {
+		fmt.Print(" WARNING: served by a proxy or cache")
+	}
+	fmt.Println()
+}
+
+func printWatchSummary(s *watchStats) {
+	fmt.Println(strings.Repeat("-", 40))
+	skipped := ""
+	if s.skipped > 0 {
+		skipped = fmt.Sprintf(", %d skipped as busy", s.skipped)
+	}
+	fmt.Printf("%-9s | %-8s | %-8s | %d rounds, %d failed%s\n", "avg",
+		formatMbpsCell(calculateAverage(s.downs)), formatMbpsCell(calculateAverage(s.ups)), s.rounds, s.failed, skipped)
+	fmt.Printf("%-9s | %-8s | %-8s |\n", "min", formatMbpsCell(minOf(s.downs)), formatMbpsCell(minOf(s.ups)))
+	fmt.Printf("%-9s | %-8s | %-8s |\n", "max", formatMbpsCell(maxOf(s.downs)), formatMbpsCell(maxOf(s.ups)))
+}
+
+func mbpsOf(r *transferResult) float64 {
+	if r == nil {
+		return 0
+	}
+	return r.Mbps
+}
+
+func minOf(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	m := values[0]
+	for _, v := range values[1:] {
+		m = min(m, v)
+	}
+	return m
+}
+
+func maxOf(values []float64) float64 {
+	m := 0.0
+	for _, v := range values {
+		m = max(m, v)
+	}
+	return m
+}
+
+// isTerminal reports whether f is an interactive terminal
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
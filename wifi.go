@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// wifiInfo is the radio state of a wireless egress interface at test time
+type wifiInfo struct {
+	SSID       string  `json:"ssid,omitempty"`
+	RSSIdBm    int     `json:"rssi_dbm,omitempty"`
+	Channel    int     `json:"channel,omitempty"`
+	FreqMHz    int     `json:"freq_mhz,omitempty"`
+	TxRateMbps float64 `json:"tx_rate_mbps,omitempty"` // PHY rates
+	RxRateMbps float64 `json:"rx_rate_mbps,omitempty"`
+}
+
+// weakRSSI is where throughput usually starts to suffer
+const weakRSSI = -70
+
+func (w *wifiInfo) String() string {
+	var parts []string
+	if w.SSID != "" {
+		parts = append(parts, fmt.Sprintf("'%s'", w.SSID))
+	}
+	if w.RSSIdBm != 0 {
+		parts = append(parts, fmt.Sprintf("%d dBm", w.RSSIdBm))
+	}
+	if w.Channel != 0 {
+		ch := fmt.Sprintf("channel %d", w.Channel)
+		if w.FreqMHz != 0 {
+			ch += fmt.Sprintf(" (%d MHz)", w.FreqMHz)
+		}
+		parts = append(parts, ch)
+	}
+	switch {
+	case w.TxRateMbps != 0 && w.RxRateMbps != 0:
+		parts = append(parts, fmt.Sprintf("PHY tx %g / rx %g Mbps", w.TxRateMbps, w.RxRateMbps))
+	case w.TxRateMbps != 0:
+		parts = append(parts, fmt.Sprintf("PHY tx %g Mbps", w.TxRateMbps))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// wifiChannel converts a center frequency to its channel number
+func wifiChannel(freqMHz int) int {
+	switch {
+	case freqMHz == 2484:
+		return 14
+	case freqMHz >= 2412 && freqMHz < 2484:
+		return (freqMHz - 2407) / 5
+	case freqMHz >= 5955 && freqMHz <= 7115:
+		return (freqMHz - 5950) / 5
+	case freqMHz >= 5000 && freqMHz < 5955:
+		return (freqMHz - 5000) / 5
+	}
+	return 0
+}
+
+// wifiFreq is the inverse of wifiChannel for tools that only print the
+// channel; 6 GHz channels overlap 5 GHz numbers and are left out
+func wifiFreq(channel int) int {
+	switch {
+	case channel == 14:
+		return 2484
+	case channel >= 1 && channel <= 13:
+		return 2407 + channel*5
+	case channel >= 32 && channel <= 177:
+		return 5000 + channel*5
+	}
+	return 0
+}
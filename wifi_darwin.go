@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"net"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// airportPath is the private tool behind the menu bar Wi-Fi details; it
+// is gone since macOS 14.4, where system_profiler is used instead
+const airportPath = "/System/Library/PrivateFrameworks/Apple80211.framework/Versions/Current/Resources/airport"
+
+// wifiStatus reports the radio state when iface is the Wi-Fi port; nil
+// for wired interfaces
+func wifiStatus(iface *net.Interface) *wifiInfo {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	ports, err := exec.CommandContext(ctx, "networksetup", "-listallhardwareports").Output()
+	if err != nil || !isWiFiPort(string(ports), iface.Name) {
+		return nil
+	}
+	if out, err := exec.CommandContext(ctx, airportPath, "-I").Output(); err == nil {
+		return parseAirport(string(out))
+	}
+	// Slow (a second or more), and the SSID is redacted without the
+	// location permission
+	out, err := exec.CommandContext(ctx, "system_profiler", "SPAirPortDataType").Output()
+	if err != nil {
+		return nil
+	}
+	return parseSystemProfiler(string(out))
+}
+
+// isWiFiPort looks for "Hardware Port: Wi-Fi" followed by "Device: <name>"
+func isWiFiPort(out, name string) bool {
+	wifi := false
+	for _, line := range strings.Split(out, "\n") {
+		if port, ok := strings.CutPrefix(line, "Hardware Port: "); ok {
+			wifi = port == "Wi-Fi" || port == "AirPort"
+		} else if dev, ok := strings.CutPrefix(line, "Device: "); ok && wifi && dev == name {
+			return true
+		}
+	}
+	return false
+}
+
+// parseAirport parses "airport -I": agrCtlRSSI, lastTxRate, SSID and
+// channel ("36,80" with the width after the comma)
+func parseAirport(out string) *wifiInfo {
+	var w wifiInfo
+	for _, line := range strings.Split(out, "\n") {
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		switch strings.TrimSpace(key) {
+		case "AirPort":
+			if value == "Off" {
+				return nil
+			}
+		case "SSID":
+			w.SSID = value
+		case "agrCtlRSSI":
+			w.RSSIdBm, _ = strconv.Atoi(value)
+		case "lastTxRate":
+			w.TxRateMbps, _ = strconv.ParseFloat(value, 64)
+		case "channel":
+			ch, _, _ := strings.Cut(value, ",")
+			w.Channel, _ = strconv.Atoi(ch)
+			w.FreqMHz = wifiFreq(w.Channel)
+		}
+	}
+	if w.Channel == 0 {
+		return nil
+	}
+	return &w
+}
+
+// parseSystemProfiler parses the "Current Network Information" block of
+// SPAirPortDataType:
+//
+//	Current Network Information:
+//	  office:
+//	    Channel: 36 (5GHz, 80MHz)
+//	    Signal / Noise: -52 dBm / -92 dBm
+//	    Transmit Rate: 866
+func parseSystemProfiler(out string) *wifiInfo {
+	_, current, ok := strings.Cut(out, "Current Network Information:")
+	if !ok {
+		return nil
+	}
+	var w wifiInfo
+	for i, line := range strings.Split(current, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if i == 1 {
+			w.SSID = strings.TrimSuffix(trimmed, ":")
+			continue
+		}
+		key, value, ok := strings.Cut(trimmed, ":")
+		if !ok {
+			continue
+		}
+		fields := strings.Fields(value)
+		if len(fields) == 0 {
+			// The next block, e.g. "Other Local Wi-Fi Networks:"
+			if i > 1 {
+				break
+			}
+			continue
+		}
+		switch key {
+		case "Channel":
+			w.Channel, _ = strconv.Atoi(fields[0])
+			w.FreqMHz = wifiFreq(w.Channel)
+		case "Signal / Noise":
+			w.RSSIdBm, _ = strconv.Atoi(fields[0])
+		case "Transmit Rate":
+			w.TxRateMbps, _ = strconv.ParseFloat(fields[0], 64)
+		}
+	}
+	if w.SSID == "<redacted>" {
+		w.SSID = ""
+	}
+	return &w
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// wifiStatus reads the association of a wireless interface with "iw dev
+// <iface> link"; nil for wired interfaces or without iw
+func wifiStatus(iface *net.Interface) *wifiInfo {
+	if _, err := os.Stat("/sys/class/net/" + iface.Name + "/wireless"); err != nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, "iw", "dev", iface.Name, "link").Output()
+	if err != nil {
+		return nil
+	}
+	return parseIWLink(string(out))
+}
+
+// parseIWLink parses iw output such as
+//
+//	Connected to aa:bb:cc:dd:ee:ff (on wlan0)
+//		SSID: office
+//		freq: 5180
+//		signal: -52 dBm
+//		rx bitrate: 866.7 MBit/s VHT-MCS 9 80MHz short GI VHT-NSS 2
+//		tx bitrate: 780.0 MBit/s VHT-MCS 8 80MHz short GI VHT-NSS 2
+func parseIWLink(out string) *wifiInfo {
+	if !strings.HasPrefix(out, "Connected") {
+		return nil
+	}
+	var w wifiInfo
+	for _, line := range strings.Split(out, "\n") {
+		key, value, ok := strings.Cut(strings.TrimSpace(line), ":")
+		if !ok {
+			continue
+		}
+		fields := strings.Fields(value)
+		if len(fields) == 0 {
+			continue
+		}
+		switch key {
+		case "SSID":
+			w.SSID = strings.TrimSpace(value)
+		case "freq":
+			// Newer iw prints fractional MHz, e.g. "5180.0"
+			f, _ := strconv.ParseFloat(fields[0], 64)
+			w.FreqMHz = int(f)
+			w.Channel = wifiChannel(w.FreqMHz)
+		case "signal":
+			w.RSSIdBm, _ = strconv.Atoi(fields[0])
+		case "rx bitrate":
+			w.RxRateMbps, _ = strconv.ParseFloat(fields[0], 64)
+		case "tx bitrate":
+			w.TxRateMbps, _ = strconv.ParseFloat(fields[0], 64)
+		}
+	}
+	return &w
+}
@@ -0,0 +1,9 @@
+//go:build !linux && !windows && !darwin
+
+package main
+
+import "net"
+
+func wifiStatus(iface *net.Interface) *wifiInfo {
+	return nil
+}
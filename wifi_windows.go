@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"net"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// wifiStatus reads the interface from "netsh wlan show interfaces"; nil
+// for wired interfaces. The labels are matched in English only.
+func wifiStatus(iface *net.Interface) *wifiInfo {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, "netsh", "wlan", "show", "interfaces").Output()
+	if err != nil {
+		return nil
+	}
+	return parseNetshWLAN(string(out), iface.Name)
+}
+
+// parseNetshWLAN picks the block of the named interface out of netsh
+// output, which lists every wireless adapter as "Name : Wi-Fi" followed by
+// "SSID", "Channel", "Receive rate (Mbps)", "Signal : 90%" and, on recent
+// builds, "Rssi" lines
+func parseNetshWLAN(out, name string) *wifiInfo {
+	var (
+		w       *wifiInfo
+		quality int
+	)
+	for _, line := range strings.Split(out, "\n") {
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+		if key == "Name" {
+			if w != nil {
+				break
+			}
+			if value == name {
+				w = &wifiInfo{}
+			}
+			continue
+		}
+		if w == nil {
+			continue
+		}
+		switch key {
+		case "State":
+			if value != "connected" {
+				return nil
+			}
+		case "SSID":
+			w.SSID = value
+		case "Channel":
+			w.Channel, _ = strconv.Atoi(value)
+			w.FreqMHz = wifiFreq(w.Channel)
+		case "Receive rate (Mbps)":
+			w.RxRateMbps, _ = strconv.ParseFloat(value, 64)
+		case "Transmit rate (Mbps)":
+			w.TxRateMbps, _ = strconv.ParseFloat(value, 64)
+		case "Rssi":
+			w.RSSIdBm, _ = strconv.Atoi(value)
+		case "Signal":
+			quality, _ = strconv.Atoi(strings.TrimSuffix(value, "%"))
+		}
+	}
+	if w != nil && w.RSSIdBm == 0 && quality > 0 {
+		// The usual mapping of Windows link quality to dBm
+		w.RSSIdBm = quality/2 - 100
+	}
+	return w
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/websocket"
+)
+
+const (
+	wsMaxMessage  = 4096
+	wsIdleTimeout = 60 * time.Second
+)
+
+// wsPingHandler serves /__ws_ping. Text frames are echoed back; JSON objects
+// additionally get the server receive time as "server_ts" (unix
+// nanoseconds). A websocket.Server is used instead of websocket.Handler so
+// clients without an Origin header (the CLI) are accepted.
+var wsPingHandler = websocket.Server{Handler: serveWSPing}
+
+func serveWSPing(ws *websocket.Conn) {
+	defer ws.Close()
+	ws.MaxPayloadBytes = wsMaxMessage
+
+	addr := clientAddr(ws.Request())
+	echoed := 0
+
+	for {
+		// The connection inherits the http.Server read/write deadlines;
+		// replace them with an idle timeout so the session can stay open.
+		ws.SetDeadline(time.Now().Add(wsIdleTimeout))
+
+		var msg string
+		if err := websocket.Message.Receive(ws, &msg); err != nil {
+			break
+		}
+		serverTS := time.Now().UnixNano()
+
+		var obj map[string]any
+		if json.Unmarshal([]byte(msg), &obj) == nil && obj != nil {
+			obj["server_ts"] = serverTS
+			if b, err := json.Marshal(obj); err == nil {
+				msg = string(b)
+			}
+		}
+
+		if err := websocket.Message.Send(ws, msg); err != nil {
+			break
+		}
+		echoed++
+	}
+
+	logTest(logWS, 0, "%s - %d pings echoed", addr, echoed)
+}
+
+// wsPingMessage is the probe sent by the CLI
+type wsPingMessage struct {
+	Seq      int   `json:"seq"`
+	ClientTS int64 `json:"client_ts"`
+	ServerTS int64 `json:"server_ts,omitempty"`
+}
+
+// wsPinger measures RTT continuously over one long-lived WebSocket
+type wsPinger struct {
+	ws   *websocket.Conn
+	done chan struct{}
+	wg   sync.WaitGroup
+
+	mu     sync.Mutex
+	rtts   []float64  // milliseconds, in arrival order
+	stamps []owdStamp // timestamps of the same probes
+}
+
+func startWSPinger(config Config, interval time.Duration) (*wsPinger, error) {
+	wsConfig, err := websocket.NewConfig(
+		strings.Replace(config.endpointURL("/__ws_ping"), "http", "ws", 1), config.baseURL()+"/")
+	if err != nil {
+		return nil, err
+	}
+	wsConfig.TlsConfig = config.clientTLSConfig()
+	config.authorizeURL(wsConfig.Location, wsConfig.Header)
+	if c := cookieHeader(config.endpointURL("/__ws_ping")); c != "" {
+		wsConfig.Header.Set("Cookie", c)
+	}
+
+	// Dialled by the websocket package rather than through newTransport, so
+	// -limit never holds the probes back behind paced transfers
+	ws, err := websocket.DialConfig(wsConfig)
+	if err != nil {
+		return nil, fmt.Errorf("websocket dial failed: %w", err)
+	}
+
+	p := &wsPinger{ws: ws, done: make(chan struct{})}
+	p.wg.Add(2)
+	go p.send(interval)
+	go p.receive()
+	return p, nil
+}
+
+func (p *wsPinger) send(interval time.Duration) {
+	defer p.wg.Done()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for seq := 0; ; seq++ {
+		msg := wsPingMessage{Seq: seq, ClientTS: time.Now().UnixNano()}
+		if err := websocket.JSON.Send(p.ws, msg); err != nil {
+			return
+		}
+
+		select {
+		case <-p.done:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (p *wsPinger) receive() {
+	defer p.wg.Done()
+
+	for {
+		var msg wsPingMessage
+		if err := websocket.JSON.Receive(p.ws, &msg); err != nil {
+			return
+		}
+		now := time.Now()
+		rtt := now.Sub(time.Unix(0, msg.ClientTS))
+
+		p.mu.Lock()
+		p.rtts = append(p.rtts, durationMs(rtt))
+		p.stamps = append(p.stamps, owdStamp{sent: msg.ClientTS, server: msg.ServerTS, received: now.UnixNano()})
+		p.mu.Unlock()
+	}
+}
+
+// samples returns the RTTs measured so far
+func (p *wsPinger) samples() []float64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]float64(nil), p.rtts...)
+}
+
+// timestamps returns the probe timestamps recorded so far
+func (p *wsPinger) timestamps() []owdStamp {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]owdStamp(nil), p.stamps...)
+}
+
+// stop closes the connection and returns all RTTs measured
+func (p *wsPinger) stop() []float64 {
+	close(p.done)
+	p.ws.Close()
+	p.wg.Wait()
+	return p.samples()
+}
+
+// runWSPingTest measures idle RTT over a WebSocket
+func runWSPingTest(config Config) error {
+	fmt.Printf("WebSocket ping test - %d probes every %v\n", config.Samples, config.SampleInterval)
+	fmt.Printf("Server: %s\n\n", config.Server)
+
+	pinger, err := startWSPinger(config, config.SampleInterval)
+	if err != nil {
+		return err
+	}
+
+	deadline := time.Now().Add(time.Duration(config.Samples)*config.SampleInterval + 5*time.Second)
+	for len(pinger.samples()) < config.Samples && time.Now().Before(deadline) {
+		time.Sleep(config.SampleInterval)
+	}
+	rtts := pinger.stop()
+	if len(rtts) > config.Samples {
+		rtts = rtts[:config.Samples]
+	}
+
+	fmt.Printf("Received: %d/%d\n", len(rtts), config.Samples)
+	fmt.Printf("RTT ms: %s\n", formatRTTStats(rtts))
+	return nil
+}